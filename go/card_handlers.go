@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"tapsilat-go-example/customers"
+	"tapsilat-go-example/orders"
+	"tapsilat-go-example/subscriptions"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tapsilat/tapsilat-go"
+)
+
+// captureOrderCard stores the card a paid order was charged with on the order's customer
+func captureOrderCard(rec orders.Record) {
+	if rec.CustomerID == "" {
+		return
+	}
+	apiClient, err := getAPIClient()
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	details, err := apiClient.GetOrderPaymentDetails(ctx, rec.ReferenceID, "")
+	if err != nil {
+		utilsInstance.LogError("Failed to get payment details for card", map[string]interface{}{
+			"reference_id": rec.ReferenceID,
+			"error":        err.Error(),
+		})
+		return
+	}
+	card, ok := cardFromPaymentDetails(details)
+	if !ok {
+		return
+	}
+	if _, err := customerStore.SaveCard(rec.CustomerID, card, time.Now()); err != nil {
+		utilsInstance.LogError("Failed to save customer card", map[string]interface{}{
+			"customer_id": rec.CustomerID,
+			"error":       err.Error(),
+		})
+	}
+}
+
+// cardFromPaymentDetails reads the stored card token from payment details. The card may be
+// reported at the top level or under "card"; nothing is stored without a token.
+func cardFromPaymentDetails(details interface{}) (customers.Card, bool) {
+	sources := []interface{}{details}
+	for _, key := range []string{"card", "payment_card", "saved_card"} {
+		if fields, ok := details.(map[string]interface{}); ok && fields[key] != nil {
+			sources = append([]interface{}{fields[key]}, sources...)
+		}
+	}
+
+	for _, v := range sources {
+		token := responseField(v, "card_token", "card_id", "card_user_key", "token")
+		if token == "" {
+			continue
+		}
+		card := customers.Card{
+			ID:        token,
+			MaskedPAN: responseField(v, "masked_pan", "masked_card_number", "card_number"),
+			Brand:     responseField(v, "card_brand", "card_association", "brand"),
+		}
+		if card.MaskedPAN == "" {
+			if last4 := responseField(v, "last_four", "last_four_digits"); last4 != "" {
+				card.MaskedPAN = responseField(v, "bin", "bin_number") + "******" + last4
+			}
+		}
+		card.ExpMonth, _ = strconv.Atoi(responseField(v, "expire_month", "exp_month", "expiry_month"))
+		card.ExpYear, _ = strconv.Atoi(responseField(v, "expire_year", "exp_year", "expiry_year"))
+		return card, true
+	}
+	return customers.Card{}, false
+}
+
+// subscriptionCard checks the saved card a subscription should be charged with. Without a
+// card id the subscriber's default card is used, when there is one. Saved cards are only
+// used when the X-Customer-Token header proves the subscriber.
+func subscriptionCard(c *gin.Context, req SubscriptionRequest, now time.Time) (string, error) {
+	customer, found := customerStore.Find(req.SubscriberEmail, req.SubscriberPhone)
+	proven := found && cartCustomer(c) == customer.ID
+	if req.CardID == "" {
+		if !proven {
+			return "", nil
+		}
+		card, _ := customerStore.DefaultCard(customer.ID, now)
+		return card.ID, nil
+	}
+	if !proven {
+		return "", fmt.Errorf("a valid %s of the subscriber is required to use saved card %s", customerHeader, req.CardID)
+	}
+	return usableCard(customer.ID, req.CardID, now)
+}
+
+// usableCard returns cardID if it is a saved card of the customer that has not expired
+func usableCard(customerID, cardID string, now time.Time) (string, error) {
+	card, ok := customerStore.Card(customerID, cardID)
+	if !ok {
+		return "", fmt.Errorf("card %s is not a saved card of the customer", cardID)
+	}
+	if card.Expired(now) {
+		return "", fmt.Errorf("card %s has expired", cardID)
+	}
+	return card.ID, nil
+}
+
+// listCustomerCardsHandler lists the saved cards of a customer, the default first
+func listCustomerCardsHandler(c *gin.Context) {
+	cards, err := customerStore.Cards(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		return
+	}
+	c.JSON(http.StatusOK, cards)
+}
+
+// updateCustomerCardHandler labels a saved card and/or makes it the default
+func updateCustomerCardHandler(c *gin.Context) {
+	var req struct {
+		Label   *string `json:"label"`
+		Default bool    `json:"default"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	customerID, cardID := c.Param("id"), c.Param("card_id")
+	card, ok := customerStore.Card(customerID, cardID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Card not found"})
+		return
+	}
+	var err error
+	if req.Label != nil {
+		if card, err = customerStore.LabelCard(customerID, cardID, *req.Label); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Default {
+		if card, err = customerStore.SetDefaultCard(customerID, cardID, time.Now()); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, card)
+}
+
+// deleteCustomerCardHandler forgets a saved card. Subscriptions still charging it are refused.
+func deleteCustomerCardHandler(c *gin.Context) {
+	customerID, cardID := c.Param("id"), c.Param("card_id")
+	if _, ok := customerStore.Card(customerID, cardID); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Card not found"})
+		return
+	}
+	if subs := cardSubscriptions(cardID); len(subs) > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":         "card is used by active subscriptions",
+			"subscriptions": subs,
+		})
+		return
+	}
+	if err := customerStore.DeleteCard(customerID, cardID, time.Now()); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// cardSubscriptions returns the references of the subscriptions still billed to cardID
+func cardSubscriptions(cardID string) []string {
+	refs := make([]string, 0)
+	for _, sub := range subscriptionStore.List() {
+		if sub.CardID != cardID {
+			continue
+		}
+		switch sub.Status {
+		case subscriptions.StatusActive, subscriptions.StatusPastDue, subscriptions.StatusPaused, subscriptions.StatusResuming:
+			refs = append(refs, sub.ReferenceID)
+		}
+	}
+	return refs
+}
+
+// ReorderRequest repeats an earlier order of a customer
+type ReorderRequest struct {
+	OrderReferenceID string `json:"order_reference_id" binding:"required"`
+	CardID           string `json:"card_id"`
+	Installment      int    `json:"installment"`
+}
+
+// reorderHandler places the lines of an earlier order again, billed to the customer's default
+// addresses and paid with a saved card. The card token is passed as card_id order metadata.
+func reorderHandler(c *gin.Context) {
+	var req ReorderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, OrderResponse{
+			Success: false,
+			Error:   "Invalid request data: " + err.Error(),
+		})
+		return
+	}
+
+	customer, ok := customerStore.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, OrderResponse{Success: false, Error: "Customer not found"})
+		return
+	}
+	rec, ok := orderStore.Get(req.OrderReferenceID)
+	if !ok || rec.CustomerID != customer.ID {
+		c.JSON(http.StatusNotFound, OrderResponse{Success: false, Error: "Order not found for this customer"})
+		return
+	}
+	if len(rec.Lines) == 0 {
+		c.JSON(http.StatusBadRequest, OrderResponse{Success: false, Error: "order has no recorded lines to repeat"})
+		return
+	}
+
+	now := time.Now()
+	cardID := req.CardID
+	if cardID == "" {
+		card, ok := customerStore.DefaultCard(customer.ID, now)
+		if !ok {
+			c.JSON(http.StatusBadRequest, OrderResponse{Success: false, Error: "customer has no usable saved card"})
+			return
+		}
+		cardID = card.ID
+	} else {
+		var err error
+		if cardID, err = usableCard(customer.ID, cardID, now); err != nil {
+			c.JSON(http.StatusBadRequest, OrderResponse{Success: false, Error: err.Error()})
+			return
+		}
+	}
+
+	orderReq, err := reorderRequest(customer, rec, cardID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, OrderResponse{Success: false, Error: err.Error()})
+		return
+	}
+	if req.Installment > 0 {
+		orderReq.Installment = req.Installment
+	}
+
+	response, status := processOrder(c, orderReq)
+	c.JSON(status, response)
+}
+
+// reorderRequest rebuilds an order request from a local order record. The products are
+// priced from the catalog again; coupons are not applied again.
+func reorderRequest(customer customers.Customer, rec orders.Record, cardID string) (OrderRequest, error) {
+	var billing, shipping *customers.Address
+	for i, a := range customer.Addresses {
+		if a.DefaultBilling {
+			billing = &customer.Addresses[i]
+		}
+		if a.DefaultShipping {
+			shipping = &customer.Addresses[i]
+		}
+	}
+	if billing == nil {
+		return OrderRequest{}, fmt.Errorf("customer has no default billing address")
+	}
+
+	req := OrderRequest{
+		Cart:           make([]Product, 0, len(rec.Lines)),
+		Installment:    1,
+		Billing:        orderAddress(customer, *billing),
+		SameAddress:    shipping == nil || shipping.ID == billing.ID,
+		Description:    "Reorder of " + rec.ReferenceID,
+		Locale:         rec.Locale,
+		Currency:       rec.Currency,
+		ShippingMethod: rec.ShippingMethod,
+		Metadata: []tapsilat.OrderMetadata{
+			{Key: "card_id", Value: cardID},
+			{Key: "reorder_of", Value: rec.ReferenceID},
+		},
+	}
+	if !req.SameAddress {
+		a := orderAddress(customer, *shipping)
+		req.Shipping = &a
+	}
+	// The products are priced from the catalog again, as for any other order
+	for _, line := range rec.Lines {
+		req.Cart = append(req.Cart, Product{ID: line.ProductID, Quantity: line.Quantity})
+	}
+	return req, nil
+}
+
+// startCardExpiryWarnings warns customers about saved cards that expire soon, unless disabled
+// via CARD_EXPIRY_WARNINGS_ENABLED=false
+func startCardExpiryWarnings() {
+	if os.Getenv("CARD_EXPIRY_WARNINGS_ENABLED") == "false" {
+		log.Println("Card expiry warnings disabled")
+		return
+	}
+	interval := getEnvDuration("CARD_EXPIRY_INTERVAL", 24*time.Hour)
+	days := 30
+	if v := os.Getenv("CARD_EXPIRY_WARNING_DAYS"); v != "" {
+		var err error
+		if days, err = strconv.Atoi(v); err != nil || days < 1 {
+			log.Fatalf("Invalid CARD_EXPIRY_WARNING_DAYS value %q", v)
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			warnExpiringCards(context.Background(), time.Now(), days)
+			<-ticker.C
+		}
+	}()
+	log.Printf("Card expiry warnings started (interval %s, %d days ahead)", interval, days)
+}
+
+// warnExpiringCards notifies the owners of cards expiring within days, once per card and expiry
+func warnExpiringCards(ctx context.Context, now time.Time, days int) {
+	for _, exp := range customerStore.ExpiringCards(now, days) {
+		if exp.Email == "" {
+			continue
+		}
+		if err := notifyCardExpiring(exp); err != nil {
+			log.Printf("Failed to send card expiry warning to %s: %v", exp.Email, err)
+			continue
+		}
+		if err := customerStore.MarkCardWarned(exp.CustomerID, exp.Card.ID, now); err != nil {
+			utilsInstance.LogError("Failed to mark card expiry warning", err.Error())
+		}
+	}
+}
@@ -0,0 +1,467 @@
+package cart
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"tapsilat-go-example/store"
+
+	"github.com/google/uuid"
+)
+
+// Line is a single product in a cart
+type Line struct {
+	ProductID int     `json:"product_id"`
+	Name      string  `json:"name"`
+	Price     float64 `json:"price"`
+	Quantity  int     `json:"quantity"`
+	Category  string  `json:"category,omitempty"`
+	Image     string  `json:"image,omitempty"`
+	Weight    float64 `json:"weight,omitempty"` // kilograms per unit
+	// Prices are catalog prices per currency; other currencies are converted from Price
+	Prices map[string]float64 `json:"prices,omitempty"`
+	// SubmerchantKey is the marketplace seller of the product, if any
+	SubmerchantKey string `json:"submerchant_key,omitempty"`
+}
+
+// Cart is a server-side shopping cart identified by its token
+type Cart struct {
+	Token          string    `json:"token"`
+	CustomerID     string    `json:"customer_id,omitempty"`
+	Currency       string    `json:"currency"`
+	Country        string    `json:"country,omitempty"`
+	ShippingCity   string    `json:"shipping_city,omitempty"`
+	ShippingMethod string    `json:"shipping_method,omitempty"`
+	Lines          []Line    `json:"lines"`
+	Coupons        []string  `json:"coupons,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+
+	// Rate converts base-currency amounts such as fixed discounts and shipping
+	// rates into the cart currency. It is set when the cart is priced.
+	Rate float64 `json:"-"`
+}
+
+// LineTotal is the priced breakdown of one cart line
+type LineTotal struct {
+	ProductID int     `json:"product_id"`
+	Quantity  int     `json:"quantity"`
+	UnitPrice float64 `json:"unit_price"`
+	Amount    float64 `json:"amount"`
+	Discount  float64 `json:"discount"`
+	TaxRate   float64 `json:"tax_rate"`
+	Tax       float64 `json:"tax"`
+}
+
+// TaxLine sums the lines taxed at one rate
+type TaxLine struct {
+	Rate  float64 `json:"rate"`
+	Net   float64 `json:"net"`
+	Tax   float64 `json:"tax"`
+	Gross float64 `json:"gross"`
+}
+
+// AppliedCoupon is a coupon that contributed to the discount
+type AppliedCoupon struct {
+	Code     string  `json:"code"`
+	Discount float64 `json:"discount"`
+}
+
+// Totals is the server-side price breakdown of a cart
+type Totals struct {
+	Currency       string          `json:"currency,omitempty"`
+	Rate           float64         `json:"rate,omitempty"`
+	Subtotal       float64         `json:"subtotal"`
+	Discount       float64         `json:"discount"`
+	Tax            float64         `json:"tax"`
+	TaxIncluded    bool            `json:"tax_included"`
+	Net            float64         `json:"net"`   // goods after discount, excluding tax
+	Gross          float64         `json:"gross"` // goods after discount, including tax
+	TaxLines       []TaxLine       `json:"tax_lines,omitempty"`
+	Shipping       float64         `json:"shipping"`
+	ShippingMethod string          `json:"shipping_method,omitempty"`
+	FreeShipping   bool            `json:"free_shipping"`
+	Total          float64         `json:"total"`
+	Lines          []LineTotal     `json:"lines"`
+	Coupons        []AppliedCoupon `json:"coupons,omitempty"`
+}
+
+// Pricer adjusts totals, e.g. discounts, tax or shipping
+type Pricer interface {
+	Price(c Cart, t *Totals) error
+}
+
+// PricerFunc adapts a function to the Pricer interface
+type PricerFunc func(c Cart, t *Totals) error
+
+// Price calls f
+func (f PricerFunc) Price(c Cart, t *Totals) error {
+	return f(c, t)
+}
+
+// Calculate prices a cart, running each pricer in order after the subtotal
+func Calculate(c Cart, pricers ...Pricer) (Totals, error) {
+	t := Totals{Currency: c.Currency, Rate: c.Rate, Lines: make([]LineTotal, 0, len(c.Lines))}
+	for _, line := range c.Lines {
+		amount := Round(line.Price * float64(line.Quantity))
+		t.Lines = append(t.Lines, LineTotal{
+			ProductID: line.ProductID,
+			Quantity:  line.Quantity,
+			UnitPrice: line.Price,
+			Amount:    amount,
+		})
+		t.Subtotal += amount
+	}
+	t.Subtotal = Round(t.Subtotal)
+
+	for _, p := range pricers {
+		if err := p.Price(c, &t); err != nil {
+			return t, err
+		}
+	}
+
+	if len(t.TaxLines) == 0 {
+		// No tax pricer ran, goods are untaxed
+		t.Net = Round(t.Subtotal - t.Discount)
+		t.Gross = t.Net
+	}
+
+	t.Total = t.Subtotal - t.Discount + t.Shipping
+	if !t.TaxIncluded {
+		t.Total += t.Tax
+	}
+	t.Total = Round(t.Total)
+	return t, nil
+}
+
+// Convert converts a base-currency amount into the totals currency
+func (t Totals) Convert(amount float64) float64 {
+	if t.Rate == 0 {
+		return amount
+	}
+	return Round(amount * t.Rate)
+}
+
+// Round rounds an amount to cents
+func Round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// Store keeps carts in memory and persists them to a JSON file
+type Store struct {
+	mu    sync.Mutex
+	file  *store.JSONFile
+	carts map[string]*Cart
+	ttl   time.Duration
+}
+
+// NewStore loads the cart store. Carts idle for longer than ttl expire.
+func NewStore(path string, ttl time.Duration) (*Store, error) {
+	s := &Store{
+		file:  store.NewJSONFile(path),
+		carts: make(map[string]*Cart),
+		ttl:   ttl,
+	}
+	if err := s.file.Load(&s.carts); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// TTL returns how long an idle cart is kept
+func (s *Store) TTL() time.Duration {
+	return s.ttl
+}
+
+// Get returns the cart for token if it exists and has not expired
+func (s *Store) Get(token string) (Cart, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.getLocked(token)
+	if !ok {
+		return Cart{}, false
+	}
+	return copyCart(c), true
+}
+
+// Create starts a new empty cart
+func (s *Store) Create(currency string) (Cart, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	c := &Cart{
+		Token:     uuid.New().String(),
+		Currency:  currency,
+		Lines:     []Line{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	s.carts[c.Token] = c
+	return copyCart(c), s.saveLocked()
+}
+
+// AddLine adds quantity of a product, merging with an existing line for the same product
+func (s *Store) AddLine(token string, line Line) (Cart, error) {
+	if line.Quantity < 1 {
+		return Cart{}, fmt.Errorf("quantity must be at least 1")
+	}
+	if line.Price <= 0 {
+		return Cart{}, fmt.Errorf("price must be positive")
+	}
+
+	return s.update(token, func(c *Cart) error {
+		for i := range c.Lines {
+			if c.Lines[i].ProductID == line.ProductID {
+				c.Lines[i].Quantity += line.Quantity
+				return nil
+			}
+		}
+		c.Lines = append(c.Lines, line)
+		return nil
+	})
+}
+
+// SetQuantity changes the quantity of a line, zero removes it
+func (s *Store) SetQuantity(token string, productID, quantity int) (Cart, error) {
+	if quantity < 0 {
+		return Cart{}, fmt.Errorf("quantity cannot be negative")
+	}
+
+	return s.update(token, func(c *Cart) error {
+		for i := range c.Lines {
+			if c.Lines[i].ProductID == productID {
+				if quantity == 0 {
+					c.Lines = append(c.Lines[:i], c.Lines[i+1:]...)
+				} else {
+					c.Lines[i].Quantity = quantity
+				}
+				return nil
+			}
+		}
+		return fmt.Errorf("product %d is not in the cart", productID)
+	})
+}
+
+// RemoveLine removes a product from the cart
+func (s *Store) RemoveLine(token string, productID int) (Cart, error) {
+	return s.SetQuantity(token, productID, 0)
+}
+
+// Clear empties the cart
+func (s *Store) Clear(token string) (Cart, error) {
+	return s.update(token, func(c *Cart) error {
+		c.Lines = []Line{}
+		return nil
+	})
+}
+
+// AddCoupon adds a coupon code to the cart
+func (s *Store) AddCoupon(token, code string) (Cart, error) {
+	return s.update(token, func(c *Cart) error {
+		for _, existing := range c.Coupons {
+			if existing == code {
+				return nil
+			}
+		}
+		c.Coupons = append(c.Coupons, code)
+		return nil
+	})
+}
+
+// RemoveCoupon removes a coupon code from the cart
+func (s *Store) RemoveCoupon(token, code string) (Cart, error) {
+	return s.update(token, func(c *Cart) error {
+		for i, existing := range c.Coupons {
+			if existing == code {
+				c.Coupons = append(c.Coupons[:i], c.Coupons[i+1:]...)
+				return nil
+			}
+		}
+		return fmt.Errorf("coupon %s is not applied", code)
+	})
+}
+
+// SetCurrency changes the cart currency
+func (s *Store) SetCurrency(token, currency string) (Cart, error) {
+	return s.update(token, func(c *Cart) error {
+		c.Currency = currency
+		return nil
+	})
+}
+
+// SetShipping sets the shipping destination and method
+func (s *Store) SetShipping(token, country, city, method string) (Cart, error) {
+	return s.update(token, func(c *Cart) error {
+		c.Country = country
+		c.ShippingCity = city
+		c.ShippingMethod = method
+		return nil
+	})
+}
+
+// Merge attaches the cart to a customer on login. If the customer already has
+// a cart, the lines are merged into it and the anonymous cart is removed. The
+// anonymous cart is what the shopper used last, so its currency wins, and its
+// coupons and shipping destination replace the customer's when it has any.
+// Coupons are replaced rather than combined, as two sets may not stack.
+func (s *Store) Merge(token, customerID string) (Cart, error) {
+	if customerID == "" {
+		return Cart{}, fmt.Errorf("customer id is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	anonymous, ok := s.getLocked(token)
+	if !ok {
+		return Cart{}, fmt.Errorf("cart not found")
+	}
+
+	var target *Cart
+	for _, c := range s.carts {
+		if c.CustomerID == customerID && c.Token != token && !s.expired(c) {
+			if target == nil || c.UpdatedAt.After(target.UpdatedAt) {
+				target = c
+			}
+		}
+	}
+
+	if target == nil {
+		anonymous.CustomerID = customerID
+		anonymous.UpdatedAt = time.Now()
+		return copyCart(anonymous), s.saveLocked()
+	}
+
+	for _, line := range anonymous.Lines {
+		merged := false
+		for i := range target.Lines {
+			if target.Lines[i].ProductID == line.ProductID {
+				target.Lines[i].Quantity += line.Quantity
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			target.Lines = append(target.Lines, line)
+		}
+	}
+	if anonymous.Currency != "" {
+		target.Currency = anonymous.Currency
+	}
+	if len(anonymous.Coupons) > 0 {
+		target.Coupons = append([]string(nil), anonymous.Coupons...)
+	}
+	if anonymous.Country != "" {
+		target.Country = anonymous.Country
+		target.ShippingCity = anonymous.ShippingCity
+		target.ShippingMethod = anonymous.ShippingMethod
+	}
+	target.UpdatedAt = time.Now()
+	delete(s.carts, token)
+	return copyCart(target), s.saveLocked()
+}
+
+// ForCustomer returns the most recently used cart of a customer
+func (s *Store) ForCustomer(customerID string) (Cart, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var latest *Cart
+	for _, c := range s.carts {
+		if c.CustomerID == customerID && !s.expired(c) {
+			if latest == nil || c.UpdatedAt.After(latest.UpdatedAt) {
+				latest = c
+			}
+		}
+	}
+	if latest == nil {
+		return Cart{}, false
+	}
+	return copyCart(latest), true
+}
+
+// Delete removes a cart, e.g. after it was converted into an order
+func (s *Store) Delete(token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.carts, token)
+	return s.saveLocked()
+}
+
+// Expire removes idle carts and returns how many were removed
+func (s *Store) Expire() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	for token, c := range s.carts {
+		if s.expired(c) {
+			delete(s.carts, token)
+			removed++
+		}
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, s.saveLocked()
+}
+
+// StartJanitor periodically expires idle carts
+func (s *Store) StartJanitor(interval time.Duration, logf func(format string, args ...interface{})) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			removed, err := s.Expire()
+			if err != nil {
+				logf("Cart janitor: %v", err)
+			} else if removed > 0 {
+				logf("Cart janitor: expired %d idle carts", removed)
+			}
+		}
+	}()
+}
+
+func (s *Store) update(token string, fn func(c *Cart) error) (Cart, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.getLocked(token)
+	if !ok {
+		return Cart{}, fmt.Errorf("cart not found")
+	}
+	if err := fn(c); err != nil {
+		return Cart{}, err
+	}
+	c.UpdatedAt = time.Now()
+	return copyCart(c), s.saveLocked()
+}
+
+func (s *Store) getLocked(token string) (*Cart, bool) {
+	c, ok := s.carts[token]
+	if !ok || s.expired(c) {
+		return nil, false
+	}
+	return c, true
+}
+
+func (s *Store) expired(c *Cart) bool {
+	return s.ttl > 0 && time.Since(c.UpdatedAt) > s.ttl
+}
+
+func (s *Store) saveLocked() error {
+	return s.file.Save(s.carts)
+}
+
+func copyCart(c *Cart) Cart {
+	out := *c
+	out.Lines = make([]Line, len(c.Lines))
+	copy(out.Lines, c.Lines)
+	out.Coupons = append([]string(nil), c.Coupons...)
+	return out
+}
@@ -0,0 +1,159 @@
+package cart
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newStore(t *testing.T, ttl time.Duration) *Store {
+	t.Helper()
+	s, err := NewStore(filepath.Join(t.TempDir(), "carts.json"), ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestCalculate(t *testing.T) {
+	lines := []Line{
+		{ProductID: 1, Price: 10.005, Quantity: 3},
+		{ProductID: 2, Price: 5, Quantity: 1},
+	}
+	discount := PricerFunc(func(c Cart, t *Totals) error {
+		t.Discount = 5
+		return nil
+	})
+	shipping := PricerFunc(func(c Cart, t *Totals) error {
+		t.Shipping = 7.5
+		return nil
+	})
+	addedTax := PricerFunc(func(c Cart, t *Totals) error {
+		t.Tax = 6
+		t.TaxLines = []TaxLine{{Rate: 20, Net: 30, Tax: 6, Gross: 36}}
+		return nil
+	})
+	includedTax := PricerFunc(func(c Cart, t *Totals) error {
+		t.Tax = 6
+		t.TaxIncluded = true
+		t.TaxLines = []TaxLine{{Rate: 20, Net: 24, Tax: 6, Gross: 30}}
+		return nil
+	})
+
+	tests := []struct {
+		name    string
+		pricers []Pricer
+		total   float64
+		net     float64
+	}{
+		{"subtotal only", nil, 35.02, 35.02},
+		{"discount and shipping", []Pricer{discount, shipping}, 37.52, 30.02},
+		{"tax added", []Pricer{discount, addedTax}, 36.02, 0},
+		{"tax included", []Pricer{discount, includedTax}, 30.02, 0},
+	}
+	for _, tt := range tests {
+		totals, err := Calculate(Cart{Currency: "TRY", Lines: lines}, tt.pricers...)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if totals.Subtotal != 35.02 {
+			t.Errorf("%s: subtotal = %v, want 35.02", tt.name, totals.Subtotal)
+		}
+		if totals.Total != tt.total {
+			t.Errorf("%s: total = %v, want %v", tt.name, totals.Total, tt.total)
+		}
+		if totals.Net != tt.net {
+			t.Errorf("%s: net = %v, want %v", tt.name, totals.Net, tt.net)
+		}
+	}
+}
+
+func TestStoreLines(t *testing.T) {
+	s := newStore(t, time.Hour)
+	c, err := s.Create("TRY")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.AddLine(c.Token, Line{ProductID: 1, Price: 10, Quantity: 1}); err != nil {
+		t.Fatal(err)
+	}
+	c, err = s.AddLine(c.Token, Line{ProductID: 1, Price: 10, Quantity: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Lines) != 1 || c.Lines[0].Quantity != 3 {
+		t.Errorf("lines = %+v, want one line of 3", c.Lines)
+	}
+
+	if _, err := s.AddLine(c.Token, Line{ProductID: 2, Price: 10, Quantity: 0}); err == nil {
+		t.Error("AddLine accepted a zero quantity")
+	}
+	if _, err := s.SetQuantity(c.Token, 9, 1); err == nil {
+		t.Error("SetQuantity accepted a product that is not in the cart")
+	}
+	if c, err = s.RemoveLine(c.Token, 1); err != nil || len(c.Lines) != 0 {
+		t.Errorf("RemoveLine = %+v, %v", c.Lines, err)
+	}
+}
+
+func TestStoreMerge(t *testing.T) {
+	s := newStore(t, time.Hour)
+
+	owned, _ := s.Create("TRY")
+	s.AddLine(owned.Token, Line{ProductID: 1, Price: 10, Quantity: 1})
+	s.AddCoupon(owned.Token, "OLD")
+	if _, err := s.Merge(owned.Token, "CUS_1"); err != nil {
+		t.Fatal(err)
+	}
+
+	anonymous, _ := s.Create("EUR")
+	s.AddLine(anonymous.Token, Line{ProductID: 1, Price: 10, Quantity: 2})
+	s.AddLine(anonymous.Token, Line{ProductID: 2, Price: 5, Quantity: 1})
+	s.AddCoupon(anonymous.Token, "NEW")
+
+	merged, err := s.Merge(anonymous.Token, "CUS_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.Token != owned.Token {
+		t.Errorf("merged into %s, want the customer's cart %s", merged.Token, owned.Token)
+	}
+	if merged.Currency != "EUR" {
+		t.Errorf("currency = %s, want EUR", merged.Currency)
+	}
+	if len(merged.Coupons) != 1 || merged.Coupons[0] != "NEW" {
+		t.Errorf("coupons = %v, want [NEW]", merged.Coupons)
+	}
+	quantities := map[int]int{}
+	for _, line := range merged.Lines {
+		quantities[line.ProductID] = line.Quantity
+	}
+	if quantities[1] != 3 || quantities[2] != 1 {
+		t.Errorf("quantities = %v", quantities)
+	}
+	if _, ok := s.Get(anonymous.Token); ok {
+		t.Error("anonymous cart still exists after the merge")
+	}
+	if got, ok := s.ForCustomer("CUS_1"); !ok || got.Token != owned.Token {
+		t.Errorf("ForCustomer = %s, %v", got.Token, ok)
+	}
+}
+
+func TestStoreExpire(t *testing.T) {
+	s := newStore(t, time.Hour)
+	fresh, _ := s.Create("TRY")
+	idle, _ := s.Create("TRY")
+	s.carts[idle.Token].UpdatedAt = time.Now().Add(-2 * time.Hour)
+
+	if _, ok := s.Get(idle.Token); ok {
+		t.Error("Get returned an idle cart")
+	}
+	removed, err := s.Expire()
+	if err != nil || removed != 1 {
+		t.Errorf("Expire = %d, %v, want 1", removed, err)
+	}
+	if _, ok := s.Get(fresh.Token); !ok {
+		t.Error("fresh cart expired")
+	}
+}
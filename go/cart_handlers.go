@@ -0,0 +1,390 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"tapsilat-go-example/cart"
+	"tapsilat-go-example/currency"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+const (
+	cartCookieName = "cart_token"
+	cartHeaderName = "X-Cart-Token"
+	customerHeader = "X-Customer-Token"
+	adminKeyHeader = "X-Admin-Key"
+)
+
+// cartPricers run after the subtotal when pricing a cart
+var cartPricers []cart.Pricer
+
+// CartResponse is returned by every cart endpoint
+type CartResponse struct {
+	Cart   cart.Cart   `json:"cart"`
+	Totals cart.Totals `json:"totals"`
+}
+
+// CartItemRequest adds a product to the cart. Everything else about the line comes
+// from the product catalog.
+type CartItemRequest struct {
+	ProductID int `json:"product_id" binding:"required"`
+	Quantity  int `json:"quantity"`
+}
+
+// cartToken reads the cart token from the header (mobile clients) or the cookie (browser)
+func cartToken(c *gin.Context) string {
+	if token := c.GetHeader(cartHeaderName); token != "" {
+		return token
+	}
+	token, _ := c.Cookie(cartCookieName)
+	return token
+}
+
+// cartCustomer returns the customer proven by the X-Customer-Token header, a token of the
+// form "<customer_id>.<expires_unix>.<signature>" issued by issueCustomerTokenHandler. It
+// returns "" when the header is missing, invalid or expired, or when CART_CUSTOMER_SECRET
+// is unset.
+func cartCustomer(c *gin.Context) string {
+	token := c.GetHeader(customerHeader)
+	sig := strings.LastIndex(token, ".")
+	if sig <= 0 || os.Getenv("CART_CUSTOMER_SECRET") == "" {
+		return ""
+	}
+	exp := strings.LastIndex(token[:sig], ".")
+	if exp <= 0 {
+		return ""
+	}
+	customerID := token[:exp]
+	expires, err := strconv.ParseInt(token[exp+1:sig], 10, 64)
+	if err != nil || time.Now().Unix() >= expires {
+		return ""
+	}
+	if !hmac.Equal([]byte(token), []byte(signCartCustomer(customerID, time.Unix(expires, 0)))) {
+		return ""
+	}
+	return customerID
+}
+
+// signCartCustomer issues the X-Customer-Token for a logged-in customer. The expiry is
+// part of the signed payload, so it cannot be extended by the client.
+func signCartCustomer(customerID string, expires time.Time) string {
+	payload := customerID + "." + strconv.FormatInt(expires.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(os.Getenv("CART_CUSTOMER_SECRET")))
+	mac.Write([]byte(payload))
+	return payload + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+// requireAdminKey only lets a request through when its X-Admin-Key matches ADMIN_API_KEY.
+// Routes behind it are meant for the shop's backend, never for the browser.
+func requireAdminKey(c *gin.Context) {
+	secret := os.Getenv("ADMIN_API_KEY")
+	if secret == "" {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "ADMIN_API_KEY is not set"})
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(c.GetHeader(adminKeyHeader)), []byte(secret)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "A valid " + adminKeyHeader + " is required"})
+		return
+	}
+	c.Next()
+}
+
+// issueCustomerTokenHandler returns the X-Customer-Token of a customer. The shop's
+// backend calls it with its X-Admin-Key after its own login and hands the token to the
+// client. Tokens expire after CART_CUSTOMER_TOKEN_TTL (default 24h).
+func issueCustomerTokenHandler(c *gin.Context) {
+	if os.Getenv("CART_CUSTOMER_SECRET") == "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "CART_CUSTOMER_SECRET is not set"})
+		return
+	}
+	customer, ok := customerStore.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		return
+	}
+	expires := time.Now().Add(getEnvDuration("CART_CUSTOMER_TOKEN_TTL", 24*time.Hour)).Truncate(time.Second)
+	c.JSON(http.StatusOK, gin.H{
+		"customer_id": customer.ID,
+		"header":      customerHeader,
+		"token":       signCartCustomer(customer.ID, expires),
+		"expires_at":  expires,
+	})
+}
+
+// currentCart returns the request's cart. Logged-in customers get their own cart on
+// any device; otherwise a new anonymous cart is created when create is set.
+func currentCart(c *gin.Context, create bool) (cart.Cart, bool) {
+	if current, ok := cartStore.Get(cartToken(c)); ok {
+		return current, true
+	}
+	if customerID := cartCustomer(c); customerID != "" {
+		if current, ok := cartStore.ForCustomer(customerID); ok {
+			setCartToken(c, current.Token)
+			return current, true
+		}
+	}
+	if !create {
+		return cart.Cart{}, false
+	}
+
+	current, err := cartStore.Create(fxEngine.Base())
+	if err != nil {
+		utilsInstance.LogError("Failed to create cart", err.Error())
+		return cart.Cart{}, false
+	}
+	setCartToken(c, current.Token)
+	return current, true
+}
+
+func setCartToken(c *gin.Context, token string) {
+	c.Header(cartHeaderName, token)
+	c.SetCookie(cartCookieName, token, int(cartStore.TTL().Seconds()), "/", "", false, true)
+}
+
+// respondCart prices the cart server-side and writes it to the response
+func respondCart(c *gin.Context, current cart.Cart) {
+	totals, _, err := priceCart(current)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, CartResponse{Cart: current, Totals: totals})
+}
+
+// getCartHandler returns the current cart, creating one if needed
+func getCartHandler(c *gin.Context) {
+	current, ok := currentCart(c, true)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	respondCart(c, current)
+}
+
+// addCartItemHandler adds a product or increases its quantity
+func addCartItemHandler(c *gin.Context) {
+	var req CartItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Quantity == 0 {
+		req.Quantity = 1
+	}
+
+	line, err := catalogLine(req.ProductID, req.Quantity)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	current, ok := currentCart(c, true)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	updated, err := cartStore.AddLine(current.Token, line)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	respondCart(c, updated)
+}
+
+// updateCartItemHandler sets the quantity of a line, zero removes it
+func updateCartItemHandler(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("product_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var req struct {
+		Quantity int `json:"quantity"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	current, ok := currentCart(c, false)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cart not found"})
+		return
+	}
+
+	updated, err := cartStore.SetQuantity(current.Token, productID, req.Quantity)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	respondCart(c, updated)
+}
+
+// removeCartItemHandler removes a line from the cart
+func removeCartItemHandler(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("product_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	current, ok := currentCart(c, false)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cart not found"})
+		return
+	}
+
+	updated, err := cartStore.RemoveLine(current.Token, productID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	respondCart(c, updated)
+}
+
+// clearCartHandler empties the cart
+func clearCartHandler(c *gin.Context) {
+	current, ok := currentCart(c, false)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cart not found"})
+		return
+	}
+
+	updated, err := cartStore.Clear(current.Token)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	respondCart(c, updated)
+}
+
+// setCartCurrencyHandler switches the currency the cart is priced in
+// PUT /api/cart/currency {"currency": "EUR"}
+func setCartCurrencyHandler(c *gin.Context) {
+	var req struct {
+		Currency string `json:"currency" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	code := currency.Normalize(req.Currency)
+	if !fxEngine.IsSupported(code) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Currency " + code + " is not supported"})
+		return
+	}
+
+	current, ok := currentCart(c, false)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cart not found"})
+		return
+	}
+
+	updated, err := cartStore.SetCurrency(current.Token, code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	respondCart(c, updated)
+}
+
+// mergeCartHandler attaches the anonymous cart to the customer of the X-Customer-Token
+// header on login
+func mergeCartHandler(c *gin.Context) {
+	customerID := cartCustomer(c)
+	if customerID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "A valid " + customerHeader + " is required"})
+		return
+	}
+
+	current, ok := currentCart(c, true)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	merged, err := cartStore.Merge(current.Token, customerID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	setCartToken(c, merged.Token)
+	respondCart(c, merged)
+}
+
+// checkoutCartHandler converts the cart into an order. The body is an OrderRequest
+// without "cart"; the lines come from the server-side cart.
+func checkoutCartHandler(c *gin.Context) {
+	current, ok := currentCart(c, false)
+	if !ok || len(current.Lines) == 0 {
+		c.JSON(http.StatusBadRequest, OrderResponse{Success: false, Error: "Cart is empty"})
+		return
+	}
+
+	var req OrderRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		c.JSON(http.StatusBadRequest, OrderResponse{Success: false, Error: "Invalid request data: " + err.Error()})
+		return
+	}
+
+	req.Cart = cartProducts(current)
+	if len(req.Coupons) == 0 {
+		req.Coupons = current.Coupons
+	}
+	if req.Currency == "" {
+		req.Currency = current.Currency
+	}
+	if req.ShippingMethod == "" {
+		req.ShippingMethod = current.ShippingMethod
+	}
+	// The destination chosen for the cart fills in what the shipping address leaves out
+	destination := &req.Billing
+	if !req.SameAddress && req.Shipping != nil {
+		destination = req.Shipping
+	}
+	if destination.Country == "" {
+		destination.Country = current.Country
+	}
+	if destination.City == "" {
+		destination.City = current.ShippingCity
+	}
+	if err := binding.Validator.ValidateStruct(req); err != nil {
+		c.JSON(http.StatusBadRequest, OrderResponse{Success: false, Error: "Invalid request data: " + err.Error()})
+		return
+	}
+
+	response, status := processOrder(c, req)
+	if response.Success {
+		if err := cartStore.Delete(current.Token); err != nil {
+			utilsInstance.LogError("Failed to remove converted cart", err.Error())
+		}
+	}
+	c.JSON(status, response)
+}
+
+// cartProducts converts cart lines into the OrderRequest cart format. Only id and quantity
+// are kept; validateOrderData prices them from the product catalog again.
+func cartProducts(current cart.Cart) []Product {
+	products := make([]Product, 0, len(current.Lines))
+	for _, line := range current.Lines {
+		products = append(products, Product{
+			ID:       line.ProductID,
+			Quantity: line.Quantity,
+		})
+	}
+	return products
+}
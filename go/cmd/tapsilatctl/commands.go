@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/tapsilat/tapsilat-go"
+)
+
+// commands mirrors the routes of the example server
+var commands = []command{
+	{group: "order", name: "create", args: "<order.json>", help: "create an order from a JSON file (- for stdin)", flags: orderCreate},
+	{group: "order", name: "status", args: "<reference_id>", help: "get order status", flags: orderStatus},
+	{group: "order", name: "details", args: "<reference_id>", help: "get order details", flags: orderDetails},
+	{group: "order", name: "transactions", args: "<reference_id>", help: "list order transactions", flags: orderTransactions},
+	{group: "order", name: "list", args: "", help: "list orders with date filters", flags: orderList},
+	{group: "order", name: "cancel", args: "<reference_id>", help: "cancel an order", flags: orderCancel},
+	{group: "order", name: "refund", args: "<reference_id>", help: "refund an order (full unless -amount)", flags: orderRefund},
+	{group: "order", name: "terminate", args: "<reference_id>", help: "terminate an order", flags: orderTerminate},
+	{group: "order", name: "manual-callback", args: "<reference_id>", help: "trigger a manual callback", flags: orderManualCallback},
+	{group: "term", name: "create", args: "<term.json>", help: "create a payment term from a JSON file", flags: termCreate},
+	{group: "term", name: "get", args: "<term_reference_id>", help: "get a payment term", flags: termGet},
+	{group: "term", name: "update", args: "<term.json>", help: "update a payment term from a JSON file", flags: termUpdate},
+	{group: "term", name: "delete", args: "<order_id> <term_reference_id>", help: "delete a payment term", flags: termDelete},
+	{group: "term", name: "refund", args: "<refund.json>", help: "refund a payment term from a JSON file", flags: termRefund},
+	{group: "subscription", name: "create", args: "<subscription.json>", help: "create a subscription from a JSON file", flags: subscriptionCreate},
+	{group: "subscription", name: "list", args: "", help: "list subscriptions", flags: subscriptionList},
+	{group: "subscription", name: "cancel", args: "<subscription_id>", help: "cancel a subscription", flags: subscriptionCancel},
+	{group: "org", name: "settings", args: "", help: "get organization settings", flags: orgSettings},
+}
+
+func requireArgs(args []string, n int, usage string) error {
+	if len(args) != n {
+		return usageErrorf("usage: tapsilatctl %s", usage)
+	}
+	return nil
+}
+
+// readJSONFile decodes a JSON file, "-" reads from stdin
+func readJSONFile(path string, v interface{}) error {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return configErrorf("failed to read %s: %v", path, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return usageErrorf("invalid JSON in %s: %v", path, err)
+	}
+	return nil
+}
+
+// --- Orders ---
+
+func orderCreate(fs *flag.FlagSet) func(ctx context.Context, e *env, args []string) error {
+	return func(ctx context.Context, e *env, args []string) error {
+		if err := requireArgs(args, 1, "order create <order.json>"); err != nil {
+			return err
+		}
+		var order tapsilat.Order
+		if err := readJSONFile(args[0], &order); err != nil {
+			return err
+		}
+		response, err := e.api.CreateOrder(ctx, order)
+		if err != nil {
+			return apiError(err)
+		}
+
+		result := map[string]interface{}{"reference_id": response.ReferenceID}
+		if response.ReferenceID != "" {
+			if url, err := e.api.GetCheckoutURL(ctx, response.ReferenceID); err == nil {
+				result["checkout_url"] = url
+			}
+		}
+		return e.render(result)
+	}
+}
+
+func orderStatus(fs *flag.FlagSet) func(ctx context.Context, e *env, args []string) error {
+	return func(ctx context.Context, e *env, args []string) error {
+		if err := requireArgs(args, 1, "order status <reference_id>"); err != nil {
+			return err
+		}
+		response, err := e.api.GetOrderStatus(ctx, args[0])
+		if err != nil {
+			return apiError(err)
+		}
+		return e.render(response)
+	}
+}
+
+func orderDetails(fs *flag.FlagSet) func(ctx context.Context, e *env, args []string) error {
+	return func(ctx context.Context, e *env, args []string) error {
+		if err := requireArgs(args, 1, "order details <reference_id>"); err != nil {
+			return err
+		}
+		response, err := e.api.GetOrder(ctx, args[0])
+		if err != nil {
+			return apiError(err)
+		}
+		return e.render(response)
+	}
+}
+
+func orderTransactions(fs *flag.FlagSet) func(ctx context.Context, e *env, args []string) error {
+	return func(ctx context.Context, e *env, args []string) error {
+		if err := requireArgs(args, 1, "order transactions <reference_id>"); err != nil {
+			return err
+		}
+		response, err := e.api.GetOrderTransactions(ctx, args[0])
+		if err != nil {
+			return apiError(err)
+		}
+		return e.render(response)
+	}
+}
+
+func orderList(fs *flag.FlagSet) func(ctx context.Context, e *env, args []string) error {
+	page := fs.Int("page", 1, "page number")
+	perPage := fs.Int("per-page", 50, "orders per page")
+	startDate := fs.String("start", "", "start date (YYYY-MM-DD)")
+	endDate := fs.String("end", "", "end date (YYYY-MM-DD)")
+	organizationID := fs.String("organization-id", "", "organization ID")
+	relatedRefID := fs.String("related-reference-id", "", "related reference ID")
+	allPages := fs.Bool("all", false, "fetch every page")
+
+	return func(ctx context.Context, e *env, args []string) error {
+		if err := requireArgs(args, 0, "order list [-start DATE] [-end DATE] [-all]"); err != nil {
+			return err
+		}
+		if !*allPages {
+			response, err := e.api.GetOrderList(ctx, *page, *perPage, *startDate, *endDate, *organizationID, *relatedRefID)
+			if err != nil {
+				return apiError(err)
+			}
+			return e.render(response)
+		}
+
+		var all []map[string]interface{}
+		for p := *page; ; p++ {
+			response, err := e.fetchPage(ctx, func(ctx context.Context) (interface{}, error) {
+				return e.api.GetOrderList(ctx, p, *perPage, *startDate, *endDate, *organizationID, *relatedRefID)
+			})
+			if err != nil {
+				return apiError(err)
+			}
+			rows, ok := toRows(response)
+			if !ok {
+				return apiError(fmt.Errorf("page %d of the order list has no rows", p))
+			}
+			all = append(all, rows...)
+			if len(rows) == 0 || p >= totalPages(response) {
+				break
+			}
+		}
+		return e.render(all)
+	}
+}
+
+// fetchPage runs one request of a paged command with its own -timeout, so fetching every
+// page is not cut short by the timeout of the first
+func (e *env) fetchPage(ctx context.Context, fetch func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), e.timeout)
+	defer cancel()
+	return fetch(ctx)
+}
+
+// totalPages reads total_pages from a paginated response, unknown means unlimited
+func totalPages(v interface{}) int {
+	var page struct {
+		TotalPages int `json:"total_pages"`
+	}
+	data, _ := json.Marshal(v)
+	json.Unmarshal(data, &page)
+	if page.TotalPages <= 0 {
+		return int(^uint(0) >> 1)
+	}
+	return page.TotalPages
+}
+
+func orderCancel(fs *flag.FlagSet) func(ctx context.Context, e *env, args []string) error {
+	return func(ctx context.Context, e *env, args []string) error {
+		if err := requireArgs(args, 1, "order cancel <reference_id>"); err != nil {
+			return err
+		}
+		response, err := e.api.CancelOrder(ctx, tapsilat.CancelOrder{ReferenceID: args[0]})
+		if err != nil {
+			return apiError(err)
+		}
+		return e.render(response)
+	}
+}
+
+func orderRefund(fs *flag.FlagSet) func(ctx context.Context, e *env, args []string) error {
+	amount := fs.Float64("amount", 0, "partial refund amount (default: full refund)")
+
+	return func(ctx context.Context, e *env, args []string) error {
+		if err := requireArgs(args, 1, "order refund <reference_id> [-amount N]"); err != nil {
+			return err
+		}
+		if *amount <= 0 {
+			response, err := e.api.RefundAllOrder(ctx, args[0])
+			if err != nil {
+				return apiError(err)
+			}
+			return e.render(response)
+		}
+		response, err := e.api.RefundOrder(ctx, tapsilat.RefundOrder{ReferenceID: args[0], Amount: *amount})
+		if err != nil {
+			return apiError(err)
+		}
+		return e.render(response)
+	}
+}
+
+func orderTerminate(fs *flag.FlagSet) func(ctx context.Context, e *env, args []string) error {
+	return func(ctx context.Context, e *env, args []string) error {
+		if err := requireArgs(args, 1, "order terminate <reference_id>"); err != nil {
+			return err
+		}
+		response, err := e.api.OrderTerminate(ctx, args[0])
+		if err != nil {
+			return apiError(err)
+		}
+		return e.render(response)
+	}
+}
+
+func orderManualCallback(fs *flag.FlagSet) func(ctx context.Context, e *env, args []string) error {
+	conversationID := fs.String("conversation-id", "", "conversation ID")
+
+	return func(ctx context.Context, e *env, args []string) error {
+		if err := requireArgs(args, 1, "order manual-callback <reference_id> [-conversation-id ID]"); err != nil {
+			return err
+		}
+		response, err := e.api.OrderManualCallback(ctx, args[0], *conversationID)
+		if err != nil {
+			return apiError(err)
+		}
+		return e.render(response)
+	}
+}
+
+// --- Payment Terms ---
+
+func termCreate(fs *flag.FlagSet) func(ctx context.Context, e *env, args []string) error {
+	return func(ctx context.Context, e *env, args []string) error {
+		if err := requireArgs(args, 1, "term create <term.json>"); err != nil {
+			return err
+		}
+		var req tapsilat.OrderPaymentTermCreateDTO
+		if err := readJSONFile(args[0], &req); err != nil {
+			return err
+		}
+		response, err := e.api.CreateOrderTerm(ctx, req)
+		if err != nil {
+			return apiError(err)
+		}
+		return e.render(response)
+	}
+}
+
+func termGet(fs *flag.FlagSet) func(ctx context.Context, e *env, args []string) error {
+	return func(ctx context.Context, e *env, args []string) error {
+		if err := requireArgs(args, 1, "term get <term_reference_id>"); err != nil {
+			return err
+		}
+		response, err := e.api.GetOrderTerm(ctx, args[0])
+		if err != nil {
+			return apiError(err)
+		}
+		return e.render(response)
+	}
+}
+
+func termUpdate(fs *flag.FlagSet) func(ctx context.Context, e *env, args []string) error {
+	return func(ctx context.Context, e *env, args []string) error {
+		if err := requireArgs(args, 1, "term update <term.json>"); err != nil {
+			return err
+		}
+		var req tapsilat.OrderPaymentTermUpdateDTO
+		if err := readJSONFile(args[0], &req); err != nil {
+			return err
+		}
+		response, err := e.api.UpdateOrderTerm(ctx, req)
+		if err != nil {
+			return apiError(err)
+		}
+		return e.render(response)
+	}
+}
+
+func termDelete(fs *flag.FlagSet) func(ctx context.Context, e *env, args []string) error {
+	return func(ctx context.Context, e *env, args []string) error {
+		if err := requireArgs(args, 2, "term delete <order_id> <term_reference_id>"); err != nil {
+			return err
+		}
+		response, err := e.api.DeleteOrderTerm(ctx, args[0], args[1])
+		if err != nil {
+			return apiError(err)
+		}
+		return e.render(response)
+	}
+}
+
+func termRefund(fs *flag.FlagSet) func(ctx context.Context, e *env, args []string) error {
+	return func(ctx context.Context, e *env, args []string) error {
+		if err := requireArgs(args, 1, "term refund <refund.json>"); err != nil {
+			return err
+		}
+		var req tapsilat.OrderTermRefundRequest
+		if err := readJSONFile(args[0], &req); err != nil {
+			return err
+		}
+		response, err := e.api.RefundOrderTerm(ctx, req)
+		if err != nil {
+			return apiError(err)
+		}
+		return e.render(response)
+	}
+}
+
+// --- Subscriptions ---
+
+func subscriptionCreate(fs *flag.FlagSet) func(ctx context.Context, e *env, args []string) error {
+	return func(ctx context.Context, e *env, args []string) error {
+		if err := requireArgs(args, 1, "subscription create <subscription.json>"); err != nil {
+			return err
+		}
+		var req tapsilat.SubscriptionCreateRequest
+		if err := readJSONFile(args[0], &req); err != nil {
+			return err
+		}
+		response, err := e.api.CreateSubscription(ctx, req)
+		if err != nil {
+			return apiError(err)
+		}
+		return e.render(response)
+	}
+}
+
+func subscriptionList(fs *flag.FlagSet) func(ctx context.Context, e *env, args []string) error {
+	page := fs.Int("page", 1, "page number")
+	perPage := fs.Int("per-page", 50, "subscriptions per page")
+
+	return func(ctx context.Context, e *env, args []string) error {
+		if err := requireArgs(args, 0, "subscription list [-page N] [-per-page N]"); err != nil {
+			return err
+		}
+		response, err := e.api.ListSubscriptions(ctx, *page, *perPage)
+		if err != nil {
+			return apiError(err)
+		}
+		return e.render(response)
+	}
+}
+
+func subscriptionCancel(fs *flag.FlagSet) func(ctx context.Context, e *env, args []string) error {
+	return func(ctx context.Context, e *env, args []string) error {
+		if err := requireArgs(args, 1, "subscription cancel <subscription_id>"); err != nil {
+			return err
+		}
+		err := e.api.CancelSubscription(ctx, tapsilat.SubscriptionCancelRequest{
+			ReferenceID:    args[0],
+			SubscriptionID: args[0],
+		})
+		if err != nil {
+			return apiError(err)
+		}
+		return e.render(map[string]interface{}{"success": true, "subscription_id": args[0]})
+	}
+}
+
+// --- Organization ---
+
+func orgSettings(fs *flag.FlagSet) func(ctx context.Context, e *env, args []string) error {
+	return func(ctx context.Context, e *env, args []string) error {
+		if err := requireArgs(args, 0, "org settings"); err != nil {
+			return err
+		}
+		response, err := e.api.GetOrganizationSettings(ctx)
+		if err != nil {
+			return apiError(err)
+		}
+		return e.render(response)
+	}
+}
@@ -0,0 +1,198 @@
+// Command tapsilatctl scripts the Tapsilat operations exposed by the example server.
+//
+// Usage:
+//
+//	tapsilatctl <group> <command> [flags] [args]
+//
+// Exit codes:
+//
+//	0  success
+//	1  the Tapsilat API returned an error
+//	2  invalid usage (unknown command, missing argument, bad flag)
+//	3  configuration error (no API key, unknown profile, unreadable file)
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tapsilat/tapsilat-go"
+)
+
+const (
+	exitOK     = 0
+	exitAPI    = 1
+	exitUsage  = 2
+	exitConfig = 3
+)
+
+// exitError carries the process exit code alongside the error
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+func usageErrorf(format string, args ...interface{}) error {
+	return &exitError{code: exitUsage, err: fmt.Errorf(format, args...)}
+}
+
+func configErrorf(format string, args ...interface{}) error {
+	return &exitError{code: exitConfig, err: fmt.Errorf(format, args...)}
+}
+
+func apiError(err error) error {
+	return &exitError{code: exitAPI, err: err}
+}
+
+// env is passed to every command
+type env struct {
+	api     *tapsilat.API
+	out     io.Writer
+	format  string
+	cols    []string
+	timeout time.Duration // per request
+}
+
+// command is a single "<group> <name>" subcommand
+type command struct {
+	group string
+	name  string
+	args  string
+	help  string
+	flags func(fs *flag.FlagSet) func(ctx context.Context, e *env, args []string) error
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage(stdout)
+		return exitOK
+	}
+
+	if args[0] == "profile" {
+		return exitCode(runProfile(args[1:], stdout), stderr)
+	}
+
+	if len(args) < 2 {
+		return exitCode(usageErrorf("missing command for %q, see 'tapsilatctl help'", args[0]), stderr)
+	}
+
+	cmd := findCommand(args[0], args[1])
+	if cmd == nil {
+		return exitCode(usageErrorf("unknown command %q, see 'tapsilatctl help'", args[0]+" "+args[1]), stderr)
+	}
+
+	fs := flag.NewFlagSet(cmd.group+" "+cmd.name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	profile := fs.String("profile", os.Getenv("TAPSILATCTL_PROFILE"), "profile name from the profiles file")
+	format := fs.String("o", "table", "output format: table, json or csv")
+	columns := fs.String("columns", "", "comma separated list of columns for table/csv output")
+	timeout := fs.Duration("timeout", 30*time.Second, "request timeout")
+	exec := cmd.flags(fs)
+
+	positional, err := parseInterspersed(fs, args[2:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitCode(usageErrorf("%v", err), stderr)
+	}
+
+	switch *format {
+	case "table", "json", "csv":
+	default:
+		return exitCode(usageErrorf("unknown output format %q", *format), stderr)
+	}
+
+	api, err := newAPIClient(*profile)
+	if err != nil {
+		return exitCode(err, stderr)
+	}
+
+	e := &env{api: api, out: stdout, format: *format, timeout: *timeout}
+	if *columns != "" {
+		e.cols = strings.Split(*columns, ",")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	return exitCode(exec(ctx, e, positional), stderr)
+}
+
+// exitCode prints err and maps it to a process exit code
+func exitCode(err error, stderr io.Writer) int {
+	if err == nil {
+		return exitOK
+	}
+	fmt.Fprintln(stderr, "Error:", err)
+
+	var ee *exitError
+	if errors.As(err, &ee) {
+		return ee.code
+	}
+	return exitAPI
+}
+
+// parseInterspersed allows flags after positional arguments
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+func findCommand(group, name string) *command {
+	for i := range commands {
+		if commands[i].group == group && commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "tapsilatctl - script Tapsilat operations from the shell")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Usage: tapsilatctl <group> <command> [flags] [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+
+	sorted := make([]command, len(commands))
+	copy(sorted, commands)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].group < sorted[j].group })
+	for _, cmd := range sorted {
+		usage := strings.TrimSpace(cmd.group + " " + cmd.name + " " + cmd.args)
+		fmt.Fprintf(w, "  %-44s %s\n", usage, cmd.help)
+	}
+	fmt.Fprintf(w, "  %-44s %s\n", "profile list|add|remove|use", "manage API key profiles")
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Common flags:")
+	fmt.Fprintln(w, "  -profile name    profile to use (default: TAPSILATCTL_PROFILE or the default profile)")
+	fmt.Fprintln(w, "  -o format        output format: table, json or csv (default table)")
+	fmt.Fprintln(w, "  -columns a,b     columns to print for table/csv output")
+	fmt.Fprintln(w, "  -timeout 30s     request timeout, per page with -all")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Exit codes: 0 success, 1 API error, 2 usage error, 3 configuration error")
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// render writes v in the selected output format
+func (e *env) render(v interface{}) error {
+	if e.format == "json" {
+		enc := json.NewEncoder(e.out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	rows, isList := toRows(v)
+	cols := e.cols
+	if len(cols) == 0 {
+		cols = columnsOf(rows)
+	}
+
+	// A single object reads better as key/value pairs in a table
+	if !isList && e.format == "table" && len(e.cols) == 0 {
+		return writeKeyValue(e.out, rows, cols)
+	}
+
+	if e.format == "csv" {
+		return writeCSV(e.out, rows, cols)
+	}
+	return writeTable(e.out, rows, cols)
+}
+
+// toRows normalizes an API response into flat rows.
+// Paginated responses are unwrapped to their "rows" field.
+func toRows(v interface{}) ([]map[string]interface{}, bool) {
+	var generic interface{}
+	data, err := json.Marshal(v)
+	if err == nil {
+		json.Unmarshal(data, &generic)
+	}
+
+	if obj, ok := generic.(map[string]interface{}); ok {
+		if list, ok := obj["rows"].([]interface{}); ok {
+			generic = list
+		}
+	}
+
+	switch value := generic.(type) {
+	case []interface{}:
+		rows := make([]map[string]interface{}, 0, len(value))
+		for _, item := range value {
+			if obj, ok := item.(map[string]interface{}); ok {
+				rows = append(rows, obj)
+			} else {
+				rows = append(rows, map[string]interface{}{"value": item})
+			}
+		}
+		return rows, true
+	case map[string]interface{}:
+		return []map[string]interface{}{value}, false
+	case nil:
+		return nil, false
+	default:
+		return []map[string]interface{}{{"value": value}}, false
+	}
+}
+
+func columnsOf(rows []map[string]interface{}) []string {
+	seen := make(map[string]bool)
+	var cols []string
+	for _, row := range rows {
+		for key := range row {
+			if !seen[key] {
+				seen[key] = true
+				cols = append(cols, key)
+			}
+		}
+	}
+	sort.Strings(cols)
+	return cols
+}
+
+// cell formats a value for table/csv output, nested values are JSON encoded
+func cell(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64, bool:
+		return fmt.Sprintf("%v", value)
+	default:
+		data, _ := json.Marshal(value)
+		return string(data)
+	}
+}
+
+func writeTable(w io.Writer, rows []map[string]interface{}, cols []string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := make([]string, len(cols))
+	for i, col := range cols {
+		header[i] = strings.ToUpper(col)
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		values := make([]string, len(cols))
+		for i, col := range cols {
+			values[i] = cell(row[col])
+		}
+		fmt.Fprintln(tw, strings.Join(values, "\t"))
+	}
+	return tw.Flush()
+}
+
+func writeKeyValue(w io.Writer, rows []map[string]interface{}, cols []string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, row := range rows {
+		for _, col := range cols {
+			fmt.Fprintf(tw, "%s\t%s\n", col, cell(row[col]))
+		}
+	}
+	return tw.Flush()
+}
+
+func writeCSV(w io.Writer, rows []map[string]interface{}, cols []string) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(cols); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		values := make([]string, len(cols))
+		for i, col := range cols {
+			values[i] = cell(row[col])
+		}
+		if err := cw.Write(values); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
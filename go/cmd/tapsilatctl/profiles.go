@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/tapsilat/tapsilat-go"
+)
+
+// Profile holds the credentials for one Tapsilat account
+type Profile struct {
+	APIKey   string `json:"api_key"`
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// ProfileConfig is the on-disk profiles file
+type ProfileConfig struct {
+	Default  string             `json:"default"`
+	Profiles map[string]Profile `json:"profiles"`
+}
+
+// profilesPath returns TAPSILATCTL_CONFIG or ~/.config/tapsilatctl/profiles.json
+func profilesPath() string {
+	if path := os.Getenv("TAPSILATCTL_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = "."
+	}
+	return filepath.Join(dir, "tapsilatctl", "profiles.json")
+}
+
+func loadProfiles() (*ProfileConfig, error) {
+	cfg := &ProfileConfig{Profiles: make(map[string]Profile)}
+
+	data, err := os.ReadFile(profilesPath())
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, configErrorf("failed to read profiles: %v", err)
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, configErrorf("failed to parse profiles: %v", err)
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = make(map[string]Profile)
+	}
+	return cfg, nil
+}
+
+func saveProfiles(cfg *ProfileConfig) error {
+	path := profilesPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return configErrorf("failed to create config directory: %v", err)
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return configErrorf("failed to encode profiles: %v", err)
+	}
+	// API keys are secrets, keep the file private
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return configErrorf("failed to write profiles: %v", err)
+	}
+	return nil
+}
+
+// newAPIClient resolves the API key from the named profile, the default profile or TAPSILAT_API_KEY
+func newAPIClient(name string) (*tapsilat.API, error) {
+	cfg, err := loadProfiles()
+	if err != nil {
+		return nil, err
+	}
+
+	if name == "" {
+		name = cfg.Default
+	}
+
+	var profile Profile
+	if name != "" {
+		p, ok := cfg.Profiles[name]
+		if !ok {
+			return nil, configErrorf("unknown profile %q", name)
+		}
+		profile = p
+	}
+	if profile.APIKey == "" {
+		profile.APIKey = os.Getenv("TAPSILAT_API_KEY")
+	}
+	if profile.APIKey == "" {
+		return nil, configErrorf("no API key: add a profile or set TAPSILAT_API_KEY")
+	}
+
+	if profile.Endpoint != "" {
+		return tapsilat.NewCustomAPI(profile.Endpoint, profile.APIKey), nil
+	}
+	return tapsilat.NewAPI(profile.APIKey), nil
+}
+
+// runProfile implements "tapsilatctl profile list|add|remove|use"
+func runProfile(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return usageErrorf("usage: tapsilatctl profile list|add|remove|use")
+	}
+
+	cfg, err := loadProfiles()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		names := make([]string, 0, len(cfg.Profiles))
+		for name := range cfg.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			marker := " "
+			if name == cfg.Default {
+				marker = "*"
+			}
+			endpoint := cfg.Profiles[name].Endpoint
+			if endpoint == "" {
+				endpoint = "(default endpoint)"
+			}
+			fmt.Fprintf(out, "%s %-20s %s\n", marker, name, endpoint)
+		}
+		return nil
+
+	case "add":
+		fs := flag.NewFlagSet("profile add", flag.ContinueOnError)
+		apiKey := fs.String("api-key", "", "Tapsilat API key")
+		endpoint := fs.String("endpoint", "", "custom API endpoint")
+		makeDefault := fs.Bool("default", false, "make this the default profile")
+		positional, err := parseInterspersed(fs, args[1:])
+		if err != nil {
+			return usageErrorf("%v", err)
+		}
+		if len(positional) != 1 || *apiKey == "" {
+			return usageErrorf("usage: tapsilatctl profile add <name> -api-key KEY [-endpoint URL] [-default]")
+		}
+		name := positional[0]
+		cfg.Profiles[name] = Profile{APIKey: *apiKey, Endpoint: *endpoint}
+		if *makeDefault || cfg.Default == "" {
+			cfg.Default = name
+		}
+		if err := saveProfiles(cfg); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Profile %s saved\n", name)
+		return nil
+
+	case "remove":
+		if len(args) != 2 {
+			return usageErrorf("usage: tapsilatctl profile remove <name>")
+		}
+		if _, ok := cfg.Profiles[args[1]]; !ok {
+			return configErrorf("unknown profile %q", args[1])
+		}
+		delete(cfg.Profiles, args[1])
+		if cfg.Default == args[1] {
+			cfg.Default = ""
+		}
+		if err := saveProfiles(cfg); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Profile %s removed\n", args[1])
+		return nil
+
+	case "use":
+		if len(args) != 2 {
+			return usageErrorf("usage: tapsilatctl profile use <name>")
+		}
+		if _, ok := cfg.Profiles[args[1]]; !ok {
+			return configErrorf("unknown profile %q", args[1])
+		}
+		cfg.Default = args[1]
+		if err := saveProfiles(cfg); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Default profile is now %s\n", args[1])
+		return nil
+	}
+
+	return usageErrorf("unknown profile command %q", args[0])
+}
@@ -0,0 +1,322 @@
+package currency
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tapsilat-go-example/store"
+)
+
+// Rate converts the base currency into Currency: 1 base = Rate units of Currency
+type Rate struct {
+	Currency  string    `json:"currency"`
+	Rate      float64   `json:"rate"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Source    string    `json:"source,omitempty"`
+}
+
+// Table is the currency configuration and the FX rate table
+type Table struct {
+	Base            string          `json:"base"` // currency of catalog prices
+	Supported       []string        `json:"supported"`
+	SupportedSource string          `json:"supported_source,omitempty"` // "config" or "organization"
+	MaxAgeHours     float64         `json:"max_age_hours,omitempty"`    // rates older than this are rejected, 0 disables
+	Rates           map[string]Rate `json:"rates"`
+}
+
+// Lock is the rate an order was priced with
+type Lock struct {
+	Base     string    `json:"base"`
+	Currency string    `json:"currency"`
+	Rate     float64   `json:"rate"`
+	RateAt   time.Time `json:"rate_at"`
+	LockedAt time.Time `json:"locked_at"`
+}
+
+// Convert converts an amount in the base currency, rounded to cents
+func (l Lock) Convert(amount float64) float64 {
+	return math.Round(amount*l.Rate*100) / 100
+}
+
+// DefaultTable prices in TRY and only accepts TRY until rates are imported
+func DefaultTable() Table {
+	return Table{
+		Base:            "TRY",
+		Supported:       []string{"TRY"},
+		SupportedSource: "config",
+		Rates:           map[string]Rate{},
+	}
+}
+
+// Normalize returns the ISO 4217 form of a currency code
+func Normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Engine holds the currency table
+type Engine struct {
+	mu    sync.RWMutex
+	file  *store.JSONFile
+	table Table
+}
+
+// NewEngine loads the currency table from path, falling back to DefaultTable
+func NewEngine(path string) (*Engine, error) {
+	e := &Engine{
+		file:  store.NewJSONFile(path),
+		table: DefaultTable(),
+	}
+	if err := e.file.Load(&e.table); err != nil {
+		return nil, err
+	}
+	if e.table.Rates == nil {
+		e.table.Rates = map[string]Rate{}
+	}
+	return e, nil
+}
+
+// Table returns a copy of the currency table
+func (e *Engine) Table() Table {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	t := e.table
+	t.Supported = append([]string(nil), e.table.Supported...)
+	t.Rates = make(map[string]Rate, len(e.table.Rates))
+	for code, r := range e.table.Rates {
+		t.Rates[code] = r
+	}
+	return t
+}
+
+// Base returns the catalog currency
+func (e *Engine) Base() string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.table.Base
+}
+
+// IsSupported reports whether orders may be placed in code
+func (e *Engine) IsSupported(code string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.supportedLocked(Normalize(code))
+}
+
+func (e *Engine) supportedLocked(code string) bool {
+	return contains(e.table.Supported, code)
+}
+
+// SetSupported replaces the supported currency list. The base currency is always supported.
+func (e *Engine) SetSupported(codes []string, source string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	supported := []string{e.table.Base}
+	for _, code := range codes {
+		code = Normalize(code)
+		if len(code) != 3 {
+			return fmt.Errorf("invalid currency code %q", code)
+		}
+		if code != e.table.Base && !contains(supported, code) {
+			supported = append(supported, code)
+		}
+	}
+	sort.Strings(supported[1:])
+
+	e.table.Supported = supported
+	e.table.SupportedSource = source
+	return e.file.Save(e.table)
+}
+
+// SetBase changes the catalog currency and how old rates may be
+func (e *Engine) SetBase(base string, maxAgeHours float64) error {
+	base = Normalize(base)
+	if len(base) != 3 {
+		return fmt.Errorf("invalid currency code %q", base)
+	}
+	if maxAgeHours < 0 {
+		return fmt.Errorf("max age cannot be negative")
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if base != e.table.Base {
+		// Rates are relative to the base, they cannot be reused
+		e.table.Rates = map[string]Rate{}
+		if !contains(e.table.Supported, base) {
+			e.table.Supported = append([]string{base}, e.table.Supported...)
+		}
+	}
+	e.table.Base = base
+	e.table.MaxAgeHours = maxAgeHours
+	return e.file.Save(e.table)
+}
+
+// Import adds or replaces rates. format is "csv" (currency,rate[,updated_at]) or "json" (a list of Rate).
+// Rates without a timestamp are stamped with the import time. It returns the number of rates imported.
+func (e *Engine) Import(r io.Reader, format, source string) (int, error) {
+	var rates []Rate
+	var err error
+	switch format {
+	case "csv":
+		rates, err = parseCSV(r)
+	case "json":
+		err = json.NewDecoder(r).Decode(&rates)
+	default:
+		return 0, fmt.Errorf("unsupported import format %q", format)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	for i := range rates {
+		rates[i].Currency = Normalize(rates[i].Currency)
+		if len(rates[i].Currency) != 3 {
+			return 0, fmt.Errorf("invalid currency code %q", rates[i].Currency)
+		}
+		if rates[i].Rate <= 0 {
+			return 0, fmt.Errorf("rate for %s must be positive", rates[i].Currency)
+		}
+		if rates[i].UpdatedAt.IsZero() {
+			rates[i].UpdatedAt = now
+		}
+		if rates[i].Source == "" {
+			rates[i].Source = source
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, rate := range rates {
+		if rate.Currency == e.table.Base {
+			continue
+		}
+		// Keep the newer rate when an older file is imported again
+		if existing, ok := e.table.Rates[rate.Currency]; ok && existing.UpdatedAt.After(rate.UpdatedAt) {
+			continue
+		}
+		e.table.Rates[rate.Currency] = rate
+	}
+	return len(rates), e.file.Save(e.table)
+}
+
+func parseCSV(r io.Reader) ([]Rate, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var rates []Rate
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rates, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("line %d: expected currency,rate[,updated_at]", line)
+		}
+		value, err := strconv.ParseFloat(record[1], 64)
+		if err != nil {
+			if line == 1 {
+				continue // header
+			}
+			return nil, fmt.Errorf("line %d: invalid rate %q", line, record[1])
+		}
+		rate := Rate{Currency: record[0], Rate: value}
+		if len(record) > 2 && record[2] != "" {
+			if rate.UpdatedAt, err = time.Parse(time.RFC3339, record[2]); err != nil {
+				return nil, fmt.Errorf("line %d: updated_at must be RFC 3339", line)
+			}
+		}
+		rates = append(rates, rate)
+	}
+}
+
+// Lock checks that code is supported and returns the current rate from the base currency
+func (e *Engine) Lock(code string) (Lock, error) {
+	code = Normalize(code)
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	now := time.Now()
+	if code == "" {
+		code = e.table.Base
+	}
+	if !e.supportedLocked(code) {
+		return Lock{}, fmt.Errorf("currency %s is not supported", code)
+	}
+	if code == e.table.Base {
+		return Lock{Base: code, Currency: code, Rate: 1, RateAt: now, LockedAt: now}, nil
+	}
+
+	rate, ok := e.table.Rates[code]
+	if !ok {
+		return Lock{}, fmt.Errorf("no exchange rate for %s", code)
+	}
+	if e.table.MaxAgeHours > 0 && now.Sub(rate.UpdatedAt) > time.Duration(e.table.MaxAgeHours*float64(time.Hour)) {
+		return Lock{}, fmt.Errorf("exchange rate for %s is out of date", code)
+	}
+	return Lock{Base: e.table.Base, Currency: code, Rate: rate.Rate, RateAt: rate.UpdatedAt, LockedAt: now}, nil
+}
+
+// FromSettings extracts supported currency codes from an organization settings response.
+// It accepts lists of codes or of objects with a "code" or "currency" field.
+func FromSettings(settings interface{}) []string {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+	if nested, ok := fields["data"].(map[string]interface{}); ok {
+		fields = nested
+	}
+
+	var codes []string
+	for _, key := range []string{"currencies", "supported_currencies", "allowed_currencies"} {
+		list, ok := fields[key].([]interface{})
+		if !ok {
+			continue
+		}
+		for _, item := range list {
+			switch v := item.(type) {
+			case string:
+				codes = append(codes, Normalize(v))
+			case map[string]interface{}:
+				for _, k := range []string{"code", "currency"} {
+					if s, ok := v[k].(string); ok && s != "" {
+						codes = append(codes, Normalize(s))
+						break
+					}
+				}
+			}
+		}
+	}
+	return codes
+}
+
+func contains(list []string, code string) bool {
+	for _, s := range list {
+		if s == code {
+			return true
+		}
+	}
+	return false
+}
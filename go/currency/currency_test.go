@@ -0,0 +1,148 @@
+package currency
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newEngine(t *testing.T) *Engine {
+	t.Helper()
+	e, err := NewEngine(filepath.Join(t.TempDir(), "currency.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestImportCSV(t *testing.T) {
+	e := newEngine(t)
+	csv := "currency,rate,updated_at\n" +
+		"usd,0.031,2026-01-02T10:00:00Z\n" +
+		"EUR, 0.028\n" +
+		"TRY,1\n"
+	n, err := e.Import(strings.NewReader(csv), "csv", "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("imported %d rates, want 3", n)
+	}
+
+	rates := e.Table().Rates
+	if _, ok := rates["TRY"]; ok {
+		t.Error("the base currency got a rate")
+	}
+	usd := rates["USD"]
+	if usd.Rate != 0.031 || usd.Source != "upload" || !usd.UpdatedAt.Equal(time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("USD = %+v", usd)
+	}
+	if rates["EUR"].UpdatedAt.IsZero() {
+		t.Error("EUR was not stamped with the import time")
+	}
+
+	// An older file does not replace a newer rate
+	if _, err := e.Import(strings.NewReader("USD,0.05,2025-01-01T00:00:00Z\n"), "csv", "upload"); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.Table().Rates["USD"].Rate; got != 0.031 {
+		t.Errorf("USD rate = %v after importing an older one", got)
+	}
+}
+
+func TestImportRejects(t *testing.T) {
+	tests := []struct {
+		format, data string
+	}{
+		{"csv", "USD\n"},
+		{"csv", "USD,0.03\nEUR,abc\n"},
+		{"csv", "USD,0.03,yesterday\n"},
+		{"csv", "DOLLAR,0.03\n"},
+		{"json", `[{"currency":"USD","rate":0}]`},
+		{"xml", "<rates/>"},
+	}
+	for _, tt := range tests {
+		if _, err := newEngine(t).Import(strings.NewReader(tt.data), tt.format, "upload"); err == nil {
+			t.Errorf("Import(%s, %q) succeeded", tt.format, tt.data)
+		}
+	}
+}
+
+func TestLock(t *testing.T) {
+	e := newEngine(t)
+	if err := e.SetSupported([]string{"usd", "eur", "gbp"}, "config"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.SetBase("TRY", 24); err != nil {
+		t.Fatal(err)
+	}
+	rates := `[{"currency":"USD","rate":0.03},{"currency":"EUR","rate":0.02,"updated_at":"2020-01-01T00:00:00Z"}]`
+	if _, err := e.Import(strings.NewReader(rates), "json", "upload"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		code    string
+		rate    float64
+		wantErr bool
+	}{
+		{"", 1, false},
+		{"try", 1, false},
+		{" usd ", 0.03, false},
+		{"EUR", 0, true}, // out of date
+		{"GBP", 0, true}, // no rate
+		{"JPY", 0, true}, // not supported
+	}
+	for _, tt := range tests {
+		lock, err := e.Lock(tt.code)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Lock(%q): err = %v, want error %v", tt.code, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (lock.Rate != tt.rate || lock.Base != "TRY") {
+			t.Errorf("Lock(%q) = %+v", tt.code, lock)
+		}
+	}
+
+	lock, _ := e.Lock("USD")
+	if got := lock.Convert(1234.56); got != 37.04 {
+		t.Errorf("Convert = %v, want 37.04", got)
+	}
+}
+
+func TestSetBaseDropsRates(t *testing.T) {
+	e := newEngine(t)
+	e.SetSupported([]string{"USD"}, "config")
+	e.Import(strings.NewReader("USD,0.03\n"), "csv", "upload")
+
+	if err := e.SetBase("usd", 0); err != nil {
+		t.Fatal(err)
+	}
+	table := e.Table()
+	if table.Base != "USD" || len(table.Rates) != 0 {
+		t.Errorf("table = %+v, want base USD without rates", table)
+	}
+	if !e.IsSupported("try") {
+		t.Error("the old base is no longer supported")
+	}
+}
+
+func TestFromSettings(t *testing.T) {
+	tests := []struct {
+		settings interface{}
+		want     []string
+	}{
+		{map[string]interface{}{"currencies": []string{"try", "usd"}}, []string{"TRY", "USD"}},
+		{map[string]interface{}{"data": map[string]interface{}{
+			"supported_currencies": []map[string]string{{"code": "eur"}, {"currency": "gbp"}},
+		}}, []string{"EUR", "GBP"}},
+		{map[string]interface{}{"name": "shop"}, nil},
+	}
+	for _, tt := range tests {
+		got := FromSettings(tt.settings)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("FromSettings(%v) = %v, want %v", tt.settings, got, tt.want)
+		}
+	}
+}
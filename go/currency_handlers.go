@@ -0,0 +1,127 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"tapsilat-go-example/cart"
+	"tapsilat-go-example/currency"
+
+	"github.com/gin-gonic/gin"
+)
+
+// priceCart converts the cart into its currency with the current exchange rate and prices it.
+// The returned lock is the rate the prices were converted with.
+func priceCart(c cart.Cart) (cart.Totals, currency.Lock, error) {
+	lock, err := fxEngine.Lock(c.Currency)
+	if err != nil {
+		return cart.Totals{}, currency.Lock{}, err
+	}
+
+	c.Currency = lock.Currency
+	c.Rate = lock.Rate
+	lines := make([]cart.Line, len(c.Lines))
+	for i, line := range c.Lines {
+		// A catalog price in the cart currency wins over a converted one
+		if price, ok := line.Prices[lock.Currency]; ok {
+			line.Price = price
+		} else {
+			line.Price = lock.Convert(line.Price)
+		}
+		lines[i] = line
+	}
+	c.Lines = lines
+
+	totals, err := cart.Calculate(c, cartPricers...)
+	return totals, lock, err
+}
+
+// listCurrenciesHandler returns the catalog currency and the currencies orders can be placed in
+func listCurrenciesHandler(c *gin.Context) {
+	table := fxEngine.Table()
+	c.JSON(http.StatusOK, gin.H{
+		"base":      table.Base,
+		"supported": table.Supported,
+	})
+}
+
+// getCurrencyTableHandler returns the currency configuration and exchange rates
+func getCurrencyTableHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, fxEngine.Table())
+}
+
+// updateCurrencyTableHandler changes the base currency, rate max age and supported currencies
+func updateCurrencyTableHandler(c *gin.Context) {
+	var req struct {
+		Base        string   `json:"base" binding:"required"`
+		MaxAgeHours float64  `json:"max_age_hours"`
+		Supported   []string `json:"supported"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := fxEngine.SetBase(req.Base, req.MaxAgeHours); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Supported != nil {
+		if err := fxEngine.SetSupported(req.Supported, "config"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, fxEngine.Table())
+}
+
+// importRatesHandler imports exchange rates as CSV (text/csv) or JSON
+func importRatesHandler(c *gin.Context) {
+	format := c.Query("format")
+	if format == "" {
+		format = "json"
+		if mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type")); strings.HasSuffix(mediaType, "csv") {
+			format = "csv"
+		}
+	}
+
+	source := c.Query("source")
+	if source == "" {
+		source = "import"
+	}
+
+	count, err := fxEngine.Import(c.Request.Body, format, source)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"imported": count, "table": fxEngine.Table()})
+}
+
+// syncCurrenciesHandler takes the supported currencies from the organization settings
+func syncCurrenciesHandler(c *gin.Context) {
+	apiClient, err := getAPIClient()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	settings, err := apiClient.GetOrganizationSettings(c.Request.Context())
+	if err != nil {
+		utilsInstance.LogError("Failed to get organization settings", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get organization settings"})
+		return
+	}
+
+	codes := currency.FromSettings(settings)
+	if len(codes) == 0 {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Organization settings do not list any currencies"})
+		return
+	}
+	if err := fxEngine.SetSupported(codes, "organization"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, fxEngine.Table())
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"tapsilat-go-example/customers"
+	"tapsilat-go-example/orders"
+	"tapsilat-go-example/validation"
+
+	"github.com/gin-gonic/gin"
+)
+
+// orderBuyer returns the stable buyer id of an order's customer, creating the customer on
+// first use, and whether the order may add to the customer's address book. An existing
+// customer is matched on an email or phone the buyer has not proven, so only a new customer,
+// or one proven by the X-Customer-Token header, gets the order's addresses.
+func orderBuyer(c *gin.Context, email, phone, name string) (string, bool) {
+	if existing, ok := customerStore.Find(email, phone); ok {
+		return existing.ID, cartCustomer(c) == existing.ID
+	}
+	customer, _, err := customerStore.Resolve(email, phone, name)
+	if err != nil {
+		utilsInstance.LogError("Failed to resolve customer", map[string]interface{}{
+			"email": email,
+			"error": err.Error(),
+		})
+		return generateBuyerID(), false
+	}
+	return customer.ID, true
+}
+
+// rememberOrderAddresses adds the billing and shipping addresses of an order to the address book
+func rememberOrderAddresses(customerID string, req OrderRequest) {
+	entries := []struct {
+		address Address
+		kind    customers.Kind
+	}{
+		{req.Billing, customers.KindBilling},
+		{orderShippingAddress(req), customers.KindShipping},
+	}
+	for _, e := range entries {
+		if err := customerStore.Remember(customerID, addressBookEntry(e.address), e.kind); err != nil {
+			utilsInstance.LogError("Failed to remember customer address", map[string]interface{}{
+				"customer_id": customerID,
+				"error":       err.Error(),
+			})
+		}
+	}
+}
+
+// addressBookEntry converts an order address into an address book entry
+func addressBookEntry(a Address) customers.Address {
+	country := a.Country
+	if code, err := validation.Country(country); err == nil {
+		country = validation.CountryName(code)
+	}
+	return customers.Address{
+		ContactName: a.ContactName,
+		Phone:       a.ContactPhone,
+		Address:     a.Address,
+		City:        a.City,
+		Country:     country,
+		ZipCode:     a.ZipCode,
+		VatNumber:   a.VatNumber,
+	}
+}
+
+// orderAddress converts an address book entry into an order address
+func orderAddress(customer customers.Customer, a customers.Address) Address {
+	phone := a.Phone
+	if phone == "" {
+		phone = customer.Phone
+	}
+	return Address{
+		ContactName:  a.ContactName,
+		Email:        customer.Email,
+		ContactPhone: phone,
+		Address:      a.Address,
+		City:         a.City,
+		Country:      a.Country,
+		ZipCode:      a.ZipCode,
+		VatNumber:    a.VatNumber,
+	}
+}
+
+// requireCustomerToken only lets a request through when its X-Customer-Token proves the
+// customer of :id, so nobody can read another customer's data or pay with their cards
+func requireCustomerToken(c *gin.Context) {
+	if customerID := cartCustomer(c); customerID == "" || customerID != c.Param("id") {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "A valid " + customerHeader + " for this customer is required"})
+		return
+	}
+	c.Next()
+}
+
+// listCustomersHandler lists customers, optionally filtered by ?q=
+func listCustomersHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, customerStore.List(c.Query("q")))
+}
+
+// resolveCustomerHandler finds a customer by email or phone, creating one if needed
+func resolveCustomerHandler(c *gin.Context) {
+	var req struct {
+		Email string `json:"email"`
+		Phone string `json:"phone"`
+		Name  string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	customer, created, err := customerStore.Resolve(req.Email, req.Phone, req.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, customer)
+}
+
+// getCustomerHandler returns a customer with the address book
+func getCustomerHandler(c *gin.Context) {
+	customer, ok := customerStore.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		return
+	}
+	c.JSON(http.StatusOK, customer)
+}
+
+// customerOrdersHandler lists a customer's orders from Tapsilat (by buyer id) and the local records
+func customerOrdersHandler(c *gin.Context) {
+	customer, ok := customerStore.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		return
+	}
+
+	local := make([]orders.Record, 0)
+	for _, rec := range orderStore.List() {
+		// Orders created before the customer registry only have the email
+		if rec.CustomerID == customer.ID ||
+			(rec.CustomerID == "" && customer.Email != "" && strings.EqualFold(rec.BuyerEmail, customer.Email)) {
+			local = append(local, rec)
+		}
+	}
+	response := gin.H{
+		"customer":     customer,
+		"local_orders": local,
+	}
+
+	apiClient, err := getAPIClient()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	gateway, err := apiClient.GetOrders(c.Request.Context(), c.DefaultQuery("page", "1"), c.DefaultQuery("per_page", "10"), customer.ID)
+	if err != nil {
+		// The local records are still useful when the gateway is unavailable
+		utilsInstance.LogError("Failed to get customer orders", err.Error())
+		response["gateway_error"] = err.Error()
+	} else {
+		response["orders"] = gateway
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// saveCustomerAddressHandler adds or replaces an address book entry
+func saveCustomerAddressHandler(c *gin.Context) {
+	var req customers.Address
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, ok := customerStore.Get(c.Param("id")); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		return
+	}
+	saved, err := customerStore.SaveAddress(c.Param("id"), req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, saved)
+}
+
+// deleteCustomerAddressHandler removes an address book entry
+func deleteCustomerAddressHandler(c *gin.Context) {
+	if err := customerStore.DeleteAddress(c.Param("id"), c.Param("address_id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
@@ -0,0 +1,265 @@
+package customers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Card is a stored card token as reported by the gateway in payment details. Only the
+// token and the masked number are kept, never the card number itself.
+type Card struct {
+	ID             string    `json:"id"` // gateway card token, sent as card_id
+	MaskedPAN      string    `json:"masked_pan"`
+	Brand          string    `json:"brand,omitempty"`
+	ExpMonth       int       `json:"exp_month"`
+	ExpYear        int       `json:"exp_year"`
+	Label          string    `json:"label,omitempty"` // e.g. personal, company
+	Default        bool      `json:"default"`
+	CreatedAt      time.Time `json:"created_at"`
+	LastUsedAt     time.Time `json:"last_used_at,omitempty"`
+	ExpiryWarnedAt time.Time `json:"expiry_warned_at,omitempty"`
+}
+
+// ExpiresAt returns the first moment the card is no longer valid. Cards are valid through
+// the last day of their expiry month; a card without an expiry never expires.
+func (c Card) ExpiresAt() time.Time {
+	if c.ExpYear == 0 || c.ExpMonth < 1 || c.ExpMonth > 12 {
+		return time.Time{}
+	}
+	return time.Date(c.ExpYear, time.Month(c.ExpMonth)+1, 1, 0, 0, 0, 0, time.Local)
+}
+
+// Expired reports whether the card has expired at now
+func (c Card) Expired(now time.Time) bool {
+	expires := c.ExpiresAt()
+	return !expires.IsZero() && !now.Before(expires)
+}
+
+// ExpiringCard is a card that expires soon, with the customer to warn
+type ExpiringCard struct {
+	CustomerID string `json:"customer_id"`
+	Email      string `json:"email"`
+	Card       Card   `json:"card"`
+}
+
+// SaveCard adds a card reported by the gateway, or refreshes the one with the same token.
+// Label and default are kept; the first usable card becomes the default.
+func (r *Registry) SaveCard(customerID string, card Card, now time.Time) (Card, error) {
+	card.ID = strings.TrimSpace(card.ID)
+	if card.ID == "" {
+		return Card{}, fmt.Errorf("card token is required")
+	}
+	if card.ExpYear > 0 && card.ExpYear < 100 {
+		card.ExpYear += 2000
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.customers[customerID]
+	if !ok {
+		return Card{}, fmt.Errorf("customer %s not found", customerID)
+	}
+	i := cardIndex(c, card.ID)
+	if i < 0 {
+		card.Label = strings.TrimSpace(card.Label)
+		card.Default = false
+		card.CreatedAt = now
+		card.ExpiryWarnedAt = time.Time{}
+		c.Cards = append(c.Cards, card)
+		i = len(c.Cards) - 1
+	} else {
+		existing := &c.Cards[i]
+		if card.MaskedPAN != "" {
+			existing.MaskedPAN = card.MaskedPAN
+		}
+		if card.Brand != "" {
+			existing.Brand = card.Brand
+		}
+		// A renewed card keeps its token but gets a new expiry
+		if card.ExpYear != 0 && (card.ExpYear != existing.ExpYear || card.ExpMonth != existing.ExpMonth) {
+			existing.ExpMonth = card.ExpMonth
+			existing.ExpYear = card.ExpYear
+			existing.ExpiryWarnedAt = time.Time{}
+		}
+	}
+	c.Cards[i].LastUsedAt = now
+	if _, hasDefault := defaultCard(c, now); !hasDefault && !c.Cards[i].Expired(now) {
+		setDefaultCard(c, card.ID)
+	}
+	c.UpdatedAt = now
+	if err := r.file.Save(r.customers); err != nil {
+		return Card{}, err
+	}
+	return c.Cards[i], nil
+}
+
+// Cards returns the cards of a customer, the default first
+func (r *Registry) Cards(customerID string) ([]Card, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c, ok := r.customers[customerID]
+	if !ok {
+		return nil, fmt.Errorf("customer %s not found", customerID)
+	}
+	cards := append([]Card{}, c.Cards...)
+	sort.SliceStable(cards, func(i, j int) bool { return cards[i].Default && !cards[j].Default })
+	return cards, nil
+}
+
+// Card returns a card of a customer
+func (r *Registry) Card(customerID, cardID string) (Card, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c, ok := r.customers[customerID]
+	if !ok {
+		return Card{}, false
+	}
+	if i := cardIndex(c, cardID); i >= 0 {
+		return c.Cards[i], true
+	}
+	return Card{}, false
+}
+
+// DefaultCard returns the default card of a customer unless it has expired
+func (r *Registry) DefaultCard(customerID string, now time.Time) (Card, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c, ok := r.customers[customerID]
+	if !ok {
+		return Card{}, false
+	}
+	return defaultCard(c, now)
+}
+
+// LabelCard sets the label of a card
+func (r *Registry) LabelCard(customerID, cardID, label string) (Card, error) {
+	return r.updateCard(customerID, cardID, func(c *Customer, i int) error {
+		c.Cards[i].Label = strings.TrimSpace(label)
+		return nil
+	})
+}
+
+// SetDefaultCard makes a card the default of its customer
+func (r *Registry) SetDefaultCard(customerID, cardID string, now time.Time) (Card, error) {
+	return r.updateCard(customerID, cardID, func(c *Customer, i int) error {
+		if c.Cards[i].Expired(now) {
+			return fmt.Errorf("card %s has expired", cardID)
+		}
+		setDefaultCard(c, cardID)
+		return nil
+	})
+}
+
+// MarkCardWarned records that the customer was told the card expires soon
+func (r *Registry) MarkCardWarned(customerID, cardID string, now time.Time) error {
+	_, err := r.updateCard(customerID, cardID, func(c *Customer, i int) error {
+		c.Cards[i].ExpiryWarnedAt = now
+		return nil
+	})
+	return err
+}
+
+// DeleteCard forgets a card. When it was the default, the most recently used card that
+// has not expired takes over.
+func (r *Registry) DeleteCard(customerID, cardID string, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.customers[customerID]
+	if !ok {
+		return fmt.Errorf("customer %s not found", customerID)
+	}
+	i := cardIndex(c, cardID)
+	if i < 0 {
+		return fmt.Errorf("card %s not found", cardID)
+	}
+	wasDefault := c.Cards[i].Default
+	c.Cards = append(c.Cards[:i], c.Cards[i+1:]...)
+	if wasDefault {
+		var next *Card
+		for j := range c.Cards {
+			if !c.Cards[j].Expired(now) && (next == nil || c.Cards[j].LastUsedAt.After(next.LastUsedAt)) {
+				next = &c.Cards[j]
+			}
+		}
+		if next != nil {
+			setDefaultCard(c, next.ID)
+		}
+	}
+	c.UpdatedAt = now
+	return r.file.Save(r.customers)
+}
+
+// ExpiringCards returns the cards that expire within the given number of days from now
+// and whose customer has not been warned yet
+func (r *Registry) ExpiringCards(now time.Time, withinDays int) []ExpiringCard {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	limit := now.AddDate(0, 0, withinDays)
+	var list []ExpiringCard
+	for _, c := range r.customers {
+		for _, card := range c.Cards {
+			expires := card.ExpiresAt()
+			if expires.IsZero() || card.Expired(now) || expires.After(limit) || !card.ExpiryWarnedAt.IsZero() {
+				continue
+			}
+			list = append(list, ExpiringCard{CustomerID: c.ID, Email: c.Email, Card: card})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Card.ExpiresAt().Before(list[j].Card.ExpiresAt()) })
+	return list
+}
+
+// updateCard applies fn to a card and saves the registry
+func (r *Registry) updateCard(customerID, cardID string, fn func(c *Customer, i int) error) (Card, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.customers[customerID]
+	if !ok {
+		return Card{}, fmt.Errorf("customer %s not found", customerID)
+	}
+	i := cardIndex(c, cardID)
+	if i < 0 {
+		return Card{}, fmt.Errorf("card %s not found", cardID)
+	}
+	if err := fn(c, i); err != nil {
+		return Card{}, err
+	}
+	c.UpdatedAt = time.Now()
+	if err := r.file.Save(r.customers); err != nil {
+		return Card{}, err
+	}
+	return c.Cards[i], nil
+}
+
+func cardIndex(c *Customer, cardID string) int {
+	for i, card := range c.Cards {
+		if card.ID == cardID {
+			return i
+		}
+	}
+	return -1
+}
+
+func defaultCard(c *Customer, now time.Time) (Card, bool) {
+	for _, card := range c.Cards {
+		if card.Default && !card.Expired(now) {
+			return card, true
+		}
+	}
+	return Card{}, false
+}
+
+func setDefaultCard(c *Customer, cardID string) {
+	for i := range c.Cards {
+		c.Cards[i].Default = c.Cards[i].ID == cardID
+	}
+}
@@ -0,0 +1,100 @@
+package customers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCards(t *testing.T) {
+	r := newRegistry(t)
+	customer, _, err := r.Resolve("jane@example.com", "", "Jane")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 6, 15, 12, 0, 0, 0, time.Local)
+
+	saves := []struct {
+		card    Card
+		year    int
+		dflt    bool
+		expired bool
+	}{
+		// An expired card never becomes the default
+		{Card{ID: "expired", ExpMonth: 5, ExpYear: 2026}, 2026, false, true},
+		{Card{ID: "june", ExpMonth: 6, ExpYear: 26}, 2026, true, false},
+		{Card{ID: "later", ExpMonth: 12, ExpYear: 2030}, 2030, false, false},
+	}
+	for i, tt := range saves {
+		saved, err := r.SaveCard(customer.ID, tt.card, now.Add(time.Duration(i)*time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if saved.ExpYear != tt.year || saved.Default != tt.dflt || saved.Expired(now) != tt.expired {
+			t.Errorf("%s: saved %+v, expired %v", tt.card.ID, saved, saved.Expired(now))
+		}
+	}
+	if _, err := r.SaveCard(customer.ID, Card{ID: " "}, now); err == nil {
+		t.Error("SaveCard accepted a card without a token")
+	}
+
+	if cards, _ := r.Cards(customer.ID); len(cards) != 3 || cards[0].ID != "june" {
+		t.Errorf("Cards = %+v, want the default first", cards)
+	}
+	if _, err := r.SetDefaultCard(customer.ID, "expired", now); err == nil {
+		t.Error("SetDefaultCard accepted an expired card")
+	}
+	if _, err := r.SetDefaultCard(customer.ID, "later", now); err != nil {
+		t.Fatal(err)
+	}
+
+	// The most recently used card that has not expired takes over
+	r.SaveCard(customer.ID, Card{ID: "expired"}, now.Add(time.Hour))
+	if err := r.DeleteCard(customer.ID, "later", now); err != nil {
+		t.Fatal(err)
+	}
+	if card, ok := r.DefaultCard(customer.ID, now); !ok || card.ID != "june" {
+		t.Errorf("DefaultCard = %+v, %v, want june", card, ok)
+	}
+	if err := r.DeleteCard(customer.ID, "later", now); err == nil {
+		t.Error("DeleteCard removed a card twice")
+	}
+}
+
+func TestExpiringCards(t *testing.T) {
+	r := newRegistry(t)
+	customer, _, _ := r.Resolve("jane@example.com", "", "Jane")
+	now := time.Date(2026, 6, 15, 12, 0, 0, 0, time.Local)
+	for _, card := range []Card{
+		{ID: "expired", ExpMonth: 5, ExpYear: 2026},
+		{ID: "june", ExpMonth: 6, ExpYear: 2026},
+		{ID: "later", ExpMonth: 12, ExpYear: 2030},
+		{ID: "unknown"},
+	} {
+		if _, err := r.SaveCard(customer.ID, card, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expiring := r.ExpiringCards(now, 30)
+	if len(expiring) != 1 || expiring[0].Card.ID != "june" || expiring[0].Email != "jane@example.com" {
+		t.Fatalf("ExpiringCards = %+v, want june", expiring)
+	}
+	if got := r.ExpiringCards(now, 10); len(got) != 0 {
+		t.Errorf("ExpiringCards within 10 days = %+v", got)
+	}
+
+	if err := r.MarkCardWarned(customer.ID, "june", now); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.ExpiringCards(now, 30); len(got) != 0 {
+		t.Errorf("ExpiringCards after the warning = %+v", got)
+	}
+
+	// A renewed card is warned again before its new expiry
+	if _, err := r.SaveCard(customer.ID, Card{ID: "june", ExpMonth: 7, ExpYear: 2026}, now); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.ExpiringCards(now, 60); len(got) != 1 || got[0].Card.ID != "june" {
+		t.Errorf("ExpiringCards after renewal = %+v", got)
+	}
+}
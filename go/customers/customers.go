@@ -0,0 +1,295 @@
+package customers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"tapsilat-go-example/store"
+)
+
+// Address is an entry in a customer's address book
+type Address struct {
+	ID              string `json:"id"`
+	Label           string `json:"label,omitempty"` // e.g. home, office
+	ContactName     string `json:"contact_name"`
+	Phone           string `json:"phone,omitempty"`
+	Address         string `json:"address"`
+	City            string `json:"city"`
+	Country         string `json:"country,omitempty"`
+	ZipCode         string `json:"zip_code,omitempty"`
+	VatNumber       string `json:"vat_number,omitempty"`
+	DefaultBilling  bool   `json:"default_billing"`
+	DefaultShipping bool   `json:"default_shipping"`
+}
+
+// Customer is a buyer with a stable id that is sent as Buyer.Id on every order
+type Customer struct {
+	ID          string    `json:"id"`
+	Email       string    `json:"email"`
+	Phone       string    `json:"phone,omitempty"`
+	Name        string    `json:"name,omitempty"`
+	Addresses   []Address `json:"addresses,omitempty"`
+	Cards       []Card    `json:"cards,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	LastOrderAt time.Time `json:"last_order_at,omitempty"`
+}
+
+// Kind of address to remember
+type Kind string
+
+const (
+	KindBilling  Kind = "billing"
+	KindShipping Kind = "shipping"
+)
+
+// Registry keeps customers with their address books and saved cards
+type Registry struct {
+	mu        sync.RWMutex
+	file      *store.JSONFile
+	customers map[string]*Customer
+}
+
+// NewRegistry loads the registry from path
+func NewRegistry(path string) (*Registry, error) {
+	r := &Registry{
+		file:      store.NewJSONFile(path),
+		customers: make(map[string]*Customer),
+	}
+	if err := r.file.Load(&r.customers); err != nil {
+		return nil, err
+	}
+	if r.customers == nil {
+		r.customers = make(map[string]*Customer)
+	}
+	return r, nil
+}
+
+// NormalizeEmail lowercases and trims an email address
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// NormalizePhone keeps the last 10 digits, so "+90 555 123 45 67" and "05551234567" match
+func NormalizePhone(phone string) string {
+	var digits strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+	d := digits.String()
+	if len(d) > 10 {
+		d = d[len(d)-10:]
+	}
+	return d
+}
+
+// Resolve finds the customer by email, then by phone, or creates one. A customer found by
+// phone gets the email when it had none; known fields are never overwritten.
+func (r *Registry) Resolve(email, phone, name string) (Customer, bool, error) {
+	email = NormalizeEmail(email)
+	phone = NormalizePhone(phone)
+	if email == "" && phone == "" {
+		return Customer{}, false, fmt.Errorf("email or phone is required")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c := r.findLocked(email, phone)
+	created := c == nil
+	now := time.Now()
+	if created {
+		id, err := store.NewID("BUYER_")
+		if err != nil {
+			return Customer{}, false, err
+		}
+		c = &Customer{ID: id, CreatedAt: now}
+		r.customers[id] = c
+	}
+	if c.Email == "" {
+		c.Email = email
+	}
+	if c.Phone == "" {
+		c.Phone = phone
+	}
+	if c.Name == "" {
+		c.Name = strings.TrimSpace(name)
+	}
+	c.UpdatedAt = now
+	if err := r.file.Save(r.customers); err != nil {
+		return Customer{}, false, err
+	}
+	return *c, created, nil
+}
+
+// Find returns the customer with email or phone without creating one
+func (r *Registry) Find(email, phone string) (Customer, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c := r.findLocked(NormalizeEmail(email), NormalizePhone(phone))
+	if c == nil {
+		return Customer{}, false
+	}
+	return *c, true
+}
+
+func (r *Registry) findLocked(email, phone string) *Customer {
+	if email != "" {
+		for _, c := range r.customers {
+			if c.Email == email {
+				return c
+			}
+		}
+	}
+	if phone != "" {
+		for _, c := range r.customers {
+			if c.Phone == phone {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// Get returns a customer by id
+func (r *Registry) Get(id string) (Customer, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c, ok := r.customers[id]
+	if !ok {
+		return Customer{}, false
+	}
+	return *c, true
+}
+
+// List returns customers ordered by email, filtered by a case-insensitive match on email, phone or name
+func (r *Registry) List(query string) []Customer {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	query = strings.ToLower(strings.TrimSpace(query))
+	list := make([]Customer, 0, len(r.customers))
+	for _, c := range r.customers {
+		if query == "" || strings.Contains(c.Email, query) || strings.Contains(c.Phone, query) ||
+			strings.Contains(strings.ToLower(c.Name), query) {
+			list = append(list, *c)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Email < list[j].Email })
+	return list
+}
+
+// SaveAddress adds an address, or replaces the one with the same id. Setting a default
+// clears it on the other addresses.
+func (r *Registry) SaveAddress(customerID string, a Address) (Address, error) {
+	if strings.TrimSpace(a.Address) == "" || strings.TrimSpace(a.City) == "" {
+		return Address{}, fmt.Errorf("address and city are required")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.customers[customerID]
+	if !ok {
+		return Address{}, fmt.Errorf("customer %s not found", customerID)
+	}
+	a, err := saveAddress(c, a)
+	if err != nil {
+		return Address{}, err
+	}
+	c.UpdatedAt = time.Now()
+	if err := r.file.Save(r.customers); err != nil {
+		return Address{}, err
+	}
+	return a, nil
+}
+
+// Remember adds an address used on an order unless the address book already has it, and
+// makes it the default of its kind
+func (r *Registry) Remember(customerID string, a Address, kind Kind) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.customers[customerID]
+	if !ok {
+		return fmt.Errorf("customer %s not found", customerID)
+	}
+	for _, existing := range c.Addresses {
+		if sameAddress(existing, a) {
+			a = existing
+			break
+		}
+	}
+	switch kind {
+	case KindBilling:
+		a.DefaultBilling = true
+	case KindShipping:
+		a.DefaultShipping = true
+	}
+	if _, err := saveAddress(c, a); err != nil {
+		return err
+	}
+	c.LastOrderAt = time.Now()
+	c.UpdatedAt = c.LastOrderAt
+	return r.file.Save(r.customers)
+}
+
+// DeleteAddress removes an address from the address book
+func (r *Registry) DeleteAddress(customerID, addressID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.customers[customerID]
+	if !ok {
+		return fmt.Errorf("customer %s not found", customerID)
+	}
+	for i, a := range c.Addresses {
+		if a.ID == addressID {
+			c.Addresses = append(c.Addresses[:i], c.Addresses[i+1:]...)
+			c.UpdatedAt = time.Now()
+			return r.file.Save(r.customers)
+		}
+	}
+	return fmt.Errorf("address %s not found", addressID)
+}
+
+// saveAddress inserts or replaces a in the address book of c
+func saveAddress(c *Customer, a Address) (Address, error) {
+	if a.ID == "" {
+		id, err := store.NewID("ADDR_")
+		if err != nil {
+			return Address{}, err
+		}
+		a.ID = id
+	}
+	replaced := false
+	for i := range c.Addresses {
+		if a.DefaultBilling {
+			c.Addresses[i].DefaultBilling = false
+		}
+		if a.DefaultShipping {
+			c.Addresses[i].DefaultShipping = false
+		}
+		if c.Addresses[i].ID == a.ID {
+			c.Addresses[i] = a
+			replaced = true
+		}
+	}
+	if !replaced {
+		c.Addresses = append(c.Addresses, a)
+	}
+	return a, nil
+}
+
+func sameAddress(a, b Address) bool {
+	norm := func(s string) string { return strings.ToLower(strings.Join(strings.Fields(s), " ")) }
+	return norm(a.Address) == norm(b.Address) && norm(a.City) == norm(b.City) &&
+		norm(a.ZipCode) == norm(b.ZipCode) && norm(a.ContactName) == norm(b.ContactName)
+}
@@ -0,0 +1,136 @@
+package customers
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func newRegistry(t *testing.T) *Registry {
+	t.Helper()
+	r, err := NewRegistry(filepath.Join(t.TempDir(), "customers.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		raw, want string
+	}{
+		{"+90 555 123 45 67", "5551234567"},
+		{"05551234567", "5551234567"},
+		{"(555) 123-4567", "5551234567"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizePhone(tt.raw); got != tt.want {
+			t.Errorf("NormalizePhone(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	r := newRegistry(t)
+
+	first, created, err := r.Resolve(" Jane@Example.com ", "", "Jane")
+	if err != nil || !created {
+		t.Fatalf("Resolve = %+v, created %v, %v", first, created, err)
+	}
+	if first.Email != "jane@example.com" || first.Name != "Jane" {
+		t.Errorf("customer = %+v", first)
+	}
+
+	// Found by email, and the phone is added since it was unknown
+	again, created, err := r.Resolve("jane@example.com", "+90 555 123 45 67", "Someone Else")
+	if err != nil || created || again.ID != first.ID {
+		t.Fatalf("second Resolve = %+v, created %v, %v", again, created, err)
+	}
+	if again.Phone != "5551234567" || again.Name != "Jane" {
+		t.Errorf("customer = %+v, want the phone added and the name kept", again)
+	}
+
+	// Found by phone when the email is new
+	if byPhone, created, _ := r.Resolve("other@example.com", "05551234567", ""); created || byPhone.ID != first.ID {
+		t.Errorf("Resolve by phone = %+v, created %v", byPhone, created)
+	}
+
+	if _, _, err := r.Resolve(" ", "", "Nobody"); err == nil {
+		t.Error("Resolve accepted a customer without email or phone")
+	}
+	if _, ok := r.Find("nobody@example.com", ""); ok {
+		t.Error("Find matched an unknown customer")
+	}
+}
+
+func TestRemember(t *testing.T) {
+	r := newRegistry(t)
+	customer, _, err := r.Resolve("jane@example.com", "", "Jane")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	home := Address{ContactName: "Jane", Address: "Bagdat Cd. 1", City: "Istanbul"}
+	office := Address{ContactName: "Jane", Address: "Levent Plaza", City: "Istanbul"}
+	steps := []struct {
+		address Address
+		kind    Kind
+	}{
+		{home, KindBilling},
+		{home, KindShipping},
+		{office, KindBilling},
+		// The same address typed differently is not added again
+		{Address{ContactName: "jane", Address: "bagdat  cd. 1", City: "ISTANBUL"}, KindBilling},
+	}
+	for _, step := range steps {
+		if err := r.Remember(customer.ID, step.address, step.kind); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	customer, _ = r.Get(customer.ID)
+	if len(customer.Addresses) != 2 {
+		t.Fatalf("addresses = %+v, want home and office", customer.Addresses)
+	}
+	for _, a := range customer.Addresses {
+		isHome := a.Address == home.Address
+		if a.DefaultBilling != isHome || a.DefaultShipping != isHome {
+			t.Errorf("%s: default billing %v, default shipping %v", a.Address, a.DefaultBilling, a.DefaultShipping)
+		}
+	}
+	if customer.LastOrderAt.IsZero() {
+		t.Error("LastOrderAt was not set")
+	}
+
+	if err := r.Remember("BUYER_missing", home, KindBilling); err == nil {
+		t.Error("Remember accepted an unknown customer")
+	}
+}
+
+func TestSaveAndDeleteAddress(t *testing.T) {
+	r := newRegistry(t)
+	customer, _, _ := r.Resolve("jane@example.com", "", "Jane")
+
+	if _, err := r.SaveAddress(customer.ID, Address{City: "Istanbul"}); err == nil {
+		t.Error("SaveAddress accepted an address without a street")
+	}
+	saved, err := r.SaveAddress(customer.ID, Address{Label: "home", Address: "Bagdat Cd. 1", City: "Istanbul"})
+	if err != nil || saved.ID == "" {
+		t.Fatalf("SaveAddress = %+v, %v", saved, err)
+	}
+	saved.Label = "old home"
+	if _, err := r.SaveAddress(customer.ID, saved); err != nil {
+		t.Fatal(err)
+	}
+	customer, _ = r.Get(customer.ID)
+	if len(customer.Addresses) != 1 || customer.Addresses[0].Label != "old home" {
+		t.Errorf("addresses = %+v, want the address replaced", customer.Addresses)
+	}
+
+	if err := r.DeleteAddress(customer.ID, saved.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.DeleteAddress(customer.ID, saved.ID); err == nil {
+		t.Error("DeleteAddress removed an address twice")
+	}
+}
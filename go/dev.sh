@@ -157,7 +157,7 @@ run_dev() {
     go mod tidy
     print_status "Starting application..."
     print_status "Application will be available at: http://localhost:5005"
-    go run main.go
+    go run .
 }
 
 # Function to show status
@@ -0,0 +1,488 @@
+package einvoice
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tapsilat-go-example/cart"
+	"tapsilat-go-example/orders"
+	"tapsilat-go-example/store"
+
+	"github.com/google/uuid"
+)
+
+// Profiles (senaryo) of UBL-TR invoices
+const (
+	ProfileEArchive   = "EARSIVFATURA" // buyers that are not e-Fatura users, including every individual
+	ProfileBasic      = "TEMELFATURA"  // e-Fatura without an acceptance step
+	ProfileCommercial = "TICARIFATURA" // e-Fatura the buyer can accept or reject
+)
+
+// Identification schemes of Turkish parties
+const (
+	SchemeTCKN = "TCKN" // 11-digit national ID of individuals
+	SchemeVKN  = "VKN"  // 10-digit tax number of companies
+)
+
+// AnonymousTCKN is the national ID GİB accepts on e-Arşiv invoices for buyers without one
+const AnonymousTCKN = "11111111111"
+
+// KDV is the UBL-TR tax type code of value added tax
+const KDV = "0015"
+
+// Supplier is the seller issuing the invoices
+type Supplier struct {
+	ID         string // VKN, or the TCKN of a sole proprietor
+	Name       string
+	TaxOffice  string
+	Street     string
+	District   string
+	City       string
+	PostalZone string
+	Email      string
+	Phone      string
+	Website    string
+}
+
+// Config is the issuing setup
+type Config struct {
+	Supplier Supplier
+	// Series are the 3-character prefixes of invoice numbers, "EAR" and "EFT" when empty
+	EArchiveSeries string
+	EInvoiceSeries string
+	// EInvoiceProfile is used for e-Fatura users, TEMELFATURA when empty
+	EInvoiceProfile string
+	// Registered lists the tax numbers of buyers registered as e-Fatura users
+	Registered map[string]bool
+}
+
+// Issue is the invoice number assigned to an order. Numbers are never reused: exporting the
+// order again produces the same invoice.
+type Issue struct {
+	ReferenceID string    `json:"reference_id"`
+	Number      string    `json:"number"`
+	UUID        string    `json:"uuid"`
+	Profile     string    `json:"profile"`
+	BuyerID     string    `json:"buyer_id"`
+	BuyerScheme string    `json:"buyer_scheme"`
+	IssuedAt    time.Time `json:"issued_at"`
+}
+
+type state struct {
+	Sequences map[string]int   `json:"sequences"` // last number used per series and year, e.g. "EAR2026"
+	Issued    map[string]Issue `json:"issued"`    // by order reference
+}
+
+// Exporter numbers orders and exports them as UBL-TR invoices
+type Exporter struct {
+	mu    sync.Mutex
+	file  *store.JSONFile
+	cfg   Config
+	state state
+}
+
+// NewExporter loads the invoice numbering from path
+func NewExporter(path string, cfg Config) (*Exporter, error) {
+	if cfg.EArchiveSeries == "" {
+		cfg.EArchiveSeries = "EAR"
+	}
+	if cfg.EInvoiceSeries == "" {
+		cfg.EInvoiceSeries = "EFT"
+	}
+	if cfg.EInvoiceProfile == "" {
+		cfg.EInvoiceProfile = ProfileBasic
+	}
+	for _, series := range []string{cfg.EArchiveSeries, cfg.EInvoiceSeries} {
+		if !seriesPattern.MatchString(series) {
+			return nil, fmt.Errorf("invoice series %q must be 3 letters or digits", series)
+		}
+	}
+	if cfg.EInvoiceProfile != ProfileBasic && cfg.EInvoiceProfile != ProfileCommercial {
+		return nil, fmt.Errorf("e-Fatura profile must be %s or %s", ProfileBasic, ProfileCommercial)
+	}
+
+	e := &Exporter{file: store.NewJSONFile(path), cfg: cfg}
+	if err := e.file.Load(&e.state); err != nil {
+		return nil, err
+	}
+	if e.state.Sequences == nil {
+		e.state.Sequences = make(map[string]int)
+	}
+	if e.state.Issued == nil {
+		e.state.Issued = make(map[string]Issue)
+	}
+	return e, nil
+}
+
+// Issued returns the invoice number of an order, if it has one
+func (e *Exporter) Issued(referenceID string) (Issue, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	issue, ok := e.state.Issued[referenceID]
+	return issue, ok
+}
+
+// List returns the issued invoices by number
+func (e *Exporter) List() []Issue {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	list := make([]Issue, 0, len(e.state.Issued))
+	for _, issue := range e.state.Issued {
+		list = append(list, issue)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Number < list[j].Number })
+	return list
+}
+
+// Export returns the invoice of a paid order as UBL-TR XML. The first export assigns the next
+// number of the series; the number is only used up once the invoice passed Validate and
+// check, which may be nil, so failed exports leave no gaps in the sequence.
+func (e *Exporter) Export(rec orders.Record, now time.Time, check func([]byte) error) (Issue, []byte, error) {
+	if rec.Status != orders.StatusPaid && rec.Status != orders.StatusRefunded {
+		return Issue{}, nil, fmt.Errorf("order %s is %s, invoices are only issued for paid orders", rec.ReferenceID, rec.Status)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	issue, issued := e.state.Issued[rec.ReferenceID]
+	if !issued && rec.Status == orders.StatusRefunded {
+		// A sale that was refunded before it was invoiced gets no sales invoice
+		return Issue{}, nil, fmt.Errorf("order %s was refunded before it was invoiced", rec.ReferenceID)
+	}
+	var key string
+	if !issued {
+		issue, key = e.nextLocked(rec, now)
+	}
+
+	inv := Build(rec, issue, e.cfg)
+	if problems := Validate(inv); len(problems) > 0 {
+		return Issue{}, nil, problems
+	}
+	data, err := Marshal(inv)
+	if err != nil {
+		return Issue{}, nil, err
+	}
+	if check != nil {
+		if err := check(data); err != nil {
+			return Issue{}, nil, err
+		}
+	}
+
+	if !issued {
+		e.state.Sequences[key]++
+		e.state.Issued[rec.ReferenceID] = issue
+		if err := e.file.Save(e.state); err != nil {
+			e.state.Sequences[key]--
+			delete(e.state.Issued, rec.ReferenceID)
+			return Issue{}, nil, err
+		}
+	}
+	return issue, data, nil
+}
+
+// nextLocked picks the profile and the next number for an order
+func (e *Exporter) nextLocked(rec orders.Record, now time.Time) (Issue, string) {
+	vat := ""
+	if rec.BillingAddress != nil {
+		vat = rec.BillingAddress.VatNumber
+	}
+	id, scheme := BuyerID(vat)
+	profile := e.cfg.Profile(id, scheme)
+
+	series := e.cfg.EArchiveSeries
+	if profile != ProfileEArchive {
+		series = e.cfg.EInvoiceSeries
+	}
+	key := series + strconv.Itoa(now.In(istanbul).Year())
+	return Issue{
+		ReferenceID: rec.ReferenceID,
+		Number:      fmt.Sprintf("%s%09d", key, e.state.Sequences[key]+1),
+		UUID:        uuid.NewString(),
+		Profile:     profile,
+		BuyerID:     id,
+		BuyerScheme: scheme,
+		IssuedAt:    now,
+	}, key
+}
+
+// BuyerID reads the buyer identity from the billing VAT number: 10 digits is a company tax
+// number, 11 digits a national ID and anything else an anonymous individual
+func BuyerID(vat string) (id, scheme string) {
+	vat = strings.TrimSpace(vat)
+	if strings.HasPrefix(strings.ToUpper(vat), "TR") {
+		vat = vat[2:]
+	}
+	if !digits(vat) {
+		return AnonymousTCKN, SchemeTCKN
+	}
+	switch len(vat) {
+	case 10:
+		return vat, SchemeVKN
+	case 11:
+		return vat, SchemeTCKN
+	}
+	return AnonymousTCKN, SchemeTCKN
+}
+
+// Profile selects the scenario: companies registered as e-Fatura users get an e-Fatura,
+// everyone else an e-Arşiv invoice
+func (c Config) Profile(id, scheme string) string {
+	if scheme == SchemeVKN && c.Registered[id] {
+		return c.EInvoiceProfile
+	}
+	return ProfileEArchive
+}
+
+// Build maps an order to a UBL-TR invoice with the given number. Prices are split into net
+// amounts and KDV per line; shipping is added as an untaxed line, as it is charged on orders.
+func Build(rec orders.Record, issue Issue, cfg Config) *Invoice {
+	currency := rec.Currency
+	if currency == "" {
+		currency = "TRY"
+	}
+	local := issue.IssuedAt.In(istanbul)
+	inv := &Invoice{
+		Xmlns:                nsInvoice,
+		XmlnsCac:             nsCac,
+		XmlnsCbc:             nsCbc,
+		XmlnsExt:             nsExt,
+		UBLVersionID:         "2.1",
+		CustomizationID:      "TR1.2",
+		ProfileID:            issue.Profile,
+		ID:                   issue.Number,
+		UUID:                 issue.UUID,
+		IssueDate:            local.Format("2006-01-02"),
+		IssueTime:            local.Format("15:04:05"),
+		InvoiceTypeCode:      "SATIS",
+		DocumentCurrencyCode: currency,
+		OrderReference: &DocumentReference{
+			ID:        rec.ReferenceID,
+			IssueDate: rec.CreatedAt.In(istanbul).Format("2006-01-02"),
+		},
+	}
+	if issue.Profile == ProfileEArchive {
+		// Internet sales are delivered electronically
+		inv.AdditionalDocuments = append(inv.AdditionalDocuments, DocumentReference{
+			ID:               "ELEKTRONIK",
+			IssueDate:        inv.IssueDate,
+			DocumentTypeCode: "gonderimSekli",
+		})
+	}
+
+	supplier := supplierParty(cfg.Supplier)
+	inv.Signature.ID = SchemedID{SchemeID: "VKN_TCKN", Value: cfg.Supplier.ID}
+	inv.Signature.SignatoryParty = Party{
+		Identifications: supplier.Identifications,
+		PostalAddress:   supplier.PostalAddress,
+	}
+	inv.Signature.Attachment.URI = "#Signature_" + issue.Number
+	inv.Supplier.Party = supplier
+	inv.Customer.Party = customerParty(rec, issue)
+
+	paidAt := rec.PaidAt()
+	if paidAt.IsZero() {
+		paidAt = rec.CreatedAt
+	}
+	inv.PaymentMeans = &PaymentMeans{Code: "48", DueDate: paidAt.In(istanbul).Format("2006-01-02")} // bank card
+	if currency != "TRY" && rec.FXBase == "TRY" && rec.FXRate > 0 {
+		inv.PricingExchangeRate = &ExchangeRate{
+			SourceCurrencyCode: currency,
+			TargetCurrencyCode: "TRY",
+			CalculationRate:    strconv.FormatFloat(1/rec.FXRate, 'f', 6, 64),
+			Date:               rec.FXRateAt.In(istanbul).Format("2006-01-02"),
+		}
+	}
+
+	var lineTotal, taxTotal float64
+	byRate := make(map[float64]*[2]float64) // net and tax per KDV rate
+	addLine := func(name, sellerID string, qty int, before, net, tax, rate float64) {
+		line := InvoiceLine{
+			ID:                  strconv.Itoa(len(inv.Lines) + 1),
+			InvoicedQuantity:    Quantity{UnitCode: "C62", Value: strconv.Itoa(qty)}, // C62: piece
+			LineExtensionAmount: money(net, currency),
+			TaxTotal: TaxTotal{
+				TaxAmount: money(tax, currency),
+				Subtotals: []TaxSubtotal{taxSubtotal(net, tax, rate, currency)},
+			},
+			Item:  Item{Name: name},
+			Price: unitPrice(before/float64(qty), currency),
+		}
+		if sellerID != "" {
+			line.Item.SellerID = &ItemIdentification{ID: sellerID}
+		}
+		if discount := cart.Round(before - net); discount > 0 {
+			base := money(before, currency)
+			line.AllowanceCharges = []AllowanceCharge{{
+				Reason:     "İskonto",
+				Amount:     money(discount, currency),
+				BaseAmount: &base,
+			}}
+		}
+		inv.Lines = append(inv.Lines, line)
+
+		lineTotal += net
+		taxTotal += tax
+		if byRate[rate] == nil {
+			byRate[rate] = &[2]float64{}
+		}
+		byRate[rate][0] += net
+		byRate[rate][1] += tax
+	}
+
+	for _, l := range rec.Lines {
+		qty := l.Quantity
+		if qty <= 0 {
+			qty = 1
+		}
+		// Amount is the gross or the net line total depending on how the order was priced
+		net := cart.Round(l.Amount - l.Discount)
+		before := l.Amount
+		if rec.TaxIncluded {
+			net = cart.Round(net - l.Tax)
+			before = net
+			if l.Discount > 0 {
+				before = cart.Round(l.Amount * 100 / (100 + l.TaxRate))
+			}
+		}
+		addLine(l.Name, strconv.Itoa(l.ProductID), qty, before, net, l.Tax, l.TaxRate)
+	}
+	if rec.Shipping > 0 {
+		name := "Kargo"
+		if rec.ShippingMethod != "" {
+			name += " (" + rec.ShippingMethod + ")"
+		}
+		addLine(name, "", 1, rec.Shipping, rec.Shipping, 0, 0)
+	}
+	inv.LineCountNumeric = len(inv.Lines)
+
+	rates := make([]float64, 0, len(byRate))
+	for rate := range byRate {
+		rates = append(rates, rate)
+	}
+	sort.Float64s(rates)
+	inv.TaxTotal.TaxAmount = money(taxTotal, currency)
+	for _, rate := range rates {
+		sums := byRate[rate]
+		inv.TaxTotal.Subtotals = append(inv.TaxTotal.Subtotals, taxSubtotal(sums[0], sums[1], rate, currency))
+	}
+
+	lineTotal = cart.Round(lineTotal)
+	inclusive := cart.Round(lineTotal + taxTotal)
+	payable := cart.Round(rec.Amount)
+	inv.LegalMonetaryTotal = MonetaryTotal{
+		LineExtensionAmount: money(lineTotal, currency),
+		TaxExclusiveAmount:  money(lineTotal, currency),
+		TaxInclusiveAmount:  money(inclusive, currency),
+		PayableAmount:       money(payable, currency),
+	}
+	// Cents lost to per-line rounding, so the payable amount is what the buyer was charged
+	if rounding := cart.Round(payable - inclusive); rounding != 0 {
+		a := money(rounding, currency)
+		inv.LegalMonetaryTotal.PayableRoundingAmount = &a
+	}
+	return inv
+}
+
+func supplierParty(s Supplier) Party {
+	scheme := SchemeVKN
+	if len(s.ID) == 11 {
+		scheme = SchemeTCKN
+	}
+	p := Party{
+		WebsiteURI:      s.Website,
+		Identifications: []Identification{{ID: SchemedID{SchemeID: scheme, Value: s.ID}}},
+		Name:            &PartyName{Name: s.Name},
+		PostalAddress: Address{
+			StreetName:          s.Street,
+			CitySubdivisionName: s.District,
+			CityName:            s.City,
+			PostalZone:          s.PostalZone,
+			Country:             "Türkiye",
+		},
+		TaxScheme: &PartyTaxScheme{TaxScheme: TaxScheme{Name: s.TaxOffice}},
+	}
+	if s.Email != "" || s.Phone != "" {
+		p.Contact = &Contact{Telephone: s.Phone, ElectronicMail: s.Email}
+	}
+	return p
+}
+
+// customerParty describes the buyer from the billing address: companies by name, individuals
+// as a person. The address has no district, so the city centre is used.
+func customerParty(rec orders.Record, issue Issue) Party {
+	a := rec.BillingAddress
+	if a == nil {
+		a = &orders.Address{Email: rec.BuyerEmail}
+	}
+	p := Party{
+		Identifications: []Identification{{ID: SchemedID{SchemeID: issue.BuyerScheme, Value: issue.BuyerID}}},
+		PostalAddress: Address{
+			StreetName:          a.Address,
+			CitySubdivisionName: "Merkez",
+			CityName:            a.City,
+			PostalZone:          a.ZipCode,
+			Country:             "Türkiye",
+		},
+	}
+	if a.Email != "" || a.Phone != "" {
+		p.Contact = &Contact{Telephone: a.Phone, ElectronicMail: a.Email}
+	}
+	if issue.BuyerScheme == SchemeVKN {
+		p.Name = &PartyName{Name: a.ContactName}
+		return p
+	}
+	first, family := splitName(a.ContactName)
+	p.Person = &Person{FirstName: first, FamilyName: family}
+	return p
+}
+
+func taxSubtotal(net, tax, rate float64, currency string) TaxSubtotal {
+	sub := TaxSubtotal{
+		TaxableAmount: money(net, currency),
+		TaxAmount:     money(tax, currency),
+		Percent:       percent(rate),
+		TaxCategory:   TaxCategory{TaxScheme: TaxScheme{Name: "KDV", TaxTypeCode: KDV}},
+	}
+	if rate == 0 {
+		sub.TaxCategory.ExemptionReasonCode = "351"
+		sub.TaxCategory.ExemptionReason = "KDV - İstisna Olmayan Diğer"
+	}
+	return sub
+}
+
+// splitName takes the last word as the family name
+func splitName(name string) (first, family string) {
+	fields := strings.Fields(name)
+	if len(fields) < 2 {
+		return strings.Join(fields, " "), ""
+	}
+	return strings.Join(fields[:len(fields)-1], " "), fields[len(fields)-1]
+}
+
+func digits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Invoice dates are local to Türkiye
+var istanbul = func() *time.Location {
+	loc, err := time.LoadLocation("Europe/Istanbul")
+	if err != nil {
+		return time.FixedZone("TRT", 3*60*60)
+	}
+	return loc
+}()
@@ -0,0 +1,241 @@
+package einvoice
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"tapsilat-go-example/orders"
+)
+
+func testConfig() Config {
+	return Config{
+		Supplier: Supplier{
+			ID:        "1234567890",
+			Name:      "Örnek Ticaret A.Ş.",
+			TaxOffice: "Kadıköy",
+			Street:    "Bağdat Cd. 1",
+			District:  "Kadıköy",
+			City:      "İstanbul",
+		},
+		Registered: map[string]bool{"4840847211": true},
+	}
+}
+
+// paidOrder is a tax-inclusive order of two items at 20% KDV plus shipping
+func paidOrder(ref, vat string) orders.Record {
+	return orders.Record{
+		ReferenceID: ref,
+		Status:      orders.StatusPaid,
+		Amount:      149.90,
+		TaxIncluded: true,
+		Currency:    "TRY",
+		Lines: []orders.Line{
+			{ProductID: 1, Name: "Premium Widget", Quantity: 2, UnitPrice: 60, Amount: 120, TaxRate: 20, Tax: 20},
+		},
+		Shipping:       29.90,
+		ShippingMethod: "standard",
+		BillingAddress: &orders.Address{
+			ContactName: "Ayşe Yılmaz",
+			Address:     "Moda Cd. 5",
+			City:        "İstanbul",
+			VatNumber:   vat,
+		},
+		CreatedAt: time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC),
+	}
+}
+
+func newExporter(t *testing.T) *Exporter {
+	t.Helper()
+	e, err := NewExporter(filepath.Join(t.TempDir(), "einvoices.json"), testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestExportNumbering(t *testing.T) {
+	march := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	// 22:00 UTC on New Year's Eve is already the next year in Istanbul
+	newYear := time.Date(2026, 12, 31, 22, 0, 0, 0, time.UTC)
+
+	e := newExporter(t)
+	steps := []struct {
+		rec     orders.Record
+		now     time.Time
+		number  string
+		profile string
+	}{
+		{paidOrder("ORDER-1", "12345678950"), march, "EAR2026000000001", ProfileEArchive},
+		{paidOrder("ORDER-2", ""), march, "EAR2026000000002", ProfileEArchive},
+		{paidOrder("ORDER-3", "4840847211"), march, "EFT2026000000001", ProfileBasic},
+		{paidOrder("ORDER-4", "3230512384"), march, "EAR2026000000003", ProfileEArchive},    // not an e-Fatura user
+		{paidOrder("ORDER-1", "12345678950"), newYear, "EAR2026000000001", ProfileEArchive}, // exported again
+		{paidOrder("ORDER-5", ""), newYear, "EAR2027000000001", ProfileEArchive},
+	}
+	for _, s := range steps {
+		issue, data, err := e.Export(s.rec, s.now, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", s.rec.ReferenceID, err)
+		}
+		if issue.Number != s.number || issue.Profile != s.profile {
+			t.Errorf("%s: got %s %s, want %s %s", s.rec.ReferenceID, issue.Number, issue.Profile, s.number, s.profile)
+		}
+		if !strings.Contains(string(data), "<cbc:ID>"+s.number+"</cbc:ID>") {
+			t.Errorf("%s: invoice XML does not carry number %s", s.rec.ReferenceID, s.number)
+		}
+	}
+}
+
+func TestExportKeepsNumbersAcrossRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "einvoices.json")
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	for i, ref := range []string{"ORDER-1", "ORDER-2"} {
+		e, err := NewExporter(path, testConfig())
+		if err != nil {
+			t.Fatal(err)
+		}
+		issue, _, err := e.Export(paidOrder(ref, ""), now, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"EAR2026000000001", "EAR2026000000002"}[i]; issue.Number != want {
+			t.Errorf("%s: number %s, want %s", ref, issue.Number, want)
+		}
+	}
+}
+
+func TestExportRefusals(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	pending := paidOrder("ORDER-P", "")
+	pending.Status = orders.StatusPending
+	refunded := paidOrder("ORDER-R", "")
+	refunded.Status = orders.StatusRefunded
+	invalid := paidOrder("ORDER-I", "12345678951") // wrong TCKN check digit is read as a TCKN
+	rejected := errors.New("rejected by the schema")
+
+	tests := []struct {
+		name  string
+		rec   orders.Record
+		check func([]byte) error
+	}{
+		{"pending order", pending, nil},
+		{"refunded before invoicing", refunded, nil},
+		{"invalid buyer", invalid, nil},
+		{"failed check", paidOrder("ORDER-C", ""), func([]byte) error { return rejected }},
+	}
+	e := newExporter(t)
+	for _, tt := range tests {
+		if _, _, err := e.Export(tt.rec, now, tt.check); err == nil {
+			t.Errorf("%s: exported", tt.name)
+		}
+	}
+	// Refused exports use up no number
+	issue, _, err := e.Export(paidOrder("ORDER-1", ""), now, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issue.Number != "EAR2026000000001" {
+		t.Errorf("number %s after refused exports, want EAR2026000000001", issue.Number)
+	}
+	if len(e.List()) != 1 {
+		t.Errorf("%d issued invoices, want 1", len(e.List()))
+	}
+}
+
+func TestBuyerID(t *testing.T) {
+	tests := []struct {
+		vat, id, scheme string
+	}{
+		{"1234567890", "1234567890", SchemeVKN},
+		{"TR1234567890", "1234567890", SchemeVKN},
+		{" 12345678950 ", "12345678950", SchemeTCKN},
+		{"", AnonymousTCKN, SchemeTCKN},
+		{"12345", AnonymousTCKN, SchemeTCKN},
+		{"DE123456789", AnonymousTCKN, SchemeTCKN},
+	}
+	for _, tt := range tests {
+		id, scheme := BuyerID(tt.vat)
+		if id != tt.id || scheme != tt.scheme {
+			t.Errorf("BuyerID(%q) = %s %s, want %s %s", tt.vat, id, scheme, tt.id, tt.scheme)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	issuedAt := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	build := func(vat, number string) *Invoice {
+		id, scheme := BuyerID(vat)
+		cfg := testConfig()
+		cfg.EInvoiceProfile = ProfileBasic
+		return Build(paidOrder("ORDER-1", vat), Issue{
+			ReferenceID: "ORDER-1",
+			Number:      number,
+			UUID:        "8d3f5a9e-2c1b-4e7a-9f60-1a2b3c4d5e6f",
+			Profile:     cfg.Profile(id, scheme),
+			BuyerID:     id,
+			BuyerScheme: scheme,
+			IssuedAt:    issuedAt,
+		}, cfg)
+	}
+
+	tests := []struct {
+		name    string
+		invoice func() *Invoice
+		problem string // "" when valid
+	}{
+		{"e-Arşiv to an individual", func() *Invoice { return build("12345678950", "EAR2026000000001") }, ""},
+		{"e-Arşiv to an anonymous buyer", func() *Invoice { return build("", "EAR2026000000001") }, ""},
+		{"e-Fatura to a registered company", func() *Invoice { return build("4840847211", "EFT2026000000001") }, ""},
+		{"short number", func() *Invoice { return build("", "EAR26000000001") }, "invoice number"},
+		{"number from another year", func() *Invoice { return build("", "EAR2025000000001") }, "not from the year"},
+		{"invalid TCKN", func() *Invoice { return build("12345678951", "EAR2026000000001") }, "not a valid national ID"},
+		{"invalid VKN", func() *Invoice {
+			inv := build("4840847211", "EFT2026000000001")
+			inv.Customer.Party.Identifications[0].ID.Value = "4840847212"
+			return inv
+		}, "not a valid tax number"},
+		{"anonymous buyer on an e-Fatura", func() *Invoice {
+			inv := build("", "EFT2026000000001")
+			inv.ProfileID = ProfileBasic
+			return inv
+		}, "needs a real TCKN"},
+		{"no delivery type on e-Arşiv", func() *Invoice {
+			inv := build("", "EAR2026000000001")
+			inv.AdditionalDocuments = nil
+			return inv
+		}, "gonderimSekli"},
+		{"payable amount off", func() *Invoice {
+			inv := build("", "EAR2026000000001")
+			inv.LegalMonetaryTotal.PayableAmount = money(150.90, "TRY")
+			return inv
+		}, "PayableAmount"},
+		{"line tax off", func() *Invoice {
+			inv := build("", "EAR2026000000001")
+			inv.Lines[0].TaxTotal.TaxAmount = money(21, "TRY")
+			inv.Lines[0].TaxTotal.Subtotals[0].TaxAmount = money(21, "TRY")
+			return inv
+		}, "differs from the line taxes"},
+		{"foreign currency without a rate", func() *Invoice {
+			inv := build("", "EAR2026000000001")
+			inv.DocumentCurrencyCode = "USD"
+			return inv
+		}, "exchange rate to TRY"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := Validate(tt.invoice())
+			if tt.problem == "" {
+				if len(problems) > 0 {
+					t.Errorf("Validate = %v, want no problems", problems)
+				}
+				return
+			}
+			if !strings.Contains(problems.Error(), tt.problem) {
+				t.Errorf("Validate = %v, want a problem about %q", problems, tt.problem)
+			}
+		})
+	}
+}
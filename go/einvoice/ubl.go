@@ -0,0 +1,234 @@
+package einvoice
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// UBL 2.1 namespaces used by UBL-TR
+const (
+	nsInvoice = "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2"
+	nsCac     = "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2"
+	nsCbc     = "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2"
+	nsExt     = "urn:oasis:names:specification:ubl:schema:xsd:CommonExtensionComponents-2"
+)
+
+// Invoice is a UBL-TR 1.2 invoice. Fields are declared in the order the UBL schema requires.
+type Invoice struct {
+	XMLName  xml.Name `xml:"Invoice"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	XmlnsCac string   `xml:"xmlns:cac,attr"`
+	XmlnsCbc string   `xml:"xmlns:cbc,attr"`
+	XmlnsExt string   `xml:"xmlns:ext,attr"`
+
+	// The integrator puts the XAdES signature here
+	Extensions Extensions `xml:"ext:UBLExtensions"`
+
+	UBLVersionID         string              `xml:"cbc:UBLVersionID"`
+	CustomizationID      string              `xml:"cbc:CustomizationID"`
+	ProfileID            string              `xml:"cbc:ProfileID"`
+	ID                   string              `xml:"cbc:ID"`
+	CopyIndicator        bool                `xml:"cbc:CopyIndicator"`
+	UUID                 string              `xml:"cbc:UUID"`
+	IssueDate            string              `xml:"cbc:IssueDate"`
+	IssueTime            string              `xml:"cbc:IssueTime"`
+	InvoiceTypeCode      string              `xml:"cbc:InvoiceTypeCode"`
+	Notes                []string            `xml:"cbc:Note"`
+	DocumentCurrencyCode string              `xml:"cbc:DocumentCurrencyCode"`
+	LineCountNumeric     int                 `xml:"cbc:LineCountNumeric"`
+	OrderReference       *DocumentReference  `xml:"cac:OrderReference"`
+	AdditionalDocuments  []DocumentReference `xml:"cac:AdditionalDocumentReference"`
+	Signature            Signature           `xml:"cac:Signature"`
+	Supplier             PartyRole           `xml:"cac:AccountingSupplierParty"`
+	Customer             PartyRole           `xml:"cac:AccountingCustomerParty"`
+	PaymentMeans         *PaymentMeans       `xml:"cac:PaymentMeans"`
+	PricingExchangeRate  *ExchangeRate       `xml:"cac:PricingExchangeRate"`
+	TaxTotal             TaxTotal            `xml:"cac:TaxTotal"`
+	LegalMonetaryTotal   MonetaryTotal       `xml:"cac:LegalMonetaryTotal"`
+	Lines                []InvoiceLine       `xml:"cac:InvoiceLine"`
+}
+
+// The types below mirror the UBL aggregates of the same name, limited to what the
+// exporter fills in
+
+type Extensions struct {
+	Extension struct {
+		Content struct{} `xml:"ext:ExtensionContent"`
+	} `xml:"ext:UBLExtension"`
+}
+
+type DocumentReference struct {
+	ID               string `xml:"cbc:ID"`
+	IssueDate        string `xml:"cbc:IssueDate"`
+	DocumentTypeCode string `xml:"cbc:DocumentTypeCode,omitempty"`
+}
+
+type Signature struct {
+	ID             SchemedID `xml:"cbc:ID"`
+	SignatoryParty Party     `xml:"cac:SignatoryParty"`
+	Attachment     struct {
+		URI string `xml:"cac:ExternalReference>cbc:URI"`
+	} `xml:"cac:DigitalSignatureAttachment"`
+}
+
+type PartyRole struct {
+	Party Party `xml:"cac:Party"`
+}
+
+type Party struct {
+	WebsiteURI      string           `xml:"cbc:WebsiteURI,omitempty"`
+	Identifications []Identification `xml:"cac:PartyIdentification"`
+	Name            *PartyName       `xml:"cac:PartyName"`
+	PostalAddress   Address          `xml:"cac:PostalAddress"`
+	TaxScheme       *PartyTaxScheme  `xml:"cac:PartyTaxScheme"`
+	Contact         *Contact         `xml:"cac:Contact"`
+	Person          *Person          `xml:"cac:Person"`
+}
+
+type Identification struct {
+	ID SchemedID `xml:"cbc:ID"`
+}
+
+type SchemedID struct {
+	SchemeID string `xml:"schemeID,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type PartyName struct {
+	Name string `xml:"cbc:Name"`
+}
+
+type Address struct {
+	StreetName          string `xml:"cbc:StreetName,omitempty"`
+	CitySubdivisionName string `xml:"cbc:CitySubdivisionName"`
+	CityName            string `xml:"cbc:CityName"`
+	PostalZone          string `xml:"cbc:PostalZone,omitempty"`
+	Country             string `xml:"cac:Country>cbc:Name"`
+}
+
+type PartyTaxScheme struct {
+	TaxScheme TaxScheme `xml:"cac:TaxScheme"`
+}
+
+type TaxScheme struct {
+	Name        string `xml:"cbc:Name,omitempty"`
+	TaxTypeCode string `xml:"cbc:TaxTypeCode,omitempty"`
+}
+
+type Contact struct {
+	Telephone      string `xml:"cbc:Telephone,omitempty"`
+	ElectronicMail string `xml:"cbc:ElectronicMail,omitempty"`
+}
+
+type Person struct {
+	FirstName  string `xml:"cbc:FirstName"`
+	FamilyName string `xml:"cbc:FamilyName"`
+}
+
+type PaymentMeans struct {
+	Code    string `xml:"cbc:PaymentMeansCode"`
+	DueDate string `xml:"cbc:PaymentDueDate,omitempty"`
+}
+
+type ExchangeRate struct {
+	SourceCurrencyCode string `xml:"cbc:SourceCurrencyCode"`
+	TargetCurrencyCode string `xml:"cbc:TargetCurrencyCode"`
+	CalculationRate    string `xml:"cbc:CalculationRate"`
+	Date               string `xml:"cbc:Date,omitempty"`
+}
+
+type TaxTotal struct {
+	TaxAmount Amount        `xml:"cbc:TaxAmount"`
+	Subtotals []TaxSubtotal `xml:"cac:TaxSubtotal"`
+}
+
+type TaxSubtotal struct {
+	TaxableAmount Amount      `xml:"cbc:TaxableAmount"`
+	TaxAmount     Amount      `xml:"cbc:TaxAmount"`
+	Percent       string      `xml:"cbc:Percent"`
+	TaxCategory   TaxCategory `xml:"cac:TaxCategory"`
+}
+
+type TaxCategory struct {
+	ExemptionReasonCode string    `xml:"cbc:TaxExemptionReasonCode,omitempty"`
+	ExemptionReason     string    `xml:"cbc:TaxExemptionReason,omitempty"`
+	TaxScheme           TaxScheme `xml:"cac:TaxScheme"`
+}
+
+type MonetaryTotal struct {
+	LineExtensionAmount   Amount  `xml:"cbc:LineExtensionAmount"`
+	TaxExclusiveAmount    Amount  `xml:"cbc:TaxExclusiveAmount"`
+	TaxInclusiveAmount    Amount  `xml:"cbc:TaxInclusiveAmount"`
+	PayableRoundingAmount *Amount `xml:"cbc:PayableRoundingAmount"`
+	PayableAmount         Amount  `xml:"cbc:PayableAmount"`
+}
+
+type InvoiceLine struct {
+	ID                  string            `xml:"cbc:ID"`
+	InvoicedQuantity    Quantity          `xml:"cbc:InvoicedQuantity"`
+	LineExtensionAmount Amount            `xml:"cbc:LineExtensionAmount"`
+	AllowanceCharges    []AllowanceCharge `xml:"cac:AllowanceCharge"`
+	TaxTotal            TaxTotal          `xml:"cac:TaxTotal"`
+	Item                Item              `xml:"cac:Item"`
+	Price               Amount            `xml:"cac:Price>cbc:PriceAmount"`
+}
+
+type AllowanceCharge struct {
+	ChargeIndicator bool    `xml:"cbc:ChargeIndicator"`
+	Reason          string  `xml:"cbc:AllowanceChargeReason,omitempty"`
+	Amount          Amount  `xml:"cbc:Amount"`
+	BaseAmount      *Amount `xml:"cbc:BaseAmount"`
+}
+
+type Item struct {
+	Name     string              `xml:"cbc:Name"`
+	SellerID *ItemIdentification `xml:"cac:SellersItemIdentification"`
+}
+
+type ItemIdentification struct {
+	ID string `xml:"cbc:ID"`
+}
+
+// Amount is a monetary amount in a currency
+type Amount struct {
+	CurrencyID string `xml:"currencyID,attr"`
+	Value      string `xml:",chardata"`
+}
+
+type Quantity struct {
+	UnitCode string `xml:"unitCode,attr"`
+	Value    string `xml:",chardata"`
+}
+
+func money(v float64, currency string) Amount {
+	return Amount{CurrencyID: currency, Value: strconv.FormatFloat(v, 'f', 2, 64)}
+}
+
+// unitPrice formats a price with up to 6 decimals, so quantity times price gives the line amount
+func unitPrice(v float64, currency string) Amount {
+	s := strings.TrimRight(strconv.FormatFloat(v, 'f', 6, 64), "0")
+	if i := strings.IndexByte(s, '.'); len(s)-i < 3 {
+		s += strings.Repeat("0", 3-(len(s)-i))
+	}
+	return Amount{CurrencyID: currency, Value: s}
+}
+
+func percent(rate float64) string {
+	return strconv.FormatFloat(rate, 'f', -1, 64)
+}
+
+// Marshal encodes the invoice as an XML document
+func Marshal(inv *Invoice) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(inv); err != nil {
+		return nil, fmt.Errorf("encode invoice %s: %w", inv.ID, err)
+	}
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,292 @@
+package einvoice
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"tapsilat-go-example/validation"
+)
+
+var (
+	seriesPattern = regexp.MustCompile(`^[A-Z0-9]{3}$`)
+	numberPattern = regexp.MustCompile(`^[A-Z0-9]{3}20[0-9]{2}[0-9]{9}$`)
+	uuidPattern   = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+// Problems lists the rules an invoice breaks
+type Problems []string
+
+func (p Problems) Error() string {
+	return "invalid invoice: " + strings.Join(p, "; ")
+}
+
+// tolerance allows for rounding to cents on each line
+const tolerance = 0.011
+
+// Validate checks an invoice against the UBL-TR 1.2 schema and the GİB business rules that
+// apply to what Build produces: required elements, code lists, the invoice number format,
+// TCKN and VKN check digits and that the amounts add up. The signature is not checked; it is
+// added by the integrator.
+func Validate(inv *Invoice) Problems {
+	v := &validator{currency: inv.DocumentCurrencyCode}
+
+	if inv.UBLVersionID != "2.1" {
+		v.addf("UBLVersionID must be 2.1")
+	}
+	if inv.CustomizationID != "TR1.2" {
+		v.addf("CustomizationID must be TR1.2")
+	}
+	switch inv.ProfileID {
+	case ProfileEArchive, ProfileBasic, ProfileCommercial:
+	default:
+		v.addf("unknown ProfileID %q", inv.ProfileID)
+	}
+	if !numberPattern.MatchString(inv.ID) {
+		v.addf("invoice number %q must be a 3-character series, the year and a 9-digit sequence", inv.ID)
+	}
+	if !uuidPattern.MatchString(inv.UUID) {
+		v.addf("UUID %q is not a UUID", inv.UUID)
+	}
+	if date, err := time.Parse("2006-01-02", inv.IssueDate); err != nil {
+		v.addf("IssueDate %q is not a date", inv.IssueDate)
+	} else if len(inv.ID) >= 7 && inv.ID[3:7] != strconv.Itoa(date.Year()) {
+		v.addf("invoice number %s is not from the year of its IssueDate", inv.ID)
+	}
+	if _, err := time.Parse("15:04:05", inv.IssueTime); err != nil {
+		v.addf("IssueTime %q is not a time", inv.IssueTime)
+	}
+	switch inv.InvoiceTypeCode {
+	case "SATIS", "IADE", "ISTISNA", "TEVKIFAT", "OZELMATRAH", "IHRACKAYITLI":
+	default:
+		v.addf("unknown InvoiceTypeCode %q", inv.InvoiceTypeCode)
+	}
+	if len(inv.DocumentCurrencyCode) != 3 || strings.ToUpper(inv.DocumentCurrencyCode) != inv.DocumentCurrencyCode {
+		v.addf("DocumentCurrencyCode %q is not an ISO 4217 code", inv.DocumentCurrencyCode)
+	}
+	if inv.DocumentCurrencyCode != "TRY" {
+		if inv.PricingExchangeRate == nil || parseAmount(inv.PricingExchangeRate.CalculationRate) <= 0 {
+			v.addf("invoices in %s need the exchange rate to TRY", inv.DocumentCurrencyCode)
+		}
+	}
+	if inv.ProfileID == ProfileEArchive && !hasDocument(inv, "gonderimSekli") {
+		v.addf("e-Arşiv invoices need the delivery type (gonderimSekli)")
+	}
+
+	v.party("supplier", inv.Supplier.Party, false)
+	v.party("customer", inv.Customer.Party, inv.ProfileID == ProfileEArchive)
+	if len(inv.Supplier.Party.Identifications) > 0 && inv.Signature.ID.Value != inv.Supplier.Party.Identifications[0].ID.Value {
+		v.addf("signature ID must be the supplier's tax number")
+	}
+	if tax := inv.Supplier.Party.TaxScheme; tax == nil || strings.TrimSpace(tax.TaxScheme.Name) == "" {
+		v.addf("supplier tax office is missing")
+	}
+	if inv.ProfileID != ProfileEArchive && len(inv.Customer.Party.Identifications) > 0 &&
+		inv.Customer.Party.Identifications[0].ID.SchemeID != SchemeVKN {
+		v.addf("%s invoices are only issued to e-Fatura users", inv.ProfileID)
+	}
+
+	if len(inv.Lines) == 0 {
+		v.addf("invoice has no lines")
+	}
+	if inv.LineCountNumeric != len(inv.Lines) {
+		v.addf("LineCountNumeric is %d but there are %d lines", inv.LineCountNumeric, len(inv.Lines))
+	}
+	var lineTotal, lineTax float64
+	for _, line := range inv.Lines {
+		amount, tax := v.line(line)
+		lineTotal += amount
+		lineTax += tax
+	}
+
+	tax := v.taxTotal(inv.TaxTotal, "invoice", len(inv.Lines))
+	if !near(tax, lineTax) {
+		v.addf("invoice tax %.2f differs from the line taxes %.2f", tax, lineTax)
+	}
+	t := inv.LegalMonetaryTotal
+	ext := v.amount(t.LineExtensionAmount, "LineExtensionAmount")
+	exclusive := v.amount(t.TaxExclusiveAmount, "TaxExclusiveAmount")
+	inclusive := v.amount(t.TaxInclusiveAmount, "TaxInclusiveAmount")
+	payable := v.amount(t.PayableAmount, "PayableAmount")
+	rounding := 0.0
+	if t.PayableRoundingAmount != nil {
+		rounding = v.amount(*t.PayableRoundingAmount, "PayableRoundingAmount")
+		if math.Abs(rounding) > tolerance*float64(len(inv.Lines)) {
+			v.addf("rounding of %.2f is more than per-line rounding explains", rounding)
+		}
+	}
+	if !near(ext, lineTotal) {
+		v.addf("LineExtensionAmount %.2f differs from the sum of the lines %.2f", ext, lineTotal)
+	}
+	if !near(exclusive, ext) {
+		v.addf("TaxExclusiveAmount %.2f differs from LineExtensionAmount %.2f", exclusive, ext)
+	}
+	if !near(inclusive, exclusive+tax) {
+		v.addf("TaxInclusiveAmount %.2f is not TaxExclusiveAmount plus tax", inclusive)
+	}
+	if !near(payable, inclusive+rounding) {
+		v.addf("PayableAmount %.2f is not TaxInclusiveAmount plus rounding", payable)
+	}
+	return v.problems
+}
+
+type validator struct {
+	currency string
+	problems Problems
+}
+
+func (v *validator) addf(format string, args ...interface{}) {
+	v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+// amount parses a monetary amount and checks it is in the document currency
+func (v *validator) amount(a Amount, field string) float64 {
+	if a.CurrencyID != v.currency {
+		v.addf("%s is in %q, not the document currency", field, a.CurrencyID)
+	}
+	f, err := strconv.ParseFloat(a.Value, 64)
+	if err != nil {
+		v.addf("%s %q is not an amount", field, a.Value)
+		return 0
+	}
+	if f < 0 && field != "PayableRoundingAmount" {
+		v.addf("%s is negative", field)
+	}
+	return f
+}
+
+// party checks the identification, name and address of a supplier or customer
+func (v *validator) party(role string, p Party, anonymousAllowed bool) {
+	if len(p.Identifications) != 1 {
+		v.addf("%s needs exactly one VKN or TCKN", role)
+		return
+	}
+	id := p.Identifications[0].ID
+	switch id.SchemeID {
+	case SchemeVKN:
+		if !validation.ValidVKN(id.Value) {
+			v.addf("%s VKN %q is not a valid tax number", role, id.Value)
+		}
+		if p.Name == nil || strings.TrimSpace(p.Name.Name) == "" {
+			v.addf("%s company name is missing", role)
+		}
+	case SchemeTCKN:
+		switch {
+		case id.Value == AnonymousTCKN:
+			if !anonymousAllowed {
+				v.addf("%s needs a real TCKN", role)
+			}
+		case !validation.ValidTCKN(id.Value):
+			v.addf("%s TCKN %q is not a valid national ID", role, id.Value)
+		}
+		named := p.Name != nil && strings.TrimSpace(p.Name.Name) != ""
+		person := p.Person != nil && strings.TrimSpace(p.Person.FirstName) != "" && strings.TrimSpace(p.Person.FamilyName) != ""
+		if !named && !person {
+			v.addf("%s first and family name are missing", role)
+		}
+	default:
+		v.addf("%s identification scheme %q must be VKN or TCKN", role, id.SchemeID)
+	}
+
+	a := p.PostalAddress
+	if strings.TrimSpace(a.CitySubdivisionName) == "" {
+		v.addf("%s district is missing", role)
+	}
+	if strings.TrimSpace(a.CityName) == "" {
+		v.addf("%s city is missing", role)
+	}
+	if strings.TrimSpace(a.Country) == "" {
+		v.addf("%s country is missing", role)
+	}
+}
+
+// line checks an invoice line and returns its amount and tax
+func (v *validator) line(line InvoiceLine) (float64, float64) {
+	name := "line " + line.ID
+	if strings.TrimSpace(line.Item.Name) == "" {
+		v.addf("%s has no item name", name)
+	}
+	qty, err := strconv.ParseFloat(line.InvoicedQuantity.Value, 64)
+	if err != nil || qty <= 0 {
+		v.addf("%s quantity %q must be positive", name, line.InvoicedQuantity.Value)
+	}
+	if line.InvoicedQuantity.UnitCode == "" {
+		v.addf("%s has no unit code", name)
+	}
+	amount := v.amount(line.LineExtensionAmount, name+" amount")
+	price := v.amount(line.Price, name+" price")
+	allowances := 0.0
+	for _, ac := range line.AllowanceCharges {
+		a := v.amount(ac.Amount, name+" allowance")
+		if ac.ChargeIndicator {
+			allowances -= a
+		} else {
+			allowances += a
+		}
+	}
+	if !near(amount, qty*price-allowances) {
+		v.addf("%s amount %.2f is not quantity times price less discounts", name, amount)
+	}
+	taxable := 0.0
+	for _, sub := range line.TaxTotal.Subtotals {
+		taxable += v.amount(sub.TaxableAmount, name+" taxable amount")
+	}
+	if !near(taxable, amount) {
+		v.addf("%s taxable amount %.2f differs from its amount %.2f", name, taxable, amount)
+	}
+	return amount, v.taxTotal(line.TaxTotal, name, 1)
+}
+
+// taxTotal checks the subtotals of a tax total over lines invoice lines and returns the tax amount
+func (v *validator) taxTotal(t TaxTotal, name string, lines int) float64 {
+	total := v.amount(t.TaxAmount, name+" tax")
+	if len(t.Subtotals) == 0 {
+		v.addf("%s has no tax subtotal", name)
+	}
+	sum := 0.0
+	for _, sub := range t.Subtotals {
+		taxable := v.amount(sub.TaxableAmount, name+" taxable amount")
+		tax := v.amount(sub.TaxAmount, name+" tax")
+		sum += tax
+		rate, err := strconv.ParseFloat(sub.Percent, 64)
+		if err != nil || rate < 0 || rate > 100 {
+			v.addf("%s tax percent %q is not a rate", name, sub.Percent)
+			continue
+		}
+		if sub.TaxCategory.TaxScheme.TaxTypeCode != KDV {
+			v.addf("%s tax type %q is not KDV (%s)", name, sub.TaxCategory.TaxScheme.TaxTypeCode, KDV)
+		}
+		if rate == 0 && sub.TaxCategory.ExemptionReasonCode == "" {
+			v.addf("%s is taxed at 0%% without an exemption code", name)
+		}
+		// Tax is rounded per line, so a subtotal may be off by half a cent per line
+		if math.Abs(taxable*rate/100-tax) > 0.005*float64(lines)+0.006 {
+			v.addf("%s tax %.2f is not %s%% of %.2f", name, tax, sub.Percent, taxable)
+		}
+	}
+	if !near(total, sum) {
+		v.addf("%s tax %.2f differs from its subtotals %.2f", name, total, sum)
+	}
+	return total
+}
+
+func hasDocument(inv *Invoice, typeCode string) bool {
+	for _, doc := range inv.AdditionalDocuments {
+		if doc.DocumentTypeCode == typeCode {
+			return true
+		}
+	}
+	return false
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < tolerance
+}
+
+func parseAmount(s string) float64 {
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"tapsilat-go-example/einvoice"
+	"tapsilat-go-example/orders"
+
+	"github.com/gin-gonic/gin"
+)
+
+// einvoiceConfig reads the seller and numbering setup from the EINVOICE_* variables
+func einvoiceConfig() einvoice.Config {
+	cfg := einvoice.Config{
+		Supplier: einvoice.Supplier{
+			ID:         os.Getenv("EINVOICE_SUPPLIER_VKN"),
+			Name:       os.Getenv("EINVOICE_SUPPLIER_NAME"),
+			TaxOffice:  os.Getenv("EINVOICE_SUPPLIER_TAX_OFFICE"),
+			Street:     os.Getenv("EINVOICE_SUPPLIER_STREET"),
+			District:   os.Getenv("EINVOICE_SUPPLIER_DISTRICT"),
+			City:       os.Getenv("EINVOICE_SUPPLIER_CITY"),
+			PostalZone: os.Getenv("EINVOICE_SUPPLIER_POSTAL_ZONE"),
+			Email:      os.Getenv("EINVOICE_SUPPLIER_EMAIL"),
+			Phone:      os.Getenv("EINVOICE_SUPPLIER_PHONE"),
+			Website:    os.Getenv("EINVOICE_SUPPLIER_WEBSITE"),
+		},
+		EArchiveSeries:  strings.ToUpper(os.Getenv("EINVOICE_EARCHIVE_SERIES")),
+		EInvoiceSeries:  strings.ToUpper(os.Getenv("EINVOICE_SERIES")),
+		EInvoiceProfile: strings.ToUpper(os.Getenv("EINVOICE_PROFILE")),
+		Registered:      make(map[string]bool),
+	}
+	if cfg.Supplier.Name == "" {
+		cfg.Supplier.Name = os.Getenv("RECEIPT_COMPANY_NAME")
+	}
+	for _, vkn := range strings.Split(os.Getenv("EINVOICE_REGISTERED_VKNS"), ",") {
+		if vkn = strings.TrimSpace(vkn); vkn != "" {
+			cfg.Registered[vkn] = true
+		}
+	}
+	return cfg
+}
+
+// invoiceSchemaCheck validates exported invoices against the UBL-TR XSD with xmllint when
+// EINVOICE_XSD points to the schema, e.g. the Invoice-2.1 main schema of the GİB package
+func invoiceSchemaCheck() func([]byte) error {
+	xsd := os.Getenv("EINVOICE_XSD")
+	if xsd == "" {
+		return nil
+	}
+	return func(data []byte) error {
+		cmd := exec.Command("xmllint", "--noout", "--schema", xsd, "-")
+		cmd.Stdin = bytes.NewReader(data)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) {
+				return fmt.Errorf("run xmllint: %w", err)
+			}
+			return einvoice.Problems{"schema: " + strings.TrimSpace(stderr.String())}
+		}
+		return nil
+	}
+}
+
+// orderInvoiceHandler serves the UBL-TR invoice of a paid order. The first request numbers
+// the invoice; later requests return the same invoice.
+// GET /api/order/:reference_id/invoice.xml
+func orderInvoiceHandler(c *gin.Context) {
+	referenceID := c.Param("reference_id")
+	rec, ok := orderStore.Get(referenceID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	rec = refreshPendingOrder(c.Request.Context(), rec, "einvoice")
+	if rec.Status != orders.StatusPaid && rec.Status != orders.StatusRefunded {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Order is %s, invoices are only issued for paid orders", rec.Status)})
+		return
+	}
+
+	issue, data, err := invoiceExporter.Export(rec, time.Now(), invoiceSchemaCheck())
+	if err != nil {
+		var problems einvoice.Problems
+		if errors.As(err, &problems) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invoice failed validation", "problems": problems})
+			return
+		}
+		utilsInstance.LogError("Failed to export invoice", map[string]interface{}{
+			"reference_id": referenceID,
+			"error":        err.Error(),
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export invoice"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%q", issue.Number+".xml"))
+	c.Data(http.StatusOK, "application/xml; charset=utf-8", data)
+}
+
+// exportInvoicesHandler exports the invoices of the local orders paid in a date range as a
+// zip of UBL-TR files. Orders are numbered in the order they were paid; orders that fail
+// validation are left out and listed in errors.txt.
+// GET /api/export/einvoices?start_date=2026-10-01&end_date=2026-10-31
+func exportInvoicesHandler(c *gin.Context) {
+	from, to, err := invoiceDateRange(c.Query("start_date"), c.Query("end_date"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var paid []orders.Record
+	for _, rec := range orderStore.List() {
+		// Refunded orders are only included when they were invoiced while paid
+		if rec.Status != orders.StatusPaid && rec.Status != orders.StatusRefunded {
+			continue
+		}
+		if _, issued := invoiceExporter.Issued(rec.ReferenceID); rec.Status == orders.StatusRefunded && !issued {
+			continue
+		}
+		at := paidOrCreatedAt(rec)
+		if (!from.IsZero() && at.Before(from)) || (!to.IsZero() && !at.Before(to)) {
+			continue
+		}
+		paid = append(paid, rec)
+	}
+	sort.Slice(paid, func(i, j int) bool { return paidOrCreatedAt(paid[i]).Before(paidOrCreatedAt(paid[j])) })
+
+	type file struct {
+		name string
+		data []byte
+	}
+	var files []file
+	var failures []string
+	check := invoiceSchemaCheck()
+	for _, rec := range paid {
+		issue, data, err := invoiceExporter.Export(rec, time.Now(), check)
+		if err != nil {
+			failures = append(failures, rec.ReferenceID+": "+err.Error())
+			continue
+		}
+		files = append(files, file{issue.Number + ".xml", data})
+	}
+	if len(files) == 0 {
+		if len(failures) > 0 {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "No invoice passed validation", "problems": failures})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "No paid orders in the date range"})
+		return
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	add := func(name string, data []byte) error {
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+	for _, f := range files {
+		if err = add(f.name, f.data); err != nil {
+			break
+		}
+	}
+	if err == nil && len(failures) > 0 {
+		err = add("errors.txt", []byte(strings.Join(failures, "\n")+"\n"))
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		utilsInstance.LogError("Failed to build invoice archive", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export invoices"})
+		return
+	}
+
+	filename := fmt.Sprintf("einvoices_%s.zip", time.Now().Format("20060102_150405"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Header("X-Invoice-Count", fmt.Sprint(len(files)))
+	c.Header("X-Invoice-Failures", fmt.Sprint(len(failures)))
+	c.Data(http.StatusOK, "application/zip", buf.Bytes())
+}
+
+// listInvoicesHandler lists the invoice numbers issued so far
+// GET /api/admin/einvoices
+func listInvoicesHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"invoices": invoiceExporter.List()})
+}
+
+// invoiceDateRange parses inclusive YYYY-MM-DD dates into [from, to) in Turkish time
+func invoiceDateRange(start, end string) (from, to time.Time, err error) {
+	loc, locErr := time.LoadLocation("Europe/Istanbul")
+	if locErr != nil {
+		// Images without tzdata; Turkey has no daylight saving time
+		loc = time.FixedZone("TRT", 3*60*60)
+	}
+	if start != "" {
+		if from, err = time.ParseInLocation("2006-01-02", start, loc); err != nil {
+			return from, to, fmt.Errorf("invalid start_date %q, use YYYY-MM-DD", start)
+		}
+	}
+	if end != "" {
+		if to, err = time.ParseInLocation("2006-01-02", end, loc); err != nil {
+			return from, to, fmt.Errorf("invalid end_date %q, use YYYY-MM-DD", end)
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+	return from, to, nil
+}
+
+func paidOrCreatedAt(rec orders.Record) time.Time {
+	if at := rec.PaidAt(); !at.IsZero() {
+		return at
+	}
+	return rec.CreatedAt
+}
@@ -0,0 +1,254 @@
+package export
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Row is a single flattened record
+type Row map[string]interface{}
+
+// Writer streams rows in one output format
+type Writer interface {
+	// WriteHeader is called once with the selected columns before any row
+	WriteHeader(columns []string) error
+	WriteRow(row Row) error
+	Close() error
+}
+
+// Format describes a supported export format
+type Format struct {
+	Name        string
+	ContentType string
+	Extension   string
+}
+
+var formats = map[string]Format{
+	"csv":    {Name: "csv", ContentType: "text/csv; charset=utf-8", Extension: "csv"},
+	"ndjson": {Name: "ndjson", ContentType: "application/x-ndjson", Extension: "ndjson"},
+	"xlsx":   {Name: "xlsx", ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", Extension: "xlsx"},
+}
+
+// LookupFormat returns the format for name
+func LookupFormat(name string) (Format, error) {
+	f, ok := formats[strings.ToLower(name)]
+	if !ok {
+		return Format{}, fmt.Errorf("unsupported format %q (use csv, ndjson or xlsx)", name)
+	}
+	return f, nil
+}
+
+// NewWriter creates a streaming writer for format
+func NewWriter(format Format, w io.Writer) Writer {
+	switch format.Name {
+	case "ndjson":
+		return &ndjsonWriter{enc: json.NewEncoder(w)}
+	case "xlsx":
+		return newXLSXWriter(w)
+	}
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+// --- CSV ---
+
+type csvWriter struct {
+	w       *csv.Writer
+	columns []string
+}
+
+func (c *csvWriter) WriteHeader(columns []string) error {
+	c.columns = columns
+	return c.w.Write(columns)
+}
+
+func (c *csvWriter) WriteRow(row Row) error {
+	values := make([]string, len(c.columns))
+	for i, col := range c.columns {
+		values[i] = FormatValue(row[col])
+	}
+	if err := c.w.Write(values); err != nil {
+		return err
+	}
+	// Flush per row so the client receives data as it is produced
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// --- NDJSON ---
+
+type ndjsonWriter struct {
+	enc     *json.Encoder
+	columns []string
+}
+
+func (n *ndjsonWriter) WriteHeader(columns []string) error {
+	n.columns = columns
+	return nil
+}
+
+func (n *ndjsonWriter) WriteRow(row Row) error {
+	if len(n.columns) == 0 {
+		return n.enc.Encode(row)
+	}
+	selected := make(Row, len(n.columns))
+	for _, col := range n.columns {
+		selected[col] = row[col]
+	}
+	return n.enc.Encode(selected)
+}
+
+func (n *ndjsonWriter) Close() error {
+	return nil
+}
+
+// FormatValue renders a value as text, nested values are JSON encoded
+func FormatValue(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64, bool, int:
+		return fmt.Sprintf("%v", value)
+	default:
+		data, _ := json.Marshal(value)
+		return string(data)
+	}
+}
+
+// Flatten turns nested objects into dotted keys. When flattenMetadata is set,
+// metadata lists of {key, value} pairs become "metadata.<key>" columns.
+func Flatten(v map[string]interface{}, flattenMetadata bool) Row {
+	row := make(Row)
+	flattenInto(row, "", v, flattenMetadata)
+	return row
+}
+
+func flattenInto(row Row, prefix string, v map[string]interface{}, flattenMetadata bool) {
+	for key, value := range v {
+		name := key
+		if prefix != "" {
+			name = prefix + "." + key
+		}
+
+		switch nested := value.(type) {
+		case map[string]interface{}:
+			flattenInto(row, name, nested, flattenMetadata)
+		case []interface{}:
+			if flattenMetadata && strings.EqualFold(key, "metadata") {
+				for _, item := range nested {
+					entry, ok := item.(map[string]interface{})
+					if !ok {
+						continue
+					}
+					if k, ok := entry["key"].(string); ok && k != "" {
+						row[name+"."+k] = entry["value"]
+					}
+				}
+				continue
+			}
+			row[name] = nested
+		default:
+			row[name] = value
+		}
+	}
+}
+
+// Columns returns the sorted union of keys of rows
+func Columns(rows []Row) []string {
+	seen := make(map[string]bool)
+	var cols []string
+	for _, row := range rows {
+		for key := range row {
+			if !seen[key] {
+				seen[key] = true
+				cols = append(cols, key)
+			}
+		}
+	}
+	sort.Strings(cols)
+	return cols
+}
+
+// Page is one page of rows returned by a PageFunc
+type Page struct {
+	Rows       []map[string]interface{}
+	TotalPages int
+}
+
+// PageFunc fetches a single page
+type PageFunc func(ctx context.Context, page int) (Page, error)
+
+// EachPage calls fn for every page until the last one, without keeping earlier pages in memory
+func EachPage(ctx context.Context, perPage int, fetch PageFunc, fn func(rows []map[string]interface{}) error) error {
+	for page := 1; ; page++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		p, err := fetch(ctx, page)
+		if err != nil {
+			return fmt.Errorf("page %d: %w", page, err)
+		}
+		if len(p.Rows) > 0 {
+			if err := fn(p.Rows); err != nil {
+				return err
+			}
+		}
+		// A short page only ends the walk when the response has no page count
+		if p.TotalPages > 0 {
+			if page >= p.TotalPages {
+				return nil
+			}
+		} else if len(p.Rows) < perPage {
+			return nil
+		}
+	}
+}
+
+// ParsePage extracts rows and the page count from a paginated API response
+func ParsePage(v interface{}) Page {
+	var generic interface{}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return Page{}
+	}
+	json.Unmarshal(data, &generic)
+
+	page := Page{}
+	switch value := generic.(type) {
+	case []interface{}:
+		page.Rows = objects(value)
+	case map[string]interface{}:
+		if total, ok := value["total_pages"].(float64); ok {
+			page.TotalPages = int(total)
+		}
+		for _, key := range []string{"rows", "transactions", "data", "items"} {
+			if list, ok := value[key].([]interface{}); ok {
+				page.Rows = objects(list)
+				return page
+			}
+		}
+		// A missing or null list means an empty page, not a record
+	}
+	return page
+}
+
+func objects(list []interface{}) []map[string]interface{} {
+	rows := make([]map[string]interface{}, 0, len(list))
+	for _, item := range list {
+		if obj, ok := item.(map[string]interface{}); ok {
+			rows = append(rows, obj)
+		}
+	}
+	return rows
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"tapsilat-go-example/export"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tapsilat/tapsilat-go"
+)
+
+// exportPageSize is the page size used when walking GetOrderList
+const exportPageSize = 100
+
+// exportOrdersHandler streams every order in the date range
+// GET /api/export/orders?format=csv|ndjson|xlsx&start_date=&end_date=&columns=a,b&flatten_metadata=true
+func exportOrdersHandler(c *gin.Context) {
+	apiClient, err := getAPIClient()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	fetchOrders := orderPageFetcher(c, apiClient)
+	flattenMetadata := c.DefaultQuery("flatten_metadata", "true") == "true"
+
+	streamExport(c, "orders", func(ctx context.Context, emit func([]export.Row) error) error {
+		return export.EachPage(ctx, exportPageSize, fetchOrders, func(rows []map[string]interface{}) error {
+			flat := make([]export.Row, 0, len(rows))
+			for _, row := range rows {
+				flat = append(flat, export.Flatten(row, flattenMetadata))
+			}
+			return emit(flat)
+		})
+	})
+}
+
+// exportTransactionsHandler streams the transactions of every order in the date range
+// GET /api/export/transactions?format=csv|ndjson|xlsx&start_date=&end_date=&columns=a,b
+func exportTransactionsHandler(c *gin.Context) {
+	apiClient, err := getAPIClient()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	fetchOrders := orderPageFetcher(c, apiClient)
+	flattenMetadata := c.DefaultQuery("flatten_metadata", "true") == "true"
+
+	streamExport(c, "transactions", func(ctx context.Context, emit func([]export.Row) error) error {
+		return export.EachPage(ctx, exportPageSize, fetchOrders, func(rows []map[string]interface{}) error {
+			for _, order := range rows {
+				referenceID, _ := order["reference_id"].(string)
+				if referenceID == "" {
+					continue
+				}
+
+				response, err := apiClient.GetOrderTransactions(ctx, referenceID)
+				if err != nil {
+					return fmt.Errorf("transactions for %s: %w", referenceID, err)
+				}
+
+				txs := export.ParsePage(response).Rows
+				flat := make([]export.Row, 0, len(txs))
+				for _, tx := range txs {
+					row := export.Flatten(tx, flattenMetadata)
+					row["order_reference_id"] = referenceID
+					flat = append(flat, row)
+				}
+				if err := emit(flat); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// orderPageFetcher returns a PageFunc over GetOrderList using the request's date filters
+func orderPageFetcher(c *gin.Context, apiClient *tapsilat.API) export.PageFunc {
+	startDate := c.DefaultQuery("start_date", "")
+	endDate := c.DefaultQuery("end_date", "")
+	organizationID := c.DefaultQuery("organization_id", "")
+
+	return func(ctx context.Context, page int) (export.Page, error) {
+		response, err := apiClient.GetOrderList(ctx, page, exportPageSize, startDate, endDate, organizationID, "")
+		if err != nil {
+			return export.Page{}, err
+		}
+		return export.ParsePage(response), nil
+	}
+}
+
+// streamExport writes rows produced by produce to the response as they arrive.
+// Errors before the first row are returned as JSON, later errors abort the stream.
+func streamExport(c *gin.Context, name string, produce func(ctx context.Context, emit func([]export.Row) error) error) {
+	format, err := export.LookupFormat(c.DefaultQuery("format", "csv"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var columns []string
+	if selected := c.Query("columns"); selected != "" {
+		for _, col := range strings.Split(selected, ",") {
+			if col = strings.TrimSpace(col); col != "" {
+				columns = append(columns, col)
+			}
+		}
+	}
+
+	// CSV and XLSX need every column in the header before the first row. Without an
+	// explicit selection the export is walked once for the column names only, so fields
+	// and metadata keys that first appear on later pages get a column too. NDJSON writes
+	// each row whole and needs no header.
+	if len(columns) == 0 && format.Name != "ndjson" {
+		seen := make(map[string]bool)
+		err := produce(c.Request.Context(), func(rows []export.Row) error {
+			for _, col := range export.Columns(rows) {
+				if !seen[col] {
+					seen[col] = true
+					columns = append(columns, col)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			utilsInstance.LogError("Export failed", map[string]interface{}{
+				"export": name,
+				"error":  err.Error(),
+			})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Export failed: " + err.Error()})
+			return
+		}
+		sort.Strings(columns)
+	}
+
+	var writer export.Writer
+	started := false
+	start := func() error {
+		filename := fmt.Sprintf("%s_%s.%s", name, time.Now().Format("20060102_150405"), format.Extension)
+		c.Header("Content-Type", format.ContentType)
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		c.Status(http.StatusOK)
+
+		writer = export.NewWriter(format, c.Writer)
+		started = true
+		return writer.WriteHeader(columns)
+	}
+
+	write := func(rows []export.Row) error {
+		for _, row := range rows {
+			if err := writer.WriteRow(row); err != nil {
+				return err
+			}
+		}
+		c.Writer.Flush()
+		return nil
+	}
+
+	emit := func(rows []export.Row) error {
+		if len(rows) == 0 {
+			return nil
+		}
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		return write(rows)
+	}
+
+	err = produce(c.Request.Context(), emit)
+	if err != nil {
+		utilsInstance.LogError("Export failed", map[string]interface{}{
+			"export": name,
+			"error":  err.Error(),
+		})
+		if !started {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Export failed: " + err.Error()})
+			return
+		}
+		// Headers are already sent, the truncated file is the only signal left
+		log.Printf("Export %s aborted after partial output: %v", name, err)
+		return
+	}
+
+	if !started {
+		if err := start(); err != nil {
+			log.Printf("Export %s failed: %v", name, err)
+			return
+		}
+	}
+	if err := writer.Close(); err != nil {
+		log.Printf("Export %s failed to finish: %v", name, err)
+	}
+}
@@ -0,0 +1,265 @@
+package i18n
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format is how a locale writes numbers, amounts and dates
+type Format struct {
+	Decimal       string `json:"decimal"`        // decimal separator
+	Group         string `json:"group"`          // thousands separator
+	CurrencyFirst bool   `json:"currency_first"` // symbol before the amount, as in "$1.00"
+	CurrencySpace bool   `json:"currency_space"` // space between the symbol and the amount
+	Date          string `json:"date"`           // Go time layout
+	DateTime      string `json:"date_time"`      // Go time layout
+}
+
+// file is a message catalog on disk, one per locale: <dir>/<locale>.json
+type file struct {
+	Name     string            `json:"name"` // shown in the language switcher
+	Format   Format            `json:"format"`
+	Messages map[string]string `json:"messages"`
+}
+
+// Catalog holds the messages and formats of every locale
+type Catalog struct {
+	defaultLocale string
+	locales       map[string]file
+}
+
+// Load reads every <locale>.json in dir. The default locale must be among them; its
+// messages are used for keys other locales lack.
+func Load(dir, defaultLocale string) (*Catalog, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	c := &Catalog{defaultLocale: Normalize(defaultLocale), locales: make(map[string]file)}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var f file
+		if err := json.Unmarshal(data, &f); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+		locale := Normalize(strings.TrimSuffix(filepath.Base(path), ".json"))
+		if f.Name == "" {
+			f.Name = locale
+		}
+		c.locales[locale] = f
+	}
+	if _, ok := c.locales[c.defaultLocale]; !ok {
+		return nil, fmt.Errorf("no message catalog for the default locale %q in %s", defaultLocale, dir)
+	}
+	return c, nil
+}
+
+// Normalize turns "tr-TR", "tr_TR" or "TR" into "tr". Anything that is not a language
+// code, such as "../x", becomes "", so a normalized locale is safe in a file path.
+func Normalize(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	for _, r := range tag {
+		if r < 'a' || r > 'z' {
+			return ""
+		}
+	}
+	return tag
+}
+
+// Default returns the default locale
+func (c *Catalog) Default() string {
+	return c.defaultLocale
+}
+
+// Locales lists the available locales
+func (c *Catalog) Locales() []string {
+	list := make([]string, 0, len(c.locales))
+	for locale := range c.locales {
+		list = append(list, locale)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Supported reports whether there is a catalog for tag
+func (c *Catalog) Supported(tag string) bool {
+	_, ok := c.locales[Normalize(tag)]
+	return ok
+}
+
+// Match returns the first supported locale among tags, in order of preference, or the
+// default locale
+func (c *Catalog) Match(tags ...string) string {
+	for _, tag := range tags {
+		if locale := Normalize(tag); c.Supported(locale) {
+			return locale
+		}
+	}
+	return c.defaultLocale
+}
+
+// ParseAcceptLanguage returns the language tags of an Accept-Language header, most
+// preferred first
+func ParseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.TrimSpace(fields[0])
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			tags = append(tags, weighted{tag, q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+	list := make([]string, len(tags))
+	for i, t := range tags {
+		list[i] = t.tag
+	}
+	return list
+}
+
+// Localizer translates and formats for one locale
+func (c *Catalog) Localizer(locale string) *Localizer {
+	locale = c.Match(locale)
+	return &Localizer{
+		Locale:   locale,
+		Name:     c.locales[locale].Name,
+		format:   c.locales[locale].Format,
+		messages: c.locales[locale].Messages,
+		fallback: c.locales[c.defaultLocale].Messages,
+	}
+}
+
+// Localizer translates messages and formats values for one locale. Templates use it as
+// {{.L.T "key"}} and {{.L.Money .Amount .Currency}}.
+type Localizer struct {
+	Locale   string
+	Name     string
+	format   Format
+	messages map[string]string
+	fallback map[string]string
+}
+
+// T returns the message for key, formatted with args as by fmt.Sprintf. Keys missing from
+// the locale come from the default locale, and unknown keys are returned as they are.
+func (l *Localizer) T(key string, args ...interface{}) string {
+	msg, ok := l.messages[key]
+	if !ok {
+		if msg, ok = l.fallback[key]; !ok {
+			msg = key
+		}
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+// Messages returns every message of the locale, including those taken from the default
+// locale, for use by scripts
+func (l *Localizer) Messages() map[string]string {
+	all := make(map[string]string, len(l.fallback))
+	for k, v := range l.fallback {
+		all[k] = v
+	}
+	for k, v := range l.messages {
+		all[k] = v
+	}
+	return all
+}
+
+// Number formats v with the given number of decimals and the locale's separators
+func (l *Localizer) Number(v float64, decimals int) string {
+	s := strconv.FormatFloat(math.Abs(v), 'f', decimals, 64)
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+	var b strings.Builder
+	if v < 0 && strings.Trim(s, "0.") != "" {
+		b.WriteByte('-')
+	}
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(l.format.Group)
+		}
+		b.WriteRune(r)
+	}
+	if frac != "" {
+		b.WriteString(l.format.Decimal)
+		b.WriteString(frac)
+	}
+	return b.String()
+}
+
+// Money formats an amount with the currency symbol, e.g. "₺1.234,50" or "$1,234.50"
+func (l *Localizer) Money(v float64, currency string) string {
+	symbol, ok := symbols[strings.ToUpper(currency)]
+	if !ok {
+		symbol = strings.ToUpper(currency)
+	}
+	amount := l.Number(v, 2)
+	sep := ""
+	if l.format.CurrencySpace || !ok {
+		sep = " "
+	}
+	if l.format.CurrencyFirst {
+		if strings.HasPrefix(amount, "-") {
+			return "-" + symbol + sep + amount[1:]
+		}
+		return symbol + sep + amount
+	}
+	return amount + sep + symbol
+}
+
+// Date formats the date part of t
+func (l *Localizer) Date(t time.Time) string {
+	return t.Format(l.layout(l.format.Date, "2006-01-02"))
+}
+
+// DateTime formats t with the time of day
+func (l *Localizer) DateTime(t time.Time) string {
+	return t.Format(l.layout(l.format.DateTime, "2006-01-02 15:04"))
+}
+
+func (l *Localizer) layout(layout, fallback string) string {
+	if layout == "" {
+		return fallback
+	}
+	return layout
+}
+
+var symbols = map[string]string{
+	"TRY": "₺",
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+}
@@ -0,0 +1,240 @@
+package installment
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"tapsilat-go-example/store"
+)
+
+// Option is one installment count offered by a rule
+type Option struct {
+	Count     int     `json:"count"`
+	Rate      float64 `json:"rate"`                 // commission the gateway adds for this count, in percent of the amount
+	MinAmount float64 `json:"min_amount,omitempty"` // smallest basket this count is offered for
+}
+
+// Rule offers installment options. Empty filters match everything.
+// Rules are applied in order; a later rule replaces the rate of a count offered earlier.
+type Rule struct {
+	ID         string   `json:"id"`
+	CardFamily string   `json:"card_family,omitempty"` // e.g. bonus, world, maximum, axess
+	Bank       string   `json:"bank,omitempty"`
+	Categories []string `json:"categories,omitempty"` // matches when any basket line is in one of them
+	MaxCount   int      `json:"max_count,omitempty"`  // caps the count for matching baskets, 0 means no cap
+	Options    []Option `json:"options,omitempty"`
+	Active     bool     `json:"active"`
+}
+
+// Config is the installment configuration
+type Config struct {
+	MaxCount int    `json:"max_count"`
+	Rules    []Rule `json:"rules"`
+}
+
+// Request describes the basket and, when known, the card to quote for
+type Request struct {
+	Amount     float64
+	Rate       float64 // converts base-currency minimum amounts into the amount's currency, 0 means 1
+	CardFamily string
+	Bank       string
+	Categories []string
+}
+
+// Plan is the cost of paying in Count installments. The order is created for the
+// basket amount; Commission is added by the gateway on the hosted checkout once the card
+// holder picks Count there, so Monthly and Total are what the card holder is charged.
+type Plan struct {
+	Count      int     `json:"count"`
+	Rate       float64 `json:"rate"`
+	Monthly    float64 `json:"monthly"`
+	Total      float64 `json:"total"`
+	Commission float64 `json:"commission"`
+}
+
+// DefaultConfig offers up to 12 installments to every card, longer plans from larger baskets
+func DefaultConfig() Config {
+	return Config{
+		MaxCount: 12,
+		Rules: []Rule{
+			{ID: "standard", Active: true, Options: []Option{
+				{Count: 1, Rate: 0},
+				{Count: 2, Rate: 2.49},
+				{Count: 3, Rate: 3.49},
+				{Count: 6, Rate: 6.99, MinAmount: 300},
+				{Count: 9, Rate: 9.99, MinAmount: 300},
+				{Count: 12, Rate: 12.99, MinAmount: 500},
+			}},
+			{ID: "jewelry", Active: true, Categories: []string{"Jewelry"}, MaxCount: 1},
+		},
+	}
+}
+
+// Engine evaluates installment rules
+type Engine struct {
+	mu   sync.RWMutex
+	file *store.JSONFile
+	cfg  Config
+}
+
+// NewEngine loads the installment rules from path, falling back to DefaultConfig
+func NewEngine(path string) (*Engine, error) {
+	e := &Engine{
+		file: store.NewJSONFile(path),
+		cfg:  DefaultConfig(),
+	}
+	if err := e.file.Load(&e.cfg); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Config returns the current configuration
+func (e *Engine) Config() Config {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.cfg
+}
+
+// SetConfig validates and stores a new configuration
+func (e *Engine) SetConfig(cfg Config) error {
+	if cfg.MaxCount < 1 {
+		return fmt.Errorf("max_count must be at least 1")
+	}
+	for _, r := range cfg.Rules {
+		if r.MaxCount < 0 {
+			return fmt.Errorf("rule %s: max_count cannot be negative", r.ID)
+		}
+		for _, o := range r.Options {
+			if o.Count < 1 || o.Count > cfg.MaxCount {
+				return fmt.Errorf("rule %s: count %d is out of range", r.ID, o.Count)
+			}
+			if o.Rate < 0 || o.MinAmount < 0 {
+				return fmt.Errorf("rule %s: rate and min_amount cannot be negative", r.ID)
+			}
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.cfg = cfg
+	return e.file.Save(e.cfg)
+}
+
+// Quote returns the plans available for a request, ordered by count.
+// Paying in one installment is always possible.
+func (e *Engine) Quote(req Request) []Plan {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	rates, limit := e.optionsLocked(req)
+	plans := make([]Plan, 0, len(rates))
+	for count, rate := range rates {
+		if count > limit {
+			continue
+		}
+		total := round(req.Amount * (1 + rate/100))
+		plans = append(plans, Plan{
+			Count:      count,
+			Rate:       rate,
+			Monthly:    round(total / float64(count)),
+			Total:      total,
+			Commission: round(total - req.Amount),
+		})
+	}
+	sort.Slice(plans, func(i, j int) bool { return plans[i].Count < plans[j].Count })
+	return plans
+}
+
+// Enabled returns the installment counts any card may use for the basket. The card is
+// only known on the hosted checkout, so card-specific rules are included as well.
+func (e *Engine) Enabled(req Request) []int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	type card struct{ family, bank string }
+	cards := []card{{}}
+	for _, r := range e.cfg.Rules {
+		if r.Active && (r.CardFamily != "" || r.Bank != "") {
+			cards = append(cards, card{r.CardFamily, r.Bank})
+		}
+	}
+
+	counts := make(map[int]bool)
+	for _, cd := range cards {
+		req.CardFamily, req.Bank = cd.family, cd.bank
+		rates, limit := e.optionsLocked(req)
+		for count := range rates {
+			if count <= limit {
+				counts[count] = true
+			}
+		}
+	}
+
+	enabled := make([]int, 0, len(counts))
+	for count := range counts {
+		enabled = append(enabled, count)
+	}
+	sort.Ints(enabled)
+	return enabled
+}
+
+// optionsLocked collects the rate per count from the matching rules and the lowest cap
+func (e *Engine) optionsLocked(req Request) (map[int]float64, int) {
+	rates := map[int]float64{1: 0}
+	limit := e.cfg.MaxCount
+	rate := req.Rate
+	if rate == 0 {
+		rate = 1
+	}
+	for _, r := range e.cfg.Rules {
+		if !r.Active || !r.matches(req) {
+			continue
+		}
+		if r.MaxCount > 0 && r.MaxCount < limit {
+			limit = r.MaxCount
+		}
+		for _, o := range r.Options {
+			if req.Amount >= o.MinAmount*rate {
+				rates[o.Count] = o.Rate
+			} else {
+				delete(rates, o.Count)
+			}
+		}
+	}
+	if _, ok := rates[1]; !ok {
+		rates[1] = 0
+	}
+	if limit < 1 {
+		limit = 1
+	}
+	return rates, limit
+}
+
+func (r Rule) matches(req Request) bool {
+	if r.CardFamily != "" && !strings.EqualFold(r.CardFamily, req.CardFamily) {
+		return false
+	}
+	if r.Bank != "" && !strings.EqualFold(r.Bank, req.Bank) {
+		return false
+	}
+	if len(r.Categories) == 0 {
+		return true
+	}
+	for _, want := range r.Categories {
+		for _, got := range req.Categories {
+			if strings.EqualFold(want, got) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
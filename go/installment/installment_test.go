@@ -0,0 +1,101 @@
+package installment
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func newEngine(t *testing.T, cfg Config) *Engine {
+	t.Helper()
+	e, err := NewEngine(filepath.Join(t.TempDir(), "installments.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.SetConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func counts(plans []Plan) []int {
+	list := make([]int, len(plans))
+	for i, p := range plans {
+		list[i] = p.Count
+	}
+	return list
+}
+
+func TestQuote(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Rules = append(cfg.Rules, Rule{ID: "bonus", CardFamily: "Bonus", Active: true, Options: []Option{
+		{Count: 3, Rate: 0},
+	}})
+	e := newEngine(t, cfg)
+
+	tests := []struct {
+		name string
+		req  Request
+		want []int
+	}{
+		{"small basket", Request{Amount: 100}, []int{1, 2, 3}},
+		{"mid basket", Request{Amount: 300}, []int{1, 2, 3, 6, 9}},
+		{"large basket", Request{Amount: 500}, []int{1, 2, 3, 6, 9, 12}},
+		{"converted minimum", Request{Amount: 300, Rate: 0.03}, []int{1, 2, 3, 6, 9, 12}},
+		{"capped category", Request{Amount: 1000, Categories: []string{"jewelry"}}, []int{1}},
+	}
+	for _, tt := range tests {
+		if got := counts(e.Quote(tt.req)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: counts = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	plans := e.Quote(Request{Amount: 1000})
+	three := plans[2]
+	if three.Count != 3 || three.Total != 1034.9 || three.Monthly != 344.97 || three.Commission != 34.9 {
+		t.Errorf("3 installments = %+v", three)
+	}
+	if plans[0].Total != 1000 || plans[0].Commission != 0 {
+		t.Errorf("single payment = %+v", plans[0])
+	}
+
+	// A later card rule replaces the rate of the same count
+	bonus := e.Quote(Request{Amount: 1000, CardFamily: "bonus"})
+	if bonus[2].Rate != 0 || bonus[2].Total != 1000 {
+		t.Errorf("bonus 3 installments = %+v", bonus[2])
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	e := newEngine(t, Config{MaxCount: 12, Rules: []Rule{
+		{ID: "all", Active: true, Options: []Option{{Count: 2, Rate: 2}}},
+		{ID: "world", CardFamily: "world", Active: true, Options: []Option{{Count: 6, Rate: 5}}},
+		{ID: "off", Active: false, Options: []Option{{Count: 9, Rate: 5}}},
+	}})
+
+	// The card is unknown when the order is created, so card rules count too
+	if got := e.Enabled(Request{Amount: 100}); !reflect.DeepEqual(got, []int{1, 2, 6}) {
+		t.Errorf("Enabled = %v, want [1 2 6]", got)
+	}
+}
+
+func TestSetConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"no max count", Config{}},
+		{"negative cap", Config{MaxCount: 12, Rules: []Rule{{ID: "a", MaxCount: -1}}}},
+		{"count above max", Config{MaxCount: 6, Rules: []Rule{{ID: "a", Options: []Option{{Count: 9}}}}}},
+		{"negative rate", Config{MaxCount: 12, Rules: []Rule{{ID: "a", Options: []Option{{Count: 2, Rate: -1}}}}}},
+	}
+	for _, tt := range tests {
+		e, err := NewEngine(filepath.Join(t.TempDir(), "installments.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := e.SetConfig(tt.cfg); err == nil {
+			t.Errorf("%s: SetConfig accepted an invalid config", tt.name)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"tapsilat-go-example/installment"
+
+	"github.com/gin-gonic/gin"
+)
+
+// installmentQuoteHandler returns the monthly payment and total for every installment option.
+// Orders are created for amount; the gateway adds the commission of the count picked on
+// the hosted checkout.
+// Query: amount (required), currency, card_family, bank and category (repeatable).
+func installmentQuoteHandler(c *gin.Context) {
+	amount, err := strconv.ParseFloat(c.Query("amount"), 64)
+	if err != nil || amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be a positive number"})
+		return
+	}
+
+	lock, err := fxEngine.Lock(c.Query("currency"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	plans := installmentEngine.Quote(installment.Request{
+		Amount:     amount,
+		Rate:       lock.Rate,
+		CardFamily: c.Query("card_family"),
+		Bank:       c.Query("bank"),
+		Categories: c.QueryArray("category"),
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"amount":                amount,
+		"currency":              lock.Currency,
+		"commission_applied_by": "gateway",
+		"options":               plans,
+	})
+}
+
+// getInstallmentConfigHandler returns the installment rules
+func getInstallmentConfigHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, installmentEngine.Config())
+}
+
+// updateInstallmentConfigHandler replaces the installment rules
+func updateInstallmentConfigHandler(c *gin.Context) {
+	var req installment.Config
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := installmentEngine.SetConfig(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, installmentEngine.Config())
+}
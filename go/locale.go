@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+
+	"tapsilat-go-example/i18n"
+
+	"github.com/gin-gonic/gin"
+)
+
+// localeCookie remembers the language picked with ?lang=
+const localeCookie = "lang"
+
+var translations *i18n.Catalog
+
+// setupTranslations loads the storefront message catalogs from LOCALES_DIR
+func setupTranslations() (*i18n.Catalog, error) {
+	dir := os.Getenv("LOCALES_DIR")
+	if dir == "" {
+		dir = "locales"
+	}
+	locale := os.Getenv("DEFAULT_LOCALE")
+	if locale == "" {
+		locale = "en"
+	}
+	return i18n.Load(dir, locale)
+}
+
+// requestLocale negotiates the locale of a request from, in order, the lang query parameter,
+// the lang cookie, the preferred locales given by the caller and Accept-Language
+func requestLocale(c *gin.Context, preferred ...string) string {
+	tags := []string{c.Query("lang")}
+	if cookie, err := c.Cookie(localeCookie); err == nil {
+		tags = append(tags, cookie)
+	}
+	tags = append(tags, preferred...)
+	tags = append(tags, i18n.ParseAcceptLanguage(c.GetHeader("Accept-Language"))...)
+	return translations.Match(tags...)
+}
+
+// pageLocalizer negotiates the locale of a page and keeps an explicit ?lang= choice in a cookie
+func pageLocalizer(c *gin.Context, preferred ...string) *i18n.Localizer {
+	locale := requestLocale(c, preferred...)
+	if lang := c.Query("lang"); lang != "" && translations.Supported(lang) {
+		c.SetCookie(localeCookie, locale, 365*24*60*60, "/", "", false, false)
+	}
+	c.Header("Content-Language", locale)
+	c.Header("Vary", "Accept-Language, Cookie")
+	return translations.Localizer(locale)
+}
+
+// Language is an entry of the language switcher
+type Language struct {
+	Code string
+	Name string
+}
+
+// localizedPage adds the localizer and the language switcher to page data
+func localizedPage(l *i18n.Localizer, data gin.H) gin.H {
+	var languages []Language
+	for _, code := range translations.Locales() {
+		languages = append(languages, Language{Code: code, Name: translations.Localizer(code).Name})
+	}
+	data["L"] = l
+	data["Languages"] = languages
+	return data
+}
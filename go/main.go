@@ -13,7 +13,22 @@ import (
 	"strings"
 	"time"
 
+	"tapsilat-go-example/cart"
+	"tapsilat-go-example/currency"
+	"tapsilat-go-example/customers"
+	"tapsilat-go-example/einvoice"
+	"tapsilat-go-example/installment"
+	"tapsilat-go-example/marketplace"
+	"tapsilat-go-example/orders"
+	"tapsilat-go-example/products"
+	"tapsilat-go-example/promo"
+	"tapsilat-go-example/risk"
+	"tapsilat-go-example/shipping"
+	"tapsilat-go-example/store"
+	"tapsilat-go-example/subscriptions"
+	"tapsilat-go-example/tax"
 	"tapsilat-go-example/utils"
+	"tapsilat-go-example/validation"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -21,7 +36,8 @@ import (
 	"github.com/tapsilat/tapsilat-go"
 )
 
-// Product represents a product in the catalog
+// Product is an order line. Clients only send id and quantity; validateOrderData fills in
+// name, prices, category, weight and seller from the product catalog.
 type Product struct {
 	ID          int     `json:"id"`
 	Name        string  `json:"name"`
@@ -29,25 +45,33 @@ type Product struct {
 	Description string  `json:"description"`
 	Image       string  `json:"image"`
 	Quantity    int     `json:"quantity,omitempty"`
+	Category    string  `json:"category,omitempty"`
+	Weight      float64 `json:"weight,omitempty"` // kilograms, used by weight-based shipping
+	// Prices are catalog prices per currency; other currencies are converted from Price
+	Prices map[string]float64 `json:"prices,omitempty"`
+	// SubmerchantKey is the marketplace seller, when not linked in the submerchant registry
+	SubmerchantKey string `json:"submerchant_key,omitempty"`
 }
 
-// Address represents billing/shipping address
+// Address represents billing/shipping address. Fields are checked by validateOrderData so
+// every problem is reported at once.
 type Address struct {
-	ContactName  string `json:"contact_name" binding:"required"`
-	Email        string `json:"email" binding:"required,email"`
-	ContactPhone string `json:"contact_phone" binding:"required"`
-	Address      string `json:"address" binding:"required"`
-	City         string `json:"city" binding:"required"`
+	ContactName  string `json:"contact_name"`
+	Email        string `json:"email"`
+	ContactPhone string `json:"contact_phone"` // normalized to E.164
+	Address      string `json:"address"`
+	City         string `json:"city"`
+	Country      string `json:"country,omitempty"` // ISO 3166 alpha-2, TR when empty
 	ZipCode      string `json:"zip_code"`
-	VatNumber    string `json:"vat_number" binding:"required"`
+	VatNumber    string `json:"vat_number"` // TCKN or VKN for Turkish buyers
 }
 
 // OrderRequest represents the order creation request
 type OrderRequest struct {
-	Cart                []Product                `json:"cart" binding:"required"`
+	Cart                []Product                `json:"cart"`
 	Installment         int                      `json:"installment"`
 	EnabledInstallments []int                    `json:"enabled_installments"`
-	Billing             Address                  `json:"billing" binding:"required"`
+	Billing             Address                  `json:"billing"`
 	Shipping            *Address                 `json:"shipping,omitempty"`
 	SameAddress         bool                     `json:"same_address"`
 	ConversationID      string                   `json:"conversation_id"`
@@ -58,6 +82,8 @@ type OrderRequest struct {
 	PaymentMethods      bool                     `json:"payment_methods"`
 	PaymentOptions      []string                 `json:"payment_options"`
 	Metadata            []tapsilat.OrderMetadata `json:"metadata"`
+	Coupons             []string                 `json:"coupons"`
+	ShippingMethod      string                   `json:"shipping_method"`
 }
 
 // OrderResponse represents the order creation response
@@ -65,7 +91,10 @@ type OrderResponse struct {
 	Success     bool   `json:"success"`
 	CheckoutURL string `json:"checkout_url,omitempty"`
 	Error       string `json:"error,omitempty"`
-	ReferenceID string `json:"reference_id,omitempty"`
+	// Errors lists the invalid fields when the request fails validation
+	Errors      validation.Errors `json:"errors,omitempty"`
+	ReferenceID string            `json:"reference_id,omitempty"`
+	CustomerID  string            `json:"customer_id,omitempty"`
 }
 
 // PaymentResult represents payment callback data
@@ -76,15 +105,18 @@ type PaymentResult struct {
 	ErrorMessage   string `form:"error_message"`
 }
 
-// SubscriptionRequest represents subscription creation request
+// SubscriptionRequest represents subscription creation request. Price, currency and
+// schedule come from the plan.
 type SubscriptionRequest struct {
-	Name            string  `json:"name"`
-	Amount          float64 `json:"amount"`
-	Period          int     `json:"period"` // 1: Monthly, etc.
-	PaymentDate     int     `json:"payment_date"`
-	CardID          string  `json:"card_id,omitempty"`
-	SubscriberEmail string  `json:"subscriber_email"`
-	SubscriberPhone string  `json:"subscriber_phone"`
+	PlanID          string `json:"plan_id"`
+	CardID          string `json:"card_id,omitempty"`
+	SubscriberEmail string `json:"subscriber_email"`
+	SubscriberPhone string `json:"subscriber_phone"` // normalized to E.164
+	// Country is the subscriber's ISO country code, Turkey when blank
+	Country string `json:"country,omitempty"`
+	// Billing is validated like an order's billing address. Without it the subscriber's
+	// default billing address is used, which needs their X-Customer-Token.
+	Billing *Address `json:"billing,omitempty"`
 }
 
 // SubscriptionResponse represents subscription creation response
@@ -92,10 +124,27 @@ type SubscriptionResponse struct {
 	Success     bool   `json:"success"`
 	CheckoutURL string `json:"checkout_url,omitempty"` // For subscriptions, this might be a redirect URL
 	Error       string `json:"error,omitempty"`
-	ReferenceID string `json:"reference_id,omitempty"`
+	// Errors lists the invalid fields when the request fails validation
+	Errors      validation.Errors `json:"errors,omitempty"`
+	ReferenceID string            `json:"reference_id,omitempty"`
+	PlanID      string            `json:"plan_id,omitempty"`
 }
 
 var utilsInstance *utils.Utils
+var orderStore *orders.Store
+var cartStore *cart.Store
+var productCatalog *products.Catalog
+var promoEngine *promo.Engine
+var taxEngine *tax.Engine
+var shippingEngine *shipping.Engine
+var fxEngine *currency.Engine
+var installmentEngine *installment.Engine
+var submerchants *marketplace.Registry
+var subscriptionPlans *subscriptions.Catalog
+var subscriptionStore *subscriptions.Registry
+var customerStore *customers.Registry
+var invoiceExporter *einvoice.Exporter
+var riskEngine *risk.Engine
 
 func init() {
 	// Load environment variables
@@ -104,6 +153,100 @@ func init() {
 	}
 
 	utilsInstance = utils.NewUtils()
+
+	// Load local order records
+	var err error
+	orderStore, err = orders.NewStore(store.DataPath("orders.json"))
+	if err != nil {
+		log.Fatal("Failed to load order store:", err)
+	}
+
+	// Load the product catalog carts and orders are priced from
+	productCatalog, err = products.NewCatalog(store.DataPath("products.json"))
+	if err != nil {
+		log.Fatal("Failed to load product catalog:", err)
+	}
+
+	// Load server-side carts
+	cartStore, err = cart.NewStore(store.DataPath("carts.json"), getEnvDuration("CART_TTL", 72*time.Hour))
+	if err != nil {
+		log.Fatal("Failed to load cart store:", err)
+	}
+
+	// Load coupons and redemptions
+	promoEngine, err = promo.NewEngine(store.DataPath("coupons.json"))
+	if err != nil {
+		log.Fatal("Failed to load coupons:", err)
+	}
+
+	// Load tax rates
+	taxEngine, err = tax.NewEngine(store.DataPath("tax.json"))
+	if err != nil {
+		log.Fatal("Failed to load tax configuration:", err)
+	}
+
+	// Load shipping methods
+	shippingEngine, err = shipping.NewEngine(store.DataPath("shipping.json"))
+	if err != nil {
+		log.Fatal("Failed to load shipping methods:", err)
+	}
+
+	// Load supported currencies and exchange rates
+	fxEngine, err = currency.NewEngine(store.DataPath("currency.json"))
+	if err != nil {
+		log.Fatal("Failed to load currency table:", err)
+	}
+
+	// Load installment rules
+	installmentEngine, err = installment.NewEngine(store.DataPath("installments.json"))
+	if err != nil {
+		log.Fatal("Failed to load installment rules:", err)
+	}
+
+	// Load marketplace submerchants
+	submerchants, err = marketplace.NewRegistry(store.DataPath("submerchants.json"))
+	if err != nil {
+		log.Fatal("Failed to load submerchants:", err)
+	}
+	submerchants.AllowUnlinked(os.Getenv("MARKETPLACE_ALLOW_UNLINKED") == "true")
+
+	// Load subscription plans and local subscription records
+	subscriptionPlans, err = subscriptions.NewCatalog(store.DataPath("plans.json"))
+	if err != nil {
+		log.Fatal("Failed to load subscription plans:", err)
+	}
+	subscriptionStore, err = subscriptions.NewRegistry(store.DataPath("subscriptions.json"))
+	if err != nil {
+		log.Fatal("Failed to load subscriptions:", err)
+	}
+
+	// Load customers and their address books
+	customerStore, err = customers.NewRegistry(store.DataPath("customers.json"))
+	if err != nil {
+		log.Fatal("Failed to load customers:", err)
+	}
+
+	// Load e-Arşiv/e-Fatura invoice numbering
+	invoiceExporter, err = einvoice.NewExporter(store.DataPath("einvoices.json"), einvoiceConfig())
+	if err != nil {
+		log.Fatal("Failed to load invoice numbering:", err)
+	}
+
+	// Load fraud screening rules and assessments
+	riskEngine, err = risk.NewEngine(store.DataPath("risk.json"))
+	if err != nil {
+		log.Fatal("Failed to load risk rules:", err)
+	}
+
+	// Load storefront translations
+	translations, err = setupTranslations()
+	if err != nil {
+		log.Fatal("Failed to load translations:", err)
+	}
+
+	// Pricing runs in this order for carts and orders: discounts, then tax on the
+	// discounted lines, then shipping (free-shipping thresholds see the taxed total)
+	cartPricers = []cart.Pricer{promoEngine, taxEngine, shippingEngine}
 }
 
 func main() {
@@ -115,6 +258,18 @@ func main() {
 	// Create Gin router
 	r := gin.Default()
 
+	// Believe X-Forwarded-For only from the configured proxies, none by default
+	if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
+
+	// Rate limit every route per client and route group
+	limiter, err := setupRateLimiter()
+	if err != nil {
+		log.Fatal("Failed to set up rate limiting:", err)
+	}
+	r.Use(limiter)
+
 	// Load HTML templates
 	r.LoadHTMLGlob("templates/*")
 
@@ -132,12 +287,117 @@ func main() {
 	r.GET("/api/payment/status/:reference_id", getPaymentStatusHandler)
 	r.GET("/api/order/conversation/:conversation_id", getOrderByConversationIDHandler)
 	r.GET("/api/order/details/:reference_id", getOrderDetailsHandler)
+	r.GET("/api/order/:reference_id/receipt.pdf", orderReceiptHandler)
+	r.GET("/api/order/:reference_id/invoice.xml", orderInvoiceHandler)
 	r.GET("/api/order/transactions/:reference_id", getOrderTransactionsHandler)
 	r.GET("/api/order/list", getOrderListHandler)
 	r.GET("/api/order/submerchants", getOrderSubmerchantsHandler)
 
+	// Product catalog
+	r.GET("/api/products", listProductsHandler)
+	r.GET("/api/admin/products", listAllProductsHandler)
+	r.POST("/api/admin/products", saveProductHandler)
+	r.DELETE("/api/admin/products/:id", deleteProductHandler)
+
+	// Cart API
+	cartStore.StartJanitor(time.Hour, log.Printf)
+	r.GET("/api/cart", getCartHandler)
+	r.DELETE("/api/cart", clearCartHandler)
+	r.POST("/api/cart/items", addCartItemHandler)
+	r.PUT("/api/cart/items/:product_id", updateCartItemHandler)
+	r.DELETE("/api/cart/items/:product_id", removeCartItemHandler)
+	r.PUT("/api/cart/currency", setCartCurrencyHandler)
+	r.POST("/api/cart/merge", mergeCartHandler)
+	r.POST("/api/admin/customers/:id/token", requireAdminKey, issueCustomerTokenHandler)
+	r.POST("/api/cart/checkout", checkoutCartHandler)
+
+	// Coupons API
+	r.POST("/api/cart/coupons", addCartCouponHandler)
+	r.DELETE("/api/cart/coupons/:code", removeCartCouponHandler)
+	r.GET("/api/admin/coupons", listCouponsHandler)
+	r.POST("/api/admin/coupons", saveCouponHandler)
+	r.DELETE("/api/admin/coupons/:code", deleteCouponHandler)
+	r.GET("/api/admin/coupons/redemptions", listRedemptionsHandler)
+
+	// Tax API
+	r.GET("/api/admin/tax", getTaxConfigHandler)
+	r.PUT("/api/admin/tax", updateTaxConfigHandler)
+
+	// Installments API
+	r.GET("/api/installments/quote", installmentQuoteHandler)
+	r.GET("/api/admin/installments", getInstallmentConfigHandler)
+	r.PUT("/api/admin/installments", updateInstallmentConfigHandler)
+
+	// Risk screening API
+	r.GET("/api/admin/risk", getRiskConfigHandler)
+	r.PUT("/api/admin/risk", updateRiskConfigHandler)
+	r.GET("/api/admin/risk/queue", riskQueueHandler)
+	r.GET("/api/admin/risk/assessments", listRiskAssessmentsHandler)
+	r.GET("/api/admin/risk/assessments/:id", getRiskAssessmentHandler)
+	r.POST("/api/admin/risk/assessments/:id/review", reviewRiskAssessmentHandler)
+
+	// Marketplace API
+	r.GET("/api/admin/submerchants", listSubmerchantsHandler)
+	r.POST("/api/admin/submerchants", saveSubmerchantHandler)
+	r.DELETE("/api/admin/submerchants/:key", deleteSubmerchantHandler)
+	r.PUT("/api/admin/submerchants/:key/products", linkSubmerchantProductsHandler)
+	r.GET("/api/admin/submerchants/:key/payouts", submerchantPayoutsHandler)
+	r.GET("/api/admin/payouts", payoutSummaryHandler)
+
+	// Customers and address books; a customer's own routes need their X-Customer-Token
+	r.GET("/api/admin/customers", listCustomersHandler)
+	r.POST("/api/admin/customers/resolve", resolveCustomerHandler)
+	r.GET("/api/admin/customers/:id", getCustomerHandler)
+	r.GET("/api/customers/:id", requireCustomerToken, getCustomerHandler)
+	r.GET("/api/customers/:id/orders", requireCustomerToken, customerOrdersHandler)
+	r.POST("/api/customers/:id/addresses", requireCustomerToken, saveCustomerAddressHandler)
+	r.DELETE("/api/customers/:id/addresses/:address_id", requireCustomerToken, deleteCustomerAddressHandler)
+
+	// Transactional email outbox and templates
+	r.GET("/api/admin/notifications", listNotificationsHandler)
+	r.GET("/api/admin/notifications/status", notificationStatusHandler)
+	r.POST("/api/admin/notifications/preview", previewNotificationHandler)
+	r.GET("/api/admin/notifications/:id", getNotificationHandler)
+	r.POST("/api/admin/notifications/:id/resend", resendNotificationHandler)
+
+	// Saved cards
+	r.GET("/api/customers/:id/cards", requireCustomerToken, listCustomerCardsHandler)
+	r.PUT("/api/customers/:id/cards/:card_id", requireCustomerToken, updateCustomerCardHandler)
+	r.DELETE("/api/customers/:id/cards/:card_id", requireCustomerToken, deleteCustomerCardHandler)
+	r.POST("/api/customers/:id/reorder", requireCustomerToken, reorderHandler)
+
+	// Subscription plan catalog
+	r.GET("/api/admin/plans", listAllPlansHandler)
+	r.POST("/api/admin/plans", savePlanHandler)
+	r.DELETE("/api/admin/plans/:id", deletePlanHandler)
+
+	// Currency API
+	r.GET("/api/currencies", listCurrenciesHandler)
+	r.GET("/api/admin/currency", getCurrencyTableHandler)
+	r.PUT("/api/admin/currency", updateCurrencyTableHandler)
+	r.POST("/api/admin/currency/rates", importRatesHandler)
+	r.POST("/api/admin/currency/sync", syncCurrenciesHandler)
+
+	// Shipping API
+	r.GET("/api/shipping/methods", listShippingMethodsHandler)
+	r.POST("/api/shipping/quote", shippingQuoteHandler)
+	r.PUT("/api/cart/shipping", setCartShippingHandler)
+	r.GET("/api/admin/shipping", listShippingMethodsHandler)
+	r.PUT("/api/admin/shipping", updateShippingMethodsHandler)
+
+	// Bulk Export API
+	r.GET("/api/export/orders", exportOrdersHandler)
+	r.GET("/api/export/transactions", exportTransactionsHandler)
+	r.GET("/api/export/einvoices", exportInvoicesHandler)
+	r.GET("/api/admin/einvoices", listInvoicesHandler)
+
 	// Subscription API
 	r.GET("/api/subscription/list", listSubscriptionsHandler)
+	r.GET("/api/subscription/plans", listPlansHandler)
+	r.POST("/api/subscription/change/preview", previewSubscriptionChangeHandler)
+	r.POST("/api/subscription/change", changeSubscriptionHandler)
+	r.POST("/api/subscription/pause", pauseSubscriptionHandler)
+	r.POST("/api/subscription/resume", resumeSubscriptionHandler)
 	r.POST("/api/subscription/cancel", cancelSubscriptionHandler)
 
 	// Payment Terms API
@@ -146,12 +406,38 @@ func main() {
 	r.POST("/api/term/delete", deleteOrderTermHandler)
 	r.POST("/api/term/update", updateOrderTermHandler)
 	r.POST("/api/term/refund", refundOrderTermHandler)
+	r.POST("/api/term/plan/preview", previewTermPlanHandler)
+	r.POST("/api/term/plan", createTermPlanHandler)
+
+	// Payment term reminders and overdue tracking
+	setupNotifier()
+	startTermTracker()
+	r.GET("/api/terms/tracked", listTrackedTermsHandler)
+	r.GET("/api/terms/overdue", overdueTermsHandler)
+	r.GET("/api/terms/tracker/status", termTrackerStatusHandler)
+	r.POST("/api/terms/tracker/run", termTrackerRunHandler)
+
+	// Subscription dunning (failed renewals), auto-resume and card expiry warnings
+	startDunning()
+	startSubscriptionResumer()
+	startCardExpiryWarnings()
+	r.GET("/api/subscriptions/past-due", pastDueSubscriptionsHandler)
+	r.GET("/api/subscriptions/dunning/status", dunningStatusHandler)
+	r.POST("/api/subscriptions/dunning/run", dunningRunHandler)
+	r.GET("/api/subscriptions/:reference_id", getSubscriptionHandler)
+	r.GET("/api/subscriptions/:reference_id/chain", subscriptionChainHandler)
+	r.POST("/api/subscriptions/:reference_id/change/retry", retryPlanChangeHandler)
 
 	// Additional Order Management
 	r.POST("/api/order/terminate", terminateOrderHandler)
 	r.POST("/api/order/manual-callback", manualCallbackHandler)
 	r.GET("/api/organization/settings", getOrganizationSettingsHandler)
 
+	// Status Poller (fallback when callbacks never arrive)
+	startStatusPoller()
+	r.GET("/api/poller/status", pollerStatusHandler)
+	r.POST("/api/poller/run", pollerRunHandler)
+
 	// Ensure webhooks directory exists
 	if _, err := os.Stat("webhooks"); os.IsNotExist(err) {
 		os.Mkdir("webhooks", 0755)
@@ -172,6 +458,11 @@ func main() {
 			fmt.Println("Webhook saved:", filename)
 		}
 
+		// Move the local order to the state reported by the callback
+		applyWebhookTransition(c.Param("type"), body)
+		// Failed renewals start dunning, paid ones end it
+		applySubscriptionWebhook(c.Param("type"), body)
+
 		c.JSON(http.StatusOK, gin.H{"status": "received"})
 	}
 
@@ -234,9 +525,10 @@ func main() {
 
 // indexHandler serves the main page
 func indexHandler(c *gin.Context) {
-	c.HTML(http.StatusOK, "index.html", gin.H{
-		"title": "Tapsilat E-Commerce Cart",
-	})
+	l := pageLocalizer(c)
+	c.HTML(http.StatusOK, "index.html", localizedPage(l, gin.H{
+		"title": l.T("page.title"),
+	}))
 }
 
 // createOrderHandler handles order creation
@@ -252,39 +544,139 @@ func createOrderHandler(c *gin.Context) {
 		return
 	}
 
+	response, status := processOrder(c, req)
+	c.JSON(status, response)
+}
+
+// processOrder validates a bound order request and submits it to Tapsilat.
+// It is shared by createOrderHandler and the cart checkout.
+func processOrder(c *gin.Context, req OrderRequest) (OrderResponse, int) {
+	// The hosted checkout follows the storefront language unless the request sets a
+	// supported one
+	if req.Locale == "" {
+		req.Locale = requestLocale(c)
+	} else {
+		req.Locale = translations.Match(req.Locale)
+	}
+
 	// Validate order data
-	if err := validateOrderData(req); err != nil {
-		utilsInstance.LogError("Order validation failed", err.Error())
-		c.JSON(http.StatusBadRequest, OrderResponse{
+	if errs := validateOrderData(&req); len(errs) > 0 {
+		utilsInstance.LogError("Order validation failed", errs.Error())
+		return OrderResponse{
 			Success: false,
-			Error:   err.Error(),
-		})
-		return
+			Error:   "Invalid order data: " + errs.Error(),
+			Errors:  errs,
+		}, http.StatusBadRequest
 	}
 
 	// Get API client
 	apiClient, err := getAPIClient()
 	if err != nil {
 		utilsInstance.LogError("Failed to create API client", err.Error())
-		c.JSON(http.StatusInternalServerError, OrderResponse{
+		return OrderResponse{
 			Success: false,
 			Error:   "Internal server error",
-		})
-		return
+		}, http.StatusInternalServerError
+	}
+
+	// Per-buyer coupon limits and risk screening use the buyer id of a known customer;
+	// customers are only created once the order passes screening
+	knownBuyerID := ""
+	if existing, ok := customerStore.Find(req.Billing.Email, req.Billing.ContactPhone); ok {
+		knownBuyerID = existing.ID
 	}
 
-	// Calculate total
-	total := calculateTotal(req.Cart)
+	// Price the cart server-side in the order currency before building basket items.
+	// Unsupported currencies are rejected here, before anything is sent to Tapsilat.
+	pricedCart := orderCart(req, knownBuyerID)
+	totals, lock, err := priceCart(pricedCart)
+	if err != nil {
+		return OrderResponse{
+			Success: false,
+			Error:   err.Error(),
+		}, http.StatusBadRequest
+	}
+	req.Currency = lock.Currency
+
+	// The selected installment count must be one the rules offer for this basket
+	if !containsInt(orderInstallments(req, totals), req.Installment) {
+		return OrderResponse{
+			Success: false,
+			Error:   fmt.Sprintf("installment %d is not available for this order", req.Installment),
+		}, http.StatusBadRequest
+	}
+
+	// Split each line between the platform and its submerchant
+	splits, err := submerchants.Split(splitItems(req, totals))
+	if err != nil {
+		return OrderResponse{
+			Success: false,
+			Error:   err.Error(),
+		}, http.StatusBadRequest
+	}
 
 	// Create reference and conversation IDs
 	referenceID := utilsInstance.GenerateReferenceID("ORDER")
-	conversationID := generateConversationID()
+	// A client-supplied conversation id is used as is, so resolve it before screening and
+	// use the same id for the order, the coupons and the local record
+	conversationID := req.ConversationID
+	if conversationID == "" {
+		conversationID = generateConversationID()
+	}
+
+	// Screen the order before anything is reserved or sent to Tapsilat
+	assessment, err := riskEngine.Assess(risk.Request{
+		ConversationID:  conversationID,
+		IP:              c.ClientIP(),
+		Email:           req.Billing.Email,
+		Phone:           req.Billing.ContactPhone,
+		BuyerID:         knownBuyerID,
+		Amount:          totals.Total,
+		Currency:        req.Currency,
+		BillingCountry:  req.Billing.Country,
+		ShippingCountry: orderShippingAddress(req).Country,
+	}, time.Now())
+	if err != nil {
+		utilsInstance.LogError("Failed to screen order", err.Error())
+		return OrderResponse{
+			Success: false,
+			Error:   "Internal server error",
+		}, http.StatusInternalServerError
+	}
+	switch assessment.Decision {
+	case risk.DecisionBlock:
+		utilsInstance.LogError("Order blocked by risk screening", map[string]interface{}{
+			"assessment_id":   assessment.ID,
+			"conversation_id": conversationID,
+			"score":           assessment.Score,
+			"reasons":         assessment.Reasons,
+		})
+		// The reasons are for reviewers only
+		return OrderResponse{
+			Success: false,
+			Error:   "This order cannot be processed, please contact support",
+		}, http.StatusForbidden
+	case risk.DecisionChallenge:
+		req.ThreeDForce = true
+	}
+
+	// The same customer keeps the same buyer id across orders
+	buyerID, ownAddressBook := orderBuyer(c, req.Billing.Email, req.Billing.ContactPhone, req.Billing.ContactName)
 
 	// Get base URL
 	baseURL := getBaseURL(c.Request)
 
 	// Create order
-	order := createTapsilatOrder(req, total, referenceID, conversationID, baseURL)
+	order := createTapsilatOrder(req, totals, splits, referenceID, conversationID, buyerID, baseURL)
+
+	// Hold the coupons while the order is being paid. A known customer keeps the buyer id
+	// the cart was priced with; a new one starts without redemptions either way.
+	if err := promoEngine.Reserve(conversationID, buyerID, pricedCart.Coupons, totals); err != nil {
+		return OrderResponse{
+			Success: false,
+			Error:   err.Error(),
+		}, http.StatusBadRequest
+	}
 
 	// Submit order to Tapsilat
 	response, err := apiClient.CreateOrder(c.Request.Context(), order)
@@ -294,11 +686,13 @@ func createOrderHandler(c *gin.Context) {
 			"reference_id":    referenceID,
 			"conversation_id": conversationID,
 		})
-		c.JSON(http.StatusInternalServerError, OrderResponse{
+		if err := promoEngine.Release(conversationID); err != nil {
+			utilsInstance.LogError("Failed to release coupons", err.Error())
+		}
+		return OrderResponse{
 			Success: false,
 			Error:   "Failed to create order: " + err.Error(),
-		})
-		return
+		}, http.StatusInternalServerError
 	}
 
 	// Get checkout URL like Python/PHP implementations
@@ -313,11 +707,55 @@ func createOrderHandler(c *gin.Context) {
 
 	log.Printf("Order created successfully: %s", response.ReferenceID)
 
-	c.JSON(http.StatusOK, OrderResponse{
+	if err := riskEngine.Attach(assessment.ID, response.ReferenceID); err != nil {
+		utilsInstance.LogError("Failed to link risk assessment", err.Error())
+	}
+
+	// Keep a local record so the status poller can follow up if no callback arrives
+	if err := orderStore.Create(orders.Record{
+		ReferenceID:     response.ReferenceID,
+		ConversationID:  conversationID,
+		Amount:          totals.Total,
+		Discount:        totals.Discount,
+		Coupons:         pricedCart.Coupons,
+		Net:             totals.Net,
+		Tax:             totals.Tax,
+		Gross:           totals.Gross,
+		TaxIncluded:     totals.TaxIncluded,
+		TaxLines:        orderTaxLines(totals),
+		Lines:           orderLines(pricedCart, totals),
+		Shipping:        totals.Shipping,
+		ShippingMethod:  totals.ShippingMethod,
+		Currency:        order.Currency,
+		FXBase:          lock.Base,
+		FXRate:          lock.Rate,
+		FXRateAt:        lock.RateAt,
+		Payouts:         orderPayouts(splits),
+		BuyerEmail:      req.Billing.Email,
+		CustomerID:      buyerID,
+		Locale:          req.Locale,
+		Installment:     req.Installment,
+		Risk:            orderRisk(assessment),
+		BillingAddress:  orderRecordAddress(req.Billing),
+		ShippingAddress: orderRecordAddress(orderShippingAddress(req)),
+	}); err != nil {
+		utilsInstance.LogError("Failed to store local order", map[string]interface{}{
+			"reference_id": response.ReferenceID,
+			"error":        err.Error(),
+		})
+	}
+
+	// Keep the addresses for the next checkout
+	if ownAddressBook {
+		rememberOrderAddresses(buyerID, req)
+	}
+
+	return OrderResponse{
 		Success:     true,
 		CheckoutURL: checkoutURL,
 		ReferenceID: response.ReferenceID,
-	})
+		CustomerID:  buyerID,
+	}, http.StatusOK
 }
 
 // paymentSuccessHandler handles successful payment callback
@@ -327,10 +765,18 @@ func paymentSuccessHandler(c *gin.Context) {
 
 	log.Printf("Payment success callback: %+v", result)
 
-	c.HTML(http.StatusOK, "payment_success.html", gin.H{
+	data := gin.H{
 		"ReferenceID":    result.ReferenceID,
 		"ConversationID": result.ConversationID,
-	})
+		"Date":           time.Now(),
+	}
+	// Show the tax breakdown when the order was created through this app, in its checkout locale
+	locale := ""
+	if rec, ok := orderStore.Get(result.ReferenceID); ok {
+		data["Order"] = rec
+		locale = rec.Locale
+	}
+	c.HTML(http.StatusOK, "payment_success.html", localizedPage(pageLocalizer(c, locale), data))
 }
 
 // paymentFailureHandler handles failed payment callback
@@ -340,11 +786,16 @@ func paymentFailureHandler(c *gin.Context) {
 
 	log.Printf("Payment failure callback: %+v", result)
 
-	c.HTML(http.StatusOK, "payment_failure.html", gin.H{
+	locale := ""
+	if rec, ok := orderStore.Get(result.ReferenceID); ok {
+		locale = rec.Locale
+	}
+	c.HTML(http.StatusOK, "payment_failure.html", localizedPage(pageLocalizer(c, locale), gin.H{
 		"ReferenceID":    result.ReferenceID,
 		"ConversationID": result.ConversationID,
 		"ErrorMessage":   result.ErrorMessage,
-	})
+		"Date":           time.Now(),
+	}))
 }
 
 // getPaymentStatusHandler gets payment status
@@ -443,25 +894,138 @@ func getAPIClient() (*tapsilat.API, error) {
 	return tapsilat.NewAPI(apiKey), nil
 }
 
-func validateOrderData(req OrderRequest) error {
+// getEnvDuration reads a duration such as "30s" or "5m" from the environment
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Warning: invalid %s=%q, using %s", key, value, fallback)
+		return fallback
+	}
+	return d
+}
+
+// getEnvInts reads a comma separated list of non-negative integers such as "7,3,1"
+func getEnvInts(key string, fallback []int) []int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	var ints []int
+	for _, part := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < 0 {
+			log.Printf("Warning: invalid %s=%q, using %v", key, value, fallback)
+			return fallback
+		}
+		ints = append(ints, n)
+	}
+	return ints
+}
+
+// validateOrderData checks an order request field by field and normalizes the phone
+// numbers, tax numbers and postal codes it accepts
+func validateOrderData(req *OrderRequest) validation.Errors {
+	var errs validation.Errors
 	if len(req.Cart) == 0 {
-		return fmt.Errorf("cart cannot be empty")
+		errs.Addf("cart", "required", "cannot be empty")
+	}
+	for i, item := range req.Cart {
+		field := fmt.Sprintf("cart[%d]", i)
+		if item.Quantity < 1 {
+			errs.Addf(field+".quantity", "invalid_quantity", "must be at least 1")
+			continue
+		}
+		product, err := catalogProduct(item.ID, item.Quantity)
+		if err != nil {
+			errs.Addf(field+".id", "unknown_product", "%v", err)
+			continue
+		}
+		req.Cart[i] = product
+	}
+	if req.Installment < 1 {
+		errs.Addf("installment", "invalid_installment", "must be at least 1")
+	}
+	validateAddress(&errs, "billing", &req.Billing)
+	if !req.SameAddress && req.Shipping != nil {
+		validateAddress(&errs, "shipping", req.Shipping)
 	}
+	return errs
+}
 
-	if req.Installment < 1 || req.Installment > 12 {
-		return fmt.Errorf("installment must be between 1 and 12")
+// validateAddress checks an order address using the rules of its country
+func validateAddress(errs *validation.Errors, field string, a *Address) {
+	normalize := func(name string, value *string, fn func(string) (string, error)) {
+		if v, err := fn(*value); err != nil {
+			errs.Add(field+"."+name, err)
+		} else {
+			*value = v
+		}
 	}
 
-	// Basic validation without Turkish-specific checks
-	if req.Billing.ContactPhone == "" {
-		return fmt.Errorf("phone number is required")
+	errs.Required(field+".contact_name", a.ContactName)
+	errs.Required(field+".address", a.Address)
+	errs.Required(field+".city", a.City)
+	if errs.Required(field+".email", a.Email) {
+		normalize("email", &a.Email, validation.Email)
 	}
 
-	if req.Billing.VatNumber == "" {
-		return fmt.Errorf("vat number is required")
+	country, err := validation.Country(a.Country)
+	if err != nil {
+		errs.Add(field+".country", err)
+		return
+	}
+	a.Country = country
+	if errs.Required(field+".contact_phone", a.ContactPhone) {
+		normalize("contact_phone", &a.ContactPhone, func(s string) (string, error) { return validation.Phone(s, country) })
+	}
+	if errs.Required(field+".vat_number", a.VatNumber) {
+		normalize("vat_number", &a.VatNumber, func(s string) (string, error) { return validation.TaxID(s, country) })
 	}
+	if strings.TrimSpace(a.ZipCode) != "" {
+		normalize("zip_code", &a.ZipCode, func(s string) (string, error) { return validation.PostalCode(s, country) })
+	}
+}
 
-	return nil
+// validateSubscriptionRequest checks a subscription request field by field and normalizes
+// the subscriber's email and phone number
+func validateSubscriptionRequest(req *SubscriptionRequest) validation.Errors {
+	var errs validation.Errors
+	errs.Required("plan_id", req.PlanID)
+	if errs.Required("subscriber_email", req.SubscriberEmail) {
+		if email, err := validation.Email(req.SubscriberEmail); err != nil {
+			errs.Add("subscriber_email", err)
+		} else {
+			req.SubscriberEmail = email
+		}
+	}
+	country, err := validation.Country(req.Country)
+	if err != nil {
+		errs.Add("country", err)
+		return errs
+	}
+	req.Country = country
+	if strings.TrimSpace(req.SubscriberPhone) != "" {
+		if phone, err := validation.Phone(req.SubscriberPhone, country); err != nil {
+			errs.Add("subscriber_phone", err)
+		} else {
+			req.SubscriberPhone = phone
+		}
+	}
+	if req.Billing != nil {
+		// The subscriber's email and phone stand in for the billing contact
+		if strings.TrimSpace(req.Billing.Email) == "" {
+			req.Billing.Email = req.SubscriberEmail
+		}
+		if strings.TrimSpace(req.Billing.ContactPhone) == "" {
+			req.Billing.ContactPhone = req.SubscriberPhone
+		}
+		validateAddress(&errs, "billing", req.Billing)
+	}
+	return errs
 }
 
 // createSubscriptionHandler handles subscription creation
@@ -475,6 +1039,14 @@ func createSubscriptionHandler(c *gin.Context) {
 		})
 		return
 	}
+	if errs := validateSubscriptionRequest(&req); len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, SubscriptionResponse{
+			Success: false,
+			Error:   "Invalid subscription data: " + errs.Error(),
+			Errors:  errs,
+		})
+		return
+	}
 
 	apiClient, err := getAPIClient()
 	if err != nil {
@@ -485,8 +1057,53 @@ func createSubscriptionHandler(c *gin.Context) {
 		return
 	}
 
+	plan, ok := subscriptionPlans.Get(req.PlanID)
+	if !ok || !plan.Active {
+		c.JSON(http.StatusBadRequest, SubscriptionResponse{
+			Success: false,
+			Error:   fmt.Sprintf("plan %s is not available", req.PlanID),
+		})
+		return
+	}
+	// Plans saved before trials were refused; the gateway would charge at once
+	if plan.TrialDays > 0 {
+		c.JSON(http.StatusBadRequest, SubscriptionResponse{
+			Success: false,
+			Error:   fmt.Sprintf("plan %s has a trial, which Tapsilat subscriptions do not support", plan.ID),
+		})
+		return
+	}
+	// The currency may have been dropped since the plan was saved
+	if !fxEngine.IsSupported(plan.Currency) {
+		c.JSON(http.StatusBadRequest, SubscriptionResponse{
+			Success: false,
+			Error:   fmt.Sprintf("currency %s is not supported", plan.Currency),
+		})
+		return
+	}
+
+	// Charge the chosen saved card, or the subscriber's default card
+	cardID, err := subscriptionCard(c, req, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, SubscriptionResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	req.CardID = cardID
+
+	billing, status, err := subscriptionBilling(c, req)
+	if err != nil {
+		c.JSON(status, SubscriptionResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
 	baseURL := getBaseURL(c.Request)
-	subscription := createTapsilatSubscription(req, baseURL)
+	subscription := createTapsilatSubscription(req, plan, billing, baseURL)
 
 	response, err := apiClient.CreateSubscription(c.Request.Context(), subscription)
 	if err != nil {
@@ -510,82 +1127,171 @@ func createSubscriptionHandler(c *gin.Context) {
 		}
 	}
 
-	c.JSON(http.StatusOK, SubscriptionResponse{
+	resp := SubscriptionResponse{
 		Success:     true,
 		ReferenceID: response.ReferenceID,
 		CheckoutURL: checkoutURL,
-	})
+		PlanID:      plan.ID,
+	}
+
+	// Keep a local record so the gateway list can be shown with plan details
+	_, err = subscriptionStore.Create(subscriptions.Subscription{
+		ReferenceID:      response.ReferenceID,
+		OrderReferenceID: response.OrderReferenceID,
+		SubscriberEmail:  strings.ToLower(strings.TrimSpace(req.SubscriberEmail)),
+		SubscriberPhone:  req.SubscriberPhone,
+		Country:          req.Country,
+		CardID:           req.CardID,
+		BaseURL:          baseURL,
+	}, plan)
+	if err != nil {
+		utilsInstance.LogError("Failed to store subscription", map[string]interface{}{
+			"reference_id": response.ReferenceID,
+			"error":        err.Error(),
+		})
+	}
+
+	// Plan changes bill proration orders to the default billing address
+	if req.Billing != nil {
+		rememberSubscriptionBilling(c, req)
+	}
+
+	c.JSON(http.StatusOK, resp)
 }
 
-func createTapsilatSubscription(req SubscriptionRequest, baseURL string) tapsilat.SubscriptionCreateRequest {
+// gatewayCountry converts a validated ISO country code to the country name Tapsilat
+// expects, e.g. "TR" to "Turkey"
+func gatewayCountry(code string) string {
+	if code == "" {
+		code = validation.DefaultCountry
+	}
+	return validation.CountryName(code)
+}
+
+// createTapsilatSubscription builds the gateway request for a subscription on plan,
+// sending the subscriber's name, address and identity number from billing
+func createTapsilatSubscription(req SubscriptionRequest, plan subscriptions.Plan, billing Address, baseURL string) tapsilat.SubscriptionCreateRequest {
 	return tapsilat.SubscriptionCreateRequest{
-		Title:    req.Name,
-		Amount:   req.Amount,
-		Currency: "TRY",
-		Period:   req.Period,
-		PaymentDate: func() int {
-			if req.PaymentDate < 1 {
-				return 1
-			}
-			return req.PaymentDate
-		}(),
-		Cycle:      12, // Default 1 year
-		SuccessURL: fmt.Sprintf("%s/payment/success", baseURL),
-		FailureURL: fmt.Sprintf("%s/payment/failure", baseURL),
+		Title:       plan.Name,
+		Amount:      plan.Price,
+		Currency:    currency.Normalize(plan.Currency),
+		Period:      plan.Period,
+		PaymentDate: plan.PaymentDay,
+		Cycle:       plan.Cycle,
+		CardID:      req.CardID,
+		SuccessURL:  fmt.Sprintf("%s/payment/success", baseURL),
+		FailureURL:  fmt.Sprintf("%s/payment/failure", baseURL),
 		User: tapsilat.SubscriptionUser{
-			FirstName:      "John",
-			LastName:       "Doe",
-			Email:          req.SubscriberEmail,
-			Phone:          req.SubscriberPhone,
-			Address:        "Mock Address",
-			City:           "Istanbul",
-			Country:        "Turkey",
-			ZipCode:        "34000",
-			IdentityNumber: "11111111111",
+			FirstName:      extractFirstName(billing.ContactName),
+			LastName:       extractLastName(billing.ContactName),
+			Email:          billing.Email,
+			Phone:          subscriberPhone(req, billing),
+			Address:        billing.Address,
+			City:           billing.City,
+			Country:        gatewayCountry(billing.Country),
+			ZipCode:        getZipCode(billing.ZipCode),
+			IdentityNumber: billing.VatNumber,
 		},
 		Billing: tapsilat.SubscriptionBilling{
-			ContactName: "John Doe",
-			Country:     "Turkey",
-			City:        "Istanbul",
-			Address:     "Mock Billing Address",
-			ZipCode:     "34000",
+			ContactName: billing.ContactName,
+			Country:     gatewayCountry(billing.Country),
+			City:        billing.City,
+			Address:     billing.Address,
+			ZipCode:     getZipCode(billing.ZipCode),
 		},
 	}
 }
 
-func calculateTotal(cart []Product) float64 {
-	total := 0.0
-	for _, item := range cart {
-		total += item.Price * float64(item.Quantity)
+// subscriberPhone prefers the phone number sent with the subscription request
+func subscriberPhone(req SubscriptionRequest, billing Address) string {
+	if req.SubscriberPhone != "" {
+		return req.SubscriberPhone
 	}
-	return total
+	return billing.ContactPhone
 }
 
-func createTapsilatOrder(req OrderRequest, total float64, referenceID, conversationID, baseURL string) tapsilat.Order {
+// orderCart turns an order request into a cart so it is priced like a server-side cart.
+// buyerID is the customer the per-buyer coupon limits are checked for.
+func orderCart(req OrderRequest, buyerID string) cart.Cart {
+	c := cart.Cart{
+		CustomerID:     buyerID,
+		Currency:       req.Currency,
+		Country:        orderShippingAddress(req).Country,
+		ShippingCity:   orderShippingAddress(req).City,
+		ShippingMethod: req.ShippingMethod,
+		Lines:          make([]cart.Line, 0, len(req.Cart)),
+		Coupons:        req.Coupons,
+	}
+	for _, item := range req.Cart {
+		c.Lines = append(c.Lines, cart.Line{
+			ProductID:      item.ID,
+			Name:           item.Name,
+			Price:          item.Price,
+			Quantity:       item.Quantity,
+			Category:       productCategory(item),
+			Weight:         item.Weight,
+			Prices:         item.Prices,
+			SubmerchantKey: item.SubmerchantKey,
+		})
+	}
+	return c
+}
+
+// orderShippingAddress returns the shipping address, which is the billing address unless a separate one is given
+func orderShippingAddress(req OrderRequest) Address {
+	if !req.SameAddress && req.Shipping != nil {
+		return *req.Shipping
+	}
+	return req.Billing
+}
+
+func createTapsilatOrder(req OrderRequest, totals cart.Totals, splits []marketplace.Split, referenceID, conversationID, buyerID, baseURL string) tapsilat.Order {
 	// Create basket items - match Python/PHP implementation
 	basketItems := make([]tapsilat.OrderBasketItem, 0, len(req.Cart))
-	for _, item := range req.Cart {
-		// Calculate total price for this item (unit price * quantity)
-		totalPrice := item.Price * float64(item.Quantity)
+	for i, item := range req.Cart {
+		// Total price for this item (unit price * quantity) minus its share of the discount, plus tax when prices exclude it
+		totalPrice := lineGross(totals, i)
 		// Set quantity to 1 since price is already total - this is key for Tapsilat API
 		quantity := 1
 
-		basketItems = append(basketItems, tapsilat.OrderBasketItem{
+		basketItem := tapsilat.OrderBasketItem{
 			Id:        strconv.Itoa(item.ID),
 			Name:      item.Name,
-			Price:     totalPrice, // Total price (unit * quantity)
+			Price:     totalPrice, // Total price (unit * quantity - discount + tax)
 			Quantity:  &quantity,  // Always 1 since price is total
-			Category1: "Electronics",
+			Category1: productCategory(item),
 			Category2: "",
 			ItemType:  "PHYSICAL",
+		}
+		// Marketplace lines carry the seller and what it is paid after commission
+		if i < len(splits) && splits[i].SubmerchantKey != "" {
+			basketItem.SubMerchantKey = splits[i].SubmerchantKey
+			basketItem.SubMerchantPrice = strconv.FormatFloat(splits[i].Payout, 'f', 2, 64)
+			basketItem.CommissionAmount = splits[i].Commission
+		}
+		basketItems = append(basketItems, basketItem)
+	}
+
+	// Shipping is charged as its own basket item so the basket adds up to the order amount
+	if totals.Shipping > 0 {
+		quantity := 1
+		name := totals.ShippingMethod
+		if method, ok := shippingEngine.Method(totals.ShippingMethod); ok {
+			name = method.Name
+		}
+		basketItems = append(basketItems, tapsilat.OrderBasketItem{
+			Id:        "SHIPPING-" + strings.ToUpper(totals.ShippingMethod),
+			Name:      name,
+			Price:     totals.Shipping,
+			Quantity:  &quantity,
+			Category1: "Shipping",
+			Category2: "",
+			ItemType:  "VIRTUAL",
 		})
 	}
 
 	// Create shipping address (same as billing if not specified)
-	shippingAddress := req.Billing
-	if !req.SameAddress && req.Shipping != nil {
-		shippingAddress = *req.Shipping
-	}
+	shippingAddress := orderShippingAddress(req)
 
 	// Create metadata
 	metadata := []tapsilat.OrderMetadata{
@@ -596,6 +1302,31 @@ func createTapsilatOrder(req OrderRequest, total float64, referenceID, conversat
 		{Key: "framework", Value: "Gin"},
 		{Key: "customer_city", Value: req.Billing.City},
 	}
+	metadata = append(metadata,
+		tapsilat.OrderMetadata{Key: "net_total", Value: strconv.FormatFloat(totals.Net, 'f', 2, 64)},
+		tapsilat.OrderMetadata{Key: "tax_total", Value: strconv.FormatFloat(totals.Tax, 'f', 2, 64)},
+		tapsilat.OrderMetadata{Key: "gross_total", Value: strconv.FormatFloat(totals.Gross, 'f', 2, 64)},
+		tapsilat.OrderMetadata{Key: "tax_included", Value: strconv.FormatBool(totals.TaxIncluded)},
+	)
+	if totals.ShippingMethod != "" {
+		metadata = append(metadata,
+			tapsilat.OrderMetadata{Key: "shipping_method", Value: totals.ShippingMethod},
+			tapsilat.OrderMetadata{Key: "shipping_total", Value: strconv.FormatFloat(totals.Shipping, 'f', 2, 64)},
+		)
+	}
+	if totals.Rate != 0 && totals.Rate != 1 {
+		metadata = append(metadata, tapsilat.OrderMetadata{Key: "fx_rate", Value: strconv.FormatFloat(totals.Rate, 'f', -1, 64)})
+	}
+	if len(totals.Coupons) > 0 {
+		codes := make([]string, 0, len(totals.Coupons))
+		for _, applied := range totals.Coupons {
+			codes = append(codes, applied.Code)
+		}
+		metadata = append(metadata,
+			tapsilat.OrderMetadata{Key: "coupon_codes", Value: strings.Join(codes, ",")},
+			tapsilat.OrderMetadata{Key: "discount_total", Value: strconv.FormatFloat(totals.Discount, 'f', 2, 64)},
+		)
+	}
 	if len(req.Metadata) > 0 {
 		metadata = append(metadata, req.Metadata...)
 	}
@@ -604,12 +1335,12 @@ func createTapsilatOrder(req OrderRequest, total float64, referenceID, conversat
 	order := tapsilat.Order{
 		Locale:            "en",
 		Currency:          "TRY",
-		Amount:            total,
-		ConversationID:    conversationID, // This default overwritten if req has it? No, passed as arg.
+		Amount:            totals.Total,
+		ConversationID:    conversationID,
 		PaymentSuccessUrl: fmt.Sprintf("%s/payment/success", baseURL),
 		PaymentFailureUrl: fmt.Sprintf("%s/payment/failure", baseURL),
 		Buyer: tapsilat.OrderBuyer{
-			Id:                  generateBuyerID(),
+			Id:                  buyerID,
 			Name:                extractFirstName(req.Billing.ContactName),
 			Surname:             extractLastName(req.Billing.ContactName),
 			Email:               req.Billing.Email,
@@ -617,14 +1348,14 @@ func createTapsilatOrder(req OrderRequest, total float64, referenceID, conversat
 			IdentityNumber:      req.Billing.VatNumber,
 			RegistrationAddress: req.Billing.Address,
 			City:                req.Billing.City,
-			Country:             "Turkey",
+			Country:             gatewayCountry(req.Billing.Country),
 			ZipCode:             getZipCode(req.Billing.ZipCode),
 			Ip:                  "127.0.0.1",
 		},
 		BillingAddress: tapsilat.OrderBillingAddress{
 			ContactName: req.Billing.ContactName,
 			City:        req.Billing.City,
-			Country:     "Turkey",
+			Country:     gatewayCountry(req.Billing.Country),
 			Address:     req.Billing.Address,
 			ZipCode:     getZipCode(req.Billing.ZipCode),
 			VatNumber:   req.Billing.VatNumber,
@@ -632,7 +1363,7 @@ func createTapsilatOrder(req OrderRequest, total float64, referenceID, conversat
 		ShippingAddress: tapsilat.OrderShippingAddress{
 			ContactName: shippingAddress.ContactName,
 			City:        shippingAddress.City,
-			Country:     "Turkey",
+			Country:     gatewayCountry(shippingAddress.Country),
 			Address:     shippingAddress.Address,
 			ZipCode:     getZipCode(shippingAddress.ZipCode),
 		},
@@ -641,22 +1372,16 @@ func createTapsilatOrder(req OrderRequest, total float64, referenceID, conversat
 		ThreeDForce:         true,                              // Mock default: 3D Secure forced turned off
 		PaymentMethods:      true,                              // Mock default: Show all payment methods or specific logic
 		PaymentOptions:      []string{"card", "bank_transfer"}, // Mock default: Available payment options
-		EnabledInstallments: []int{1, 2, 3, 6, 9, 12},          // Mock default: All installments enabled
+		EnabledInstallments: orderInstallments(req, totals),    // Derived from the installment rules
 	}
 
 	// Overrides
-	if req.ConversationID != "" {
-		order.ConversationID = req.ConversationID
-	}
 	if req.Locale != "" {
 		order.Locale = req.Locale
 	}
 	if req.Currency != "" {
 		order.Currency = req.Currency
 	}
-	if len(req.EnabledInstallments) > 0 {
-		order.EnabledInstallments = req.EnabledInstallments
-	}
 	if len(req.PaymentOptions) > 0 {
 		order.PaymentOptions = req.PaymentOptions
 	}
@@ -667,13 +1392,98 @@ func createTapsilatOrder(req OrderRequest, total float64, referenceID, conversat
 	order.ThreeDForce = req.ThreeDForce
 	order.PaymentMethods = req.PaymentMethods
 
-	// Note: EnabledInstallments is already set above with defaults, but can be overridden
-	if req.Installment > 1 {
-		// If specific installment selected, maybe we want to restrict?
-		// But for now, let's keep the mock default of all enabled
+	return order
+}
+
+// lineGross returns what the customer pays for line i: its amount after discount, plus tax when prices exclude it
+func lineGross(totals cart.Totals, i int) float64 {
+	line := totals.Lines[i]
+	gross := line.Amount - line.Discount
+	if !totals.TaxIncluded {
+		gross += line.Tax
 	}
+	return cart.Round(gross)
+}
 
-	return order
+// orderInstallments returns the installment counts the rules allow for the order,
+// narrowed to req.EnabledInstallments when the client asks for fewer
+func orderInstallments(req OrderRequest, totals cart.Totals) []int {
+	categories := make([]string, 0, len(req.Cart))
+	for _, item := range req.Cart {
+		categories = append(categories, productCategory(item))
+	}
+	allowed := installmentEngine.Enabled(installment.Request{
+		Amount:     totals.Total,
+		Rate:       totals.Rate,
+		Categories: categories,
+	})
+
+	// Paying in one installment is always possible
+	enabled := []int{1}
+	for _, count := range allowed {
+		if count != 1 && (len(req.EnabledInstallments) == 0 || containsInt(req.EnabledInstallments, count)) {
+			enabled = append(enabled, count)
+		}
+	}
+	return enabled
+}
+
+func containsInt(list []int, v int) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+// orderLines copies the priced cart lines into the local order record
+func orderLines(c cart.Cart, totals cart.Totals) []orders.Line {
+	lines := make([]orders.Line, 0, len(totals.Lines))
+	for i, line := range totals.Lines {
+		lines = append(lines, orders.Line{
+			ProductID: line.ProductID,
+			Name:      c.Lines[i].Name,
+			Category:  c.Lines[i].Category,
+			Quantity:  line.Quantity,
+			UnitPrice: line.UnitPrice,
+			Amount:    line.Amount,
+			Discount:  line.Discount,
+			TaxRate:   line.TaxRate,
+			Tax:       line.Tax,
+		})
+	}
+	return lines
+}
+
+// orderRecordAddress copies an address into the local order record
+func orderRecordAddress(a Address) *orders.Address {
+	return &orders.Address{
+		ContactName: a.ContactName,
+		Email:       a.Email,
+		Phone:       a.ContactPhone,
+		Address:     a.Address,
+		City:        a.City,
+		ZipCode:     a.ZipCode,
+		VatNumber:   a.VatNumber,
+	}
+}
+
+// orderTaxLines copies the tax breakdown into the local order record
+func orderTaxLines(totals cart.Totals) []orders.TaxLine {
+	lines := make([]orders.TaxLine, 0, len(totals.TaxLines))
+	for _, tl := range totals.TaxLines {
+		lines = append(lines, orders.TaxLine{Rate: tl.Rate, Net: tl.Net, Tax: tl.Tax, Gross: tl.Gross})
+	}
+	return lines
+}
+
+// productCategory returns the basket category of a product
+func productCategory(item Product) string {
+	if item.Category != "" {
+		return item.Category
+	}
+	return "Electronics"
 }
 
 func generateConversationID() string {
@@ -682,6 +1492,7 @@ func generateConversationID() string {
 	return fmt.Sprintf("CONV_%d_%s", timestamp, uniqueID)
 }
 
+// generateBuyerID returns a one-off buyer id, used when the customer registry is unavailable
 func generateBuyerID() string {
 	hash := md5.Sum([]byte(fmt.Sprintf("%d", time.Now().UnixNano())))
 	return fmt.Sprintf("BUYER_%x", hash)[:16]
@@ -772,6 +1583,24 @@ func refundOrderHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	// Record the refund for the receipt; the order is refunded once nothing is left
+	if rec, ok := orderStore.Get(req.ReferenceID); ok {
+		if left := rec.Amount - rec.Refunded(); amountVal <= 0 || amountVal > left {
+			amountVal = left
+		}
+		rec, err := orderStore.AddRefund(req.ReferenceID, cart.Round(amountVal), "api:refund")
+		if err != nil {
+			utilsInstance.LogError("Failed to record refund", map[string]interface{}{
+				"reference_id": req.ReferenceID,
+				"error":        err.Error(),
+			})
+		} else {
+			notifyOrderEvent(rec, "order_refunded", cart.Round(amountVal))
+			if cart.Round(rec.Amount-rec.Refunded()) <= 0 {
+				applyOrderTransition(rec.ReferenceID, orders.StatusRefunded, "api:refund")
+			}
+		}
+	}
 
 	c.JSON(http.StatusOK, response)
 }
@@ -850,7 +1679,7 @@ func listSubscriptionsHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, response)
+	c.JSON(http.StatusOK, enrichSubscriptions(response))
 }
 
 type SubscriptionCancelRequest struct {
@@ -877,6 +1706,14 @@ func cancelSubscriptionHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if sub, ok := subscriptionStore.Get(req.SubscriptionID); ok {
+		if err := subscriptionStore.SetStatus(req.SubscriptionID, subscriptions.StatusCancelled, "api:cancel"); err != nil {
+			utilsInstance.LogError("Failed to update subscription", err.Error())
+		}
+		if err := notifySubscriptionCancelled(sub, "cancelled on request"); err != nil {
+			utilsInstance.LogError("Failed to send cancellation email", err.Error())
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Subscription cancelled"})
 }
 
@@ -914,6 +1751,7 @@ func createOrderTermHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	trackTerm(req.OrderId, req.TermReferenceId, req.TermSequence, req.Amount, req.DueDate)
 	c.JSON(http.StatusOK, response)
 }
 
@@ -937,6 +1775,9 @@ func deleteOrderTermHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if err := termTracker.Untrack(req.TermReferenceID); err != nil {
+		utilsInstance.LogError("Failed to untrack payment term", err.Error())
+	}
 	c.JSON(http.StatusOK, response)
 }
 
@@ -957,6 +1798,12 @@ func updateOrderTermHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if term, ok := termTracker.Get(req.TermReferenceId); ok {
+		if req.DueDate != "" {
+			term.DueDate = req.DueDate
+		}
+		trackTerm(term.OrderReferenceID, term.TermReferenceID, term.Sequence, req.Amount, term.DueDate)
+	}
 	c.JSON(http.StatusOK, response)
 }
 
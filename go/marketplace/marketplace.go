@@ -0,0 +1,280 @@
+package marketplace
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"tapsilat-go-example/store"
+)
+
+// Status of a submerchant
+type Status string
+
+const (
+	StatusActive    Status = "active"
+	StatusSuspended Status = "suspended"
+)
+
+// Submerchant is a seller that receives part of the proceeds of an order
+type Submerchant struct {
+	Key            string    `json:"key"`
+	Name           string    `json:"name"`
+	IBAN           string    `json:"iban"`
+	CommissionRate float64   `json:"commission_rate"` // percent kept by the platform
+	Status         Status    `json:"status"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Item is a priced basket line to split
+type Item struct {
+	ProductID      int
+	SubmerchantKey string // as sent by the client; must agree with the product link
+	Amount         float64
+}
+
+// Split is how the amount of one basket line is shared. Lines without a
+// submerchant belong to the platform and have an empty key.
+type Split struct {
+	ProductID      int     `json:"product_id"`
+	SubmerchantKey string  `json:"submerchant_key,omitempty"`
+	Amount         float64 `json:"amount"`
+	CommissionRate float64 `json:"commission_rate"`
+	Commission     float64 `json:"commission"`
+	Payout         float64 `json:"payout"`
+}
+
+type state struct {
+	Submerchants map[string]*Submerchant `json:"submerchants"`
+	Products     map[int]string          `json:"products"` // product id -> submerchant key
+}
+
+// Registry keeps submerchants and the products they sell
+type Registry struct {
+	mu    sync.RWMutex
+	file  *store.JSONFile
+	state state
+	// allowUnlinked accepts a client's submerchant key for products not in the registry
+	allowUnlinked bool
+}
+
+// NewRegistry loads the registry from path
+func NewRegistry(path string) (*Registry, error) {
+	r := &Registry{
+		file: store.NewJSONFile(path),
+		state: state{
+			Submerchants: make(map[string]*Submerchant),
+			Products:     make(map[int]string),
+		},
+	}
+	if err := r.file.Load(&r.state); err != nil {
+		return nil, err
+	}
+	if r.state.Submerchants == nil {
+		r.state.Submerchants = make(map[string]*Submerchant)
+	}
+	if r.state.Products == nil {
+		r.state.Products = make(map[int]string)
+	}
+	return r, nil
+}
+
+// List returns all submerchants ordered by key
+func (r *Registry) List() []Submerchant {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]Submerchant, 0, len(r.state.Submerchants))
+	for _, s := range r.state.Submerchants {
+		list = append(list, *s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list
+}
+
+// Get returns a submerchant by key
+func (r *Registry) Get(key string) (Submerchant, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, ok := r.state.Submerchants[key]
+	if !ok {
+		return Submerchant{}, false
+	}
+	return *s, true
+}
+
+// Save validates and creates or replaces a submerchant
+func (r *Registry) Save(s Submerchant) (Submerchant, error) {
+	s.Key = strings.TrimSpace(s.Key)
+	s.IBAN = NormalizeIBAN(s.IBAN)
+	if s.Key == "" || s.Name == "" {
+		return Submerchant{}, fmt.Errorf("key and name are required")
+	}
+	if err := ValidateIBAN(s.IBAN); err != nil {
+		return Submerchant{}, err
+	}
+	if s.CommissionRate < 0 || s.CommissionRate > 100 {
+		return Submerchant{}, fmt.Errorf("commission rate must be between 0 and 100")
+	}
+	switch s.Status {
+	case "":
+		s.Status = StatusActive
+	case StatusActive, StatusSuspended:
+	default:
+		return Submerchant{}, fmt.Errorf("status must be active or suspended")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	s.CreatedAt = now
+	if existing, ok := r.state.Submerchants[s.Key]; ok {
+		s.CreatedAt = existing.CreatedAt
+	}
+	s.UpdatedAt = now
+	r.state.Submerchants[s.Key] = &s
+	return s, r.file.Save(r.state)
+}
+
+// Delete removes a submerchant and its product links
+func (r *Registry) Delete(key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.state.Submerchants[key]; !ok {
+		return fmt.Errorf("submerchant %s not found", key)
+	}
+	delete(r.state.Submerchants, key)
+	for id, k := range r.state.Products {
+		if k == key {
+			delete(r.state.Products, id)
+		}
+	}
+	return r.file.Save(r.state)
+}
+
+// LinkProducts makes key the seller of the given products
+func (r *Registry) LinkProducts(key string, productIDs []int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.state.Submerchants[key]; !ok {
+		return fmt.Errorf("submerchant %s not found", key)
+	}
+	for _, id := range productIDs {
+		r.state.Products[id] = key
+	}
+	return r.file.Save(r.state)
+}
+
+// Products returns the ids of the products linked to key
+func (r *Registry) Products(key string) []int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ids := []int{}
+	for id, k := range r.state.Products {
+		if k == key {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// AllowUnlinked sets whether items of products without a registry link may name their
+// submerchant. It is off by default, so only the registry decides who is paid.
+func (r *Registry) AllowUnlinked(allow bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.allowUnlinked = allow
+}
+
+// Split computes the commission and payout of every item. The registry link of a
+// product wins; an item naming another submerchant is rejected. It also fails when an
+// item belongs to an unknown or suspended submerchant.
+func (r *Registry) Split(items []Item) ([]Split, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	splits := make([]Split, 0, len(items))
+	for _, item := range items {
+		key, linked := r.state.Products[item.ProductID]
+		switch {
+		case linked && item.SubmerchantKey != "" && item.SubmerchantKey != key:
+			return nil, fmt.Errorf("product %d is not sold by submerchant %s", item.ProductID, item.SubmerchantKey)
+		case !linked && item.SubmerchantKey != "":
+			if !r.allowUnlinked {
+				return nil, fmt.Errorf("product %d is not linked to a submerchant", item.ProductID)
+			}
+			key = item.SubmerchantKey
+		}
+		if key == "" {
+			splits = append(splits, Split{ProductID: item.ProductID, Amount: item.Amount})
+			continue
+		}
+
+		s, ok := r.state.Submerchants[key]
+		if !ok {
+			return nil, fmt.Errorf("submerchant %s not found", key)
+		}
+		if s.Status != StatusActive {
+			return nil, fmt.Errorf("submerchant %s is %s", key, s.Status)
+		}
+
+		commission := round(item.Amount * s.CommissionRate / 100)
+		splits = append(splits, Split{
+			ProductID:      item.ProductID,
+			SubmerchantKey: key,
+			Amount:         item.Amount,
+			CommissionRate: s.CommissionRate,
+			Commission:     commission,
+			Payout:         round(item.Amount - commission),
+		})
+	}
+	return splits, nil
+}
+
+// NormalizeIBAN removes spaces and upper-cases an IBAN
+func NormalizeIBAN(iban string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(iban), " ", ""))
+}
+
+// ValidateIBAN checks the length of Turkish IBANs and the ISO 13616 check digits
+func ValidateIBAN(iban string) error {
+	if len(iban) < 15 || len(iban) > 34 {
+		return fmt.Errorf("invalid IBAN length")
+	}
+	if strings.HasPrefix(iban, "TR") && len(iban) != 26 {
+		return fmt.Errorf("Turkish IBANs have 26 characters")
+	}
+
+	// Move the country code and check digits to the end and turn letters into numbers
+	var digits strings.Builder
+	for _, ch := range iban[4:] + iban[:4] {
+		switch {
+		case ch >= '0' && ch <= '9':
+			digits.WriteRune(ch)
+		case ch >= 'A' && ch <= 'Z':
+			fmt.Fprintf(&digits, "%d", ch-'A'+10)
+		default:
+			return fmt.Errorf("invalid IBAN character %q", ch)
+		}
+	}
+	n, ok := new(big.Int).SetString(digits.String(), 10)
+	if !ok || new(big.Int).Mod(n, big.NewInt(97)).Int64() != 1 {
+		return fmt.Errorf("invalid IBAN checksum")
+	}
+	return nil
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
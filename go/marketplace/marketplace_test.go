@@ -0,0 +1,137 @@
+package marketplace
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+const testIBAN = "TR330006100519786457841326"
+
+func newRegistry(t *testing.T) *Registry {
+	t.Helper()
+	r, err := NewRegistry(filepath.Join(t.TempDir(), "submerchants.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestValidateIBAN(t *testing.T) {
+	tests := []struct {
+		iban string
+		ok   bool
+	}{
+		{testIBAN, true},
+		{NormalizeIBAN(" tr33 0006 1005 1978 6457 8413 26 "), true},
+		{"GB82WEST12345698765432", true},
+		{"TR330006100519786457841327", false},
+		{"TR33000610051978645784132", false},
+		{"GB82WEST1234569876543!", false},
+		{"DE89", false},
+	}
+	for _, tt := range tests {
+		if err := ValidateIBAN(tt.iban); (err == nil) != tt.ok {
+			t.Errorf("ValidateIBAN(%q) = %v, want ok %v", tt.iban, err, tt.ok)
+		}
+	}
+}
+
+func TestSave(t *testing.T) {
+	r := newRegistry(t)
+	s, err := r.Save(Submerchant{Key: " shop-1 ", Name: "Shop", IBAN: "tr33 0006 1005 1978 6457 8413 26", CommissionRate: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Key != "shop-1" || s.IBAN != testIBAN || s.Status != StatusActive {
+		t.Errorf("saved = %+v", s)
+	}
+
+	tests := []Submerchant{
+		{Name: "No key", IBAN: testIBAN},
+		{Key: "a", Name: "Bad IBAN", IBAN: "TR00"},
+		{Key: "a", Name: "Rate", IBAN: testIBAN, CommissionRate: 120},
+		{Key: "a", Name: "Status", IBAN: testIBAN, Status: "closed"},
+	}
+	for _, tt := range tests {
+		if _, err := r.Save(tt); err == nil {
+			t.Errorf("Save(%+v) accepted an invalid submerchant", tt)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	r := newRegistry(t)
+	for _, s := range []Submerchant{
+		{Key: "books", Name: "Books", IBAN: testIBAN, CommissionRate: 12.5},
+		{Key: "closed", Name: "Closed", IBAN: testIBAN, CommissionRate: 10, Status: StatusSuspended},
+	} {
+		if _, err := r.Save(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.LinkProducts("books", []int{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.LinkProducts("closed", []int{3}); err != nil {
+		t.Fatal(err)
+	}
+
+	splits, err := r.Split([]Item{
+		{ProductID: 1, Amount: 99.99},
+		{ProductID: 2, SubmerchantKey: "books", Amount: 40},
+		{ProductID: 9, Amount: 10},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Split{
+		{ProductID: 1, SubmerchantKey: "books", Amount: 99.99, CommissionRate: 12.5, Commission: 12.5, Payout: 87.49},
+		{ProductID: 2, SubmerchantKey: "books", Amount: 40, CommissionRate: 12.5, Commission: 5, Payout: 35},
+		{ProductID: 9, Amount: 10},
+	}
+	for i := range want {
+		if splits[i] != want[i] {
+			t.Errorf("split %d = %+v, want %+v", i, splits[i], want[i])
+		}
+	}
+
+	rejected := []struct {
+		name  string
+		items []Item
+	}{
+		{"other seller", []Item{{ProductID: 1, SubmerchantKey: "closed", Amount: 10}}},
+		{"suspended", []Item{{ProductID: 3, Amount: 10}}},
+		{"unlinked", []Item{{ProductID: 9, SubmerchantKey: "books", Amount: 10}}},
+	}
+	for _, tt := range rejected {
+		if _, err := r.Split(tt.items); err == nil {
+			t.Errorf("%s: Split succeeded", tt.name)
+		}
+	}
+
+	r.AllowUnlinked(true)
+	splits, err = r.Split([]Item{{ProductID: 9, SubmerchantKey: "books", Amount: 10}})
+	if err != nil || splits[0].SubmerchantKey != "books" {
+		t.Errorf("unlinked allowed: %+v, %v", splits, err)
+	}
+}
+
+func TestDeleteUnlinksProducts(t *testing.T) {
+	r := newRegistry(t)
+	if _, err := r.Save(Submerchant{Key: "books", Name: "Books", IBAN: testIBAN}); err != nil {
+		t.Fatal(err)
+	}
+	r.LinkProducts("books", []int{2, 1})
+	if got := r.Products("books"); len(got) != 2 || got[0] != 1 {
+		t.Errorf("Products = %v, want [1 2]", got)
+	}
+	if err := r.Delete("books"); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Products("books"); len(got) != 0 {
+		t.Errorf("Products after delete = %v", got)
+	}
+	if err := r.LinkProducts("books", []int{1}); err == nil {
+		t.Error("LinkProducts linked to a deleted submerchant")
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"tapsilat-go-example/cart"
+	"tapsilat-go-example/marketplace"
+	"tapsilat-go-example/orders"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SubmerchantOrder is one order in a submerchant payout report
+type SubmerchantOrder struct {
+	ReferenceID string        `json:"reference_id"`
+	Status      orders.Status `json:"status"`
+	Currency    string        `json:"currency"`
+	CreatedAt   time.Time     `json:"created_at"`
+	Amount      float64       `json:"amount"`
+	Commission  float64       `json:"commission"`
+	Payout      float64       `json:"payout"`
+	Refunded    float64       `json:"refunded,omitempty"` // the seller's share of partial refunds
+}
+
+// PayoutReport sums what a submerchant is owed. Only paid orders are owed, less their
+// share of partial refunds; pending orders may still be paid, refunded and cancelled
+// ones are not owed.
+type PayoutReport struct {
+	SubmerchantKey string             `json:"submerchant_key"`
+	Owed           map[string]float64 `json:"owed"`    // per currency, paid orders
+	Pending        map[string]float64 `json:"pending"` // per currency, orders not paid yet
+	Commission     map[string]float64 `json:"commission"`
+	Orders         []SubmerchantOrder `json:"orders,omitempty"`
+}
+
+// splitItems returns the basket lines of an order for the submerchant split
+func splitItems(req OrderRequest, totals cart.Totals) []marketplace.Item {
+	items := make([]marketplace.Item, 0, len(req.Cart))
+	for i, item := range req.Cart {
+		items = append(items, marketplace.Item{
+			ProductID:      item.ID,
+			SubmerchantKey: item.SubmerchantKey,
+			Amount:         lineGross(totals, i),
+		})
+	}
+	return items
+}
+
+// orderPayouts keeps the submerchant lines of a split for the local order record
+func orderPayouts(splits []marketplace.Split) []orders.Payout {
+	var payouts []orders.Payout
+	for _, s := range splits {
+		if s.SubmerchantKey == "" {
+			continue
+		}
+		payouts = append(payouts, orders.Payout{
+			ProductID:      s.ProductID,
+			SubmerchantKey: s.SubmerchantKey,
+			Amount:         s.Amount,
+			Commission:     s.Commission,
+			Payout:         s.Payout,
+		})
+	}
+	return payouts
+}
+
+// payoutReports builds the payout report of every submerchant from the local order records
+func payoutReports(withOrders bool) map[string]*PayoutReport {
+	reports := make(map[string]*PayoutReport)
+	for _, rec := range orderStore.List() {
+		perKey := make(map[string]*SubmerchantOrder)
+		for _, p := range rec.Payouts {
+			o, ok := perKey[p.SubmerchantKey]
+			if !ok {
+				o = &SubmerchantOrder{
+					ReferenceID: rec.ReferenceID,
+					Status:      rec.Status,
+					Currency:    rec.Currency,
+					CreatedAt:   rec.CreatedAt,
+				}
+				perKey[p.SubmerchantKey] = o
+			}
+			o.Amount = cart.Round(o.Amount + p.Amount)
+			o.Commission = cart.Round(o.Commission + p.Commission)
+			o.Payout = cart.Round(o.Payout + p.Payout)
+		}
+
+		// Refunds are not recorded per line, so a partial refund is taken from every line
+		// in proportion to the order amount
+		if refunded := rec.Refunded(); refunded > 0 && rec.Amount > 0 {
+			share := math.Min(refunded/rec.Amount, 1)
+			for _, o := range perKey {
+				o.Refunded = cart.Round(o.Amount * share)
+				o.Commission = cart.Round(o.Commission * (1 - share))
+				o.Payout = cart.Round(o.Payout * (1 - share))
+			}
+		}
+
+		for key, o := range perKey {
+			report, ok := reports[key]
+			if !ok {
+				report = &PayoutReport{
+					SubmerchantKey: key,
+					Owed:           map[string]float64{},
+					Pending:        map[string]float64{},
+					Commission:     map[string]float64{},
+				}
+				reports[key] = report
+			}
+			switch o.Status {
+			case orders.StatusPaid:
+				report.Owed[o.Currency] = cart.Round(report.Owed[o.Currency] + o.Payout)
+				report.Commission[o.Currency] = cart.Round(report.Commission[o.Currency] + o.Commission)
+			case orders.StatusPending:
+				report.Pending[o.Currency] = cart.Round(report.Pending[o.Currency] + o.Payout)
+			}
+			if withOrders {
+				report.Orders = append(report.Orders, *o)
+			}
+		}
+	}
+	return reports
+}
+
+// listSubmerchantsHandler lists the local submerchant registry
+func listSubmerchantsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, submerchants.List())
+}
+
+// saveSubmerchantHandler creates or replaces a submerchant
+func saveSubmerchantHandler(c *gin.Context) {
+	var req marketplace.Submerchant
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	saved, err := submerchants.Save(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, saved)
+}
+
+// deleteSubmerchantHandler removes a submerchant
+func deleteSubmerchantHandler(c *gin.Context) {
+	if err := submerchants.Delete(c.Param("key")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// linkSubmerchantProductsHandler links catalog products to a submerchant
+func linkSubmerchantProductsHandler(c *gin.Context) {
+	var req struct {
+		ProductIDs []int `json:"product_ids" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	key := c.Param("key")
+	if err := submerchants.LinkProducts(key, req.ProductIDs); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"key": key, "product_ids": submerchants.Products(key)})
+}
+
+// submerchantPayoutsHandler reports what a submerchant is owed, order by order
+func submerchantPayoutsHandler(c *gin.Context) {
+	key := c.Param("key")
+	_, registered := submerchants.Get(key)
+	report, ok := payoutReports(true)[key]
+	if !ok && !registered {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Submerchant not found"})
+		return
+	}
+	if !ok {
+		report = &PayoutReport{
+			SubmerchantKey: key,
+			Owed:           map[string]float64{},
+			Pending:        map[string]float64{},
+			Commission:     map[string]float64{},
+		}
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// payoutSummaryHandler reports the totals owed to every submerchant
+func payoutSummaryHandler(c *gin.Context) {
+	reports := payoutReports(false)
+	list := make([]PayoutReport, 0, len(reports))
+	for _, report := range reports {
+		list = append(list, *report)
+	}
+	// Removed submerchants stay in the report until they are paid out
+	sort.Slice(list, func(i, j int) bool { return list[i].SubmerchantKey < list[j].SubmerchantKey })
+	c.JSON(http.StatusOK, list)
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"tapsilat-go-example/customers"
+	"tapsilat-go-example/notify"
+	"tapsilat-go-example/orders"
+	"tapsilat-go-example/store"
+	"tapsilat-go-example/subscriptions"
+
+	"github.com/gin-gonic/gin"
+)
+
+var notifier notify.Transport
+var outbox *notify.Outbox
+var emailTemplates *notify.Templates
+
+// setupNotifier builds the notification transport from NOTIFY_TRANSPORT. Every message goes
+// through the outbox, which retries failed deliveries.
+func setupNotifier() {
+	dir := os.Getenv("NOTIFY_DIR")
+	if dir == "" {
+		dir = store.DataPath("notifications")
+	}
+	cfg := notify.Config{
+		Dir:        dir,
+		MailboxDir: dir + "/mailbox",
+		SMTP: notify.SMTPConfig{
+			Host:     os.Getenv("SMTP_HOST"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("SMTP_FROM"),
+		},
+	}
+	if port := os.Getenv("SMTP_PORT"); port != "" {
+		var err error
+		if cfg.SMTP.Port, err = strconv.Atoi(port); err != nil {
+			log.Fatalf("Invalid SMTP_PORT value %q", port)
+		}
+	}
+	transport, err := notify.FromNames(os.Getenv("NOTIFY_TRANSPORT"), cfg)
+	if err != nil {
+		log.Fatal("Failed to set up notifications:", err)
+	}
+
+	outboxCfg := notify.DefaultOutboxConfig()
+	outboxCfg.Interval = getEnvDuration("NOTIFY_OUTBOX_INTERVAL", outboxCfg.Interval)
+	outbox, err = notify.NewOutbox(store.DataPath("outbox.json"), outboxCfg, transport)
+	if err != nil {
+		log.Fatal("Failed to load the notification outbox:", err)
+	}
+	notifier = outbox
+	outbox.Start(context.Background())
+
+	templateDir := os.Getenv("EMAIL_TEMPLATE_DIR")
+	if templateDir == "" {
+		templateDir = "email_templates"
+	}
+	locale := os.Getenv("EMAIL_DEFAULT_LOCALE")
+	if locale == "" {
+		locale = "en"
+	}
+	emailTemplates = notify.NewTemplates(templateDir, locale)
+}
+
+// sendEmail renders the template of event in locale and queues it for to. An email with a
+// key already in the outbox is not queued again, so repeated callbacks send one email.
+func sendEmail(event, locale, to, key string, data gin.H, meta map[string]string) {
+	if err := queueEmail(event, locale, to, key, data, meta); err != nil {
+		utilsInstance.LogError("Failed to send email", map[string]interface{}{
+			"event": event,
+			"to":    to,
+			"error": err.Error(),
+		})
+	}
+}
+
+// queueEmail is sendEmail for callers that handle the error themselves
+func queueEmail(event, locale, to, key string, data gin.H, meta map[string]string) error {
+	if to == "" {
+		return nil
+	}
+	msg, used, err := emailTemplates.Render(event, locale, data)
+	if err != nil {
+		return fmt.Errorf("render %s: %w", event, err)
+	}
+	msg.To = to
+	msg.Meta = meta
+	if _, _, err := outbox.Enqueue(key, used, msg); err != nil {
+		return fmt.Errorf("queue %s: %w", event, err)
+	}
+	return nil
+}
+
+// notifyOrderEvent emails the buyer about a paid or refunded order
+func notifyOrderEvent(rec orders.Record, event string, amount float64) {
+	key := event + ":" + rec.ReferenceID
+	if event == "order_refunded" {
+		// Every partial refund is its own email, even when two have the same amount;
+		// a full refund by callback has no recorded refunds and counts as 0
+		key += ":" + strconv.Itoa(len(rec.Refunds))
+	}
+	sendEmail(event, rec.Locale, rec.BuyerEmail, key, orderEmailData(rec, amount), map[string]string{
+		"reference_id": rec.ReferenceID,
+	})
+}
+
+// notifySubscriptionCancelled emails the subscriber about a cancelled subscription, once
+// however it was cancelled
+func notifySubscriptionCancelled(sub subscriptions.Subscription, reason string) error {
+	return queueEmail("subscription_cancelled", "", sub.SubscriberEmail, "subscription_cancelled:"+sub.ReferenceID,
+		subscriptionEmailData(sub, reason), map[string]string{
+			"subscription_reference_id": sub.ReferenceID,
+			"plan_id":                   sub.PlanID,
+		})
+}
+
+// notifySubscriptionPastDue emails the subscriber a link to pay a failed renewal. Each
+// retry of a dunning round is its own email.
+func notifySubscriptionPastDue(sub subscriptions.Subscription, link string) error {
+	data := subscriptionEmailData(sub, "")
+	data["PaymentLink"] = link
+	data["NextRetryAt"] = sub.NextRetryAt
+	key := fmt.Sprintf("subscription_past_due:%s:%s:%d", sub.ReferenceID, sub.PastDueSince.Format(time.RFC3339), sub.RetryAttempts)
+	return queueEmail("subscription_past_due", "", sub.SubscriberEmail, key, data, map[string]string{
+		"subscription_reference_id": sub.ReferenceID,
+		"plan_id":                   sub.PlanID,
+	})
+}
+
+// notifyCardExpiring warns a customer that a saved card expires soon, once per card and expiry
+func notifyCardExpiring(exp customers.ExpiringCard) error {
+	key := fmt.Sprintf("card_expiring:%s:%02d%d", exp.Card.ID, exp.Card.ExpMonth, exp.Card.ExpYear)
+	return queueEmail("card_expiring", "", exp.Email, key, cardEmailData(exp.Card, cardSubscriptions(exp.Card.ID)), map[string]string{
+		"customer_id": exp.CustomerID,
+		"card_id":     exp.Card.ID,
+	})
+}
+
+func orderEmailData(rec orders.Record, amount float64) gin.H {
+	name := ""
+	if customer, ok := customerStore.Get(rec.CustomerID); ok {
+		name = customer.Name
+	}
+	return gin.H{
+		"Order":    rec,
+		"Name":     name,
+		"Amount":   amount,
+		"Currency": rec.Currency,
+	}
+}
+
+func subscriptionEmailData(sub subscriptions.Subscription, reason string) gin.H {
+	return gin.H{
+		"Subscription": sub,
+		"Plan":         sub.Plan,
+		"Reason":       reason,
+	}
+}
+
+func cardEmailData(card customers.Card, subs []string) gin.H {
+	name := card.MaskedPAN
+	if card.Label != "" {
+		name = card.Label + " (" + card.MaskedPAN + ")"
+	}
+	return gin.H{
+		"Card":          card,
+		"CardName":      name,
+		"Expiry":        fmt.Sprintf("%02d/%d", card.ExpMonth, card.ExpYear),
+		"Subscriptions": len(subs),
+	}
+}
+
+// sampleEmailData is used to preview templates without a real order or subscription
+func sampleEmailData(event string) gin.H {
+	now := time.Now()
+	rec := orders.Record{
+		ReferenceID: "ORDER_SAMPLE",
+		Status:      orders.StatusPaid,
+		Amount:      1180,
+		Net:         1000,
+		Tax:         180,
+		Gross:       1180,
+		Currency:    "TRY",
+		BuyerEmail:  "jane@example.com",
+		Lines: []orders.Line{
+			{ProductID: 1, Name: "Wireless Headphones", Quantity: 2, UnitPrice: 500, Amount: 1000, TaxRate: 18, Tax: 180},
+		},
+		CreatedAt: now,
+	}
+	switch event {
+	case "subscription_cancelled", "subscription_past_due":
+		plan, _ := subscriptionPlans.Get("gold-monthly")
+		sub := subscriptions.Subscription{
+			ReferenceID:     "SUB_SAMPLE",
+			PlanID:          plan.ID,
+			Plan:            plan,
+			SubscriberEmail: "jane@example.com",
+			Status:          subscriptions.StatusCancelled,
+			CreatedAt:       now,
+		}
+		if event == "subscription_past_due" {
+			sub.Status = subscriptions.StatusPastDue
+			sub.NextRetryAt = now.AddDate(0, 0, 3)
+			data := subscriptionEmailData(sub, "")
+			data["PaymentLink"] = "https://checkout.example.com/SAMPLE"
+			data["NextRetryAt"] = sub.NextRetryAt
+			return data
+		}
+		return subscriptionEmailData(sub, "cancelled on request")
+	case "card_expiring":
+		return cardEmailData(customers.Card{
+			ID:        "CARD_SAMPLE",
+			Label:     "Personal",
+			MaskedPAN: "5528 79** **** 0008",
+			ExpMonth:  int(now.Month()),
+			ExpYear:   now.Year(),
+		}, []string{"SUB_SAMPLE"})
+	}
+	data := orderEmailData(rec, rec.Amount)
+	data["Name"] = "Jane Doe"
+	return data
+}
+
+// listNotificationsHandler lists outbox entries, optionally filtered by ?status=
+func listNotificationsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, outbox.List(notify.EntryStatus(c.Query("status"))))
+}
+
+// notificationStatusHandler returns the outbox counters and the available templates
+func notificationStatusHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"outbox":    outbox.Stats(),
+		"templates": emailTemplates.Kinds(),
+	})
+}
+
+// getNotificationHandler returns an outbox entry
+func getNotificationHandler(c *gin.Context) {
+	entry, ok := outbox.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+// resendNotificationHandler queues a copy of an outbox entry
+func resendNotificationHandler(c *gin.Context) {
+	entry, err := outbox.Resend(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+// previewNotificationHandler renders a template without sending it, for a local order or
+// subscription or for sample data
+func previewNotificationHandler(c *gin.Context) {
+	var req struct {
+		Event                   string  `json:"event" binding:"required"`
+		Locale                  string  `json:"locale"`
+		OrderReferenceID        string  `json:"order_reference_id"`
+		SubscriptionReferenceID string  `json:"subscription_reference_id"`
+		Amount                  float64 `json:"amount"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data := sampleEmailData(req.Event)
+	to := "jane@example.com"
+	switch {
+	case req.OrderReferenceID != "":
+		rec, ok := orderStore.Get(req.OrderReferenceID)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			return
+		}
+		amount := req.Amount
+		if amount == 0 {
+			amount = rec.Amount
+		}
+		data, to = orderEmailData(rec, amount), rec.BuyerEmail
+		if req.Locale == "" {
+			req.Locale = rec.Locale
+		}
+	case req.SubscriptionReferenceID != "":
+		sub, ok := subscriptionStore.Get(req.SubscriptionReferenceID)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+			return
+		}
+		data, to = subscriptionEmailData(sub, ""), sub.SubscriberEmail
+	}
+
+	msg, locale, err := emailTemplates.Render(req.Event, req.Locale, data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("failed to render %s: %v", req.Event, err)})
+		return
+	}
+	msg.To = to
+	c.JSON(http.StatusOK, gin.H{
+		"locale":  locale,
+		"message": msg,
+	})
+}
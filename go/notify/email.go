@@ -0,0 +1,145 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"tapsilat-go-example/store"
+)
+
+// SMTPConfig is the mail server messages are sent through
+type SMTPConfig struct {
+	Host     string
+	Port     int // 587 when zero
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPTransport sends messages as email
+type SMTPTransport struct {
+	Config SMTPConfig
+}
+
+// Send delivers msg to msg.To. net/smtp upgrades to TLS when the server offers STARTTLS.
+func (t SMTPTransport) Send(ctx context.Context, msg Message) error {
+	if msg.To == "" {
+		return fmt.Errorf("message has no recipient")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	port := t.Config.Port
+	if port == 0 {
+		port = 587
+	}
+	var auth smtp.Auth
+	if t.Config.Username != "" {
+		auth = smtp.PlainAuth("", t.Config.Username, t.Config.Password, t.Config.Host)
+	}
+	data, err := ComposeEmail(t.Config.From, msg)
+	if err != nil {
+		return err
+	}
+	addr := net.JoinHostPort(t.Config.Host, strconv.Itoa(port))
+	if err := smtp.SendMail(addr, auth, t.Config.From, []string{msg.To}, data); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	return nil
+}
+
+// MailboxTransport writes every message as an .eml file into Dir, so emails can be opened
+// in a mail client during local development
+type MailboxTransport struct {
+	Dir  string
+	From string
+}
+
+// Send writes msg to a new .eml file
+func (t MailboxTransport) Send(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(t.Dir, 0755); err != nil {
+		return err
+	}
+	if msg.SentAt.IsZero() {
+		msg.SentAt = time.Now()
+	}
+	from := t.From
+	if from == "" {
+		from = "shop@localhost"
+	}
+	data, err := ComposeEmail(from, msg)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s_%d_%s.eml", msg.SentAt.Format("20060102_150405"), msg.SentAt.UnixNano()%1000000, msg.Kind)
+	return os.WriteFile(filepath.Join(t.Dir, name), data, 0644)
+}
+
+// ComposeEmail builds the RFC 5322 message for msg: plain text, or multipart/alternative
+// when msg has an HTML body
+func ComposeEmail(from string, msg Message) ([]byte, error) {
+	sentAt := msg.SentAt
+	if sentAt.IsZero() {
+		sentAt = time.Now()
+	}
+	var buf bytes.Buffer
+	header := func(key, value string) { fmt.Fprintf(&buf, "%s: %s\r\n", key, value) }
+	header("From", from)
+	header("To", msg.To)
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", sentAt.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	if msg.Kind != "" {
+		header("X-Notification-Kind", msg.Kind)
+	}
+
+	if msg.HTML == "" {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(&buf, msg.Body); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	boundary, err := store.NewID("alt_")
+	if err != nil {
+		return nil, err
+	}
+	header("Content-Type", `multipart/alternative; boundary="`+boundary+`"`)
+	buf.WriteString("\r\n")
+	parts := []struct{ contentType, body string }{
+		{"text/plain", msg.Body},
+		{"text/html", msg.HTML},
+	}
+	for _, part := range parts {
+		fmt.Fprintf(&buf, "--%s\r\n", boundary)
+		fmt.Fprintf(&buf, "Content-Type: %s; charset=utf-8\r\n", part.contentType)
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQuotedPrintable(&buf, part.body); err != nil {
+			return nil, err
+		}
+		buf.WriteString("\r\n")
+	}
+	fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(buf *bytes.Buffer, body string) error {
+	w := quotedprintable.NewWriter(buf)
+	// Line breaks are written as CRLF in text mode
+	if _, err := w.Write([]byte(body)); err != nil {
+		return err
+	}
+	return w.Close()
+}
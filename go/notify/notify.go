@@ -0,0 +1,105 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Message is a notification to a customer or to the merchant
+type Message struct {
+	Kind    string            `json:"kind"` // e.g. term_reminder, term_overdue
+	To      string            `json:"to"`
+	Subject string            `json:"subject"`
+	Body    string            `json:"body"`           // plain text
+	HTML    string            `json:"html,omitempty"` // optional HTML alternative of Body
+	Meta    map[string]string `json:"meta,omitempty"`
+	SentAt  time.Time         `json:"sent_at"`
+}
+
+// Transport delivers messages
+type Transport interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogTransport writes messages to the application log
+type LogTransport struct{}
+
+// Send logs msg
+func (LogTransport) Send(ctx context.Context, msg Message) error {
+	log.Printf("Notification [%s] to %s: %s", msg.Kind, msg.To, msg.Subject)
+	return nil
+}
+
+// FileTransport writes every message as a JSON file into Dir
+type FileTransport struct {
+	Dir string
+}
+
+// Send writes msg to a new file
+func (t FileTransport) Send(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(t.Dir, 0755); err != nil {
+		return err
+	}
+	if msg.SentAt.IsZero() {
+		msg.SentAt = time.Now()
+	}
+	data, err := json.MarshalIndent(msg, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s_%d_%s.json", msg.SentAt.Format("20060102_150405"), msg.SentAt.UnixNano()%1000000, msg.Kind)
+	return os.WriteFile(filepath.Join(t.Dir, name), data, 0644)
+}
+
+// Multi sends every message through all transports and returns the first error
+type Multi []Transport
+
+// Send delivers msg through every transport
+func (m Multi) Send(ctx context.Context, msg Message) error {
+	var first error
+	for _, t := range m {
+		if err := t.Send(ctx, msg); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Config configures the transports built by FromNames
+type Config struct {
+	Dir        string // where the file transport writes messages
+	MailboxDir string // where the mailbox transport writes .eml files
+	SMTP       SMTPConfig
+}
+
+// FromNames builds a transport from a comma separated list such as "log,file"
+func FromNames(names string, cfg Config) (Transport, error) {
+	var transports Multi
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "", "log":
+			transports = append(transports, LogTransport{})
+		case "file":
+			transports = append(transports, FileTransport{Dir: cfg.Dir})
+		case "mailbox":
+			transports = append(transports, MailboxTransport{Dir: cfg.MailboxDir, From: cfg.SMTP.From})
+		case "smtp":
+			if cfg.SMTP.Host == "" || cfg.SMTP.From == "" {
+				return nil, fmt.Errorf("smtp transport needs a host and a from address")
+			}
+			transports = append(transports, SMTPTransport{Config: cfg.SMTP})
+		default:
+			return nil, fmt.Errorf("unknown notification transport %q", name)
+		}
+	}
+	if len(transports) == 1 {
+		return transports[0], nil
+	}
+	return transports, nil
+}
@@ -0,0 +1,295 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"tapsilat-go-example/store"
+)
+
+// EntryStatus is the delivery state of an outbox entry
+type EntryStatus string
+
+const (
+	EntryPending EntryStatus = "pending"
+	EntrySent    EntryStatus = "sent"
+	EntryFailed  EntryStatus = "failed" // gave up after the last retry
+)
+
+// Entry is a message waiting in, or delivered from, the outbox
+type Entry struct {
+	ID            string      `json:"id"`
+	Key           string      `json:"key,omitempty"` // entries with the same key are only sent once
+	Message       Message     `json:"message"`
+	Locale        string      `json:"locale,omitempty"`
+	Status        EntryStatus `json:"status"`
+	Attempts      int         `json:"attempts"`
+	NextAttemptAt time.Time   `json:"next_attempt_at,omitempty"`
+	LastError     string      `json:"last_error,omitempty"`
+	ResendOf      string      `json:"resend_of,omitempty"`
+	CreatedAt     time.Time   `json:"created_at"`
+	SentAt        time.Time   `json:"sent_at,omitempty"`
+}
+
+// OutboxConfig controls delivery retries
+type OutboxConfig struct {
+	Interval    time.Duration   // how often due entries are delivered
+	RetryDelays []time.Duration // wait before each retry; the entry fails after the last one
+}
+
+// DefaultOutboxConfig retries after 1, 5, 30 minutes and 2 hours
+func DefaultOutboxConfig() OutboxConfig {
+	return OutboxConfig{
+		Interval:    30 * time.Second,
+		RetryDelays: []time.Duration{time.Minute, 5 * time.Minute, 30 * time.Minute, 2 * time.Hour},
+	}
+}
+
+// OutboxStats describes the outbox state
+type OutboxStats struct {
+	Running   bool      `json:"running"`
+	Pending   int       `json:"pending"`
+	Sent      int       `json:"sent"`
+	Failed    int       `json:"failed"`
+	Retries   int       `json:"retries"`
+	LastRunAt time.Time `json:"last_run_at,omitempty"`
+}
+
+// Outbox stores messages and delivers them through a transport, retrying failures.
+// It is a Transport itself: Send only queues the message.
+type Outbox struct {
+	cfg       OutboxConfig
+	file      *store.JSONFile
+	transport Transport
+	wake      chan struct{}
+
+	mu      sync.Mutex
+	entries map[string]*Entry
+	stats   OutboxStats
+}
+
+// NewOutbox loads the outbox from path
+func NewOutbox(path string, cfg OutboxConfig, transport Transport) (*Outbox, error) {
+	o := &Outbox{
+		cfg:       cfg,
+		file:      store.NewJSONFile(path),
+		transport: transport,
+		wake:      make(chan struct{}, 1),
+		entries:   make(map[string]*Entry),
+	}
+	if err := o.file.Load(&o.entries); err != nil {
+		return nil, err
+	}
+	if o.entries == nil {
+		o.entries = make(map[string]*Entry)
+	}
+	return o, nil
+}
+
+// Send queues msg for delivery
+func (o *Outbox) Send(ctx context.Context, msg Message) error {
+	_, _, err := o.Enqueue("", "", msg)
+	return err
+}
+
+// Enqueue queues msg unless an entry with the same non-empty key exists. It returns the
+// entry and whether it was queued now.
+func (o *Outbox) Enqueue(key, locale string, msg Message) (Entry, bool, error) {
+	if msg.To == "" {
+		return Entry{}, false, fmt.Errorf("message has no recipient")
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if key != "" {
+		for _, e := range o.entries {
+			if e.Key == key {
+				return *e, false, nil
+			}
+		}
+	}
+	e, err := o.addLocked(Entry{Key: key, Locale: locale, Message: msg})
+	if err != nil {
+		return Entry{}, false, err
+	}
+	return e, true, nil
+}
+
+// Resend queues a copy of an entry, whatever its state
+func (o *Outbox) Resend(id string) (Entry, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	orig, ok := o.entries[id]
+	if !ok {
+		return Entry{}, fmt.Errorf("notification %s not found", id)
+	}
+	msg := orig.Message
+	msg.SentAt = time.Time{}
+	return o.addLocked(Entry{Locale: orig.Locale, Message: msg, ResendOf: orig.ID})
+}
+
+func (o *Outbox) addLocked(e Entry) (Entry, error) {
+	id, err := store.NewID("MSG_")
+	if err != nil {
+		return Entry{}, err
+	}
+	now := time.Now()
+	e.ID = id
+	e.Status = EntryPending
+	e.NextAttemptAt = now
+	e.CreatedAt = now
+	o.entries[e.ID] = &e
+	if err := o.file.Save(o.entries); err != nil {
+		delete(o.entries, e.ID)
+		return Entry{}, err
+	}
+	// Deliver without waiting for the next tick
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return e, nil
+}
+
+// Get returns an entry by id
+func (o *Outbox) Get(id string) (Entry, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	e, ok := o.entries[id]
+	if !ok {
+		return Entry{}, false
+	}
+	return *e, true
+}
+
+// List returns the entries newest first, optionally only those with status
+func (o *Outbox) List(status EntryStatus) []Entry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	list := make([]Entry, 0, len(o.entries))
+	for _, e := range o.entries {
+		if status == "" || e.Status == status {
+			list = append(list, *e)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
+
+// Start delivers queued entries until ctx is cancelled
+func (o *Outbox) Start(ctx context.Context) {
+	o.mu.Lock()
+	o.stats.Running = true
+	o.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(o.cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			o.RunOnce(ctx, time.Now())
+			select {
+			case <-ctx.Done():
+				o.mu.Lock()
+				o.stats.Running = false
+				o.mu.Unlock()
+				return
+			case <-ticker.C:
+			case <-o.wake:
+			}
+		}
+	}()
+}
+
+// RunOnce delivers every pending entry that is due
+func (o *Outbox) RunOnce(ctx context.Context, now time.Time) {
+	for _, e := range o.due(now) {
+		if ctx.Err() != nil {
+			return
+		}
+		msg := e.Message
+		if msg.SentAt.IsZero() {
+			msg.SentAt = now
+		}
+		err := o.transport.Send(ctx, msg)
+		o.finish(e.ID, msg.SentAt, err, now)
+	}
+
+	o.mu.Lock()
+	o.stats.LastRunAt = now
+	o.mu.Unlock()
+}
+
+// Stats returns the outbox counters
+func (o *Outbox) Stats() OutboxStats {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	stats := o.stats
+	stats.Pending, stats.Sent, stats.Failed = 0, 0, 0
+	for _, e := range o.entries {
+		switch e.Status {
+		case EntryPending:
+			stats.Pending++
+		case EntrySent:
+			stats.Sent++
+		case EntryFailed:
+			stats.Failed++
+		}
+	}
+	return stats
+}
+
+func (o *Outbox) due(now time.Time) []Entry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var due []Entry
+	for _, e := range o.entries {
+		if e.Status == EntryPending && !e.NextAttemptAt.After(now) {
+			due = append(due, *e)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].CreatedAt.Before(due[j].CreatedAt) })
+	return due
+}
+
+// finish records the outcome of a delivery attempt
+func (o *Outbox) finish(id string, sentAt time.Time, err error, now time.Time) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	e, ok := o.entries[id]
+	if !ok {
+		return
+	}
+	e.Attempts++
+	switch {
+	case err == nil:
+		e.Status = EntrySent
+		e.Message.SentAt = sentAt
+		e.SentAt = now
+		e.NextAttemptAt = time.Time{}
+		e.LastError = ""
+	case e.Attempts > len(o.cfg.RetryDelays):
+		e.Status = EntryFailed
+		e.NextAttemptAt = time.Time{}
+		e.LastError = err.Error()
+		log.Printf("Notification %s [%s] to %s failed after %d attempts: %v", e.ID, e.Message.Kind, e.Message.To, e.Attempts, err)
+	default:
+		o.stats.Retries++
+		e.NextAttemptAt = now.Add(o.cfg.RetryDelays[e.Attempts-1])
+		e.LastError = err.Error()
+	}
+	if err := o.file.Save(o.entries); err != nil {
+		log.Printf("Failed to save the notification outbox: %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+
+	"tapsilat-go-example/i18n"
+)
+
+// Templates renders messages from template files, one directory per locale:
+//
+//	<dir>/<locale>/<kind>.subject.txt  subject (text/template, required)
+//	<dir>/<locale>/<kind>.txt          plain text body (text/template, required)
+//	<dir>/<locale>/<kind>.html         HTML body (html/template, optional)
+//
+// Files are read on every render, so templates can be edited without a restart.
+type Templates struct {
+	dir           string
+	defaultLocale string
+}
+
+// NewTemplates reads templates from dir, falling back to defaultLocale for missing locales
+func NewTemplates(dir, defaultLocale string) *Templates {
+	return &Templates{dir: dir, defaultLocale: i18n.Normalize(defaultLocale)}
+}
+
+// Render builds the message of kind in locale from data. The locale actually used is
+// returned, which is the default one when the template has no translation.
+func (t *Templates) Render(kind, locale string, data interface{}) (Message, string, error) {
+	if kind == "" || strings.ContainsAny(kind, `/\.`) {
+		return Message{}, "", fmt.Errorf("invalid template name %q", kind)
+	}
+	locale = t.resolve(kind, i18n.Normalize(locale))
+	if locale == "" {
+		return Message{}, "", fmt.Errorf("no template for %s", kind)
+	}
+	base := filepath.Join(t.dir, locale, kind)
+
+	subject, err := renderText(base+".subject.txt", data)
+	if err != nil {
+		return Message{}, "", err
+	}
+	body, err := renderText(base+".txt", data)
+	if err != nil {
+		return Message{}, "", err
+	}
+	html := ""
+	if _, err := os.Stat(base + ".html"); err == nil {
+		tmpl, err := htmltemplate.ParseFiles(base + ".html")
+		if err != nil {
+			return Message{}, "", err
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return Message{}, "", fmt.Errorf("render %s.html: %w", kind, err)
+		}
+		html = buf.String()
+	}
+
+	return Message{
+		Kind:    kind,
+		Subject: strings.TrimSpace(subject),
+		Body:    body,
+		HTML:    html,
+	}, locale, nil
+}
+
+// Kinds lists the templates available per locale
+func (t *Templates) Kinds() map[string][]string {
+	kinds := make(map[string][]string)
+	locales, err := os.ReadDir(t.dir)
+	if err != nil {
+		return kinds
+	}
+	for _, l := range locales {
+		if !l.IsDir() {
+			continue
+		}
+		files, _ := filepath.Glob(filepath.Join(t.dir, l.Name(), "*.subject.txt"))
+		for _, f := range files {
+			kinds[l.Name()] = append(kinds[l.Name()], strings.TrimSuffix(filepath.Base(f), ".subject.txt"))
+		}
+		sort.Strings(kinds[l.Name()])
+	}
+	return kinds
+}
+
+// resolve returns locale if kind is translated into it, else the default locale if that has it
+func (t *Templates) resolve(kind, locale string) string {
+	for _, l := range []string{locale, t.defaultLocale} {
+		if l == "" {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(t.dir, l, kind+".subject.txt")); err == nil {
+			return l
+		}
+	}
+	return ""
+}
+
+func renderText(path string, data interface{}) (string, error) {
+	tmpl, err := texttemplate.ParseFiles(path)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("render %s: %w", filepath.Base(path), err)
+	}
+	return buf.String(), nil
+}
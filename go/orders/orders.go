@@ -0,0 +1,343 @@
+package orders
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tapsilat-go-example/store"
+)
+
+// Status represents the local state of an order
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusPaid      Status = "paid"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+	StatusRefunded  Status = "refunded"
+)
+
+// IsTerminal reports whether no further transitions are expected
+func (s Status) IsTerminal() bool {
+	switch s {
+	case StatusPaid, StatusFailed, StatusCancelled, StatusRefunded:
+		return true
+	}
+	return false
+}
+
+// Transition records a single status change
+type Transition struct {
+	From   Status    `json:"from"`
+	To     Status    `json:"to"`
+	Source string    `json:"source"`
+	At     time.Time `json:"at"`
+}
+
+// Line is a priced basket line of an order
+type Line struct {
+	ProductID int     `json:"product_id"`
+	Name      string  `json:"name"`
+	Category  string  `json:"category,omitempty"`
+	Quantity  int     `json:"quantity"`
+	UnitPrice float64 `json:"unit_price"`
+	Amount    float64 `json:"amount"`
+	Discount  float64 `json:"discount,omitempty"`
+	TaxRate   float64 `json:"tax_rate"`
+	Tax       float64 `json:"tax"`
+}
+
+// TaxLine sums the order lines taxed at one rate
+type TaxLine struct {
+	Rate  float64 `json:"rate"`
+	Net   float64 `json:"net"`
+	Tax   float64 `json:"tax"`
+	Gross float64 `json:"gross"`
+}
+
+// Payout is what a submerchant is owed for one line of an order
+type Payout struct {
+	ProductID      int     `json:"product_id"`
+	SubmerchantKey string  `json:"submerchant_key"`
+	Amount         float64 `json:"amount"`
+	Commission     float64 `json:"commission"`
+	Payout         float64 `json:"payout"`
+}
+
+// Address is a billing or shipping address of an order
+type Address struct {
+	ContactName string `json:"contact_name"`
+	Email       string `json:"email,omitempty"`
+	Phone       string `json:"phone,omitempty"`
+	Address     string `json:"address"`
+	City        string `json:"city"`
+	ZipCode     string `json:"zip_code,omitempty"`
+	VatNumber   string `json:"vat_number,omitempty"`
+}
+
+// Risk is the fraud screening outcome of an order
+type Risk struct {
+	AssessmentID string   `json:"assessment_id"`
+	Score        int      `json:"score"`
+	Decision     string   `json:"decision"` // allow or challenge; blocked orders are never created
+	Reasons      []string `json:"reasons,omitempty"`
+	Review       string   `json:"review,omitempty"` // verdict of a manual review
+}
+
+// Refund is a refund made on an order
+type Refund struct {
+	Amount float64   `json:"amount"`
+	Source string    `json:"source"`
+	At     time.Time `json:"at"`
+}
+
+// Record is the local copy of an order created through the example
+type Record struct {
+	ReferenceID    string       `json:"reference_id"`
+	ConversationID string       `json:"conversation_id"`
+	Status         Status       `json:"status"`
+	Amount         float64      `json:"amount"`
+	Discount       float64      `json:"discount,omitempty"`
+	Coupons        []string     `json:"coupons,omitempty"`
+	Net            float64      `json:"net"`
+	Tax            float64      `json:"tax"`
+	Gross          float64      `json:"gross"`
+	TaxIncluded    bool         `json:"tax_included"`
+	TaxLines       []TaxLine    `json:"tax_lines,omitempty"`
+	Lines          []Line       `json:"lines,omitempty"`
+	Shipping       float64      `json:"shipping,omitempty"`
+	ShippingMethod string       `json:"shipping_method,omitempty"`
+	Currency       string       `json:"currency"`
+	FXBase         string       `json:"fx_base,omitempty"`
+	FXRate         float64      `json:"fx_rate,omitempty"`
+	FXRateAt       time.Time    `json:"fx_rate_at,omitempty"`
+	Payouts        []Payout     `json:"payouts,omitempty"`
+	BuyerEmail     string       `json:"buyer_email,omitempty"`
+	CustomerID     string       `json:"customer_id,omitempty"`
+	Locale         string       `json:"locale,omitempty"` // checkout locale, used for emails
+	Installment    int          `json:"installment,omitempty"`
+	Risk           *Risk        `json:"risk,omitempty"`
+	Refunds        []Refund     `json:"refunds,omitempty"`
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+	History        []Transition `json:"history,omitempty"`
+
+	// Addresses as entered at checkout
+	BillingAddress  *Address `json:"billing_address,omitempty"`
+	ShippingAddress *Address `json:"shipping_address,omitempty"`
+
+	// Status poller bookkeeping
+	PollAttempts  int       `json:"poll_attempts,omitempty"`
+	LastPolledAt  time.Time `json:"last_polled_at,omitempty"`
+	NextPollAt    time.Time `json:"next_poll_at,omitempty"`
+	PollAbandoned bool      `json:"poll_abandoned,omitempty"`
+}
+
+// Refunded returns the amount refunded so far
+func (r Record) Refunded() float64 {
+	total := 0.0
+	for _, refund := range r.Refunds {
+		total += refund.Amount
+	}
+	return total
+}
+
+// PaidAt returns when the order became paid, or the zero time
+func (r Record) PaidAt() time.Time {
+	for _, t := range r.History {
+		if t.To == StatusPaid {
+			return t.At
+		}
+	}
+	return time.Time{}
+}
+
+// Store keeps order records in memory and persists them to a JSON file
+type Store struct {
+	mu      sync.RWMutex
+	file    *store.JSONFile
+	records map[string]*Record
+}
+
+// NewStore loads the order store from path
+func NewStore(path string) (*Store, error) {
+	s := &Store{
+		file:    store.NewJSONFile(path),
+		records: make(map[string]*Record),
+	}
+	if err := s.file.Load(&s.records); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Create stores a new pending order record
+func (s *Store) Create(rec Record) error {
+	if rec.ReferenceID == "" {
+		return fmt.Errorf("reference id is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.records[rec.ReferenceID]; exists {
+		return fmt.Errorf("order %s already exists", rec.ReferenceID)
+	}
+
+	now := time.Now()
+	if rec.Status == "" {
+		rec.Status = StatusPending
+	}
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = now
+	}
+	rec.UpdatedAt = now
+	s.records[rec.ReferenceID] = &rec
+	return s.saveLocked()
+}
+
+// Get returns a copy of the record for referenceID
+func (s *Store) Get(referenceID string) (Record, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rec, ok := s.records[referenceID]
+	if !ok {
+		return Record{}, false
+	}
+	return *rec, true
+}
+
+// List returns all records, newest first
+func (s *Store) List() []Record {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Record, 0, len(s.records))
+	for _, rec := range s.records {
+		list = append(list, *rec)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list
+}
+
+// Pending returns pending orders created before the given time that are still being polled
+func (s *Store) Pending(createdBefore time.Time) []Record {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var list []Record
+	for _, rec := range s.records {
+		if rec.Status == StatusPending && !rec.PollAbandoned && rec.CreatedAt.Before(createdBefore) {
+			list = append(list, *rec)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list
+}
+
+// Update applies fn to the stored record and persists the result
+func (s *Store) Update(referenceID string, fn func(rec *Record)) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.records[referenceID]
+	if !ok {
+		return Record{}, fmt.Errorf("order %s not found", referenceID)
+	}
+	fn(rec)
+	rec.UpdatedAt = time.Now()
+	return *rec, s.saveLocked()
+}
+
+// Apply moves an order to status if the transition is allowed.
+// It returns the updated record and whether anything changed.
+func (s *Store) Apply(referenceID string, status Status, source string) (Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.records[referenceID]
+	if !ok {
+		return Record{}, false, fmt.Errorf("order %s not found", referenceID)
+	}
+	if rec.Status == status || !CanTransition(rec.Status, status) {
+		return *rec, false, nil
+	}
+
+	now := time.Now()
+	rec.History = append(rec.History, Transition{From: rec.Status, To: status, Source: source, At: now})
+	rec.Status = status
+	rec.UpdatedAt = now
+	return *rec, true, s.saveLocked()
+}
+
+// AddRefund records a refund of amount on an order
+func (s *Store) AddRefund(referenceID string, amount float64, source string) (Record, error) {
+	if amount <= 0 {
+		return Record{}, fmt.Errorf("refund amount must be positive")
+	}
+	return s.Update(referenceID, func(rec *Record) {
+		rec.Refunds = append(rec.Refunds, Refund{Amount: amount, Source: source, At: time.Now()})
+	})
+}
+
+func (s *Store) saveLocked() error {
+	return s.file.Save(s.records)
+}
+
+// CanTransition reports whether an order may move from one status to another
+func CanTransition(from, to Status) bool {
+	switch from {
+	case StatusPending:
+		return to != StatusPending
+	case StatusFailed:
+		// A buyer can retry on the hosted checkout after a failed attempt
+		return to == StatusPaid || to == StatusCancelled
+	case StatusPaid:
+		return to == StatusRefunded || to == StatusCancelled
+	}
+	return false
+}
+
+// ParseGatewayStatus maps a Tapsilat order status (numeric code or name) to a local status.
+// Unknown or in-progress values map to StatusPending. A partially refunded order stays
+// paid; its refunds are kept in Record.Refunds.
+func ParseGatewayStatus(raw string) Status {
+	raw = strings.ToLower(strings.TrimSpace(raw))
+	if code, err := strconv.Atoi(raw); err == nil {
+		switch code {
+		case 3, 5, 9: // Paid, Shipped, Completed
+			return StatusPaid
+		case 8: // Cancelled
+			return StatusCancelled
+		case 10: // Refunded
+			return StatusRefunded
+		case 13, 17, 18: // Failure, Disapproved, Errored
+			return StatusFailed
+		}
+		return StatusPending
+	}
+
+	switch {
+	case strings.Contains(raw, "partial") && strings.Contains(raw, "refund"):
+		return StatusPaid
+	case strings.Contains(raw, "refund"):
+		return StatusRefunded
+	case strings.Contains(raw, "cancel"):
+		return StatusCancelled
+	case strings.Contains(raw, "fail"), strings.Contains(raw, "error"), strings.Contains(raw, "disapprov"):
+		return StatusFailed
+	case raw == "paid", raw == "success", raw == "succeeded", raw == "completed", raw == "shipped":
+		return StatusPaid
+	}
+	return StatusPending
+}
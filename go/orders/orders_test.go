@@ -0,0 +1,51 @@
+package orders
+
+import "testing"
+
+func TestParseGatewayStatus(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want Status
+	}{
+		{"3", StatusPaid},
+		{"9", StatusPaid},
+		{"8", StatusCancelled},
+		{"10", StatusRefunded},
+		{"13", StatusFailed},
+		{"1", StatusPending},
+		{" Paid ", StatusPaid},
+		{"REFUNDED", StatusRefunded},
+		{"partially_refunded", StatusPaid},
+		{"Partial Refund", StatusPaid},
+		{"cancelled", StatusCancelled},
+		{"disapproved", StatusFailed},
+		{"processing", StatusPending},
+		{"", StatusPending},
+	}
+	for _, tt := range tests {
+		if got := ParseGatewayStatus(tt.raw); got != tt.want {
+			t.Errorf("ParseGatewayStatus(%q) = %s, want %s", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to Status
+		want     bool
+	}{
+		{StatusPending, StatusPaid, true},
+		{StatusPending, StatusPending, false},
+		{StatusFailed, StatusPaid, true},
+		{StatusFailed, StatusRefunded, false},
+		{StatusPaid, StatusRefunded, true},
+		{StatusPaid, StatusFailed, false},
+		{StatusRefunded, StatusPaid, false},
+		{StatusCancelled, StatusPaid, false},
+	}
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransition(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
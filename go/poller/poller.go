@@ -0,0 +1,222 @@
+package poller
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"tapsilat-go-example/orders"
+)
+
+// StatusFetcher asks the gateway for the current status of an order
+type StatusFetcher interface {
+	FetchStatus(ctx context.Context, referenceID string) (orders.Status, error)
+}
+
+// ApplyFunc applies a status transition the same way a webhook callback would
+type ApplyFunc func(referenceID string, status orders.Status, source string)
+
+// Config controls how often and how aggressively orders are polled
+type Config struct {
+	Interval    time.Duration // how often the queue is scanned
+	MinAge      time.Duration // orders younger than this are left to the callback
+	MaxAge      time.Duration // orders older than this are no longer polled
+	BaseBackoff time.Duration // delay after the first poll of an order
+	MaxBackoff  time.Duration // upper bound for the per-order delay
+	RateLimit   time.Duration // minimum gap between two gateway calls
+}
+
+// DefaultConfig returns the poller defaults
+func DefaultConfig() Config {
+	return Config{
+		Interval:    30 * time.Second,
+		MinAge:      2 * time.Minute,
+		MaxAge:      24 * time.Hour,
+		BaseBackoff: time.Minute,
+		MaxBackoff:  time.Hour,
+		RateLimit:   time.Second,
+	}
+}
+
+// Stats describes the poller state
+type Stats struct {
+	Running    bool      `json:"running"`
+	QueueDepth int       `json:"queue_depth"`
+	Due        int       `json:"due"`
+	Polled     int       `json:"polled"`
+	Applied    int       `json:"applied"`
+	Errors     int       `json:"errors"`
+	Abandoned  int       `json:"abandoned"`
+	LastRunAt  time.Time `json:"last_run_at,omitempty"`
+}
+
+// Poller checks locally pending orders against the gateway when callbacks never arrive
+type Poller struct {
+	cfg   Config
+	store *orders.Store
+	fetch StatusFetcher
+	apply ApplyFunc
+
+	// onAbandon is called for orders the poller gives up on
+	onAbandon func(rec orders.Record)
+
+	run   sync.Mutex // held for the duration of a polling pass
+	mu    sync.Mutex
+	stats Stats
+}
+
+// New creates a Poller
+func New(cfg Config, store *orders.Store, fetch StatusFetcher, apply ApplyFunc) *Poller {
+	return &Poller{
+		cfg:   cfg,
+		store: store,
+		fetch: fetch,
+		apply: apply,
+	}
+}
+
+// OnAbandon sets a function called for every order the poller gives up on, e.g. to
+// release what the order was holding
+func (p *Poller) OnAbandon(fn func(rec orders.Record)) {
+	p.onAbandon = fn
+}
+
+// Start runs the poller until ctx is cancelled
+func (p *Poller) Start(ctx context.Context) {
+	p.mu.Lock()
+	p.stats.Running = true
+	p.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(p.cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			p.RunOnce(ctx)
+			select {
+			case <-ctx.Done():
+				p.mu.Lock()
+				p.stats.Running = false
+				p.mu.Unlock()
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RunOnce polls every order that is due, respecting the rate limit. Passes never overlap:
+// it returns false without polling when another pass is running.
+func (p *Poller) RunOnce(ctx context.Context) bool {
+	if !p.run.TryLock() {
+		return false
+	}
+	defer p.run.Unlock()
+
+	now := time.Now()
+	pending := p.store.Pending(now.Add(-p.cfg.MinAge))
+
+	var due []orders.Record
+	for _, rec := range pending {
+		if now.Sub(rec.CreatedAt) > p.cfg.MaxAge {
+			p.abandon(rec)
+			continue
+		}
+		if rec.NextPollAt.After(now) {
+			continue
+		}
+		due = append(due, rec)
+	}
+
+	p.mu.Lock()
+	p.stats.LastRunAt = now
+	p.stats.Due = len(due)
+	p.mu.Unlock()
+
+	for i, rec := range due {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return true
+			case <-time.After(p.cfg.RateLimit):
+			}
+		}
+		p.poll(ctx, rec)
+	}
+	return true
+}
+
+func (p *Poller) poll(ctx context.Context, rec orders.Record) {
+	status, err := p.fetch.FetchStatus(ctx, rec.ReferenceID)
+
+	attempts := rec.PollAttempts + 1
+	_, updateErr := p.store.Update(rec.ReferenceID, func(r *orders.Record) {
+		r.PollAttempts = attempts
+		r.LastPolledAt = time.Now()
+		r.NextPollAt = r.LastPolledAt.Add(p.backoff(attempts))
+	})
+	if updateErr != nil {
+		log.Printf("Status poller: failed to update %s: %v", rec.ReferenceID, updateErr)
+	}
+
+	p.mu.Lock()
+	p.stats.Polled++
+	if err != nil {
+		p.stats.Errors++
+		p.mu.Unlock()
+		log.Printf("Status poller: failed to fetch status for %s: %v", rec.ReferenceID, err)
+		return
+	}
+	if status == orders.StatusPending {
+		p.mu.Unlock()
+		return
+	}
+	p.stats.Applied++
+	p.mu.Unlock()
+
+	// apply sends emails and calls the gateway, so it must not hold the stats lock
+	p.apply(rec.ReferenceID, status, "poller")
+}
+
+func (p *Poller) abandon(rec orders.Record) {
+	_, err := p.store.Update(rec.ReferenceID, func(r *orders.Record) {
+		r.PollAbandoned = true
+	})
+	if err != nil {
+		log.Printf("Status poller: failed to abandon %s: %v", rec.ReferenceID, err)
+		return
+	}
+	log.Printf("Status poller: giving up on %s after %s", rec.ReferenceID, p.cfg.MaxAge)
+	if p.onAbandon != nil {
+		p.onAbandon(rec)
+	}
+
+	p.mu.Lock()
+	p.stats.Abandoned++
+	p.mu.Unlock()
+}
+
+// backoff doubles the delay with each attempt up to MaxBackoff
+func (p *Poller) backoff(attempts int) time.Duration {
+	delay := p.cfg.BaseBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= p.cfg.MaxBackoff {
+			return p.cfg.MaxBackoff
+		}
+	}
+	return delay
+}
+
+// Stats returns a snapshot of the poller state including the current queue depth
+func (p *Poller) Stats() Stats {
+	queued := p.store.Pending(time.Now())
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := p.stats
+	stats.QueueDepth = len(queued)
+	return stats
+}
@@ -0,0 +1,126 @@
+package poller
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tapsilat-go-example/orders"
+)
+
+// fakeFetcher reports a fixed status, or an error, per reference id
+type fakeFetcher map[string]orders.Status
+
+func (f fakeFetcher) FetchStatus(ctx context.Context, referenceID string) (orders.Status, error) {
+	status, ok := f[referenceID]
+	if !ok {
+		return orders.StatusPending, errors.New("gateway unavailable")
+	}
+	return status, nil
+}
+
+func newStore(t *testing.T, ages map[string]time.Duration) *orders.Store {
+	t.Helper()
+	s, err := orders.NewStore(filepath.Join(t.TempDir(), "orders.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ref, age := range ages {
+		if err := s.Create(orders.Record{ReferenceID: ref, CreatedAt: time.Now().Add(-age)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func TestRunOnce(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.RateLimit = 0
+	store := newStore(t, map[string]time.Duration{
+		"paid":    10 * time.Minute,
+		"failed":  10 * time.Minute,
+		"waiting": 10 * time.Minute,
+		"broken":  10 * time.Minute,
+		"young":   time.Second,
+		"old":     48 * time.Hour,
+	})
+	fetch := fakeFetcher{
+		"paid":    orders.StatusPaid,
+		"failed":  orders.StatusFailed,
+		"waiting": orders.StatusPending,
+		"young":   orders.StatusPaid,
+		"old":     orders.StatusPaid,
+	}
+	applied := map[string]orders.Status{}
+	p := New(cfg, store, fetch, func(referenceID string, status orders.Status, source string) {
+		if source != "poller" {
+			t.Errorf("apply source = %q", source)
+		}
+		applied[referenceID] = status
+	})
+	var abandoned []string
+	p.OnAbandon(func(rec orders.Record) { abandoned = append(abandoned, rec.ReferenceID) })
+
+	if !p.RunOnce(context.Background()) {
+		t.Fatal("RunOnce = false")
+	}
+
+	want := map[string]orders.Status{"paid": orders.StatusPaid, "failed": orders.StatusFailed}
+	if len(applied) != len(want) {
+		t.Errorf("applied = %v, want %v", applied, want)
+	}
+	for ref, status := range want {
+		if applied[ref] != status {
+			t.Errorf("applied[%s] = %s, want %s", ref, applied[ref], status)
+		}
+	}
+	if len(abandoned) != 1 || abandoned[0] != "old" {
+		t.Errorf("abandoned = %v, want [old]", abandoned)
+	}
+
+	stats := p.Stats()
+	if stats.Due != 4 || stats.Polled != 4 || stats.Applied != 2 || stats.Errors != 1 || stats.Abandoned != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	// Polled orders wait for their backoff before the next poll
+	rec, _ := store.Get("waiting")
+	if rec.PollAttempts != 1 || !rec.NextPollAt.After(time.Now()) {
+		t.Errorf("waiting = %d attempts, next poll %s", rec.PollAttempts, rec.NextPollAt)
+	}
+	applied = map[string]orders.Status{}
+	p.RunOnce(context.Background())
+	if stats := p.Stats(); stats.Due != 0 || len(applied) != 0 {
+		t.Errorf("second pass: due %d, applied %v", stats.Due, applied)
+	}
+}
+
+func TestRunOnceDoesNotOverlap(t *testing.T) {
+	p := New(DefaultConfig(), newStore(t, nil), fakeFetcher{}, func(string, orders.Status, string) {})
+	p.run.Lock()
+	defer p.run.Unlock()
+	if p.RunOnce(context.Background()) {
+		t.Error("RunOnce ran while another pass was running")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := New(Config{BaseBackoff: time.Minute, MaxBackoff: 10 * time.Minute}, nil, nil, nil)
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{5, 10 * time.Minute},
+		{20, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := p.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package products
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"tapsilat-go-example/store"
+)
+
+// Product is a catalog entry. Prices, tax category, weight and seller of a cart
+// or order line always come from here, never from the client.
+type Product struct {
+	ID          int     `json:"id"`
+	Name        string  `json:"name"`
+	Description string  `json:"description,omitempty"`
+	Price       float64 `json:"price"` // in the base currency
+	Category    string  `json:"category,omitempty"`
+	Image       string  `json:"image,omitempty"`
+	Weight      float64 `json:"weight,omitempty"` // kilograms per unit
+	// Prices are fixed prices per currency; other currencies are converted from Price
+	Prices map[string]float64 `json:"prices,omitempty"`
+	// SubmerchantKey is the marketplace seller, when not linked in the submerchant registry
+	SubmerchantKey string    `json:"submerchant_key,omitempty"`
+	Active         bool      `json:"active"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// DefaultProducts is the catalog used until products are configured
+func DefaultProducts() map[int]*Product {
+	return map[int]*Product{
+		1: {ID: 1, Name: "Premium Widget", Price: 100.00, Category: "Electronics", Weight: 0.5, Active: true},
+		2: {ID: 2, Name: "Standard Widget", Price: 50.00, Category: "Electronics", Weight: 0.3, Active: true},
+		3: {ID: 3, Name: "Widget Manual", Price: 25.00, Category: "Books", Weight: 0.2, Active: true},
+	}
+}
+
+// Catalog keeps the products
+type Catalog struct {
+	mu       sync.RWMutex
+	file     *store.JSONFile
+	products map[int]*Product
+}
+
+// NewCatalog loads the product catalog from path. The default products are only
+// used until the catalog is first saved, so deleted defaults stay deleted.
+func NewCatalog(path string) (*Catalog, error) {
+	c := &Catalog{file: store.NewJSONFile(path)}
+	if err := c.file.Load(&c.products); err != nil {
+		return nil, err
+	}
+	if c.products == nil {
+		c.products = DefaultProducts()
+	}
+	return c, nil
+}
+
+// List returns the products ordered by id, only the active ones unless all is set
+func (c *Catalog) List(all bool) []Product {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	list := make([]Product, 0, len(c.products))
+	for _, p := range c.products {
+		if all || p.Active {
+			list = append(list, copyProduct(p))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// Get returns a product by id
+func (c *Catalog) Get(id int) (Product, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	p, ok := c.products[id]
+	if !ok {
+		return Product{}, false
+	}
+	return copyProduct(p), true
+}
+
+// Available returns an active product by id
+func (c *Catalog) Available(id int) (Product, error) {
+	p, ok := c.Get(id)
+	if !ok || !p.Active {
+		return Product{}, fmt.Errorf("product %d is not available", id)
+	}
+	return p, nil
+}
+
+// Save validates and creates or replaces a product
+func (c *Catalog) Save(p Product) (Product, error) {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.ID < 1 || p.Name == "" {
+		return Product{}, fmt.Errorf("id and name are required")
+	}
+	if p.Price <= 0 {
+		return Product{}, fmt.Errorf("price must be positive")
+	}
+	if p.Weight < 0 {
+		return Product{}, fmt.Errorf("weight cannot be negative")
+	}
+	prices := make(map[string]float64, len(p.Prices))
+	for code, price := range p.Prices {
+		if price <= 0 {
+			return Product{}, fmt.Errorf("price in %s must be positive", code)
+		}
+		prices[strings.ToUpper(strings.TrimSpace(code))] = price
+	}
+	p.Prices = prices
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	p.CreatedAt = now
+	if existing, ok := c.products[p.ID]; ok {
+		p.CreatedAt = existing.CreatedAt
+	}
+	p.UpdatedAt = now
+	c.products[p.ID] = &p
+	if err := c.file.Save(c.products); err != nil {
+		return Product{}, err
+	}
+	return copyProduct(&p), nil
+}
+
+// Delete removes a product. Carts and orders keep the lines they already have.
+func (c *Catalog) Delete(id int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.products[id]; !ok {
+		return fmt.Errorf("product %d not found", id)
+	}
+	delete(c.products, id)
+	return c.file.Save(c.products)
+}
+
+func copyProduct(p *Product) Product {
+	out := *p
+	if p.Prices != nil {
+		out.Prices = make(map[string]float64, len(p.Prices))
+		for code, price := range p.Prices {
+			out.Prices[code] = price
+		}
+	}
+	return out
+}
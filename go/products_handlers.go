@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"tapsilat-go-example/cart"
+	"tapsilat-go-example/products"
+
+	"github.com/gin-gonic/gin"
+)
+
+// catalogProduct returns quantity of an active catalog product as an order line
+func catalogProduct(id, quantity int) (Product, error) {
+	p, err := productCatalog.Available(id)
+	if err != nil {
+		return Product{}, err
+	}
+	return Product{
+		ID:             p.ID,
+		Name:           p.Name,
+		Price:          p.Price,
+		Description:    p.Description,
+		Image:          p.Image,
+		Quantity:       quantity,
+		Category:       p.Category,
+		Weight:         p.Weight,
+		Prices:         p.Prices,
+		SubmerchantKey: p.SubmerchantKey,
+	}, nil
+}
+
+// catalogLine returns quantity of an active catalog product as a cart line
+func catalogLine(id, quantity int) (cart.Line, error) {
+	p, err := catalogProduct(id, quantity)
+	if err != nil {
+		return cart.Line{}, err
+	}
+	return cart.Line{
+		ProductID:      p.ID,
+		Name:           p.Name,
+		Price:          p.Price,
+		Quantity:       p.Quantity,
+		Category:       p.Category,
+		Image:          p.Image,
+		Weight:         p.Weight,
+		Prices:         p.Prices,
+		SubmerchantKey: p.SubmerchantKey,
+	}, nil
+}
+
+// catalogProducts replaces every item with its catalog product, keeping the quantity
+func catalogProducts(items []Product) ([]Product, error) {
+	resolved := make([]Product, 0, len(items))
+	for _, item := range items {
+		if item.Quantity < 1 {
+			return nil, fmt.Errorf("quantity of product %d must be at least 1", item.ID)
+		}
+		p, err := catalogProduct(item.ID, item.Quantity)
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, p)
+	}
+	return resolved, nil
+}
+
+// listProductsHandler lists the products customers can buy
+func listProductsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, productCatalog.List(false))
+}
+
+// listAllProductsHandler lists every product, including inactive ones
+func listAllProductsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, productCatalog.List(true))
+}
+
+// saveProductHandler creates or replaces a product
+func saveProductHandler(c *gin.Context) {
+	var req products.Product
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	saved, err := productCatalog.Save(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, saved)
+}
+
+// deleteProductHandler removes a product from the catalog
+func deleteProductHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+	if err := productCatalog.Delete(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
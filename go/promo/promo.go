@@ -0,0 +1,478 @@
+package promo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"tapsilat-go-example/cart"
+	"tapsilat-go-example/store"
+)
+
+// Type is the kind of discount a coupon grants
+type Type string
+
+const (
+	TypePercentage   Type = "percentage"
+	TypeFixed        Type = "fixed"
+	TypeFreeShipping Type = "free_shipping"
+	TypeBuyXGetY     Type = "buy_x_get_y"
+)
+
+// Coupon is a discount code with its rules
+type Coupon struct {
+	Code          string    `json:"code"`
+	Type          Type      `json:"type"`
+	Value         float64   `json:"value"`                     // percent for percentage, amount for fixed
+	BuyQuantity   int       `json:"buy_quantity,omitempty"`    // buy_x_get_y: units to pay for
+	GetQuantity   int       `json:"get_quantity,omitempty"`    // buy_x_get_y: free units per group
+	StartsAt      time.Time `json:"starts_at,omitempty"`       // zero means no start
+	EndsAt        time.Time `json:"ends_at,omitempty"`         // zero means no end
+	UsageLimit    int       `json:"usage_limit,omitempty"`     // total redemptions, 0 is unlimited
+	PerBuyerLimit int       `json:"per_buyer_limit,omitempty"` // redemptions per buyer, 0 is unlimited
+	MinBasket     float64   `json:"min_basket,omitempty"`      // minimum subtotal
+	ProductIDs    []int     `json:"product_ids,omitempty"`     // limit to these products
+	Categories    []string  `json:"categories,omitempty"`      // limit to these categories
+	Stackable     bool      `json:"stackable"`                 // can be combined with other stackable coupons
+	Active        bool      `json:"active"`
+}
+
+// RedemptionStatus tracks a coupon use through the payment
+type RedemptionStatus string
+
+const (
+	RedemptionReserved RedemptionStatus = "reserved"
+	RedemptionRedeemed RedemptionStatus = "redeemed"
+	RedemptionReleased RedemptionStatus = "released"
+)
+
+// Redemption records a coupon used on an order
+type Redemption struct {
+	Code           string           `json:"code"`
+	Buyer          string           `json:"buyer"`
+	ConversationID string           `json:"conversation_id"`
+	Discount       float64          `json:"discount"`
+	Status         RedemptionStatus `json:"status"`
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+}
+
+type state struct {
+	Coupons     map[string]*Coupon `json:"coupons"`
+	Redemptions []*Redemption      `json:"redemptions"`
+}
+
+// Engine validates and applies coupons and records their redemptions
+type Engine struct {
+	mu    sync.Mutex
+	file  *store.JSONFile
+	state state
+}
+
+// NewEngine loads coupons and redemptions from path
+func NewEngine(path string) (*Engine, error) {
+	e := &Engine{
+		file:  store.NewJSONFile(path),
+		state: state{Coupons: make(map[string]*Coupon)},
+	}
+	if err := e.file.Load(&e.state); err != nil {
+		return nil, err
+	}
+	if e.state.Coupons == nil {
+		e.state.Coupons = make(map[string]*Coupon)
+	}
+	return e, nil
+}
+
+// NormalizeCode makes coupon codes case-insensitive
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Save creates or replaces a coupon
+func (e *Engine) Save(c Coupon) (Coupon, error) {
+	c.Code = NormalizeCode(c.Code)
+	if c.Code == "" {
+		return Coupon{}, fmt.Errorf("code is required")
+	}
+	switch c.Type {
+	case TypePercentage:
+		if c.Value <= 0 || c.Value > 100 {
+			return Coupon{}, fmt.Errorf("percentage must be between 0 and 100")
+		}
+	case TypeFixed:
+		if c.Value <= 0 {
+			return Coupon{}, fmt.Errorf("fixed discount must be positive")
+		}
+	case TypeBuyXGetY:
+		if c.BuyQuantity < 1 || c.GetQuantity < 1 {
+			return Coupon{}, fmt.Errorf("buy_quantity and get_quantity must be at least 1")
+		}
+	case TypeFreeShipping:
+	default:
+		return Coupon{}, fmt.Errorf("unknown coupon type %q", c.Type)
+	}
+	if !c.EndsAt.IsZero() && c.EndsAt.Before(c.StartsAt) {
+		return Coupon{}, fmt.Errorf("ends_at must be after starts_at")
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.state.Coupons[c.Code] = &c
+	return c, e.saveLocked()
+}
+
+// Delete removes a coupon; its redemption history is kept
+func (e *Engine) Delete(code string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	code = NormalizeCode(code)
+	if _, ok := e.state.Coupons[code]; !ok {
+		return fmt.Errorf("coupon %s not found", code)
+	}
+	delete(e.state.Coupons, code)
+	return e.saveLocked()
+}
+
+// List returns all coupons sorted by code
+func (e *Engine) List() []Coupon {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	list := make([]Coupon, 0, len(e.state.Coupons))
+	for _, c := range e.state.Coupons {
+		list = append(list, *c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Code < list[j].Code })
+	return list
+}
+
+// Redemptions returns the redemption history of a coupon, or all when code is empty
+func (e *Engine) Redemptions(code string) []Redemption {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	code = NormalizeCode(code)
+	var list []Redemption
+	for _, r := range e.state.Redemptions {
+		if code == "" || r.Code == code {
+			list = append(list, *r)
+		}
+	}
+	return list
+}
+
+// Price implements cart.Pricer. Coupons come from the cart, the buyer is the cart customer.
+func (e *Engine) Price(c cart.Cart, t *cart.Totals) error {
+	if len(c.Coupons) == 0 {
+		return nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	coupons, err := e.validateLocked(c.Coupons, c.CustomerID, *t, "")
+	if err != nil {
+		return err
+	}
+
+	for _, coupon := range coupons {
+		before := lineDiscounts(t)
+		applyCoupon(coupon, c, t)
+		t.Coupons = append(t.Coupons, cart.AppliedCoupon{
+			Code:     coupon.Code,
+			Discount: cart.Round(lineDiscounts(t) - before),
+		})
+	}
+
+	t.Discount = cart.Round(lineDiscounts(t))
+	return nil
+}
+
+func lineDiscounts(t *cart.Totals) float64 {
+	sum := 0.0
+	for _, line := range t.Lines {
+		sum += line.Discount
+	}
+	return sum
+}
+
+// validateLocked checks every code against its rules and the stacking policy.
+// Redemptions held by ignoreConversation are not counted against the limits.
+func (e *Engine) validateLocked(codes []string, buyer string, t cart.Totals, ignoreConversation string) ([]*Coupon, error) {
+	now := time.Now()
+	seen := make(map[string]bool)
+	var coupons []*Coupon
+
+	for _, raw := range codes {
+		code := NormalizeCode(raw)
+		if seen[code] {
+			continue
+		}
+		seen[code] = true
+
+		c, ok := e.state.Coupons[code]
+		if !ok || !c.Active {
+			return nil, fmt.Errorf("coupon %s is not valid", code)
+		}
+		if !c.StartsAt.IsZero() && now.Before(c.StartsAt) {
+			return nil, fmt.Errorf("coupon %s is not active yet", code)
+		}
+		if !c.EndsAt.IsZero() && now.After(c.EndsAt) {
+			return nil, fmt.Errorf("coupon %s has expired", code)
+		}
+		if minBasket := t.Convert(c.MinBasket); minBasket > 0 && t.Subtotal < minBasket {
+			return nil, fmt.Errorf("coupon %s requires a minimum basket of %.2f", code, minBasket)
+		}
+
+		total, perBuyer := e.usageLocked(code, buyer, ignoreConversation)
+		if c.UsageLimit > 0 && total >= c.UsageLimit {
+			return nil, fmt.Errorf("coupon %s has reached its usage limit", code)
+		}
+		if c.PerBuyerLimit > 0 && buyer != "" && perBuyer >= c.PerBuyerLimit {
+			return nil, fmt.Errorf("coupon %s has already been used", code)
+		}
+		coupons = append(coupons, c)
+	}
+
+	if len(coupons) > 1 {
+		for _, c := range coupons {
+			if !c.Stackable {
+				return nil, fmt.Errorf("coupon %s cannot be combined with other coupons", c.Code)
+			}
+		}
+	}
+	return coupons, nil
+}
+
+// usageLocked counts reserved and redeemed uses of a code, overall and for buyer. The
+// reservations of ignoreConversation are left out because Reserve replaces them; its
+// redeemed uses always count, as the conversation id comes from the client.
+func (e *Engine) usageLocked(code, buyer, ignoreConversation string) (total, perBuyer int) {
+	for _, r := range e.state.Redemptions {
+		if r.Code != code || r.Status == RedemptionReleased {
+			continue
+		}
+		if ignoreConversation != "" && r.ConversationID == ignoreConversation && r.Status == RedemptionReserved {
+			continue
+		}
+		total++
+		if buyer != "" && strings.EqualFold(r.Buyer, buyer) {
+			perBuyer++
+		}
+	}
+	return total, perBuyer
+}
+
+// applyCoupon adds the coupon's discount to the eligible lines
+func applyCoupon(c *Coupon, crt cart.Cart, t *cart.Totals) {
+	var eligible []int
+	eligibleAmount := 0.0
+	for i, line := range crt.Lines {
+		if i >= len(t.Lines) || !c.appliesTo(line) {
+			continue
+		}
+		if remaining(t.Lines[i]) <= 0 {
+			continue
+		}
+		eligible = append(eligible, i)
+		eligibleAmount += remaining(t.Lines[i])
+	}
+	if len(eligible) == 0 {
+		return
+	}
+
+	switch c.Type {
+	case TypePercentage:
+		for _, i := range eligible {
+			addDiscount(&t.Lines[i], cart.Round(remaining(t.Lines[i])*c.Value/100))
+		}
+
+	case TypeFixed:
+		// Spread the amount over the eligible lines by their share, the last line takes the rounding rest
+		amount := t.Convert(c.Value)
+		if amount > eligibleAmount {
+			amount = eligibleAmount
+		}
+		left := amount
+		for n, i := range eligible {
+			share := cart.Round(amount * remaining(t.Lines[i]) / eligibleAmount)
+			if n == len(eligible)-1 {
+				share = cart.Round(left)
+			}
+			addDiscount(&t.Lines[i], share)
+			left -= share
+		}
+
+	case TypeBuyXGetY:
+		group := c.BuyQuantity + c.GetQuantity
+		for _, i := range eligible {
+			free := (t.Lines[i].Quantity / group) * c.GetQuantity
+			addDiscount(&t.Lines[i], cart.Round(float64(free)*t.Lines[i].UnitPrice))
+		}
+
+	case TypeFreeShipping:
+		t.FreeShipping = true
+	}
+}
+
+func (c *Coupon) appliesTo(line cart.Line) bool {
+	if len(c.ProductIDs) == 0 && len(c.Categories) == 0 {
+		return true
+	}
+	for _, id := range c.ProductIDs {
+		if id == line.ProductID {
+			return true
+		}
+	}
+	for _, category := range c.Categories {
+		if strings.EqualFold(category, line.Category) {
+			return true
+		}
+	}
+	return false
+}
+
+func remaining(line cart.LineTotal) float64 {
+	return line.Amount - line.Discount
+}
+
+// addDiscount never discounts a line below zero
+func addDiscount(line *cart.LineTotal, amount float64) {
+	if amount > remaining(*line) {
+		amount = remaining(*line)
+	}
+	line.Discount = cart.Round(line.Discount + amount)
+}
+
+// Reserve records the coupons of an order before it is submitted. Limits are
+// checked again under the lock so concurrent checkouts cannot exceed them.
+func (e *Engine) Reserve(conversationID, buyer string, codes []string, t cart.Totals) error {
+	if len(codes) == 0 {
+		return nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	coupons, err := e.validateLocked(codes, buyer, t, conversationID)
+	if err != nil {
+		return err
+	}
+
+	// A retry of the same order replaces its earlier reservations instead of adding to them
+	kept := e.state.Redemptions[:0]
+	for _, r := range e.state.Redemptions {
+		if r.ConversationID != conversationID || r.Status == RedemptionRedeemed {
+			kept = append(kept, r)
+		}
+	}
+	e.state.Redemptions = kept
+
+	now := time.Now()
+	for _, c := range coupons {
+		e.state.Redemptions = append(e.state.Redemptions, &Redemption{
+			Code:           c.Code,
+			Buyer:          buyer,
+			ConversationID: conversationID,
+			Discount:       appliedDiscount(c.Code, t),
+			Status:         RedemptionReserved,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		})
+	}
+	return e.saveLocked()
+}
+
+// appliedDiscount returns the discount a coupon contributed to the priced totals
+func appliedDiscount(code string, t cart.Totals) float64 {
+	for _, applied := range t.Coupons {
+		if applied.Code == code {
+			return applied.Discount
+		}
+	}
+	return 0
+}
+
+// Confirm marks the coupons of an order as redeemed once it is paid. Coupons
+// released by an earlier failed attempt are redeemed again when a retry succeeds,
+// unless other orders have used up their limits meanwhile; those stay released
+// and are reported in the error.
+func (e *Engine) Confirm(conversationID string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	changed := false
+	var exhausted []string
+	for _, r := range e.state.Redemptions {
+		if r.ConversationID != conversationID {
+			continue
+		}
+		switch r.Status {
+		case RedemptionReserved:
+		case RedemptionReleased:
+			if c, ok := e.state.Coupons[r.Code]; ok {
+				total, perBuyer := e.usageLocked(r.Code, r.Buyer, "")
+				if (c.UsageLimit > 0 && total >= c.UsageLimit) ||
+					(c.PerBuyerLimit > 0 && r.Buyer != "" && perBuyer >= c.PerBuyerLimit) {
+					exhausted = append(exhausted, r.Code)
+					continue
+				}
+			}
+		default:
+			continue
+		}
+		r.Status = RedemptionRedeemed
+		r.UpdatedAt = time.Now()
+		changed = true
+	}
+	if changed {
+		if err := e.saveLocked(); err != nil {
+			return err
+		}
+	}
+	if len(exhausted) > 0 {
+		return fmt.Errorf("coupons %s reached their limits before the order was paid", strings.Join(exhausted, ", "))
+	}
+	return nil
+}
+
+// Release gives the coupons of a failed or cancelled order back
+func (e *Engine) Release(conversationID string) error {
+	return e.setStatus(conversationID, RedemptionReleased, RedemptionReserved)
+}
+
+func (e *Engine) setStatus(conversationID string, to RedemptionStatus, from ...RedemptionStatus) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	changed := false
+	for _, r := range e.state.Redemptions {
+		if r.ConversationID == conversationID && containsStatus(from, r.Status) {
+			r.Status = to
+			r.UpdatedAt = time.Now()
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return e.saveLocked()
+}
+
+func containsStatus(list []RedemptionStatus, status RedemptionStatus) bool {
+	for _, s := range list {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Engine) saveLocked() error {
+	return e.file.Save(e.state)
+}
@@ -0,0 +1,171 @@
+package promo
+
+import (
+	"path/filepath"
+	"testing"
+
+	"tapsilat-go-example/cart"
+)
+
+func newEngine(t *testing.T, coupons ...Coupon) *Engine {
+	t.Helper()
+	e, err := NewEngine(filepath.Join(t.TempDir(), "coupons.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range coupons {
+		if _, err := e.Save(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return e
+}
+
+func testCart(buyer string, coupons ...string) cart.Cart {
+	return cart.Cart{
+		CustomerID: buyer,
+		Currency:   "TRY",
+		Coupons:    coupons,
+		Lines: []cart.Line{
+			{ProductID: 1, Price: 100, Quantity: 1, Category: "books"},
+			{ProductID: 2, Price: 50, Quantity: 3, Category: "toys"},
+		},
+	}
+}
+
+func TestPrice(t *testing.T) {
+	e := newEngine(t,
+		Coupon{Code: "ten", Type: TypePercentage, Value: 10, Active: true},
+		Coupon{Code: "BOOKS20", Type: TypePercentage, Value: 20, Categories: []string{"Books"}, Active: true},
+		Coupon{Code: "FIXED", Type: TypeFixed, Value: 25, Active: true},
+		Coupon{Code: "B2G1", Type: TypeBuyXGetY, BuyQuantity: 2, GetQuantity: 1, Active: true},
+		Coupon{Code: "SHIP", Type: TypeFreeShipping, Active: true},
+		Coupon{Code: "BIG", Type: TypePercentage, Value: 10, MinBasket: 500, Active: true},
+		Coupon{Code: "OFF", Type: TypePercentage, Value: 10},
+		Coupon{Code: "S1", Type: TypePercentage, Value: 10, Stackable: true, Active: true},
+		Coupon{Code: "S2", Type: TypeFixed, Value: 10, Stackable: true, Active: true},
+	)
+
+	tests := []struct {
+		coupons  []string
+		discount float64
+		free     bool
+		wantErr  bool
+	}{
+		{[]string{"TEN"}, 25, false, false},
+		{[]string{"books20"}, 20, false, false},
+		{[]string{"FIXED"}, 25, false, false},
+		{[]string{"B2G1"}, 50, false, false},
+		{[]string{"SHIP"}, 0, true, false},
+		{[]string{"S1", "S2"}, 35, false, false},
+		{[]string{"TEN", "S1"}, 0, false, true},
+		{[]string{"BIG"}, 0, false, true},
+		{[]string{"OFF"}, 0, false, true},
+		{[]string{"MISSING"}, 0, false, true},
+	}
+	for _, tt := range tests {
+		totals, err := cart.Calculate(testCart("", tt.coupons...), e)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%v: err = %v, want error %v", tt.coupons, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if totals.Discount != tt.discount {
+			t.Errorf("%v: discount = %v, want %v", tt.coupons, totals.Discount, tt.discount)
+		}
+		if totals.FreeShipping != tt.free {
+			t.Errorf("%v: free shipping = %v, want %v", tt.coupons, totals.FreeShipping, tt.free)
+		}
+	}
+}
+
+func TestPerBuyerLimit(t *testing.T) {
+	e := newEngine(t, Coupon{Code: "ONCE", Type: TypePercentage, Value: 10, PerBuyerLimit: 1, Active: true})
+
+	totals, err := cart.Calculate(testCart("BUYER_1", "ONCE"), e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Reserve("conv-1", "BUYER_1", []string{"ONCE"}, totals); err != nil {
+		t.Fatal(err)
+	}
+	// Retrying the same order replaces its reservation
+	if err := e.Reserve("conv-1", "BUYER_1", []string{"ONCE"}, totals); err != nil {
+		t.Errorf("retry: %v", err)
+	}
+
+	// The buyer priced a cart under the same id the coupon was reserved for
+	if _, err := cart.Calculate(testCart("BUYER_1", "ONCE"), e); err == nil {
+		t.Error("Price accepted a coupon the buyer has already used")
+	}
+	if err := e.Reserve("conv-2", "BUYER_1", []string{"ONCE"}, totals); err == nil {
+		t.Error("Reserve accepted a coupon the buyer has already used")
+	}
+	if _, err := cart.Calculate(testCart("BUYER_2", "ONCE"), e); err != nil {
+		t.Errorf("other buyer: %v", err)
+	}
+
+	// A failed order gives the coupon back
+	if err := e.Release("conv-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cart.Calculate(testCart("BUYER_1", "ONCE"), e); err != nil {
+		t.Errorf("after release: %v", err)
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	e := newEngine(t, Coupon{Code: "LIMITED", Type: TypeFixed, Value: 10, UsageLimit: 1, Active: true})
+	totals, err := cart.Calculate(testCart("", "LIMITED"), e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.Reserve("conv-1", "BUYER_1", []string{"LIMITED"}, totals); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Release("conv-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Reserve("conv-2", "BUYER_2", []string{"LIMITED"}, totals); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Confirm("conv-2"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The released coupon of conv-1 was used up meanwhile, so its late payment cannot redeem it
+	if err := e.Confirm("conv-1"); err == nil {
+		t.Error("Confirm redeemed a coupon beyond its usage limit")
+	}
+	redeemed := 0
+	for _, r := range e.Redemptions("limited") {
+		if r.Status == RedemptionRedeemed {
+			redeemed++
+			if r.Discount != 10 {
+				t.Errorf("redeemed discount = %v, want 10", r.Discount)
+			}
+		}
+	}
+	if redeemed != 1 {
+		t.Errorf("redeemed = %d, want 1", redeemed)
+	}
+}
+
+func TestSave(t *testing.T) {
+	e := newEngine(t)
+	tests := []Coupon{
+		{Code: " ", Type: TypePercentage, Value: 10},
+		{Code: "A", Type: TypePercentage, Value: 150},
+		{Code: "B", Type: TypeFixed, Value: 0},
+		{Code: "C", Type: TypeBuyXGetY, BuyQuantity: 2},
+		{Code: "D", Type: "mystery"},
+	}
+	for _, c := range tests {
+		if _, err := e.Save(c); err == nil {
+			t.Errorf("Save(%+v) accepted an invalid coupon", c)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+
+	"tapsilat-go-example/promo"
+
+	"github.com/gin-gonic/gin"
+)
+
+// addCartCouponHandler applies a coupon code to the current cart
+func addCartCouponHandler(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	current, ok := currentCart(c, false)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cart not found"})
+		return
+	}
+
+	code := promo.NormalizeCode(req.Code)
+	updated, err := cartStore.AddCoupon(current.Token, code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Reject codes that do not apply so the cart never holds an invalid coupon
+	if _, _, err := priceCart(updated); err != nil {
+		cartStore.RemoveCoupon(current.Token, code)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	respondCart(c, updated)
+}
+
+// removeCartCouponHandler removes a coupon code from the current cart
+func removeCartCouponHandler(c *gin.Context) {
+	current, ok := currentCart(c, false)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cart not found"})
+		return
+	}
+
+	updated, err := cartStore.RemoveCoupon(current.Token, promo.NormalizeCode(c.Param("code")))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	respondCart(c, updated)
+}
+
+// listCouponsHandler lists all coupons
+func listCouponsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, promoEngine.List())
+}
+
+// saveCouponHandler creates or replaces a coupon
+func saveCouponHandler(c *gin.Context) {
+	var req promo.Coupon
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	coupon, err := promoEngine.Save(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, coupon)
+}
+
+// deleteCouponHandler removes a coupon
+func deleteCouponHandler(c *gin.Context) {
+	if err := promoEngine.Delete(c.Param("code")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// listRedemptionsHandler lists coupon redemptions, optionally filtered by ?code=
+func listRedemptionsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, promoEngine.Redemptions(c.Query("code")))
+}
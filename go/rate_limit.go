@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"tapsilat-go-example/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Rate limit groups. Each client has one bucket per group.
+const (
+	limitCheckout = "checkout" // creates orders or subscriptions at the gateway
+	limitAdmin    = "admin"
+	limitWebhooks = "webhooks"
+	limitReads    = "reads"
+	limitWrites   = "writes"
+)
+
+// checkoutRoutes are the writes that create orders or subscriptions at Tapsilat, and coupon
+// entry, which is limited as tightly to slow down code guessing
+var checkoutRoutes = map[string]bool{
+	"/api":                       true,
+	"/api/cart/checkout":         true,
+	"/api/cart/coupons":          true,
+	"/api/subscription":          true,
+	"/api/subscription/change":   true,
+	"/api/customers/:id/reorder": true,
+	"/api/term/create":           true,
+	"/api/term/plan":             true,
+}
+
+var webhookRoutes = map[string]bool{
+	"/api/callback":        true,
+	"/api/fail_callback":   true,
+	"/api/refund_callback": true,
+	"/api/cancel_callback": true,
+}
+
+// setupRateLimiter builds the rate limiting middleware from the RATE_LIMIT_* variables.
+// Buckets are kept in memory unless RATE_LIMIT_REDIS_URL points to a Redis shared by
+// every instance.
+func setupRateLimiter() (gin.HandlerFunc, error) {
+	if os.Getenv("RATE_LIMIT_ENABLED") == "false" {
+		return func(c *gin.Context) { c.Next() }, nil
+	}
+
+	limits := map[string]ratelimit.Limit{
+		limitCheckout: getEnvLimit("RATE_LIMIT_CHECKOUT", ratelimit.Limit{Requests: 10, Period: time.Minute}),
+		limitAdmin:    getEnvLimit("RATE_LIMIT_ADMIN", ratelimit.Limit{Requests: 120, Period: time.Minute}),
+		limitWebhooks: getEnvLimit("RATE_LIMIT_WEBHOOKS", ratelimit.Limit{Requests: 600, Period: time.Minute}),
+		limitReads:    getEnvLimit("RATE_LIMIT_READS", ratelimit.Limit{Requests: 300, Period: time.Minute}),
+		limitWrites:   getEnvLimit("RATE_LIMIT_WRITES", ratelimit.Limit{Requests: 60, Period: time.Minute}),
+	}
+
+	var backend ratelimit.Backend = ratelimit.NewMemory()
+	if redisURL := os.Getenv("RATE_LIMIT_REDIS_URL"); redisURL != "" {
+		redis, err := ratelimit.NewRedis(redisURL, "tapsilat:ratelimit:")
+		if err != nil {
+			return nil, err
+		}
+		backend = redis
+	}
+
+	return rateLimitMiddleware(backend, limits, rateLimitAPIKeys()), nil
+}
+
+// rateLimitAPIKeys reads RATE_LIMIT_API_KEYS, the comma-separated API keys that get a bucket
+// of their own. Entries are plain keys or "sha256:<hex>" of a key; only the hashes are kept.
+func rateLimitAPIKeys() map[string]bool {
+	keys := make(map[string]bool)
+	for _, entry := range strings.Split(os.Getenv("RATE_LIMIT_API_KEYS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if hash, ok := strings.CutPrefix(entry, "sha256:"); ok {
+			keys[strings.ToLower(hash)] = true
+			continue
+		}
+		keys[hashAPIKey(entry)] = true
+	}
+	return keys
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// rateLimitMiddleware takes a token from the client's bucket for the route group and
+// answers 429 when the bucket is empty. Every limited response carries the RateLimit-*
+// headers. When the backend fails, requests are let through.
+func rateLimitMiddleware(backend ratelimit.Backend, limits map[string]ratelimit.Limit, apiKeys map[string]bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		group := rateLimitGroup(c)
+		limit, ok := limits[group]
+		if group == "" || !ok || !limit.Enabled() {
+			c.Next()
+			return
+		}
+
+		result, err := backend.Take(c.Request.Context(), group+":"+rateLimitClient(c, apiKeys), limit)
+		if err != nil {
+			utilsInstance.LogError("Rate limiter unavailable", err.Error())
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Requests, ceilSeconds(limit.Period)))
+		c.Header("RateLimit-Limit", fmt.Sprint(result.Limit))
+		c.Header("RateLimit-Remaining", fmt.Sprint(result.Remaining))
+		c.Header("RateLimit-Reset", fmt.Sprint(ceilSeconds(result.Reset)))
+		if !result.Allowed {
+			retryAfter := ceilSeconds(result.RetryAfter)
+			c.Header("Retry-After", fmt.Sprint(retryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error":       "Too many requests, try again later",
+				"retry_after": retryAfter,
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// rateLimitGroup returns the limit group of a request, or "" for requests that are not
+// limited
+func rateLimitGroup(c *gin.Context) string {
+	route := c.FullPath()
+	switch {
+	case strings.HasPrefix(route, "/static/"):
+		return ""
+	case webhookRoutes[route]:
+		return limitWebhooks
+	case strings.HasPrefix(route, "/api/admin/") || strings.HasPrefix(route, "/api/export/"):
+		return limitAdmin
+	case c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead:
+		return limitReads
+	case checkoutRoutes[route]:
+		return limitCheckout
+	}
+	return limitWrites
+}
+
+// rateLimitClient identifies the client by its API key (X-API-Key or a bearer token) when
+// the key is one of apiKeys, and otherwise by its IP. Any other key is ignored, so sending a
+// new random key does not get a fresh bucket.
+func rateLimitClient(c *gin.Context, apiKeys map[string]bool) string {
+	key := c.GetHeader("X-API-Key")
+	if auth := c.GetHeader("Authorization"); key == "" && strings.HasPrefix(auth, "Bearer ") {
+		key = strings.TrimPrefix(auth, "Bearer ")
+	}
+	if key = strings.TrimSpace(key); key != "" {
+		if hash := hashAPIKey(key); apiKeys[hash] {
+			return "key:" + hash[:16]
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// trustedProxies reads TRUSTED_PROXIES, the comma-separated proxy IPs or ranges whose
+// X-Forwarded-For is believed when identifying clients. Unset or "none" trusts no proxy,
+// so the client IP is the address of the connection.
+func trustedProxies() []string {
+	var proxies []string
+	for _, p := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if p = strings.TrimSpace(p); p != "" && p != "none" {
+			proxies = append(proxies, p)
+		}
+	}
+	return proxies
+}
+
+func getEnvLimit(key string, fallback ratelimit.Limit) ratelimit.Limit {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	limit, err := ratelimit.ParseLimit(value)
+	if err != nil {
+		log.Printf("Warning: %v in %s, using %s", err, key, fallback)
+		return fallback
+	}
+	return limit
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,131 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Limit
+		wantErr bool
+	}{
+		{in: "10/1m", want: Limit{Requests: 10, Period: time.Minute}},
+		{in: "300/m", want: Limit{Requests: 300, Period: time.Minute}},
+		{in: " 5 / 30s ", want: Limit{Requests: 5, Period: 30 * time.Second}},
+		{in: "1000/h", want: Limit{Requests: 1000, Period: time.Hour}},
+		{in: "off", want: Limit{}},
+		{in: "0", want: Limit{}},
+		{in: "10", wantErr: true},
+		{in: "-1/m", wantErr: true},
+		{in: "ten/m", wantErr: true},
+		{in: "10/day", wantErr: true},
+		{in: "10/0s", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseLimit(%q) = %v, %v; want %v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestMemoryTake(t *testing.T) {
+	limit := Limit{Requests: 3, Period: 3 * time.Second} // one token per second
+	type step struct {
+		after      time.Duration // since the previous step
+		key        string
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+		reset      time.Duration
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "burst up to the capacity",
+			steps: []step{
+				{key: "a", allowed: true, remaining: 2, reset: time.Second},
+				{key: "a", allowed: true, remaining: 1, reset: 2 * time.Second},
+				{key: "a", allowed: true, remaining: 0, reset: 3 * time.Second},
+				{key: "a", allowed: false, remaining: 0, retryAfter: time.Second, reset: 3 * time.Second},
+			},
+		},
+		{
+			name: "refill at the rate",
+			steps: []step{
+				{key: "a", allowed: true, remaining: 2, reset: time.Second},
+				{key: "a", allowed: true, remaining: 1, reset: 2 * time.Second},
+				{key: "a", allowed: true, remaining: 0, reset: 3 * time.Second},
+				{after: 500 * time.Millisecond, key: "a", allowed: false, remaining: 0,
+					retryAfter: 500 * time.Millisecond, reset: 2500 * time.Millisecond},
+				{after: 500 * time.Millisecond, key: "a", allowed: true, remaining: 0, reset: 3 * time.Second},
+				{after: 2 * time.Second, key: "a", allowed: true, remaining: 1, reset: 2 * time.Second},
+			},
+		},
+		{
+			name: "never above the capacity",
+			steps: []step{
+				{key: "a", allowed: true, remaining: 2, reset: time.Second},
+				{after: time.Hour, key: "a", allowed: true, remaining: 2, reset: time.Second},
+			},
+		},
+		{
+			name: "one bucket per key",
+			steps: []step{
+				{key: "a", allowed: true, remaining: 2, reset: time.Second},
+				{key: "a", allowed: true, remaining: 1, reset: 2 * time.Second},
+				{key: "a", allowed: true, remaining: 0, reset: 3 * time.Second},
+				{key: "b", allowed: true, remaining: 2, reset: time.Second},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+			m := NewMemory()
+			m.now = func() time.Time { return now }
+			for i, s := range tt.steps {
+				now = now.Add(s.after)
+				r, err := m.Take(context.Background(), s.key, limit)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := Result{
+					Allowed:    s.allowed,
+					Limit:      limit.Requests,
+					Remaining:  s.remaining,
+					RetryAfter: s.retryAfter,
+					Reset:      s.reset,
+				}
+				if r != want {
+					t.Errorf("step %d: Take = %+v, want %+v", i+1, r, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMemorySweepsFullBuckets(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+	limit := Limit{Requests: 10, Period: time.Minute}
+
+	for _, key := range []string{"a", "b"} {
+		if _, err := m.Take(context.Background(), key, limit); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now = now.Add(2 * time.Minute)
+	if _, err := m.Take(context.Background(), "c", limit); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.buckets) != 1 {
+		t.Errorf("%d buckets after the sweep, want only the new one", len(m.buckets))
+	}
+}
@@ -0,0 +1,78 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript refills and takes from a bucket stored as a hash of tokens and the last
+// update in milliseconds. It uses the Redis clock so instances with skewed clocks agree.
+var takeScript = redis.NewScript(`
+if redis.replicate_commands then redis.replicate_commands() end
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'at')
+local tokens = tonumber(state[1])
+local at = tonumber(state[2])
+if tokens == nil or at == nil then
+  tokens = capacity
+  at = now
+end
+tokens = math.min(capacity, tokens + math.max(0, now - at) * rate)
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'at', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil((capacity - tokens) / rate) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+// Redis keeps buckets in Redis so every instance of the app shares them
+type Redis struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedis creates a backend for a URL like redis://:password@host:6379/0, or rediss://
+// for TLS. Keys are stored under prefix.
+func NewRedis(rawURL, prefix string) (*Redis, error) {
+	opts, err := redis.ParseURL(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url: %w", err)
+	}
+	// Requests wait on the limiter, so a slow Redis must fail fast
+	opts.DialTimeout = time.Second
+	opts.ReadTimeout = time.Second
+	opts.WriteTimeout = time.Second
+	return &Redis{client: redis.NewClient(opts), prefix: prefix}, nil
+}
+
+// Take implements Backend
+func (r *Redis) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	// Run tries EVALSHA and loads the script with EVAL when the server does not have it
+	values, err := takeScript.Run(ctx, r.client, []string{r.prefix + key},
+		limit.Requests,
+		strconv.FormatFloat(limit.perSecond()/1000, 'g', -1, 64),
+	).Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	if len(values) != 2 {
+		return Result{}, fmt.Errorf("unexpected redis reply %v", values)
+	}
+	allowed, _ := values[0].(int64)
+	tokensText, _ := values[1].(string)
+	tokens, err := strconv.ParseFloat(tokensText, 64)
+	if err != nil {
+		return Result{}, fmt.Errorf("unexpected redis reply %v", values)
+	}
+	return limit.result(allowed == 1, tokens), nil
+}
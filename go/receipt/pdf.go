@@ -0,0 +1,202 @@
+package receipt
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A4 page size in points
+const (
+	pageWidth  = 595.0
+	pageHeight = 842.0
+)
+
+// Color is an RGB color with components between 0 and 1
+type Color struct {
+	R, G, B float64
+}
+
+var (
+	black = Color{0, 0, 0}
+	grey  = Color{0.4, 0.4, 0.4}
+	white = Color{1, 1, 1}
+)
+
+// document is a minimal PDF writer: A4 pages with Helvetica text, lines and filled
+// rectangles. Text is encoded as WinAnsi, which covers Latin-1.
+type document struct {
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+}
+
+func (d *document) addPage() {
+	d.page = &bytes.Buffer{}
+	d.pages = append(d.pages, d.page)
+}
+
+// text draws s with its baseline starting at x, y (from the bottom left corner)
+func (d *document) text(x, y, size float64, bold bool, c Color, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(d.page, "BT %s rg /%s %s Tf %s %s Td (%s) Tj ET\n",
+		c.op(), font, num(size), num(x), num(y), escape(encodeWinAnsi(s)))
+}
+
+// textRight draws s so that it ends at x
+func (d *document) textRight(x, y, size float64, bold bool, c Color, s string) {
+	d.text(x-textWidth(s, size, bold), y, size, bold, c, s)
+}
+
+func (d *document) rect(x, y, w, h float64, c Color) {
+	fmt.Fprintf(d.page, "%s rg %s %s %s %s re f\n", c.op(), num(x), num(y), num(w), num(h))
+}
+
+func (d *document) line(x1, y1, x2, y2 float64, c Color) {
+	fmt.Fprintf(d.page, "%s RG 0.5 w %s %s m %s %s l S\n",
+		c.op(), num(x1), num(y1), num(x2), num(y2))
+}
+
+// bytes assembles the PDF file
+func (d *document) bytes(title string) []byte {
+	var out bytes.Buffer
+	var offsets []int
+	obj := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	// 1 catalog, 2 page tree, 3-4 fonts, 5 info, then a page and its content per page
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+2*i)
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	obj(fmt.Sprintf("<< /Title (%s) /Producer (tapsilat-go-example) >>", escape(encodeWinAnsi(title))))
+	for i, page := range d.pages {
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			num(pageWidth), num(pageHeight), 7+2*i))
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", page.Len(), page.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+func (c Color) op() string {
+	return num(c.R) + " " + num(c.G) + " " + num(c.B)
+}
+
+func num(f float64) string {
+	s := strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.3f", f), "0"), ".")
+	if s == "" || s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+func escape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`, "\r", "", "\n", " ")
+	return r.Replace(s)
+}
+
+// encodeWinAnsi converts s to WinAnsi bytes. Letters the encoding lacks, such as the Turkish
+// ş, ğ and ı, are written without their accent.
+func encodeWinAnsi(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r < 0x80 || (r >= 0xa0 && r <= 0xff):
+			b.WriteByte(byte(r))
+		case r == '€':
+			b.WriteByte(0x80)
+		case r == '–':
+			b.WriteByte(0x96)
+		default:
+			if base, ok := plainLetters[r]; ok {
+				b.WriteByte(base)
+			} else {
+				b.WriteByte('?')
+			}
+		}
+	}
+	return b.String()
+}
+
+var plainLetters = map[rune]byte{
+	'ş': 's', 'Ş': 'S', 'ğ': 'g', 'Ğ': 'G', 'ı': 'i', 'İ': 'I',
+	'ć': 'c', 'č': 'c', 'ł': 'l', 'ń': 'n', 'ś': 's', 'ż': 'z', 'ź': 'z', 'ő': 'o', 'ű': 'u',
+}
+
+// textWidth measures s in points using the Helvetica metrics
+func textWidth(s string, size float64, bold bool) float64 {
+	widths := helvetica
+	if bold {
+		widths = helveticaBold
+	}
+	units := 0
+	for _, c := range []byte(encodeWinAnsi(s)) {
+		units += glyphWidth(widths, c)
+	}
+	return float64(units) * size / 1000
+}
+
+func glyphWidth(widths []int, c byte) int {
+	if c >= 32 && c <= 126 {
+		return widths[c-32]
+	}
+	// Accented Latin-1 letters are as wide as their base letter
+	if c >= 0xc0 {
+		if base, ok := latin1Base[c]; ok {
+			return widths[base-32]
+		}
+	}
+	return 556
+}
+
+var latin1Base = func() map[byte]byte {
+	m := make(map[byte]byte)
+	groups := map[byte]string{
+		'A': "\xc0\xc1\xc2\xc3\xc4\xc5", 'C': "\xc7", 'E': "\xc8\xc9\xca\xcb", 'I': "\xcc\xcd\xce\xcf",
+		'N': "\xd1", 'O': "\xd2\xd3\xd4\xd5\xd6\xd8", 'U': "\xd9\xda\xdb\xdc", 'Y': "\xdd",
+		'a': "\xe0\xe1\xe2\xe3\xe4\xe5", 'c': "\xe7", 'e': "\xe8\xe9\xea\xeb", 'i': "\xec\xed\xee\xef",
+		'n': "\xf1", 'o': "\xf2\xf3\xf4\xf5\xf6\xf8", 'u': "\xf9\xfa\xfb\xfc", 'y': "\xfd\xff",
+	}
+	for base, chars := range groups {
+		for i := 0; i < len(chars); i++ {
+			m[chars[i]] = base
+		}
+	}
+	return m
+}()
+
+// Glyph widths of characters 32-126 in 1/1000 em, from the standard Helvetica AFM files
+var helvetica = []int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+var helveticaBold = []int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
@@ -0,0 +1,306 @@
+package receipt
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"tapsilat-go-example/orders"
+)
+
+// Brand is the seller shown on the receipt
+type Brand struct {
+	Name    string
+	Address string
+	TaxID   string
+	Email   string
+	Color   Color // header bar
+}
+
+// ParseColor parses a hex color such as "#667eea"
+func ParseColor(hex string) (Color, error) {
+	hex = strings.TrimPrefix(strings.TrimSpace(hex), "#")
+	if len(hex) != 6 {
+		return Color{}, fmt.Errorf("invalid color %q", hex)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return Color{}, fmt.Errorf("invalid color %q", hex)
+	}
+	return Color{
+		R: float64(v>>16&0xff) / 255,
+		G: float64(v>>8&0xff) / 255,
+		B: float64(v&0xff) / 255,
+	}, nil
+}
+
+// Layout, in points
+const (
+	left      = 40.0
+	right     = pageWidth - 40
+	bottom    = 90.0 // rows below this go to the next page
+	rowHeight = 16.0
+)
+
+// Table columns: the item name starts at colItem, the others are right aligned at their x
+const (
+	colItem   = left + 6
+	colQty    = 330.0
+	colUnit   = 410.0
+	colVAT    = 465.0
+	colAmount = right - 6
+)
+
+var lightGrey = Color{0.93, 0.93, 0.95}
+
+// Render draws the receipt of a paid or refunded order. Refunds recorded on the order are
+// listed below the total.
+func Render(rec orders.Record, brand Brand, now time.Time) ([]byte, error) {
+	if rec.Status != orders.StatusPaid && rec.Status != orders.StatusRefunded {
+		return nil, fmt.Errorf("order %s is %s, receipts are only issued for paid orders", rec.ReferenceID, rec.Status)
+	}
+	r := &renderer{doc: &document{}, rec: rec, brand: brand}
+	r.doc.addPage()
+	r.header()
+	r.parties()
+	r.lines()
+	r.totals()
+	r.footers(now)
+	return r.doc.bytes("Receipt " + rec.ReferenceID), nil
+}
+
+type renderer struct {
+	doc   *document
+	rec   orders.Record
+	brand Brand
+	y     float64
+}
+
+func (r *renderer) money(v float64) string {
+	return fmt.Sprintf("%.2f %s", v, r.rec.Currency)
+}
+
+// header draws the brand bar, the seller and the receipt details
+func (r *renderer) header() {
+	d := r.doc
+	d.rect(0, pageHeight-80, pageWidth, 80, r.brand.Color)
+	d.text(left, pageHeight-48, 20, true, white, r.brand.Name)
+	d.textRight(right, pageHeight-45, 14, true, white, "RECEIPT")
+	d.textRight(right, pageHeight-62, 9, false, white, r.rec.ReferenceID)
+
+	y := pageHeight - 105
+	for _, s := range []string{r.brand.Address, taxID(r.brand.TaxID), r.brand.Email} {
+		if s != "" {
+			d.text(left, y, 9, false, grey, s)
+			y -= 12
+		}
+	}
+
+	date := r.rec.PaidAt()
+	if date.IsZero() {
+		date = r.rec.CreatedAt
+	}
+	payment := "Single payment"
+	if r.rec.Installment > 1 {
+		payment = fmt.Sprintf("%d installments", r.rec.Installment)
+	}
+	details := [][2]string{
+		{"Date", date.Format("02.01.2006 15:04")},
+		{"Status", strings.ToUpper(string(r.rec.Status))},
+		{"Payment", payment},
+		{"Currency", r.rec.Currency},
+	}
+	y = pageHeight - 105
+	for _, row := range details {
+		d.text(380, y, 9, true, black, row[0])
+		d.textRight(right, y, 9, false, black, row[1])
+		y -= 12
+	}
+	r.y = pageHeight - 170
+}
+
+// parties draws the billing and shipping addresses
+func (r *renderer) parties() {
+	d := r.doc
+	columns := []struct {
+		title string
+		x     float64
+		addr  *orders.Address
+	}{
+		{"BILLED TO", left, r.rec.BillingAddress},
+		{"SHIP TO", 300, r.rec.ShippingAddress},
+	}
+	lowest := r.y
+	for _, col := range columns {
+		y := r.y
+		d.text(col.x, y, 9, true, grey, col.title)
+		y -= 14
+		lines := addressLines(col.addr)
+		if col.addr == nil && col.x == left && r.rec.BuyerEmail != "" {
+			lines = []string{r.rec.BuyerEmail}
+		}
+		for i, s := range lines {
+			d.text(col.x, y, 10, i == 0, black, s)
+			y -= 13
+		}
+		if y < lowest {
+			lowest = y
+		}
+	}
+	r.y = lowest - 20
+}
+
+// lines draws the basket table, continuing on new pages as needed
+func (r *renderer) lines() {
+	r.tableHeader()
+	for _, line := range r.rec.Lines {
+		if r.y < bottom {
+			r.nextPage()
+			r.tableHeader()
+		}
+		d := r.doc
+		d.text(colItem, r.y, 9, false, black, fit(line.Name, colQty-60-colItem, 9))
+		d.textRight(colQty, r.y, 9, false, black, strconv.Itoa(line.Quantity))
+		d.textRight(colUnit, r.y, 9, false, black, fmt.Sprintf("%.2f", line.UnitPrice))
+		d.textRight(colVAT, r.y, 9, false, black, fmt.Sprintf("%g%%", line.TaxRate))
+		d.textRight(colAmount, r.y, 9, false, black, fmt.Sprintf("%.2f", line.Amount))
+		if line.Discount > 0 {
+			r.y -= 11
+			d.text(colItem+8, r.y, 8, false, grey, fmt.Sprintf("Discount -%.2f", line.Discount))
+		}
+		d.line(left, r.y-5, right, r.y-5, lightGrey)
+		r.y -= rowHeight
+	}
+	r.y -= 8
+}
+
+func (r *renderer) tableHeader() {
+	d := r.doc
+	d.rect(left, r.y-5, right-left, 18, lightGrey)
+	prices := "excl. VAT"
+	if r.rec.TaxIncluded {
+		prices = "incl. VAT"
+	}
+	d.text(colItem, r.y, 9, true, black, "Item")
+	d.textRight(colQty, r.y, 9, true, black, "Qty")
+	d.textRight(colUnit, r.y, 9, true, black, "Unit price")
+	d.textRight(colVAT, r.y, 9, true, black, "VAT")
+	d.textRight(colAmount, r.y, 9, true, black, "Amount ("+prices+")")
+	r.y -= rowHeight + 4
+}
+
+// totals draws the totals, the tax breakdown and the refunds
+func (r *renderer) totals() {
+	rec := r.rec
+	subtotal := 0.0
+	for _, line := range rec.Lines {
+		subtotal += line.Amount
+	}
+
+	r.total("Subtotal", r.money(subtotal), false)
+	if rec.Discount > 0 {
+		r.total("Discount", "-"+r.money(rec.Discount), false)
+	}
+	r.total("Net (excl. VAT)", r.money(rec.Net), false)
+	for _, tl := range rec.TaxLines {
+		r.total(fmt.Sprintf("VAT %g%% on %.2f", tl.Rate, tl.Net), r.money(tl.Tax), false)
+	}
+	if rec.ShippingMethod != "" || rec.Shipping > 0 {
+		label := "Shipping"
+		if rec.ShippingMethod != "" {
+			label += " (" + rec.ShippingMethod + ")"
+		}
+		r.total(label, r.money(rec.Shipping), false)
+	}
+	r.total("Total", r.money(rec.Amount), true)
+
+	refunds := rec.Refunds
+	if len(refunds) == 0 && rec.Status == orders.StatusRefunded {
+		// Refunded outside the app: only the status is known
+		refunds = []orders.Refund{{Amount: rec.Amount, At: rec.UpdatedAt}}
+	}
+	if len(refunds) == 0 {
+		return
+	}
+	r.y -= 6
+	refunded := 0.0
+	for _, refund := range refunds {
+		refunded += refund.Amount
+		r.total("Refund "+refund.At.Format("02.01.2006"), "-"+r.money(refund.Amount), false)
+	}
+	r.total("Net paid", r.money(rec.Amount-refunded), true)
+}
+
+func (r *renderer) total(label, value string, bold bool) {
+	if r.y < bottom {
+		r.nextPage()
+	}
+	size := 9.0
+	if bold {
+		size = 11
+		r.doc.line(colQty-40, r.y+13, right, r.y+13, grey)
+	}
+	r.doc.text(colQty-40, r.y, size, bold, black, label)
+	r.doc.textRight(colAmount, r.y, size, bold, black, value)
+	r.y -= 14
+	if bold {
+		r.y -= 4
+	}
+}
+
+// nextPage starts a new page with a small header
+func (r *renderer) nextPage() {
+	d := r.doc
+	d.addPage()
+	d.rect(0, pageHeight-30, pageWidth, 30, r.brand.Color)
+	d.text(left, pageHeight-20, 11, true, white, r.brand.Name)
+	d.textRight(right, pageHeight-20, 9, false, white, "Receipt "+r.rec.ReferenceID)
+	r.y = pageHeight - 60
+}
+
+// footers numbers the pages once their count is known
+func (r *renderer) footers(now time.Time) {
+	d := r.doc
+	current := d.page
+	for i, page := range d.pages {
+		d.page = page
+		d.line(left, 60, right, 60, lightGrey)
+		d.text(left, 46, 8, false, grey, "Thank you for your purchase. Generated "+now.Format("02.01.2006 15:04")+".")
+		d.textRight(right, 46, 8, false, grey, fmt.Sprintf("Page %d of %d", i+1, len(d.pages)))
+	}
+	d.page = current
+}
+
+func addressLines(a *orders.Address) []string {
+	if a == nil {
+		return nil
+	}
+	city := strings.TrimSpace(a.City + " " + a.ZipCode)
+	var lines []string
+	for _, s := range []string{a.ContactName, a.Address, city, a.Phone, a.Email, taxID(a.VatNumber)} {
+		if s = strings.TrimSpace(s); s != "" {
+			lines = append(lines, s)
+		}
+	}
+	return lines
+}
+
+func taxID(id string) string {
+	if id == "" {
+		return ""
+	}
+	return "Tax ID: " + id
+}
+
+// fit shortens s with an ellipsis so that it is at most width wide
+func fit(s string, width, size float64) string {
+	if textWidth(s, size, false) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && textWidth(string(runes)+"...", size, false) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
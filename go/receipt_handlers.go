@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"tapsilat-go-example/orders"
+	"tapsilat-go-example/receipt"
+	"tapsilat-go-example/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// receiptBrand reads the seller shown on receipts from the RECEIPT_* variables
+func receiptBrand() receipt.Brand {
+	brand := receipt.Brand{
+		Name:    os.Getenv("RECEIPT_COMPANY_NAME"),
+		Address: os.Getenv("RECEIPT_COMPANY_ADDRESS"),
+		TaxID:   os.Getenv("RECEIPT_COMPANY_TAX_ID"),
+		Email:   os.Getenv("RECEIPT_COMPANY_EMAIL"),
+	}
+	if brand.Name == "" {
+		brand.Name = "Tapsilat Demo Store"
+	}
+	color := os.Getenv("RECEIPT_BRAND_COLOR")
+	if color == "" {
+		color = "#667eea"
+	}
+	var err error
+	if brand.Color, err = receipt.ParseColor(color); err != nil {
+		utilsInstance.LogError("Invalid RECEIPT_BRAND_COLOR", err.Error())
+		brand.Color, _ = receipt.ParseColor("#667eea")
+	}
+	return brand
+}
+
+// orderReceiptHandler serves the PDF receipt of a paid order. The PDF is stored next to the
+// local order records and rendered again when the order has changed since, e.g. after a refund.
+func orderReceiptHandler(c *gin.Context) {
+	referenceID := c.Param("reference_id")
+	rec, ok := orderStore.Get(referenceID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	// The buyer may open the receipt before the payment callback arrived
+	rec = refreshPendingOrder(c.Request.Context(), rec, "receipt")
+
+	path := store.DataPath(filepath.Join("receipts", referenceID+".pdf"))
+	if info, err := os.Stat(path); err != nil || info.ModTime().Before(rec.UpdatedAt) {
+		data, err := receipt.Render(rec, receiptBrand(), time.Now())
+		if err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err := writeReceipt(path, data); err != nil {
+			utilsInstance.LogError("Failed to store receipt", map[string]interface{}{
+				"reference_id": referenceID,
+				"error":        err.Error(),
+			})
+			c.Data(http.StatusOK, "application/pdf", data)
+			return
+		}
+	}
+
+	c.Header("Content-Disposition", `inline; filename="receipt-`+referenceID+`.pdf"`)
+	c.File(path)
+}
+
+// refreshPendingOrder asks the gateway for the status of a pending order and applies it
+func refreshPendingOrder(ctx context.Context, rec orders.Record, source string) orders.Record {
+	if rec.Status != orders.StatusPending {
+		return rec
+	}
+	status, err := (gatewayStatusFetcher{}).FetchStatus(ctx, rec.ReferenceID)
+	if err != nil || status == orders.StatusPending {
+		return rec
+	}
+	applyOrderTransition(rec.ReferenceID, status, source)
+	if updated, ok := orderStore.Get(rec.ReferenceID); ok {
+		return updated
+	}
+	return rec
+}
+
+// writeReceipt stores a rendered receipt, replacing the previous one atomically
+func writeReceipt(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
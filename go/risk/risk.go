@@ -0,0 +1,509 @@
+package risk
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"tapsilat-go-example/store"
+)
+
+// Decision is what happens to an order after screening
+type Decision string
+
+const (
+	DecisionAllow     Decision = "allow"
+	DecisionChallenge Decision = "challenge" // allowed with 3-D Secure forced
+	DecisionBlock     Decision = "block"
+)
+
+// Key is a buyer attribute velocity limits count attempts by
+type Key string
+
+const (
+	KeyIP      Key = "ip"
+	KeyEmail   Key = "email"
+	KeyPhone   Key = "phone"
+	KeyBuyerID Key = "buyer_id"
+)
+
+// Verdict is the outcome of a manual review
+type Verdict string
+
+const (
+	VerdictLegitimate Verdict = "legitimate"
+	VerdictFraud      Verdict = "fraud"
+)
+
+// VelocityLimit scores a buyer attribute seen in more than Max attempts within the window,
+// counting the attempt being screened
+type VelocityLimit struct {
+	Key           Key `json:"key"`
+	WindowMinutes int `json:"window_minutes"`
+	Max           int `json:"max"`
+	Score         int `json:"score"`
+}
+
+// AmountLimit scores orders in Currency above an amount. Several limits of one currency
+// add up, so larger amounts can cross more than one.
+type AmountLimit struct {
+	Currency string  `json:"currency"`
+	Above    float64 `json:"above"`
+	Score    int     `json:"score"`
+}
+
+// List is a block or allow list. Emails match exactly or by "@domain"; IPs match exactly
+// or by CIDR range.
+type List struct {
+	IPs       []string `json:"ips,omitempty"`
+	Emails    []string `json:"emails,omitempty"`
+	Phones    []string `json:"phones,omitempty"`
+	BuyerIDs  []string `json:"buyer_ids,omitempty"`
+	Countries []string `json:"countries,omitempty"` // billing or shipping country
+}
+
+// Config is the risk screening configuration. Blocklisted orders are blocked and
+// allowlisted ones allowed without scoring; other orders are scored and challenged or
+// blocked at the thresholds.
+type Config struct {
+	Enabled              bool            `json:"enabled"`
+	ChallengeScore       int             `json:"challenge_score"` // scores at or above force 3-D Secure
+	BlockScore           int             `json:"block_score"`     // scores at or above block the order
+	Velocity             []VelocityLimit `json:"velocity"`
+	Amounts              []AmountLimit   `json:"amounts"`
+	CountryMismatchScore int             `json:"country_mismatch_score"` // billing and shipping countries differ
+	Blocklist            List            `json:"blocklist"`
+	Allowlist            List            `json:"allowlist"`
+	RetentionDays        int             `json:"retention_days"` // reviewed and allowed assessments are kept this long
+}
+
+// DefaultConfig challenges large or repeated orders and blocks obvious card testing
+func DefaultConfig() Config {
+	return Config{
+		Enabled:        true,
+		ChallengeScore: 40,
+		BlockScore:     100,
+		Velocity: []VelocityLimit{
+			{Key: KeyIP, WindowMinutes: 60, Max: 20, Score: 40},
+			{Key: KeyIP, WindowMinutes: 10, Max: 8, Score: 60},
+			{Key: KeyEmail, WindowMinutes: 60, Max: 5, Score: 40},
+			{Key: KeyPhone, WindowMinutes: 60, Max: 5, Score: 30},
+			{Key: KeyBuyerID, WindowMinutes: 24 * 60, Max: 10, Score: 30},
+		},
+		Amounts: []AmountLimit{
+			{Currency: "TRY", Above: 25000, Score: 40},
+			{Currency: "TRY", Above: 100000, Score: 40},
+			{Currency: "USD", Above: 1000, Score: 40},
+			{Currency: "USD", Above: 4000, Score: 40},
+			{Currency: "EUR", Above: 1000, Score: 40},
+			{Currency: "EUR", Above: 4000, Score: 40},
+		},
+		CountryMismatchScore: 30,
+		RetentionDays:        90,
+	}
+}
+
+// Request is the order being screened
+type Request struct {
+	ConversationID  string
+	IP              string
+	Email           string
+	Phone           string
+	BuyerID         string
+	Amount          float64
+	Currency        string
+	BillingCountry  string
+	ShippingCountry string
+}
+
+// Reason is a rule that contributed to a decision
+type Reason struct {
+	Rule   string `json:"rule"` // e.g. velocity:email, amount, blocklist:ip
+	Score  int    `json:"score,omitempty"`
+	Detail string `json:"detail"`
+}
+
+// Review is the manual review of a challenged or blocked order
+type Review struct {
+	Verdict Verdict   `json:"verdict"`
+	Note    string    `json:"note,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// Assessment is the screening of one order attempt
+type Assessment struct {
+	ID              string    `json:"id"`
+	ConversationID  string    `json:"conversation_id,omitempty"`
+	ReferenceID     string    `json:"reference_id,omitempty"` // set once the order is created
+	IP              string    `json:"ip,omitempty"`
+	Email           string    `json:"email,omitempty"`
+	Phone           string    `json:"phone,omitempty"`
+	BuyerID         string    `json:"buyer_id,omitempty"`
+	Amount          float64   `json:"amount"`
+	Currency        string    `json:"currency"`
+	BillingCountry  string    `json:"billing_country,omitempty"`
+	ShippingCountry string    `json:"shipping_country,omitempty"`
+	Score           int       `json:"score"`
+	Decision        Decision  `json:"decision"`
+	Reasons         []Reason  `json:"reasons,omitempty"`
+	Review          *Review   `json:"review,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// value returns the attribute of the assessment a velocity key counts by
+func (a *Assessment) value(k Key) string {
+	switch k {
+	case KeyIP:
+		return a.IP
+	case KeyEmail:
+		return a.Email
+	case KeyPhone:
+		return a.Phone
+	case KeyBuyerID:
+		return a.BuyerID
+	}
+	return ""
+}
+
+type state struct {
+	Config      Config        `json:"config"`
+	Assessments []*Assessment `json:"assessments"`
+}
+
+// Engine screens orders and keeps the assessments for velocity counting and review
+type Engine struct {
+	mu    sync.Mutex
+	file  *store.JSONFile
+	state state
+}
+
+// NewEngine loads the configuration and assessments from path, falling back to DefaultConfig
+func NewEngine(path string) (*Engine, error) {
+	e := &Engine{
+		file:  store.NewJSONFile(path),
+		state: state{Config: DefaultConfig()},
+	}
+	if err := e.file.Load(&e.state); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Config returns the current configuration
+func (e *Engine) Config() Config {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.state.Config
+}
+
+// SetConfig validates and stores a new configuration
+func (e *Engine) SetConfig(cfg Config) error {
+	if cfg.ChallengeScore < 1 || cfg.BlockScore < 1 {
+		return fmt.Errorf("challenge_score and block_score must be at least 1")
+	}
+	if cfg.ChallengeScore > cfg.BlockScore {
+		return fmt.Errorf("challenge_score cannot be above block_score")
+	}
+	if cfg.RetentionDays < 1 {
+		return fmt.Errorf("retention_days must be at least 1")
+	}
+	for _, v := range cfg.Velocity {
+		switch v.Key {
+		case KeyIP, KeyEmail, KeyPhone, KeyBuyerID:
+		default:
+			return fmt.Errorf("unknown velocity key %q", v.Key)
+		}
+		if v.WindowMinutes < 1 || v.Max < 1 || v.Score < 0 {
+			return fmt.Errorf("velocity %s: window_minutes and max must be at least 1 and score cannot be negative", v.Key)
+		}
+	}
+	for i, a := range cfg.Amounts {
+		cfg.Amounts[i].Currency = strings.ToUpper(strings.TrimSpace(a.Currency))
+		if cfg.Amounts[i].Currency == "" || a.Above < 0 || a.Score < 0 {
+			return fmt.Errorf("amount limits need a currency, and above and score cannot be negative")
+		}
+	}
+	for _, list := range []List{cfg.Blocklist, cfg.Allowlist} {
+		for _, ip := range list.IPs {
+			if strings.Contains(ip, "/") {
+				if _, _, err := net.ParseCIDR(ip); err != nil {
+					return fmt.Errorf("invalid ip range %q", ip)
+				}
+			} else if net.ParseIP(ip) == nil {
+				return fmt.Errorf("invalid ip %q", ip)
+			}
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.state.Config = cfg
+	return e.saveLocked()
+}
+
+// Assess screens an order attempt and records it. Every attempt, blocked or not, counts
+// towards the velocity limits of later attempts.
+func (e *Engine) Assess(req Request, now time.Time) (Assessment, error) {
+	id, err := store.NewID("RISK_")
+	if err != nil {
+		return Assessment{}, err
+	}
+	a := &Assessment{
+		ID:              id,
+		ConversationID:  req.ConversationID,
+		IP:              strings.TrimSpace(req.IP),
+		Email:           strings.ToLower(strings.TrimSpace(req.Email)),
+		Phone:           strings.TrimSpace(req.Phone),
+		BuyerID:         strings.TrimSpace(req.BuyerID),
+		Amount:          req.Amount,
+		Currency:        strings.ToUpper(req.Currency),
+		BillingCountry:  strings.ToUpper(req.BillingCountry),
+		ShippingCountry: strings.ToUpper(req.ShippingCountry),
+		CreatedAt:       now,
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	cfg := e.state.Config
+	switch {
+	case !cfg.Enabled:
+		a.Decision = DecisionAllow
+	case listed(a, cfg.Blocklist, "blocklist"):
+		a.Decision = DecisionBlock
+	case listed(a, cfg.Allowlist, "allowlist"):
+		a.Decision = DecisionAllow
+	default:
+		e.scoreLocked(a, cfg, now)
+		switch {
+		case a.Score >= cfg.BlockScore:
+			a.Decision = DecisionBlock
+		case a.Score >= cfg.ChallengeScore:
+			a.Decision = DecisionChallenge
+		default:
+			a.Decision = DecisionAllow
+		}
+	}
+
+	e.pruneLocked(now)
+	e.state.Assessments = append(e.state.Assessments, a)
+	return *a, e.saveLocked()
+}
+
+// listed records a reason for every entry of list the assessment matches
+func listed(a *Assessment, list List, name string) bool {
+	before := len(a.Reasons)
+	add := func(rule, detail string) {
+		a.Reasons = append(a.Reasons, Reason{Rule: name + ":" + rule, Detail: detail})
+	}
+	if a.IP != "" && matchIP(list.IPs, a.IP) {
+		add("ip", "IP "+a.IP+" is listed")
+	}
+	if a.Email != "" && matchEmail(list.Emails, a.Email) {
+		add("email", "email "+a.Email+" is listed")
+	}
+	if a.Phone != "" && contains(list.Phones, a.Phone) {
+		add("phone", "phone "+a.Phone+" is listed")
+	}
+	if a.BuyerID != "" && contains(list.BuyerIDs, a.BuyerID) {
+		add("buyer_id", "buyer "+a.BuyerID+" is listed")
+	}
+	for _, country := range []string{a.BillingCountry, a.ShippingCountry} {
+		if country != "" && contains(list.Countries, country) {
+			add("country", "country "+country+" is listed")
+			break
+		}
+	}
+	return len(a.Reasons) > before
+}
+
+// scoreLocked adds up the velocity, amount and country mismatch rules
+func (e *Engine) scoreLocked(a *Assessment, cfg Config, now time.Time) {
+	add := func(rule string, score int, detail string) {
+		if score > 0 {
+			a.Score += score
+			a.Reasons = append(a.Reasons, Reason{Rule: rule, Score: score, Detail: detail})
+		}
+	}
+
+	for _, v := range cfg.Velocity {
+		value := a.value(v.Key)
+		if value == "" {
+			continue
+		}
+		since := now.Add(-time.Duration(v.WindowMinutes) * time.Minute)
+		count := 1
+		for _, prev := range e.state.Assessments {
+			if !prev.CreatedAt.Before(since) && prev.value(v.Key) == value {
+				count++
+			}
+		}
+		if count > v.Max {
+			add("velocity:"+string(v.Key), v.Score,
+				fmt.Sprintf("%d attempts from %s %s in %d minutes, limit %d", count, v.Key, value, v.WindowMinutes, v.Max))
+		}
+	}
+
+	for _, l := range cfg.Amounts {
+		if l.Currency == a.Currency && a.Amount > l.Above {
+			add("amount", l.Score, fmt.Sprintf("%.2f %s is above %.2f", a.Amount, a.Currency, l.Above))
+		}
+	}
+
+	if a.BillingCountry != "" && a.ShippingCountry != "" && a.BillingCountry != a.ShippingCountry {
+		add("country_mismatch", cfg.CountryMismatchScore,
+			fmt.Sprintf("billed in %s, shipped to %s", a.BillingCountry, a.ShippingCountry))
+	}
+}
+
+// pruneLocked drops allowed and reviewed assessments older than the retention period, or
+// than the longest velocity window if that is longer. Unreviewed challenges and blocks stay
+// in the queue until reviewed.
+func (e *Engine) pruneLocked(now time.Time) {
+	cfg := e.state.Config
+	cutoff := now.AddDate(0, 0, -cfg.RetentionDays)
+	for _, v := range cfg.Velocity {
+		if since := now.Add(-time.Duration(v.WindowMinutes) * time.Minute); since.Before(cutoff) {
+			cutoff = since
+		}
+	}
+	kept := e.state.Assessments[:0]
+	for _, a := range e.state.Assessments {
+		if a.CreatedAt.Before(cutoff) && (a.Decision == DecisionAllow || a.Review != nil) {
+			continue
+		}
+		kept = append(kept, a)
+	}
+	e.state.Assessments = kept
+}
+
+// Attach links an assessment to the order created after it
+func (e *Engine) Attach(id, referenceID string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	a := e.findLocked(id)
+	if a == nil {
+		return fmt.Errorf("assessment %s not found", id)
+	}
+	a.ReferenceID = referenceID
+	return e.saveLocked()
+}
+
+// Get returns an assessment
+func (e *Engine) Get(id string) (Assessment, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	a := e.findLocked(id)
+	if a == nil {
+		return Assessment{}, false
+	}
+	return *a, true
+}
+
+// List returns the assessments with decision, or all of them when decision is empty,
+// newest first
+func (e *Engine) List(decision Decision) []Assessment {
+	return e.filter(func(a *Assessment) bool { return decision == "" || a.Decision == decision })
+}
+
+// Queue returns the challenged and blocked assessments awaiting review, newest first
+func (e *Engine) Queue() []Assessment {
+	return e.filter(func(a *Assessment) bool { return a.Decision != DecisionAllow && a.Review == nil })
+}
+
+func (e *Engine) filter(keep func(a *Assessment) bool) []Assessment {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var list []Assessment
+	for _, a := range e.state.Assessments {
+		if keep(a) {
+			list = append(list, *a)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
+
+// Review records the verdict of a manual review. A fraud verdict adds the email, phone
+// and buyer id of the attempt to the blocklist; the IP is left out as it may be shared.
+func (e *Engine) Review(id string, verdict Verdict, note string, now time.Time) (Assessment, error) {
+	if verdict != VerdictLegitimate && verdict != VerdictFraud {
+		return Assessment{}, fmt.Errorf("verdict must be %s or %s", VerdictLegitimate, VerdictFraud)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	a := e.findLocked(id)
+	if a == nil {
+		return Assessment{}, fmt.Errorf("assessment %s not found", id)
+	}
+	a.Review = &Review{Verdict: verdict, Note: strings.TrimSpace(note), At: now}
+	if verdict == VerdictFraud {
+		list := &e.state.Config.Blocklist
+		list.Emails = appendMissing(list.Emails, a.Email)
+		list.Phones = appendMissing(list.Phones, a.Phone)
+		list.BuyerIDs = appendMissing(list.BuyerIDs, a.BuyerID)
+	}
+	return *a, e.saveLocked()
+}
+
+func (e *Engine) findLocked(id string) *Assessment {
+	for _, a := range e.state.Assessments {
+		if a.ID == id {
+			return a
+		}
+	}
+	return nil
+}
+
+func (e *Engine) saveLocked() error {
+	return e.file.Save(e.state)
+}
+
+func matchIP(list []string, ip string) bool {
+	parsed := net.ParseIP(ip)
+	for _, entry := range list {
+		if entry == ip {
+			return true
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil && parsed != nil && network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchEmail(list []string, email string) bool {
+	domain := email[strings.LastIndexByte(email, '@')+1:]
+	for _, entry := range list {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == email || (strings.HasPrefix(entry, "@") && entry[1:] == domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, value string) bool {
+	for _, entry := range list {
+		if strings.EqualFold(strings.TrimSpace(entry), value) {
+			return true
+		}
+	}
+	return false
+}
+
+func appendMissing(list []string, value string) []string {
+	if value == "" || contains(list, value) {
+		return list
+	}
+	return append(list, value)
+}
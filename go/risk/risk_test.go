@@ -0,0 +1,142 @@
+package risk
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newEngine(t *testing.T, cfg Config) *Engine {
+	t.Helper()
+	e, err := NewEngine(filepath.Join(t.TempDir(), "risk.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.SetConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestAssess(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Blocklist = List{IPs: []string{"203.0.113.0/24"}, Emails: []string{"@fraud.test"}, Countries: []string{"KP"}}
+	cfg.Allowlist = List{BuyerIDs: []string{"BUYER_vip"}}
+	e := newEngine(t, cfg)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		req      Request
+		decision Decision
+		score    int
+	}{
+		{"small order", Request{Email: "a@example.com", Amount: 100, Currency: "TRY"}, DecisionAllow, 0},
+		{"large order", Request{Email: "b@example.com", Amount: 30000, Currency: "try"}, DecisionChallenge, 40},
+		{"very large order", Request{Email: "c@example.com", Amount: 150000, Currency: "TRY"}, DecisionChallenge, 80},
+		{"large and shipped abroad", Request{Email: "d@example.com", Amount: 150000, Currency: "TRY", BillingCountry: "TR", ShippingCountry: "de"}, DecisionBlock, 110},
+		{"blocked range", Request{IP: "203.0.113.7", Amount: 10, Currency: "TRY"}, DecisionBlock, 0},
+		{"blocked domain", Request{Email: "Someone@Fraud.test", Amount: 10, Currency: "TRY"}, DecisionBlock, 0},
+		{"blocked country", Request{ShippingCountry: "kp", Amount: 10, Currency: "TRY"}, DecisionBlock, 0},
+		{"allowlisted", Request{BuyerID: "BUYER_vip", Amount: 500000, Currency: "TRY"}, DecisionAllow, 0},
+	}
+	for _, tt := range tests {
+		a, err := e.Assess(tt.req, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Decision != tt.decision || a.Score != tt.score {
+			t.Errorf("%s: %s with score %d, want %s with %d (%+v)", tt.name, a.Decision, a.Score, tt.decision, tt.score, a.Reasons)
+		}
+	}
+
+	cfg.Enabled = false
+	if err := e.SetConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if a, _ := e.Assess(Request{IP: "203.0.113.7"}, now); a.Decision != DecisionAllow {
+		t.Errorf("disabled screening: %s", a.Decision)
+	}
+}
+
+func TestVelocity(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Velocity = []VelocityLimit{{Key: KeyEmail, WindowMinutes: 10, Max: 2, Score: 50}}
+	e := newEngine(t, cfg)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		at       time.Duration
+		decision Decision
+	}{
+		{0, DecisionAllow},
+		{time.Minute, DecisionAllow},
+		{2 * time.Minute, DecisionChallenge}, // third attempt within 10 minutes
+		{3 * time.Minute, DecisionChallenge}, // the challenged attempt counts too
+		{20 * time.Minute, DecisionAllow},
+	}
+	for _, tt := range tests {
+		a, err := e.Assess(Request{Email: "buyer@example.com", Amount: 10, Currency: "TRY"}, now.Add(tt.at))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Decision != tt.decision {
+			t.Errorf("after %s: %s, want %s", tt.at, a.Decision, tt.decision)
+		}
+	}
+}
+
+func TestReview(t *testing.T) {
+	e := newEngine(t, DefaultConfig())
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	a, err := e.Assess(Request{IP: "198.51.100.1", Email: "buyer@example.com", Phone: "5551234567", Amount: 30000, Currency: "TRY"}, now)
+	if err != nil || a.Decision != DecisionChallenge {
+		t.Fatalf("Assess = %+v, %v", a, err)
+	}
+	if queue := e.Queue(); len(queue) != 1 || queue[0].ID != a.ID {
+		t.Errorf("Queue = %+v", queue)
+	}
+	if _, err := e.Review(a.ID, "maybe", "", now); err == nil {
+		t.Error("Review accepted an unknown verdict")
+	}
+	if _, err := e.Review(a.ID, VerdictFraud, " stolen card ", now); err != nil {
+		t.Fatal(err)
+	}
+	if queue := e.Queue(); len(queue) != 0 {
+		t.Errorf("Queue after review = %+v", queue)
+	}
+
+	// The email and phone are blocked from now on, the IP is not
+	blocked := e.Config().Blocklist
+	if len(blocked.Emails) != 1 || len(blocked.Phones) != 1 || len(blocked.IPs) != 0 {
+		t.Errorf("blocklist = %+v", blocked)
+	}
+	if next, _ := e.Assess(Request{Email: "BUYER@example.com", Amount: 10, Currency: "TRY"}, now); next.Decision != DecisionBlock {
+		t.Errorf("next attempt: %s, want block", next.Decision)
+	}
+}
+
+func TestSetConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(cfg *Config)
+	}{
+		{"challenge above block", func(cfg *Config) { cfg.ChallengeScore = cfg.BlockScore + 1 }},
+		{"no retention", func(cfg *Config) { cfg.RetentionDays = 0 }},
+		{"unknown key", func(cfg *Config) { cfg.Velocity = []VelocityLimit{{Key: "card", WindowMinutes: 1, Max: 1}} }},
+		{"no currency", func(cfg *Config) { cfg.Amounts = []AmountLimit{{Above: 10, Score: 10}} }},
+		{"bad ip range", func(cfg *Config) { cfg.Blocklist.IPs = []string{"10.0.0.0/40"} }},
+	}
+	for _, tt := range tests {
+		e, err := NewEngine(filepath.Join(t.TempDir(), "risk.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg := DefaultConfig()
+		tt.change(&cfg)
+		if err := e.SetConfig(cfg); err == nil {
+			t.Errorf("%s: SetConfig accepted an invalid config", tt.name)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"tapsilat-go-example/orders"
+	"tapsilat-go-example/risk"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getRiskConfigHandler returns the fraud screening rules and lists
+func getRiskConfigHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, riskEngine.Config())
+}
+
+// riskConfigRequest is a full risk configuration. Enabled must be sent, so a body that
+// leaves it out does not switch screening off.
+type riskConfigRequest struct {
+	risk.Config
+	Enabled *bool `json:"enabled"`
+}
+
+// updateRiskConfigHandler replaces the fraud screening configuration
+func updateRiskConfigHandler(c *gin.Context) {
+	var req riskConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Enabled == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "enabled is required"})
+		return
+	}
+	req.Config.Enabled = *req.Enabled
+
+	if err := riskEngine.SetConfig(req.Config); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, riskEngine.Config())
+}
+
+// riskQueueHandler lists the challenged and blocked orders awaiting review, newest first
+// GET /api/admin/risk/queue
+func riskQueueHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, riskEngine.Queue())
+}
+
+// listRiskAssessmentsHandler lists screened order attempts, optionally filtered by
+// ?decision=allow|challenge|block
+func listRiskAssessmentsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, riskEngine.List(risk.Decision(c.Query("decision"))))
+}
+
+// getRiskAssessmentHandler returns one assessment
+func getRiskAssessmentHandler(c *gin.Context) {
+	a, ok := riskEngine.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Assessment not found"})
+		return
+	}
+	c.JSON(http.StatusOK, a)
+}
+
+// reviewRiskAssessmentHandler records a reviewer's verdict and removes the assessment from
+// the queue. A fraud verdict blocklists the buyer's email, phone and buyer id.
+// POST /api/admin/risk/assessments/:id/review {"verdict": "legitimate"|"fraud", "note": "..."}
+func reviewRiskAssessmentHandler(c *gin.Context) {
+	var req struct {
+		Verdict risk.Verdict `json:"verdict" binding:"required"`
+		Note    string       `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, ok := riskEngine.Get(c.Param("id")); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Assessment not found"})
+		return
+	}
+	a, err := riskEngine.Review(c.Param("id"), req.Verdict, req.Note, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Keep the verdict with the order as well
+	if a.ReferenceID != "" {
+		if _, err := orderStore.Update(a.ReferenceID, func(rec *orders.Record) {
+			if rec.Risk != nil {
+				rec.Risk.Review = string(a.Review.Verdict)
+			}
+		}); err != nil {
+			utilsInstance.LogError("Failed to store risk review on order", map[string]interface{}{
+				"reference_id": a.ReferenceID,
+				"error":        err.Error(),
+			})
+		}
+	}
+	c.JSON(http.StatusOK, a)
+}
+
+// orderRisk converts a screening outcome for the order record
+func orderRisk(a risk.Assessment) *orders.Risk {
+	r := &orders.Risk{
+		AssessmentID: a.ID,
+		Score:        a.Score,
+		Decision:     string(a.Decision),
+	}
+	for _, reason := range a.Reasons {
+		r.Reasons = append(r.Reasons, reason.Detail)
+	}
+	return r
+}
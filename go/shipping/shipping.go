@@ -0,0 +1,244 @@
+package shipping
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"tapsilat-go-example/cart"
+	"tapsilat-go-example/store"
+)
+
+// Type is how a shipping method is priced
+type Type string
+
+const (
+	TypeFlat   Type = "flat"
+	TypeWeight Type = "weight"
+	TypeZone   Type = "zone"
+)
+
+// WeightBand prices parcels up to MaxWeight kilograms
+type WeightBand struct {
+	MaxWeight float64 `json:"max_weight"`
+	Price     float64 `json:"price"`
+}
+
+// Zone prices deliveries to a set of cities
+type Zone struct {
+	Name   string   `json:"name"`
+	Cities []string `json:"cities"`
+	Price  float64  `json:"price"`
+}
+
+// Method is a configurable shipping method
+type Method struct {
+	ID          string       `json:"id"`
+	Name        string       `json:"name"`
+	Type        Type         `json:"type"`
+	Price       float64      `json:"price"`                  // flat price, or the zone default
+	Bands       []WeightBand `json:"bands,omitempty"`        // weight-based
+	ExtraPerKg  float64      `json:"extra_per_kg,omitempty"` // weight above the last band
+	Zones       []Zone       `json:"zones,omitempty"`        // city/zone table
+	FreeOver    float64      `json:"free_over,omitempty"`    // free when goods total reaches this, 0 disables
+	ItemWeight  float64      `json:"item_weight,omitempty"`  // default kg for lines without a weight
+	Active      bool         `json:"active"`
+	Default     bool         `json:"default,omitempty"` // used for orders that name no method
+	Description string       `json:"description,omitempty"`
+}
+
+// DefaultMethods are used until methods are configured
+func DefaultMethods() []Method {
+	return []Method{
+		{ID: "standard", Name: "Standard Delivery", Type: TypeFlat, Price: 29.90, FreeOver: 500, Active: true, Default: true},
+		{ID: "cargo", Name: "Cargo (by weight)", Type: TypeWeight, ItemWeight: 1, Bands: []WeightBand{
+			{MaxWeight: 2, Price: 39.90},
+			{MaxWeight: 10, Price: 69.90},
+			{MaxWeight: 30, Price: 129.90},
+		}, ExtraPerKg: 5, Active: true},
+		{ID: "express", Name: "Express Delivery", Type: TypeZone, Price: 99.90, Zones: []Zone{
+			{Name: "Istanbul", Cities: []string{"Istanbul"}, Price: 49.90},
+			{Name: "Metropolitan", Cities: []string{"Ankara", "Izmir", "Bursa", "Antalya"}, Price: 69.90},
+		}, Active: true},
+	}
+}
+
+// Engine holds the shipping methods and implements cart.Pricer
+type Engine struct {
+	mu      sync.RWMutex
+	file    *store.JSONFile
+	methods []Method
+}
+
+// NewEngine loads shipping methods from path, falling back to DefaultMethods
+func NewEngine(path string) (*Engine, error) {
+	e := &Engine{
+		file:    store.NewJSONFile(path),
+		methods: DefaultMethods(),
+	}
+	if err := e.file.Load(&e.methods); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Methods returns all methods
+func (e *Engine) Methods() []Method {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return append([]Method(nil), e.methods...)
+}
+
+// SetMethods validates and replaces all methods
+func (e *Engine) SetMethods(methods []Method) error {
+	seen := make(map[string]bool)
+	defaults := 0
+	for i := range methods {
+		m := &methods[i]
+		m.ID = strings.ToLower(strings.TrimSpace(m.ID))
+		if m.ID == "" {
+			return fmt.Errorf("every method needs an id")
+		}
+		if seen[m.ID] {
+			return fmt.Errorf("duplicate method %s", m.ID)
+		}
+		seen[m.ID] = true
+		if m.Default {
+			if !m.Active {
+				return fmt.Errorf("method %s: the default method must be active", m.ID)
+			}
+			if defaults++; defaults > 1 {
+				return fmt.Errorf("only one method can be the default")
+			}
+		}
+		if err := validate(*m); err != nil {
+			return fmt.Errorf("method %s: %w", m.ID, err)
+		}
+		sort.Slice(m.Bands, func(a, b int) bool { return m.Bands[a].MaxWeight < m.Bands[b].MaxWeight })
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.methods = methods
+	return e.file.Save(e.methods)
+}
+
+func validate(m Method) error {
+	if m.Price < 0 || m.ExtraPerKg < 0 || m.FreeOver < 0 || m.ItemWeight < 0 {
+		return fmt.Errorf("amounts cannot be negative")
+	}
+	switch m.Type {
+	case TypeFlat, TypeZone:
+	case TypeWeight:
+		if len(m.Bands) == 0 {
+			return fmt.Errorf("weight-based methods need at least one band")
+		}
+	default:
+		return fmt.Errorf("unknown type %q", m.Type)
+	}
+	return nil
+}
+
+// Method returns an active method by id
+func (e *Engine) Method(id string) (Method, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.methodLocked(id)
+}
+
+func (e *Engine) methodLocked(id string) (Method, bool) {
+	id = strings.ToLower(strings.TrimSpace(id))
+	for _, m := range e.methods {
+		if m.ID == id && m.Active {
+			return m, true
+		}
+	}
+	return Method{}, false
+}
+
+// Price implements cart.Pricer. It runs after tax so the free-shipping threshold
+// is compared against what the customer pays for the goods.
+func (e *Engine) Price(c cart.Cart, t *cart.Totals) error {
+	m, ok, err := e.cartMethod(c)
+	if err != nil || !ok {
+		return err
+	}
+
+	t.ShippingMethod = m.ID
+	if t.FreeShipping || (m.FreeOver > 0 && t.Gross >= t.Convert(m.FreeOver)) {
+		t.FreeShipping = true
+		t.Shipping = 0
+		return nil
+	}
+	t.Shipping = t.Convert(Rate(m, c))
+	return nil
+}
+
+// cartMethod returns the method a cart is charged for. A cart with a destination but
+// no method gets the default method; without a default it must choose one while any
+// method is active. Carts without a destination are not charged yet.
+func (e *Engine) cartMethod(c cart.Cart) (Method, bool, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if c.ShippingMethod != "" {
+		m, ok := e.methodLocked(c.ShippingMethod)
+		if !ok {
+			return Method{}, false, fmt.Errorf("shipping method %s is not available", c.ShippingMethod)
+		}
+		return m, true, nil
+	}
+	if c.ShippingCity == "" {
+		return Method{}, false, nil
+	}
+	active := false
+	for _, m := range e.methods {
+		if m.Active && m.Default {
+			return m, true, nil
+		}
+		active = active || m.Active
+	}
+	if active {
+		return Method{}, false, fmt.Errorf("a shipping method is required")
+	}
+	return Method{}, false, nil
+}
+
+// Rate returns the price of a method for a cart in the base currency, before any free-shipping rule
+func Rate(m Method, c cart.Cart) float64 {
+	switch m.Type {
+	case TypeWeight:
+		weight := Weight(c, m.ItemWeight)
+		for _, band := range m.Bands {
+			if weight <= band.MaxWeight {
+				return band.Price
+			}
+		}
+		last := m.Bands[len(m.Bands)-1]
+		return cart.Round(last.Price + (weight-last.MaxWeight)*m.ExtraPerKg)
+	case TypeZone:
+		for _, zone := range m.Zones {
+			for _, city := range zone.Cities {
+				if strings.EqualFold(city, c.ShippingCity) {
+					return zone.Price
+				}
+			}
+		}
+	}
+	return m.Price
+}
+
+// Weight returns the parcel weight in kilograms
+func Weight(c cart.Cart, itemWeight float64) float64 {
+	total := 0.0
+	for _, line := range c.Lines {
+		w := line.Weight
+		if w == 0 {
+			w = itemWeight
+		}
+		total += w * float64(line.Quantity)
+	}
+	return total
+}
@@ -0,0 +1,107 @@
+package shipping
+
+import (
+	"path/filepath"
+	"testing"
+
+	"tapsilat-go-example/cart"
+)
+
+func newEngine(t *testing.T) *Engine {
+	t.Helper()
+	e, err := NewEngine(filepath.Join(t.TempDir(), "shipping.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestRate(t *testing.T) {
+	methods := DefaultMethods()
+	cargo, express := methods[1], methods[2]
+
+	tests := []struct {
+		name   string
+		method Method
+		city   string
+		lines  []cart.Line
+		want   float64
+	}{
+		{"flat", methods[0], "Ankara", nil, 29.90},
+		{"first band", cargo, "", []cart.Line{{Quantity: 2}}, 39.90},
+		{"line weight", cargo, "", []cart.Line{{Quantity: 3, Weight: 3}}, 69.90},
+		{"above last band", cargo, "", []cart.Line{{Quantity: 1, Weight: 32}}, 139.90},
+		{"zone", express, "istanbul", nil, 49.90},
+		{"other zone", express, "Izmir", nil, 69.90},
+		{"no zone", express, "Trabzon", nil, 99.90},
+	}
+	for _, tt := range tests {
+		c := cart.Cart{ShippingCity: tt.city, Lines: tt.lines}
+		if got := Rate(tt.method, c); got != tt.want {
+			t.Errorf("%s: Rate = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPrice(t *testing.T) {
+	e := newEngine(t)
+
+	tests := []struct {
+		name    string
+		cart    cart.Cart
+		gross   float64
+		free    bool
+		want    float64
+		method  string
+		wantErr bool
+	}{
+		{"no destination", cart.Cart{}, 100, false, 0, "", false},
+		{"default method", cart.Cart{ShippingCity: "Ankara"}, 100, false, 29.90, "standard", false},
+		{"free over", cart.Cart{ShippingCity: "Ankara"}, 500, false, 0, "standard", false},
+		{"free shipping coupon", cart.Cart{ShippingCity: "Ankara", ShippingMethod: "express"}, 100, true, 0, "express", false},
+		{"chosen method", cart.Cart{ShippingCity: "Istanbul", ShippingMethod: "EXPRESS"}, 100, false, 49.90, "express", false},
+		{"unknown method", cart.Cart{ShippingCity: "Ankara", ShippingMethod: "drone"}, 100, false, 0, "", true},
+	}
+	for _, tt := range tests {
+		totals := cart.Totals{Gross: tt.gross, FreeShipping: tt.free}
+		err := e.Price(tt.cart, &totals)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if totals.Shipping != tt.want || totals.ShippingMethod != tt.method {
+			t.Errorf("%s: shipping = %v via %q, want %v via %q", tt.name, totals.Shipping, totals.ShippingMethod, tt.want, tt.method)
+		}
+	}
+}
+
+func TestPriceWithoutDefault(t *testing.T) {
+	e := newEngine(t)
+	if err := e.SetMethods([]Method{{ID: "flat", Type: TypeFlat, Price: 10, Active: true}}); err != nil {
+		t.Fatal(err)
+	}
+	totals := cart.Totals{}
+	if err := e.Price(cart.Cart{ShippingCity: "Ankara"}, &totals); err == nil {
+		t.Error("Price charged a cart that chose no method while no method is the default")
+	}
+}
+
+func TestSetMethods(t *testing.T) {
+	tests := []struct {
+		name    string
+		methods []Method
+	}{
+		{"missing id", []Method{{Type: TypeFlat}}},
+		{"duplicate id", []Method{{ID: "a", Type: TypeFlat}, {ID: " A ", Type: TypeFlat}}},
+		{"inactive default", []Method{{ID: "a", Type: TypeFlat, Default: true}}},
+		{"two defaults", []Method{{ID: "a", Type: TypeFlat, Active: true, Default: true}, {ID: "b", Type: TypeFlat, Active: true, Default: true}}},
+		{"negative price", []Method{{ID: "a", Type: TypeFlat, Price: -1}}},
+		{"weight without bands", []Method{{ID: "a", Type: TypeWeight}}},
+		{"unknown type", []Method{{ID: "a", Type: "pigeon"}}},
+	}
+	for _, tt := range tests {
+		if err := newEngine(t).SetMethods(tt.methods); err == nil {
+			t.Errorf("%s: SetMethods accepted invalid methods", tt.name)
+		}
+	}
+}
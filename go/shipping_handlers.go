@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net/http"
+
+	"tapsilat-go-example/shipping"
+	"tapsilat-go-example/validation"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ShippingQuoteRequest prices a cart for an address. Without items the current cart is used.
+type ShippingQuoteRequest struct {
+	Items    []Product `json:"items"`
+	Coupons  []string  `json:"coupons"`
+	Currency string    `json:"currency"`
+	Country  string    `json:"country"`
+	City     string    `json:"city" binding:"required"`
+}
+
+// ShippingQuote is the price of one shipping method and the resulting cart total
+type ShippingQuote struct {
+	MethodID string  `json:"method_id"`
+	Name     string  `json:"name"`
+	Price    float64 `json:"price"`
+	Free     bool    `json:"free"`
+	Total    float64 `json:"total"`
+}
+
+// listShippingMethodsHandler lists the configured shipping methods
+func listShippingMethodsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, shippingEngine.Methods())
+}
+
+// updateShippingMethodsHandler replaces the shipping methods
+func updateShippingMethodsHandler(c *gin.Context) {
+	var req []shipping.Method
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := shippingEngine.SetMethods(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, shippingEngine.Methods())
+}
+
+// shippingQuoteHandler prices every active shipping method for a cart and address
+func shippingQuoteHandler(c *gin.Context) {
+	var req ShippingQuoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	country, err := validation.Country(req.Country)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "country: " + err.Error()})
+		return
+	}
+
+	items, err := catalogProducts(req.Items)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	quoted := orderCart(OrderRequest{Cart: items, Coupons: req.Coupons, Currency: req.Currency}, "")
+	if len(req.Items) == 0 {
+		current, ok := currentCart(c, false)
+		if !ok || len(current.Lines) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cart is empty"})
+			return
+		}
+		quoted = current
+		if req.Currency != "" {
+			quoted.Currency = req.Currency
+		}
+	}
+	quoted.Country = country
+	quoted.ShippingCity = req.City
+
+	quotes := make([]ShippingQuote, 0)
+	for _, method := range shippingEngine.Methods() {
+		if !method.Active {
+			continue
+		}
+		quoted.ShippingMethod = method.ID
+		totals, _, err := priceCart(quoted)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		quotes = append(quotes, ShippingQuote{
+			MethodID: method.ID,
+			Name:     method.Name,
+			Price:    totals.Shipping,
+			Free:     totals.FreeShipping,
+			Total:    totals.Total,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"quotes": quotes})
+}
+
+// setCartShippingHandler chooses the shipping destination and method for the current cart
+func setCartShippingHandler(c *gin.Context) {
+	var req struct {
+		Country string `json:"country"`
+		City    string `json:"city" binding:"required"`
+		Method  string `json:"method" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	country, err := validation.Country(req.Country)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "country: " + err.Error()})
+		return
+	}
+
+	current, ok := currentCart(c, false)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cart not found"})
+		return
+	}
+
+	method, ok := shippingEngine.Method(req.Method)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown shipping method"})
+		return
+	}
+
+	updated, err := cartStore.SetShipping(current.Token, country, req.City, method.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	respondCart(c, updated)
+}
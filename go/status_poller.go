@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"tapsilat-go-example/orders"
+	"tapsilat-go-example/poller"
+
+	"github.com/gin-gonic/gin"
+)
+
+var statusPoller *poller.Poller
+
+// gatewayStatusFetcher resolves order status through the Tapsilat API
+type gatewayStatusFetcher struct{}
+
+// FetchStatus asks GetOrderStatus first and falls back to the payment details
+func (gatewayStatusFetcher) FetchStatus(ctx context.Context, referenceID string) (orders.Status, error) {
+	apiClient, err := getAPIClient()
+	if err != nil {
+		return orders.StatusPending, err
+	}
+
+	status, err := apiClient.GetOrderStatus(ctx, referenceID)
+	if err != nil {
+		return orders.StatusPending, fmt.Errorf("get order status: %w", err)
+	}
+	if s := orders.ParseGatewayStatus(responseField(status, "status", "status_enum")); s != orders.StatusPending {
+		return s, nil
+	}
+
+	details, err := apiClient.GetOrderPaymentDetails(ctx, referenceID, "")
+	if err != nil {
+		return orders.StatusPending, fmt.Errorf("get order payment details: %w", err)
+	}
+	return orders.ParseGatewayStatus(responseField(details, "status", "payment_status", "status_enum")), nil
+}
+
+// startStatusPoller starts the background poller unless disabled via STATUS_POLLER_ENABLED=false
+func startStatusPoller() {
+	cfg := poller.DefaultConfig()
+	cfg.Interval = getEnvDuration("STATUS_POLLER_INTERVAL", cfg.Interval)
+	cfg.MinAge = getEnvDuration("STATUS_POLLER_MIN_AGE", cfg.MinAge)
+	cfg.MaxAge = getEnvDuration("STATUS_POLLER_MAX_AGE", cfg.MaxAge)
+	cfg.BaseBackoff = getEnvDuration("STATUS_POLLER_BACKOFF", cfg.BaseBackoff)
+	cfg.MaxBackoff = getEnvDuration("STATUS_POLLER_MAX_BACKOFF", cfg.MaxBackoff)
+	cfg.RateLimit = getEnvDuration("STATUS_POLLER_RATE_LIMIT", cfg.RateLimit)
+
+	statusPoller = poller.New(cfg, orderStore, gatewayStatusFetcher{}, applyOrderTransition)
+	// An abandoned order will not be paid through this app, so its coupons are freed
+	statusPoller.OnAbandon(func(rec orders.Record) {
+		if err := promoEngine.Release(rec.ConversationID); err != nil {
+			utilsInstance.LogError("Failed to release coupons of abandoned order", map[string]interface{}{
+				"reference_id": rec.ReferenceID,
+				"error":        err.Error(),
+			})
+		}
+		dropPlanChange(rec.ReferenceID)
+	})
+
+	if os.Getenv("STATUS_POLLER_ENABLED") == "false" {
+		log.Println("Status poller disabled")
+		return
+	}
+	statusPoller.Start(context.Background())
+	log.Printf("Status poller started (interval %s, min age %s, max age %s)", cfg.Interval, cfg.MinAge, cfg.MaxAge)
+}
+
+// applyOrderTransition is the single place where webhook callbacks and the poller change order state
+func applyOrderTransition(referenceID string, status orders.Status, source string) {
+	rec, changed, err := orderStore.Apply(referenceID, status, source)
+	if err != nil {
+		utilsInstance.LogError("Failed to apply order transition", map[string]interface{}{
+			"reference_id": referenceID,
+			"status":       status,
+			"source":       source,
+			"error":        err.Error(),
+		})
+		return
+	}
+	if !changed {
+		return
+	}
+	log.Printf("Order %s is now %s (via %s)", referenceID, rec.Status, source)
+
+	// Coupons are only consumed by paid orders
+	var promoErr error
+	switch rec.Status {
+	case orders.StatusPaid:
+		promoErr = promoEngine.Confirm(rec.ConversationID)
+		// Keep the card for one-click reorders and subscriptions
+		go captureOrderCard(rec)
+		go completePlanChange(rec.ReferenceID)
+	case orders.StatusFailed, orders.StatusCancelled:
+		promoErr = promoEngine.Release(rec.ConversationID)
+		dropPlanChange(rec.ReferenceID)
+	}
+	if promoErr != nil {
+		utilsInstance.LogError("Failed to update coupon redemptions", map[string]interface{}{
+			"reference_id": referenceID,
+			"error":        promoErr.Error(),
+		})
+	}
+
+	// Tell the buyer
+	switch rec.Status {
+	case orders.StatusPaid:
+		notifyOrderEvent(rec, "order_paid", rec.Amount)
+	case orders.StatusRefunded:
+		// Refunds made through the API were announced one by one
+		if len(rec.Refunds) == 0 {
+			notifyOrderEvent(rec, "order_refunded", rec.Amount)
+		}
+	}
+}
+
+// applyWebhookTransition updates the local order for a received callback
+func applyWebhookTransition(callbackType string, body []byte) {
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return
+	}
+
+	referenceID := responseField(payload, "reference_id", "order_reference_id")
+	if referenceID == "" {
+		return
+	}
+	if _, ok := orderStore.Get(referenceID); !ok {
+		return
+	}
+
+	var status orders.Status
+	switch callbackType {
+	case "success":
+		status = orders.StatusPaid
+	case "fail":
+		status = orders.StatusFailed
+	case "refund":
+		status = orders.StatusRefunded
+	case "cancel":
+		status = orders.StatusCancelled
+	default:
+		return
+	}
+
+	// Callbacks are unauthenticated, so only act on what the gateway confirms
+	confirmed, err := gatewayStatusFetcher{}.FetchStatus(context.Background(), referenceID)
+	if err != nil {
+		utilsInstance.LogError("Failed to verify order callback", map[string]interface{}{
+			"type":         callbackType,
+			"reference_id": referenceID,
+			"error":        err.Error(),
+		})
+		return
+	}
+	if callbackType == "refund" && confirmed == orders.StatusPaid {
+		// A partial refund leaves the order paid; refunds made here are in its Refunds
+		log.Printf("Order %s was partially refunded and stays paid", referenceID)
+		return
+	}
+	if confirmed != status {
+		log.Printf("Ignoring %s callback for %s: gateway reports %s", callbackType, referenceID, confirmed)
+		return
+	}
+	applyOrderTransition(referenceID, status, "webhook:"+callbackType)
+}
+
+// pollerStatusHandler exposes the poller queue depth and counters
+func pollerStatusHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, statusPoller.Stats())
+}
+
+// pollerRunHandler triggers an immediate polling pass
+func pollerRunHandler(c *gin.Context) {
+	if !statusPoller.RunOnce(c.Request.Context()) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A polling pass is already running"})
+		return
+	}
+	c.JSON(http.StatusOK, statusPoller.Stats())
+}
+
+// responseField returns the first non-empty value among keys of a JSON-serializable response
+func responseField(v interface{}, keys ...string) string {
+	fields, ok := v.(map[string]interface{})
+	if !ok {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return ""
+		}
+	}
+
+	for _, key := range keys {
+		switch value := fields[key].(type) {
+		case nil:
+			continue
+		case string:
+			if value != "" {
+				return value
+			}
+		default:
+			return fmt.Sprintf("%v", value)
+		}
+	}
+	return ""
+}
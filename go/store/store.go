@@ -0,0 +1,88 @@
+package store
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// JSONFile persists a single JSON document on disk
+type JSONFile struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewJSONFile creates a JSONFile backed by the given path
+func NewJSONFile(path string) *JSONFile {
+	return &JSONFile{path: path}
+}
+
+// DataPath returns the path of a file inside the local data directory
+func DataPath(name string) string {
+	dir := os.Getenv("DATA_DIR")
+	if dir == "" {
+		dir = "data"
+	}
+	return filepath.Join(dir, name)
+}
+
+// NewID returns a random id for a stored record, e.g. "BUYER_3f9a0c12d4"
+func NewID(prefix string) (string, error) {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate id: %w", err)
+	}
+	return prefix + hex.EncodeToString(b), nil
+}
+
+// Path returns the file path
+func (f *JSONFile) Path() string {
+	return f.path
+}
+
+// Load decodes the file into v. A missing file leaves v untouched.
+func (f *JSONFile) Load(v interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, err := os.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", f.path, err)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", f.path, err)
+	}
+	return nil
+}
+
+// Save encodes v and atomically replaces the file
+func (f *JSONFile) Save(v interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", f.path, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+		return fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	// Write to a temp file first so a crash never leaves a half-written file
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	return os.Rename(tmp, f.path)
+}
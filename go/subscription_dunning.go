@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"tapsilat-go-example/orders"
+	"tapsilat-go-example/subscriptions"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tapsilat/tapsilat-go"
+)
+
+var subscriptionDunner *subscriptions.Dunner
+
+// emailDunningNotifier sends the dunning emails from the email templates
+type emailDunningNotifier struct{}
+
+// NotifySubscription implements subscriptions.Notifier
+func (emailDunningNotifier) NotifySubscription(ctx context.Context, event string, sub subscriptions.Subscription, data map[string]interface{}) error {
+	switch event {
+	case "subscription_past_due":
+		link, _ := data["PaymentLink"].(string)
+		return notifySubscriptionPastDue(sub, link)
+	case "subscription_cancelled":
+		reason, _ := data["Reason"].(string)
+		return notifySubscriptionCancelled(sub, reason)
+	}
+	return fmt.Errorf("no email for %s", event)
+}
+
+// sdkSubscriptionGateway gives dunning access to the Tapsilat API
+type sdkSubscriptionGateway struct{}
+
+// PaymentLink points the subscription back at this app and returns the checkout URL of the failed renewal
+func (sdkSubscriptionGateway) PaymentLink(ctx context.Context, sub subscriptions.Subscription) (string, error) {
+	apiClient, err := getAPIClient()
+	if err != nil {
+		return "", err
+	}
+	if sub.BaseURL != "" {
+		_, err := apiClient.RedirectSubscription(ctx, tapsilat.SubscriptionRedirectRequest{
+			SubscriptionID: sub.ReferenceID,
+			SuccessURL:     fmt.Sprintf("%s/payment/success", sub.BaseURL),
+			FailureURL:     fmt.Sprintf("%s/payment/failure", sub.BaseURL),
+		})
+		if err != nil {
+			return "", fmt.Errorf("redirect subscription: %w", err)
+		}
+	}
+
+	orderReferenceID := sub.RenewalReference
+	if orderReferenceID == "" {
+		orderReferenceID = sub.OrderReferenceID
+	}
+	if orderReferenceID == "" {
+		return "", fmt.Errorf("subscription %s has no order to pay", sub.ReferenceID)
+	}
+	return apiClient.GetCheckoutURL(ctx, orderReferenceID)
+}
+
+// Paid asks the gateway for the status of the failed renewal order
+func (sdkSubscriptionGateway) Paid(ctx context.Context, sub subscriptions.Subscription) (bool, error) {
+	if sub.RenewalReference == "" {
+		return false, nil
+	}
+	apiClient, err := getAPIClient()
+	if err != nil {
+		return false, err
+	}
+	status, err := apiClient.GetOrderStatus(ctx, sub.RenewalReference)
+	if err != nil {
+		return false, fmt.Errorf("get order status: %w", err)
+	}
+	return orders.ParseGatewayStatus(responseField(status, "status", "status_enum")) == orders.StatusPaid, nil
+}
+
+// Cancel cancels the subscription on the gateway
+func (sdkSubscriptionGateway) Cancel(ctx context.Context, sub subscriptions.Subscription) error {
+	apiClient, err := getAPIClient()
+	if err != nil {
+		return err
+	}
+	return apiClient.CancelSubscription(ctx, tapsilat.SubscriptionCancelRequest{
+		ReferenceID:    sub.ReferenceID,
+		SubscriptionID: sub.ReferenceID,
+	})
+}
+
+// startDunning starts the renewal retries unless disabled via DUNNING_ENABLED=false
+func startDunning() {
+	cfg := subscriptions.DefaultDunningConfig()
+	cfg.Interval = getEnvDuration("DUNNING_INTERVAL", cfg.Interval)
+	cfg.RetryDays = getEnvInts("DUNNING_RETRY_DAYS", cfg.RetryDays)
+
+	subscriptionDunner = subscriptions.NewDunner(cfg, subscriptionStore, sdkSubscriptionGateway{}, emailDunningNotifier{})
+
+	if os.Getenv("DUNNING_ENABLED") == "false" {
+		log.Println("Subscription dunning disabled")
+		return
+	}
+	subscriptionDunner.Start(context.Background())
+	log.Printf("Subscription dunning started (interval %s, retries %v days after a failed renewal)", cfg.Interval, cfg.RetryDays)
+}
+
+// applySubscriptionWebhook starts dunning for a failed renewal and ends it once a renewal is paid
+func applySubscriptionWebhook(callbackType string, body []byte) {
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return
+	}
+	sub, orderReferenceID, ok := webhookSubscription(payload)
+	if !ok {
+		return
+	}
+
+	var want []orders.Status
+	switch callbackType {
+	case "fail":
+		// A failed first payment is handled by the checkout page, only renewals are dunned
+		if orderReferenceID == sub.OrderReferenceID {
+			return
+		}
+		want = []orders.Status{orders.StatusFailed, orders.StatusCancelled}
+	case "success":
+		want = []orders.Status{orders.StatusPaid}
+	default:
+		return
+	}
+	if !subscriptionCallbackConfirmed(callbackType, sub, orderReferenceID, want...) {
+		return
+	}
+
+	var err error
+	if callbackType == "fail" {
+		reason := responseField(payload, "error_message", "message", "status")
+		err = subscriptionDunner.Fail(context.Background(), sub.ReferenceID, orderReferenceID, reason, time.Now())
+	} else {
+		err = subscriptionDunner.Recover(sub.ReferenceID, "webhook:success", time.Now())
+	}
+	if err != nil {
+		utilsInstance.LogError("Failed to apply subscription callback", map[string]interface{}{
+			"reference_id": sub.ReferenceID,
+			"callback":     callbackType,
+			"error":        err.Error(),
+		})
+	}
+}
+
+// subscriptionCallbackConfirmed checks with the gateway that the order a subscription callback reports is in one of the wanted states
+func subscriptionCallbackConfirmed(callbackType string, sub subscriptions.Subscription, orderReferenceID string, want ...orders.Status) bool {
+	if orderReferenceID == "" {
+		log.Printf("Ignoring %s callback for subscription %s: no order to verify", callbackType, sub.ReferenceID)
+		return false
+	}
+	status, err := gatewayStatusFetcher{}.FetchStatus(context.Background(), orderReferenceID)
+	if err != nil {
+		utilsInstance.LogError("Failed to verify subscription callback", map[string]interface{}{
+			"reference_id":       sub.ReferenceID,
+			"order_reference_id": orderReferenceID,
+			"callback":           callbackType,
+			"error":              err.Error(),
+		})
+		return false
+	}
+	for _, s := range want {
+		if status == s {
+			return true
+		}
+	}
+	log.Printf("Ignoring %s callback for subscription %s: gateway reports order %s as %s", callbackType, sub.ReferenceID, orderReferenceID, status)
+	return false
+}
+
+// webhookSubscription finds the local subscription a callback is about and the renewal order
+// it reports. A callback that only names the subscription gets its latest order from Tapsilat,
+// so dunning always has the renewal to link to and check; "" means none could be found.
+func webhookSubscription(payload map[string]interface{}) (subscriptions.Subscription, string, bool) {
+	orderReferenceID := responseField(payload, "order_reference_id", "reference_id")
+	var sub subscriptions.Subscription
+	var ok bool
+	if id := responseField(payload, "subscription_reference_id", "subscription_id"); id != "" {
+		sub, ok = subscriptionStore.Get(id)
+	} else if orderReferenceID != "" {
+		if sub, ok = subscriptionStore.Get(orderReferenceID); !ok {
+			sub, ok = subscriptionStore.FindByOrder(orderReferenceID)
+		}
+	}
+	if !ok {
+		return subscriptions.Subscription{}, "", false
+	}
+
+	if orderReferenceID == "" || orderReferenceID == sub.ReferenceID {
+		latest, err := latestSubscriptionOrder(context.Background(), sub.ReferenceID)
+		if err != nil {
+			utilsInstance.LogError("Failed to find the latest subscription order", map[string]interface{}{
+				"reference_id": sub.ReferenceID,
+				"error":        err.Error(),
+			})
+		}
+		orderReferenceID = latest
+	}
+	return sub, orderReferenceID, true
+}
+
+// latestSubscriptionOrder returns the reference of the last order Tapsilat lists for a subscription
+func latestSubscriptionOrder(ctx context.Context, subscriptionID string) (string, error) {
+	apiClient, err := getAPIClient()
+	if err != nil {
+		return "", err
+	}
+	response, err := apiClient.GetSubscription(ctx, tapsilat.SubscriptionGetRequest{ReferenceID: subscriptionID})
+	if err != nil {
+		return "", fmt.Errorf("get subscription: %w", err)
+	}
+
+	var details struct {
+		Orders []map[string]interface{} `json:"orders"`
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		return "", err
+	}
+	if err := json.Unmarshal(data, &details); err != nil {
+		return "", fmt.Errorf("decode subscription: %w", err)
+	}
+	if len(details.Orders) == 0 {
+		return "", nil
+	}
+	return responseField(details.Orders[len(details.Orders)-1], "reference_id", "order_reference_id"), nil
+}
+
+// getSubscriptionHandler returns the local record of a subscription with its history
+func getSubscriptionHandler(c *gin.Context) {
+	sub, ok := subscriptionStore.Get(c.Param("reference_id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+		return
+	}
+	c.JSON(http.StatusOK, sub)
+}
+
+// subscriptionChainHandler returns every gateway subscription of a logical subscription, oldest first
+func subscriptionChainHandler(c *gin.Context) {
+	sub, ok := currentSubscription(c.Param("reference_id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"logical_id": sub.LogicalID,
+		"current":    sub.ReferenceID,
+		"chain":      subscriptionStore.Chain(sub.LogicalID),
+	})
+}
+
+// pastDueSubscriptionsHandler lists the subscriptions in dunning
+func pastDueSubscriptionsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, subscriptionDunner.PastDue())
+}
+
+// dunningStatusHandler returns the dunning counters
+func dunningStatusHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, subscriptionDunner.Stats())
+}
+
+// dunningRunHandler runs the due retries immediately
+func dunningRunHandler(c *gin.Context) {
+	if !subscriptionDunner.RunOnce(c.Request.Context(), time.Now()) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A dunning pass is already running"})
+		return
+	}
+	c.JSON(http.StatusOK, subscriptionDunner.Stats())
+}
@@ -0,0 +1,559 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"tapsilat-go-example/customers"
+	"tapsilat-go-example/orders"
+	"tapsilat-go-example/subscriptions"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tapsilat/tapsilat-go"
+)
+
+// listPlansHandler lists the plans customers can subscribe to
+func listPlansHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, subscriptionPlans.List(false))
+}
+
+// listAllPlansHandler lists every plan, including inactive ones
+func listAllPlansHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, subscriptionPlans.List(true))
+}
+
+// savePlanHandler creates or replaces a plan
+func savePlanHandler(c *gin.Context) {
+	var req subscriptions.Plan
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Currency == "" {
+		req.Currency = fxEngine.Base()
+	}
+	if !fxEngine.IsSupported(req.Currency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("currency %s is not supported", req.Currency)})
+		return
+	}
+
+	saved, err := subscriptionPlans.Save(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, saved)
+}
+
+// deletePlanHandler removes a plan from the catalog
+func deletePlanHandler(c *gin.Context) {
+	if err := subscriptionPlans.Delete(c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// enrichSubscriptions adds the local plan and subscriber to every row of a gateway subscription list
+func enrichSubscriptions(response interface{}) interface{} {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return response
+	}
+	var list map[string]interface{}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return response
+	}
+
+	rows, _ := list["rows"].([]interface{})
+	for _, row := range rows {
+		fields, ok := row.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		sub, ok := subscriptionStore.Get(responseField(fields, "reference_id"))
+		if !ok {
+			continue
+		}
+		fields["plan"] = sub.Plan
+		fields["logical_id"] = sub.LogicalID
+		fields["subscriber_email"] = sub.SubscriberEmail
+		fields["local_status"] = sub.Status
+		if pause, ok := subscriptions.CurrentPause(sub); ok && !pause.ResumeAt.IsZero() {
+			fields["resume_at"] = pause.ResumeAt
+		}
+	}
+	return list
+}
+
+// SubscriptionChangeRequest moves a subscription to another plan. SubscriptionID is the
+// gateway reference or the logical id.
+type SubscriptionChangeRequest struct {
+	SubscriptionID string `json:"subscription_id" binding:"required"`
+	PlanID         string `json:"plan_id" binding:"required"`
+}
+
+// SubscriptionChangeResponse is a priced or applied plan change
+type SubscriptionChangeResponse struct {
+	Success                 bool                    `json:"success"`
+	LogicalID               string                  `json:"logical_id,omitempty"`
+	ReferenceID             string                  `json:"reference_id,omitempty"` // the new gateway subscription
+	Proration               subscriptions.Proration `json:"proration"`
+	CheckoutURL             string                  `json:"checkout_url,omitempty"` // pays the amount due
+	OrderReferenceID        string                  `json:"order_reference_id,omitempty"`
+	SubscriptionCheckoutURL string                  `json:"subscription_checkout_url,omitempty"`
+	Pending                 bool                    `json:"pending,omitempty"` // the plan changes once checkout_url is paid
+	Error                   string                  `json:"error,omitempty"`
+}
+
+// currentSubscription resolves a gateway reference or logical id to the subscription in effect
+func currentSubscription(id string) (subscriptions.Subscription, bool) {
+	sub, ok := subscriptionStore.Get(id)
+	if ok && sub.Status != subscriptions.StatusChanged {
+		return sub, true
+	}
+	logicalID := id
+	if ok {
+		logicalID = sub.LogicalID
+	}
+	chain := subscriptionStore.Chain(logicalID)
+	if len(chain) == 0 {
+		return subscriptions.Subscription{}, false
+	}
+	return chain[len(chain)-1], true
+}
+
+// subscriberSubscription resolves id to the subscription in effect, but only when the
+// request's X-Customer-Token proves its subscriber, so nobody can change, pause or resume
+// another customer's subscription
+func subscriberSubscription(c *gin.Context, id string) (subscriptions.Subscription, int, error) {
+	sub, ok := currentSubscription(id)
+	if !ok {
+		return sub, http.StatusNotFound, fmt.Errorf("subscription %s not found", id)
+	}
+	customerID := cartCustomer(c)
+	customer, found := customerStore.Find(sub.SubscriberEmail, sub.SubscriberPhone)
+	if customerID == "" || !found || customer.ID != customerID {
+		return subscriptions.Subscription{}, http.StatusUnauthorized, fmt.Errorf("A valid %s of the subscriber is required", customerHeader)
+	}
+	return sub, http.StatusOK, nil
+}
+
+// prorateChange prices a plan change of a subscription of the requesting customer
+func prorateChange(c *gin.Context, req SubscriptionChangeRequest) (subscriptions.Subscription, subscriptions.Plan, subscriptions.Proration, int, error) {
+	sub, status, err := subscriberSubscription(c, req.SubscriptionID)
+	if err != nil {
+		return sub, subscriptions.Plan{}, subscriptions.Proration{}, status, err
+	}
+	plan, ok := subscriptionPlans.Get(req.PlanID)
+	if !ok {
+		return sub, plan, subscriptions.Proration{}, http.StatusBadRequest, fmt.Errorf("plan %s is not available", req.PlanID)
+	}
+	p, err := subscriptions.Prorate(sub, plan, time.Now())
+	if err != nil {
+		return sub, plan, p, http.StatusBadRequest, err
+	}
+	return sub, plan, p, http.StatusOK, nil
+}
+
+// previewSubscriptionChangeHandler prices a plan change without applying it
+func previewSubscriptionChangeHandler(c *gin.Context) {
+	var req SubscriptionChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sub, _, p, status, err := prorateChange(c, req)
+	if err != nil {
+		c.JSON(status, SubscriptionChangeResponse{Success: false, Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, SubscriptionChangeResponse{Success: true, LogicalID: sub.LogicalID, ReferenceID: sub.ReferenceID, Proration: p})
+}
+
+// changeSubscriptionHandler moves a subscription to another plan. When a prorated
+// difference is due, the change waits until its order is paid.
+func changeSubscriptionHandler(c *gin.Context) {
+	var req SubscriptionChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sub, plan, p, status, err := prorateChange(c, req)
+	if err != nil {
+		c.JSON(status, SubscriptionChangeResponse{Success: false, Error: err.Error()})
+		return
+	}
+
+	apiClient, err := getAPIClient()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	baseURL := getBaseURL(c.Request)
+	resp := SubscriptionChangeResponse{LogicalID: sub.LogicalID, Proration: p}
+
+	// A positive difference is paid first with a one-off order; the plan only changes
+	// once that order is paid (see completePlanChange)
+	if p.AmountDue > 0 {
+		if sub.PendingChange != nil {
+			resp.Error = "A plan change is already waiting for payment of order " + sub.PendingChange.OrderReferenceID
+			c.JSON(http.StatusConflict, resp)
+			return
+		}
+
+		customer, billing, err := subscriberBilling(sub.SubscriberEmail, sub.SubscriberPhone)
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		resp.OrderReferenceID, resp.CheckoutURL, err = createProrationOrder(ctx, apiClient, sub, customer, billing, plan, p, baseURL)
+		if err != nil {
+			utilsInstance.LogError("Failed to create proration order", map[string]interface{}{
+				"subscription": sub.ReferenceID,
+				"error":        err.Error(),
+			})
+			resp.Error = "Failed to create proration order: " + err.Error()
+			c.JSON(http.StatusBadGateway, resp)
+			return
+		}
+
+		if _, err := subscriptionStore.SetPendingChange(sub.ReferenceID, subscriptions.PendingChange{
+			OrderReferenceID: resp.OrderReferenceID,
+			Plan:             plan,
+			Proration:        p,
+			BaseURL:          baseURL,
+			RequestedAt:      time.Now(),
+		}); err != nil {
+			utilsInstance.LogError("Failed to store pending plan change", map[string]interface{}{
+				"subscription": sub.ReferenceID,
+				"error":        err.Error(),
+			})
+			cancelProrationOrder(context.WithoutCancel(ctx), apiClient, resp.OrderReferenceID)
+			resp.OrderReferenceID, resp.CheckoutURL = "", ""
+			resp.Error = "Failed to store plan change: " + err.Error()
+			c.JSON(http.StatusConflict, resp)
+			return
+		}
+
+		resp.Success = true
+		resp.Pending = true
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	if err := applyPlanChange(ctx, apiClient, sub, plan, p, baseURL, &resp); err != nil {
+		resp.Error = err.Error()
+		c.JSON(http.StatusBadGateway, resp)
+		return
+	}
+	resp.Success = true
+	c.JSON(http.StatusOK, resp)
+}
+
+// applyPlanChange creates the subscription on the new plan, billing from the end of the
+// current period, and cancels the old one. resp receives the new subscription.
+func applyPlanChange(ctx context.Context, apiClient *tapsilat.API, sub subscriptions.Subscription, plan subscriptions.Plan, p subscriptions.Proration, baseURL string, resp *SubscriptionChangeResponse) error {
+	// 1. The new plan starts billing when the current period ends
+	next := plan
+	next.PaymentDay = p.NextPaymentAt.Day()
+	if next.PaymentDay > 28 {
+		next.PaymentDay = 28
+	}
+	_, billing, err := subscriberBilling(sub.SubscriberEmail, sub.SubscriberPhone)
+	if err != nil {
+		return err
+	}
+	request := createTapsilatSubscription(SubscriptionRequest{
+		SubscriberEmail: sub.SubscriberEmail,
+		SubscriberPhone: sub.SubscriberPhone,
+		Country:         sub.Country,
+		CardID:          sub.CardID,
+	}, next, billing, baseURL)
+	created, err := apiClient.CreateSubscription(ctx, request)
+	if err != nil {
+		utilsInstance.LogError("Failed to create subscription for plan change", err.Error())
+		return fmt.Errorf("Failed to create subscription: %w", err)
+	}
+
+	// 2. Cancel the old plan, or undo the new subscription
+	if err := apiClient.CancelSubscription(ctx, tapsilat.SubscriptionCancelRequest{
+		ReferenceID:    sub.ReferenceID,
+		SubscriptionID: sub.ReferenceID,
+	}); err != nil {
+		utilsInstance.LogError("Failed to cancel subscription for plan change", err.Error())
+		if rbErr := apiClient.CancelSubscription(context.WithoutCancel(ctx), tapsilat.SubscriptionCancelRequest{
+			ReferenceID:    created.ReferenceID,
+			SubscriptionID: created.ReferenceID,
+		}); rbErr != nil {
+			utilsInstance.LogError("Failed to cancel new subscription after failed plan change", map[string]interface{}{
+				"reference_id": created.ReferenceID,
+				"error":        rbErr.Error(),
+			})
+		}
+		return fmt.Errorf("Failed to cancel current subscription: %w", err)
+	}
+
+	if created.OrderReferenceID != "" {
+		if url, err := apiClient.GetCheckoutURL(ctx, created.OrderReferenceID); err == nil {
+			resp.SubscriptionCheckoutURL = url
+		}
+	}
+
+	replaced, err := subscriptionStore.Replace(sub.ReferenceID, subscriptions.Subscription{
+		ReferenceID:      created.ReferenceID,
+		OrderReferenceID: created.OrderReferenceID,
+	}, next, p, time.Now())
+	if err != nil {
+		utilsInstance.LogError("Failed to store plan change", map[string]interface{}{
+			"from":  sub.ReferenceID,
+			"to":    created.ReferenceID,
+			"error": err.Error(),
+		})
+	}
+
+	resp.ReferenceID = created.ReferenceID
+	if replaced.LogicalID != "" {
+		resp.LogicalID = replaced.LogicalID
+	}
+	return nil
+}
+
+// completePlanChange applies the plan change that was waiting for a proration order
+// once the order is paid. The change stays on the subscription until it is applied or
+// the payment is refunded, so a failed attempt can be retried.
+func completePlanChange(orderReferenceID string) error {
+	sub, change, ok, err := subscriptionStore.ClaimPendingChange(orderReferenceID, time.Now())
+	if err != nil {
+		utilsInstance.LogError("Failed to claim pending plan change", map[string]interface{}{
+			"order_reference_id": orderReferenceID,
+			"error":              err.Error(),
+		})
+		return err
+	}
+	if !ok {
+		return nil
+	}
+
+	ctx := context.Background()
+	apiClient, err := getAPIClient()
+	if err == nil {
+		// The subscription may have been paused or ended while the order was open; the
+		// payment is refunded instead
+		if sub.Status != subscriptions.StatusActive && sub.Status != subscriptions.StatusPastDue {
+			if _, err = apiClient.RefundAllOrder(ctx, orderReferenceID); err != nil {
+				err = fmt.Errorf("subscription is %s and the refund failed: %w", sub.Status, err)
+			} else {
+				_, _, _, err = subscriptionStore.TakePendingChange(orderReferenceID, "plan_change_refunded", time.Now())
+				return err
+			}
+		} else {
+			var resp SubscriptionChangeResponse
+			if err = applyPlanChange(ctx, apiClient, sub, change.Plan, change.Proration, change.BaseURL, &resp); err == nil {
+				_, _, _, err = subscriptionStore.TakePendingChange(orderReferenceID, "plan_change_applied", time.Now())
+				return err
+			}
+		}
+	}
+
+	utilsInstance.LogError("Failed to complete paid plan change", map[string]interface{}{
+		"subscription":       sub.ReferenceID,
+		"order_reference_id": orderReferenceID,
+		"error":              err.Error(),
+	})
+	if failErr := subscriptionStore.FailPendingChange(orderReferenceID, err.Error(), time.Now()); failErr != nil {
+		utilsInstance.LogError("Failed to record plan change failure", failErr.Error())
+	}
+	return err
+}
+
+// retryPlanChangeHandler tries again to apply, or refund, a paid plan change that failed
+func retryPlanChangeHandler(c *gin.Context) {
+	sub, ok := subscriptionStore.Get(c.Param("reference_id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+		return
+	}
+	if sub.PendingChange == nil || sub.PendingChange.PaidAt.IsZero() {
+		c.JSON(http.StatusConflict, gin.H{"error": "No paid plan change is waiting"})
+		return
+	}
+	if err := completePlanChange(sub.PendingChange.OrderReferenceID); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	sub, _ = subscriptionStore.Get(sub.ReferenceID)
+	c.JSON(http.StatusOK, sub)
+}
+
+// dropPlanChange forgets the plan change of a proration order that failed, was
+// cancelled or was never paid
+func dropPlanChange(orderReferenceID string) {
+	if _, err := subscriptionStore.DropPendingChange(orderReferenceID, time.Now()); err != nil {
+		utilsInstance.LogError("Failed to drop pending plan change", map[string]interface{}{
+			"order_reference_id": orderReferenceID,
+			"error":              err.Error(),
+		})
+	}
+}
+
+// cancelProrationOrder cancels a proration order whose plan change will not happen
+func cancelProrationOrder(ctx context.Context, apiClient *tapsilat.API, referenceID string) {
+	if _, err := apiClient.CancelOrder(ctx, tapsilat.CancelOrder{ReferenceID: referenceID}); err != nil {
+		utilsInstance.LogError("Failed to cancel proration order", map[string]interface{}{
+			"reference_id": referenceID,
+			"error":        err.Error(),
+		})
+	}
+}
+
+// subscriptionBilling returns the address a new subscription is billed to: the billing
+// address sent with the request, or the subscriber's default billing address when the
+// request carries their X-Customer-Token. A stored address is never used for a subscriber
+// the request has not proven.
+func subscriptionBilling(c *gin.Context, req SubscriptionRequest) (Address, int, error) {
+	if req.Billing != nil {
+		return *req.Billing, http.StatusOK, nil
+	}
+	customer, found := customerStore.Find(req.SubscriberEmail, req.SubscriberPhone)
+	if !found || cartCustomer(c) != customer.ID {
+		return Address{}, http.StatusBadRequest, fmt.Errorf("billing is required, or send the subscriber's %s to use their default billing address", customerHeader)
+	}
+	_, billing, err := subscriberBilling(req.SubscriberEmail, req.SubscriberPhone)
+	if err != nil {
+		return Address{}, http.StatusBadRequest, err
+	}
+	return billing, http.StatusOK, nil
+}
+
+// rememberSubscriptionBilling adds the billing address of a subscription request to the
+// subscriber's address book, on the same terms as an order's addresses (see orderBuyer)
+func rememberSubscriptionBilling(c *gin.Context, req SubscriptionRequest) {
+	customerID, ownAddressBook := orderBuyer(c, req.SubscriberEmail, req.SubscriberPhone, req.Billing.ContactName)
+	if !ownAddressBook {
+		return
+	}
+	if err := customerStore.Remember(customerID, addressBookEntry(*req.Billing), customers.KindBilling); err != nil {
+		utilsInstance.LogError("Failed to remember customer address", map[string]interface{}{
+			"customer_id": customerID,
+			"error":       err.Error(),
+		})
+	}
+}
+
+// subscriberBilling returns the subscriber's customer record and default billing address,
+// which plan changes, resumes and proration orders are billed to. The address must carry
+// the identity or tax number the gateway needs.
+func subscriberBilling(email, phone string) (customers.Customer, Address, error) {
+	customer, ok := customerStore.Find(email, phone)
+	if !ok {
+		return customers.Customer{}, Address{}, fmt.Errorf("Subscriber is not a known customer, add a billing address first")
+	}
+	for _, a := range customer.Addresses {
+		if !a.DefaultBilling {
+			continue
+		}
+		if a.VatNumber == "" {
+			return customers.Customer{}, Address{}, fmt.Errorf("Subscriber's default billing address has no identity or tax number")
+		}
+		return customer, orderAddress(customer, a), nil
+	}
+	return customers.Customer{}, Address{}, fmt.Errorf("Subscriber has no default billing address")
+}
+
+// createProrationOrder creates the one-off order for the amount due on a plan change
+func createProrationOrder(ctx context.Context, apiClient *tapsilat.API, sub subscriptions.Subscription, customer customers.Customer, billing Address, plan subscriptions.Plan, p subscriptions.Proration, baseURL string) (string, string, error) {
+	quantity := 1
+	country := gatewayCountry(sub.Country)
+	order := tapsilat.Order{
+		Locale:            "en",
+		Currency:          p.Currency,
+		Amount:            p.AmountDue,
+		ConversationID:    generateConversationID(),
+		PaymentSuccessUrl: fmt.Sprintf("%s/payment/success", baseURL),
+		PaymentFailureUrl: fmt.Sprintf("%s/payment/failure", baseURL),
+		Buyer: tapsilat.OrderBuyer{
+			Id:                  customer.ID,
+			Name:                extractFirstName(billing.ContactName),
+			Surname:             extractLastName(billing.ContactName),
+			Email:               sub.SubscriberEmail,
+			GsmNumber:           sub.SubscriberPhone,
+			IdentityNumber:      billing.VatNumber,
+			RegistrationAddress: billing.Address,
+			City:                billing.City,
+			Country:             country,
+			ZipCode:             getZipCode(billing.ZipCode),
+			Ip:                  "127.0.0.1",
+		},
+		BillingAddress: tapsilat.OrderBillingAddress{
+			ContactName: billing.ContactName,
+			City:        billing.City,
+			Country:     country,
+			Address:     billing.Address,
+			ZipCode:     getZipCode(billing.ZipCode),
+			VatNumber:   billing.VatNumber,
+		},
+		ShippingAddress: tapsilat.OrderShippingAddress{
+			ContactName: billing.ContactName,
+			City:        billing.City,
+			Country:     country,
+			Address:     billing.Address,
+			ZipCode:     getZipCode(billing.ZipCode),
+		},
+		BasketItems: []tapsilat.OrderBasketItem{{
+			Id:        "PRORATION-" + strings.ToUpper(plan.ID),
+			Name:      fmt.Sprintf("%s until %s", plan.Name, p.NextPaymentAt.Format("2006-01-02")),
+			Price:     p.AmountDue,
+			Quantity:  &quantity,
+			Category1: "Subscription",
+			Category2: "",
+			ItemType:  "VIRTUAL",
+		}},
+		Metadata: []tapsilat.OrderMetadata{
+			{Key: "subscription_logical_id", Value: sub.LogicalID},
+			{Key: "subscription_reference_id", Value: sub.ReferenceID},
+			{Key: "from_plan", Value: p.FromPlanID},
+			{Key: "to_plan", Value: p.ToPlanID},
+			{Key: "proration_credit", Value: strconv.FormatFloat(p.Credit, 'f', 2, 64)},
+		},
+	}
+
+	response, err := apiClient.CreateOrder(ctx, order)
+	if err != nil {
+		return "", "", err
+	}
+	checkoutURL, err := apiClient.GetCheckoutURL(ctx, response.ReferenceID)
+	if err != nil {
+		log.Printf("Warning: Failed to get checkout URL: %v", err)
+	}
+
+	if err := orderStore.Create(orders.Record{
+		ReferenceID:    response.ReferenceID,
+		ConversationID: order.ConversationID,
+		Amount:         p.AmountDue,
+		Net:            p.AmountDue,
+		Gross:          p.AmountDue,
+		Currency:       p.Currency,
+		BuyerEmail:     sub.SubscriberEmail,
+		CustomerID:     order.Buyer.Id,
+	}); err != nil {
+		utilsInstance.LogError("Failed to store local order", map[string]interface{}{
+			"reference_id": response.ReferenceID,
+			"error":        err.Error(),
+		})
+	}
+	return response.ReferenceID, checkoutURL, nil
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"tapsilat-go-example/subscriptions"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tapsilat/tapsilat-go"
+)
+
+// SubscriptionPauseRequest pauses a subscription, optionally until a date (YYYY-MM-DD)
+type SubscriptionPauseRequest struct {
+	SubscriptionID string `json:"subscription_id" binding:"required"`
+	ResumeAt       string `json:"resume_at,omitempty"`
+}
+
+// SubscriptionResumeResponse describes how a subscription continues after a pause
+type SubscriptionResumeResponse struct {
+	Success     bool                     `json:"success"`
+	LogicalID   string                   `json:"logical_id,omitempty"`
+	ReferenceID string                   `json:"reference_id,omitempty"` // the new gateway subscription
+	Resumption  subscriptions.Resumption `json:"resumption"`
+	CheckoutURL string                   `json:"checkout_url,omitempty"`
+	Error       string                   `json:"error,omitempty"`
+}
+
+// pauseSubscriptionHandler stops billing by cancelling the gateway subscription and records the pause
+func pauseSubscriptionHandler(c *gin.Context) {
+	var req SubscriptionPauseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sub, status, err := subscriberSubscription(c, req.SubscriptionID)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	var resumeAt time.Time
+	if req.ResumeAt != "" {
+		var err error
+		if resumeAt, err = time.Parse("2006-01-02", req.ResumeAt); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "resume_at must be YYYY-MM-DD"})
+			return
+		}
+	}
+	now := time.Now()
+	if err := subscriptions.CanPause(sub, resumeAt, now); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	apiClient, err := getAPIClient()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	// The pause is recorded first so a failed write never leaves a subscription cancelled
+	// at the gateway but active here
+	paused, err := subscriptionStore.Pause(sub.ReferenceID, resumeAt, now)
+	if err != nil {
+		utilsInstance.LogError("Failed to store subscription pause", map[string]interface{}{
+			"reference_id": sub.ReferenceID,
+			"error":        err.Error(),
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The gateway has no pause, so billing stops by cancelling; resuming creates a new subscription
+	if err := apiClient.CancelSubscription(c.Request.Context(), tapsilat.SubscriptionCancelRequest{
+		ReferenceID:    sub.ReferenceID,
+		SubscriptionID: sub.ReferenceID,
+	}); err != nil {
+		utilsInstance.LogError("Failed to cancel subscription for pause", err.Error())
+		if undoErr := subscriptionStore.UndoPause(sub.ReferenceID, err.Error(), time.Now()); undoErr != nil {
+			utilsInstance.LogError("Failed to undo subscription pause", map[string]interface{}{
+				"reference_id": sub.ReferenceID,
+				"error":        undoErr.Error(),
+			})
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to pause subscription: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, paused)
+}
+
+// resumeSubscriptionHandler resumes a paused subscription now
+func resumeSubscriptionHandler(c *gin.Context) {
+	var req struct {
+		SubscriptionID string `json:"subscription_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sub, status, err := subscriberSubscription(c, req.SubscriptionID)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	if sub.BaseURL == "" {
+		sub.BaseURL = getBaseURL(c.Request)
+	}
+
+	resp, status := resumeSubscription(c.Request.Context(), sub, time.Now())
+	c.JSON(status, resp)
+}
+
+// resumeSubscription creates the gateway subscription that continues a paused one
+func resumeSubscription(ctx context.Context, sub subscriptions.Subscription, now time.Time) (SubscriptionResumeResponse, int) {
+	resp := SubscriptionResumeResponse{LogicalID: sub.LogicalID}
+
+	res, err := subscriptions.PlanResume(sub, now)
+	if err != nil {
+		resp.Error = err.Error()
+		return resp, http.StatusBadRequest
+	}
+	resp.Resumption = res
+
+	apiClient, err := getAPIClient()
+	if err != nil {
+		resp.Error = "Internal server error"
+		return resp, http.StatusInternalServerError
+	}
+
+	// Claim the resume so a request and the auto-resumer never both create a subscription
+	if err := subscriptionStore.ClaimResume(sub.ReferenceID, now); err != nil {
+		resp.Error = err.Error()
+		return resp, http.StatusConflict
+	}
+	release := func(reason string) {
+		if err := subscriptionStore.ReleaseResume(sub.ReferenceID, reason, time.Now()); err != nil {
+			utilsInstance.LogError("Failed to release subscription resume", map[string]interface{}{
+				"reference_id": sub.ReferenceID,
+				"error":        err.Error(),
+			})
+		}
+	}
+
+	plan := sub.Plan
+	plan.PaymentDay = res.PaymentDay
+	plan.Cycle = res.Cycles
+	_, billing, err := subscriberBilling(sub.SubscriberEmail, sub.SubscriberPhone)
+	if err != nil {
+		release(err.Error())
+		resp.Error = "Failed to resume subscription: " + err.Error()
+		return resp, http.StatusBadRequest
+	}
+	request := createTapsilatSubscription(SubscriptionRequest{
+		SubscriberEmail: sub.SubscriberEmail,
+		SubscriberPhone: sub.SubscriberPhone,
+		Country:         sub.Country,
+		CardID:          sub.CardID,
+	}, plan, billing, sub.BaseURL)
+	created, err := apiClient.CreateSubscription(ctx, request)
+	if err != nil {
+		utilsInstance.LogError("Failed to create subscription for resume", err.Error())
+		release(err.Error())
+		resp.Error = "Failed to resume subscription: " + err.Error()
+		return resp, http.StatusBadGateway
+	}
+
+	if _, err := subscriptionStore.Resume(sub.ReferenceID, subscriptions.Subscription{
+		ReferenceID:      created.ReferenceID,
+		OrderReferenceID: created.OrderReferenceID,
+		BaseURL:          sub.BaseURL,
+	}, res); err != nil {
+		utilsInstance.LogError("Failed to store subscription resume", map[string]interface{}{
+			"from":  sub.ReferenceID,
+			"to":    created.ReferenceID,
+			"error": err.Error(),
+		})
+		// Without a local record nothing tracks the new subscription, so undo it
+		if cancelErr := apiClient.CancelSubscription(context.WithoutCancel(ctx), tapsilat.SubscriptionCancelRequest{
+			ReferenceID:    created.ReferenceID,
+			SubscriptionID: created.ReferenceID,
+		}); cancelErr != nil {
+			utilsInstance.LogError("Failed to cancel new subscription after failed resume", map[string]interface{}{
+				"reference_id": created.ReferenceID,
+				"error":        cancelErr.Error(),
+			})
+		}
+		release(err.Error())
+		resp.Error = "Failed to resume subscription: " + err.Error()
+		return resp, http.StatusInternalServerError
+	}
+
+	if created.OrderReferenceID != "" {
+		if url, err := apiClient.GetCheckoutURL(ctx, created.OrderReferenceID); err == nil {
+			resp.CheckoutURL = url
+		}
+	}
+	resp.Success = true
+	resp.ReferenceID = created.ReferenceID
+	return resp, http.StatusOK
+}
+
+// startSubscriptionResumer resumes paused subscriptions on their scheduled date unless
+// disabled via SUBSCRIPTION_AUTO_RESUME=false
+func startSubscriptionResumer() {
+	if os.Getenv("SUBSCRIPTION_AUTO_RESUME") == "false" {
+		log.Println("Subscription auto-resume disabled")
+		return
+	}
+	interval := getEnvDuration("SUBSCRIPTION_RESUME_INTERVAL", time.Hour)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			for _, sub := range subscriptionStore.DueResumes(time.Now()) {
+				resp, _ := resumeSubscription(context.Background(), sub, time.Now())
+				if !resp.Success {
+					log.Printf("Auto-resume of subscription %s failed: %s", sub.ReferenceID, resp.Error)
+					continue
+				}
+				log.Printf("Subscription %s resumed as %s", sub.ReferenceID, resp.ReferenceID)
+			}
+			<-ticker.C
+		}
+	}()
+	log.Printf("Subscription auto-resume started (interval %s)", interval)
+}
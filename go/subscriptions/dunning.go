@@ -0,0 +1,304 @@
+package subscriptions
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Gateway is what dunning needs from the payment gateway
+type Gateway interface {
+	// PaymentLink returns a fresh link the subscriber can pay the failed renewal with
+	PaymentLink(ctx context.Context, sub Subscription) (string, error)
+	// Paid reports whether the failed renewal has been paid in the meantime
+	Paid(ctx context.Context, sub Subscription) (bool, error)
+	// Cancel cancels the subscription
+	Cancel(ctx context.Context, sub Subscription) error
+}
+
+// Notifier emails the subscriber about a dunning event such as subscription_past_due or
+// subscription_cancelled. data holds the details of the event for its template.
+type Notifier interface {
+	NotifySubscription(ctx context.Context, event string, sub Subscription, data map[string]interface{}) error
+}
+
+// DunningConfig controls the retry schedule
+type DunningConfig struct {
+	Interval  time.Duration // how often due retries are checked
+	RetryDays []int         // days after the first failure for each retry; cancelled after the last one
+}
+
+// DefaultDunningConfig retries 1, 3 and 7 days after the failure
+func DefaultDunningConfig() DunningConfig {
+	return DunningConfig{
+		Interval:  time.Hour,
+		RetryDays: []int{1, 3, 7},
+	}
+}
+
+// DunningStats describes the dunning state
+type DunningStats struct {
+	Running   bool      `json:"running"`
+	PastDue   int       `json:"past_due"`
+	Failures  int       `json:"failures"`
+	Retries   int       `json:"retries"`
+	Recovered int       `json:"recovered"`
+	Cancelled int       `json:"cancelled"`
+	Errors    int       `json:"errors"`
+	LastRunAt time.Time `json:"last_run_at,omitempty"`
+}
+
+// Dunner chases failed renewals until they are paid or the subscription is cancelled
+type Dunner struct {
+	cfg      DunningConfig
+	registry *Registry
+	gateway  Gateway
+	notifier Notifier
+
+	mu    sync.Mutex
+	stats DunningStats
+	run   sync.Mutex // held during a pass so passes never overlap
+}
+
+// NewDunner creates a Dunner
+func NewDunner(cfg DunningConfig, registry *Registry, gateway Gateway, notifier Notifier) *Dunner {
+	return &Dunner{
+		cfg:      cfg,
+		registry: registry,
+		gateway:  gateway,
+		notifier: notifier,
+	}
+}
+
+// Fail records a failed renewal. The first failure makes the subscription past due and
+// schedules the retries; later failures while past due are only recorded. The renewal
+// order is required, as the payment link and the retries are about that order.
+func (d *Dunner) Fail(ctx context.Context, referenceID, renewalReferenceID, reason string, now time.Time) error {
+	if renewalReferenceID == "" {
+		return fmt.Errorf("renewal order reference is required")
+	}
+	first := false
+	sub, err := d.registry.Update(referenceID, func(sub *Subscription) {
+		// Paused, replaced and cancelled subscriptions are not billed any more
+		if sub.Status != StatusActive && sub.Status != StatusPastDue {
+			return
+		}
+		sub.record("renewal_failed", reason, now)
+		sub.RenewalReference = renewalReferenceID
+		if sub.Status == StatusPastDue {
+			return
+		}
+		first = true
+		sub.Status = StatusPastDue
+		sub.PastDueSince = now
+		sub.RetryAttempts = 0
+		sub.NextRetryAt = d.retryAt(now, 0)
+	})
+	if err != nil {
+		return err
+	}
+	if !first {
+		return nil
+	}
+
+	d.mu.Lock()
+	d.stats.Failures++
+	d.mu.Unlock()
+	d.notifyPastDue(ctx, sub, now)
+	return nil
+}
+
+// Recover marks a past due subscription active again
+func (d *Dunner) Recover(referenceID, source string, now time.Time) error {
+	recovered := false
+	_, err := d.registry.Update(referenceID, func(sub *Subscription) {
+		if sub.Status != StatusPastDue {
+			return
+		}
+		recovered = true
+		sub.Status = StatusActive
+		sub.PastDueSince = time.Time{}
+		sub.RetryAttempts = 0
+		sub.NextRetryAt = time.Time{}
+		sub.record("recovered", source, now)
+	})
+	if err == nil && recovered {
+		d.mu.Lock()
+		d.stats.Recovered++
+		d.mu.Unlock()
+	}
+	return err
+}
+
+// PastDue returns the past due subscriptions
+func (d *Dunner) PastDue() []Subscription {
+	list := make([]Subscription, 0)
+	for _, sub := range d.registry.List() {
+		if sub.Status == StatusPastDue {
+			list = append(list, sub)
+		}
+	}
+	return list
+}
+
+// Start runs the retries until ctx is cancelled
+func (d *Dunner) Start(ctx context.Context) {
+	d.mu.Lock()
+	d.stats.Running = true
+	d.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(d.cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			d.RunOnce(ctx, time.Now())
+			select {
+			case <-ctx.Done():
+				d.mu.Lock()
+				d.stats.Running = false
+				d.mu.Unlock()
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RunOnce runs every retry that is due. Passes never overlap: it returns false without
+// retrying anything when another pass is running.
+func (d *Dunner) RunOnce(ctx context.Context, now time.Time) bool {
+	if !d.run.TryLock() {
+		return false
+	}
+	defer d.run.Unlock()
+
+	for _, sub := range d.PastDue() {
+		if ctx.Err() != nil {
+			return true
+		}
+		if !sub.NextRetryAt.After(now) {
+			d.retry(ctx, sub, now)
+		}
+	}
+
+	d.mu.Lock()
+	d.stats.LastRunAt = now
+	d.mu.Unlock()
+	return true
+}
+
+// Stats returns the dunning counters
+func (d *Dunner) Stats() DunningStats {
+	d.mu.Lock()
+	stats := d.stats
+	d.mu.Unlock()
+	stats.PastDue = len(d.PastDue())
+	return stats
+}
+
+// retry checks whether the renewal was paid; if not it sends a new link, or cancels after the last retry
+func (d *Dunner) retry(ctx context.Context, sub Subscription, now time.Time) {
+	attempt := sub.RetryAttempts + 1
+	d.mu.Lock()
+	d.stats.Retries++
+	d.mu.Unlock()
+
+	paid, err := d.gateway.Paid(ctx, sub)
+	if err != nil {
+		d.countError()
+		log.Printf("Dunning: failed to check subscription %s: %v", sub.ReferenceID, err)
+		// Unknown is not unpaid: keep the attempt for the next run
+		return
+	}
+	if paid {
+		if err := d.Recover(sub.ReferenceID, fmt.Sprintf("paid before retry %d", attempt), now); err != nil {
+			d.countError()
+		}
+		return
+	}
+
+	if attempt < len(d.cfg.RetryDays) {
+		sub, err = d.registry.Update(sub.ReferenceID, func(s *Subscription) {
+			s.RetryAttempts = attempt
+			s.NextRetryAt = d.retryAt(s.PastDueSince, attempt)
+			s.record("retry", fmt.Sprintf("attempt %d of %d", attempt, len(d.cfg.RetryDays)), now)
+		})
+		if err != nil {
+			d.countError()
+			return
+		}
+		d.notifyPastDue(ctx, sub, now)
+		return
+	}
+
+	// The last retry failed too
+	if err := d.gateway.Cancel(ctx, sub); err != nil {
+		d.countError()
+		log.Printf("Dunning: failed to cancel subscription %s: %v", sub.ReferenceID, err)
+		// Try again on the next run
+		d.registry.Update(sub.ReferenceID, func(s *Subscription) {
+			s.record("cancel_failed", err.Error(), now)
+		})
+		return
+	}
+	sub, err = d.registry.Update(sub.ReferenceID, func(s *Subscription) {
+		s.RetryAttempts = attempt
+		s.NextRetryAt = time.Time{}
+		s.Status = StatusCancelled
+		s.record("cancelled", fmt.Sprintf("unpaid after %d retries", attempt), now)
+	})
+	if err != nil {
+		d.countError()
+		return
+	}
+	d.mu.Lock()
+	d.stats.Cancelled++
+	d.mu.Unlock()
+	d.send(ctx, sub, "subscription_cancelled", map[string]interface{}{
+		"Reason": fmt.Sprintf("unpaid after %d retries", attempt),
+	}, now)
+}
+
+// retryAt returns when retry number attempt (0 based) is due
+func (d *Dunner) retryAt(since time.Time, attempt int) time.Time {
+	if attempt >= len(d.cfg.RetryDays) {
+		return since
+	}
+	return since.AddDate(0, 0, d.cfg.RetryDays[attempt])
+}
+
+// notifyPastDue sends the subscriber a fresh payment link
+func (d *Dunner) notifyPastDue(ctx context.Context, sub Subscription, now time.Time) {
+	link, err := d.gateway.PaymentLink(ctx, sub)
+	if err != nil {
+		d.countError()
+		log.Printf("Dunning: failed to get a payment link for %s: %v", sub.ReferenceID, err)
+	}
+
+	d.send(ctx, sub, "subscription_past_due", map[string]interface{}{"PaymentLink": link}, now)
+}
+
+func (d *Dunner) send(ctx context.Context, sub Subscription, event string, data map[string]interface{}, now time.Time) {
+	if d.notifier == nil {
+		return
+	}
+	err := d.notifier.NotifySubscription(ctx, event, sub, data)
+	detail := event
+	if err != nil {
+		d.countError()
+		log.Printf("Dunning: failed to send %s for %s: %v", event, sub.ReferenceID, err)
+		detail += " failed: " + err.Error()
+	}
+	d.registry.Update(sub.ReferenceID, func(s *Subscription) {
+		s.record("notified", detail, now)
+	})
+}
+
+func (d *Dunner) countError() {
+	d.mu.Lock()
+	d.stats.Errors++
+	d.mu.Unlock()
+}
@@ -0,0 +1,196 @@
+package subscriptions
+
+import (
+	"fmt"
+	"time"
+)
+
+// Pause is an interval during which a subscription is not billed
+type Pause struct {
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to,omitempty"`        // zero while paused
+	ResumeAt time.Time `json:"resume_at,omitempty"` // scheduled automatic resume
+}
+
+// Resumption is how a paused subscription continues
+type Resumption struct {
+	ResumedAt     time.Time `json:"resumed_at"`
+	DeferredDays  int       `json:"deferred_days"` // paid days left when paused
+	StartsAt      time.Time `json:"starts_at"`     // first charge after the pause
+	PaymentDay    int       `json:"payment_day"`
+	Cycles        int       `json:"cycles"` // charges left
+	PrepaidAmount float64   `json:"prepaid_amount"`
+}
+
+// ChargesUntil counts the charges made from the start of billing up to and including t
+func ChargesUntil(sub Subscription, t time.Time) int {
+	start := dateOnly(sub.BillingStartsAt)
+	t = dateOnly(t)
+	charges := 0
+	for k := 0; ; k++ {
+		at := start
+		if k > 0 {
+			at = onDay(start.Year(), start.Month()+time.Month(k*sub.Plan.Period), sub.Plan.PaymentDay)
+		}
+		if at.After(t) {
+			return charges
+		}
+		charges++
+	}
+}
+
+// CurrentPause returns the open pause of a paused subscription
+func CurrentPause(sub Subscription) (Pause, bool) {
+	if sub.Status != StatusPaused || len(sub.Pauses) == 0 {
+		return Pause{}, false
+	}
+	p := sub.Pauses[len(sub.Pauses)-1]
+	return p, p.To.IsZero()
+}
+
+// PlanResume works out how a paused subscription continues at now. The paid days that were
+// left when it was paused are given back: the first charge moves that many days past now,
+// and only the charges not made before the pause remain.
+func PlanResume(sub Subscription, now time.Time) (Resumption, error) {
+	pause, ok := CurrentPause(sub)
+	if !ok {
+		return Resumption{}, fmt.Errorf("subscription is not paused")
+	}
+
+	period := CurrentPeriod(sub, pause.From)
+	deferred := days(dateOnly(pause.From), period.End)
+	if deferred < 0 {
+		deferred = 0
+	}
+	cycles := sub.Plan.Cycle - ChargesUntil(sub, pause.From)
+	if cycles < 1 {
+		return Resumption{}, fmt.Errorf("subscription has no charges left")
+	}
+
+	r := Resumption{
+		ResumedAt:    now,
+		DeferredDays: deferred,
+		StartsAt:     dateOnly(now).AddDate(0, 0, deferred),
+		Cycles:       cycles,
+	}
+	if total := days(period.Start, period.End); total > 0 {
+		r.PrepaidAmount = round(period.Paid * float64(deferred) / float64(total))
+	}
+	// The gateway takes a day of month; every month has a 28th
+	r.PaymentDay = r.StartsAt.Day()
+	if r.PaymentDay > 28 {
+		r.PaymentDay = 28
+	}
+	return r, nil
+}
+
+// CanPause reports why sub cannot be paused at now, if it cannot
+func CanPause(sub Subscription, resumeAt, now time.Time) error {
+	if sub.Status != StatusActive {
+		return fmt.Errorf("only active subscriptions can be paused, this one is %s", sub.Status)
+	}
+	if sub.PendingChange != nil {
+		// Pausing would cancel the gateway subscription the change replaces
+		return fmt.Errorf("a plan change is waiting for order %s, cancel that order or let the change complete first", sub.PendingChange.OrderReferenceID)
+	}
+	if !resumeAt.IsZero() && !resumeAt.After(now) {
+		return fmt.Errorf("resume date must be in the future")
+	}
+	if ChargesUntil(sub, now) >= sub.Plan.Cycle {
+		return fmt.Errorf("subscription has no charges left")
+	}
+	return nil
+}
+
+// Pause marks a subscription paused from now, optionally resuming automatically at resumeAt
+func (r *Registry) Pause(referenceID string, resumeAt, now time.Time) (Subscription, error) {
+	var err error
+	sub, updateErr := r.Update(referenceID, func(sub *Subscription) {
+		if err = CanPause(*sub, resumeAt, now); err != nil {
+			return
+		}
+		sub.Status = StatusPaused
+		sub.Pauses = append(sub.Pauses, Pause{From: now, ResumeAt: resumeAt})
+		detail := "until resumed"
+		if !resumeAt.IsZero() {
+			detail = "until " + resumeAt.Format("2006-01-02")
+		}
+		sub.record("paused", detail, now)
+	})
+	if updateErr != nil {
+		return Subscription{}, updateErr
+	}
+	return sub, err
+}
+
+// UndoPause reopens a subscription whose pause could not be applied at the gateway
+func (r *Registry) UndoPause(referenceID, reason string, now time.Time) error {
+	_, err := r.Update(referenceID, func(sub *Subscription) {
+		if _, ok := CurrentPause(*sub); !ok {
+			return
+		}
+		sub.Status = StatusActive
+		sub.Pauses = sub.Pauses[:len(sub.Pauses)-1]
+		sub.record("pause_failed", reason, now)
+	})
+	return err
+}
+
+// ClaimResume marks a paused subscription as resuming, so only one caller creates the
+// gateway subscription that continues it. It fails when the subscription is not paused.
+func (r *Registry) ClaimResume(referenceID string, now time.Time) error {
+	var err error
+	_, updateErr := r.Update(referenceID, func(sub *Subscription) {
+		if _, ok := CurrentPause(*sub); !ok {
+			err = fmt.Errorf("subscription is not paused")
+			return
+		}
+		sub.Status = StatusResuming
+		sub.record("resuming", "", now)
+	})
+	if updateErr != nil {
+		return updateErr
+	}
+	return err
+}
+
+// ReleaseResume puts a subscription whose resume failed back to paused
+func (r *Registry) ReleaseResume(referenceID, reason string, now time.Time) error {
+	_, err := r.Update(referenceID, func(sub *Subscription) {
+		if sub.Status == StatusResuming {
+			sub.Status = StatusPaused
+			sub.record("resume_failed", reason, now)
+		}
+	})
+	return err
+}
+
+// Resume stores next as the continuation of the subscription at referenceID, claimed with
+// ClaimResume
+func (r *Registry) Resume(referenceID string, next Subscription, res Resumption) (Subscription, error) {
+	detail := fmt.Sprintf("first charge %s, %d charges left", res.StartsAt.Format("2006-01-02"), res.Cycles)
+
+	return r.supersede(referenceID, next, res.ResumedAt, func(prev, next *Subscription) {
+		prev.record("resumed", detail, res.ResumedAt)
+		if n := len(prev.Pauses); n > 0 {
+			prev.Pauses[n-1].To = res.ResumedAt
+			next.Pauses[n-1].To = res.ResumedAt
+		}
+		next.Plan.PaymentDay = res.PaymentDay
+		next.Plan.Cycle = res.Cycles
+		next.BillingStartsAt = res.StartsAt
+		next.PrepaidAmount = res.PrepaidAmount
+		next.record("created", "resumed from "+prev.ReferenceID+": "+detail, res.ResumedAt)
+	})
+}
+
+// DueResumes returns the paused subscriptions whose scheduled resume date has come
+func (r *Registry) DueResumes(now time.Time) []Subscription {
+	var due []Subscription
+	for _, sub := range r.List() {
+		if pause, ok := CurrentPause(sub); ok && !pause.ResumeAt.IsZero() && !pause.ResumeAt.After(now) {
+			due = append(due, sub)
+		}
+	}
+	return due
+}
@@ -0,0 +1,159 @@
+package subscriptions
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"tapsilat-go-example/store"
+)
+
+// Plan is a named subscription offer
+type Plan struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Price       float64   `json:"price"`
+	Currency    string    `json:"currency"`
+	Period      int       `json:"period"`      // months between charges, 1: monthly, 12: yearly
+	Cycle       int       `json:"cycle"`       // number of charges
+	TrialDays   int       `json:"trial_days"`  // must be 0, Tapsilat subscriptions have no trial
+	PaymentDay  int       `json:"payment_day"` // day of month the charge is taken
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// DefaultPlans is the catalog used until plans are configured
+func DefaultPlans() map[string]*Plan {
+	return map[string]*Plan{
+		"gold-monthly": {
+			ID:         "gold-monthly",
+			Name:       "Gold Plan",
+			Price:      49.90,
+			Currency:   "TRY",
+			Period:     1,
+			Cycle:      12,
+			PaymentDay: 1,
+			Active:     true,
+		},
+		"gold-yearly": {
+			ID:         "gold-yearly",
+			Name:       "Gold Plan (Yearly)",
+			Price:      499.00,
+			Currency:   "TRY",
+			Period:     12,
+			Cycle:      1,
+			PaymentDay: 1,
+			Active:     true,
+		},
+	}
+}
+
+// Catalog keeps the subscription plans
+type Catalog struct {
+	mu    sync.RWMutex
+	file  *store.JSONFile
+	plans map[string]*Plan
+}
+
+// NewCatalog loads the plan catalog from path. The default plans are only used
+// until the catalog is first saved, so deleted defaults stay deleted.
+func NewCatalog(path string) (*Catalog, error) {
+	c := &Catalog{file: store.NewJSONFile(path)}
+	if err := c.file.Load(&c.plans); err != nil {
+		return nil, err
+	}
+	if c.plans == nil {
+		c.plans = DefaultPlans()
+	}
+	return c, nil
+}
+
+// List returns the plans ordered by id, only the active ones unless all is set
+func (c *Catalog) List(all bool) []Plan {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	list := make([]Plan, 0, len(c.plans))
+	for _, p := range c.plans {
+		if all || p.Active {
+			list = append(list, *p)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// Get returns a plan by id
+func (c *Catalog) Get(id string) (Plan, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	p, ok := c.plans[id]
+	if !ok {
+		return Plan{}, false
+	}
+	return *p, true
+}
+
+// Save validates and creates or replaces a plan
+func (c *Catalog) Save(p Plan) (Plan, error) {
+	p.ID = strings.ToLower(strings.TrimSpace(p.ID))
+	p.Currency = strings.ToUpper(strings.TrimSpace(p.Currency))
+	if p.ID == "" || p.Name == "" {
+		return Plan{}, fmt.Errorf("id and name are required")
+	}
+	if p.Price <= 0 {
+		return Plan{}, fmt.Errorf("price must be positive")
+	}
+	if p.Currency == "" {
+		return Plan{}, fmt.Errorf("currency is required")
+	}
+	if p.Period < 1 {
+		return Plan{}, fmt.Errorf("period must be at least 1 month")
+	}
+	if p.Cycle < 1 {
+		return Plan{}, fmt.Errorf("cycle must be at least 1")
+	}
+	// The gateway charges when the subscription is created, so a trial could not be honoured
+	if p.TrialDays != 0 {
+		return Plan{}, fmt.Errorf("trial days are not supported by Tapsilat subscriptions")
+	}
+	if p.PaymentDay == 0 {
+		p.PaymentDay = 1
+	}
+	// Every month has a 28th
+	if p.PaymentDay < 1 || p.PaymentDay > 28 {
+		return Plan{}, fmt.Errorf("payment day must be between 1 and 28")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	p.CreatedAt = now
+	if existing, ok := c.plans[p.ID]; ok {
+		p.CreatedAt = existing.CreatedAt
+	}
+	p.UpdatedAt = now
+	c.plans[p.ID] = &p
+	if err := c.file.Save(c.plans); err != nil {
+		return Plan{}, err
+	}
+	return p, nil
+}
+
+// Delete removes a plan. Existing subscriptions keep the plan they were created with.
+func (c *Catalog) Delete(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.plans[id]; !ok {
+		return fmt.Errorf("plan %s not found", id)
+	}
+	delete(c.plans, id)
+	return c.file.Save(c.plans)
+}
@@ -0,0 +1,128 @@
+package subscriptions
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Period is a stretch of time the subscriber has paid for
+type Period struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Paid  float64   `json:"paid"`
+}
+
+// Proration is what a plan change costs
+type Proration struct {
+	FromPlanID    string    `json:"from_plan_id"`
+	ToPlanID      string    `json:"to_plan_id"`
+	Currency      string    `json:"currency"`
+	PeriodStart   time.Time `json:"period_start"`
+	PeriodEnd     time.Time `json:"period_end"`
+	RemainingDays int       `json:"remaining_days"`
+	Credit        float64   `json:"credit"`         // unused part of the current period
+	Charge        float64   `json:"charge"`         // the new plan until the end of the current period
+	BalanceUsed   float64   `json:"balance_used"`   // existing credit balance applied
+	AmountDue     float64   `json:"amount_due"`     // charged now with a one-off order
+	CreditBalance float64   `json:"credit_balance"` // carried forward
+	NextPaymentAt time.Time `json:"next_payment_at"`
+}
+
+// CurrentPeriod returns the period that contains now. Renewals fall on the plan's payment day
+// every Period months after billing starts; before that the subscription is in the rest of
+// a period paid for by a plan change or before a resume.
+func CurrentPeriod(sub Subscription, now time.Time) Period {
+	now = dateOnly(now)
+	start := dateOnly(sub.BillingStartsAt)
+	if now.Before(start) {
+		return Period{Start: dateOnly(sub.CreatedAt), End: start, Paid: sub.PrepaidAmount}
+	}
+
+	// Both ends are clamped to the month, as AddDate would turn March 31 less a month
+	// into March 3
+	periodStart, end := start, start
+	for k := 1; !end.After(now); k++ {
+		if k > 1 {
+			periodStart = end
+		}
+		end = onDay(start.Year(), start.Month()+time.Month(k*sub.Plan.Period), sub.Plan.PaymentDay)
+	}
+	return Period{Start: periodStart, End: end, Paid: sub.Plan.Price}
+}
+
+// Prorate prices a change of sub to plan at now. The unused part of the current period
+// and any credit balance pay for the new plan until the period ends; the rest is due now,
+// or carried as credit when the new plan is cheaper. The new plan bills from the period end.
+func Prorate(sub Subscription, to Plan, now time.Time) (Proration, error) {
+	if sub.Status != StatusActive {
+		return Proration{}, fmt.Errorf("only active subscriptions can change plans, this one is %s", sub.Status)
+	}
+	if sub.PlanID == to.ID {
+		return Proration{}, fmt.Errorf("subscription is already on plan %s", to.ID)
+	}
+	if !to.Active {
+		return Proration{}, fmt.Errorf("plan %s is not available", to.ID)
+	}
+	if sub.Plan.Currency != to.Currency {
+		return Proration{}, fmt.Errorf("cannot change from a %s plan to a %s plan", sub.Plan.Currency, to.Currency)
+	}
+
+	period := CurrentPeriod(sub, now)
+	today := dateOnly(now)
+	total := days(period.Start, period.End)
+	remaining := days(today, period.End)
+
+	p := Proration{
+		FromPlanID:    sub.PlanID,
+		ToPlanID:      to.ID,
+		Currency:      to.Currency,
+		PeriodStart:   period.Start,
+		PeriodEnd:     period.End,
+		RemainingDays: remaining,
+		NextPaymentAt: period.End,
+	}
+	if total > 0 {
+		p.Credit = round(period.Paid * float64(remaining) / float64(total))
+	}
+	// The new plan's daily price over one of its own periods, ending with the current one
+	day := sub.Plan.PaymentDay
+	if day < 1 {
+		day = period.End.Day()
+	}
+	toDays := days(onDay(period.End.Year(), period.End.Month()-time.Month(to.Period), day), period.End)
+	if remaining > 0 && period.Paid > 0 {
+		p.Charge = round(to.Price * float64(remaining) / float64(toDays))
+	}
+
+	due := round(p.Charge - p.Credit)
+	p.BalanceUsed = math.Min(sub.CreditBalance, math.Max(due, 0))
+	due = round(due - p.BalanceUsed)
+	if due > 0 {
+		p.AmountDue = due
+		p.CreditBalance = round(sub.CreditBalance - p.BalanceUsed)
+	} else {
+		p.CreditBalance = round(sub.CreditBalance - p.BalanceUsed - due)
+	}
+	return p, nil
+}
+
+func days(from, to time.Time) int {
+	return int(math.Round(to.Sub(from).Hours() / 24))
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func onDay(year int, month time.Month, day int) time.Time {
+	last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	if day > last {
+		day = last
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func dateOnly(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
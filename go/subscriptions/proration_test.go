@@ -0,0 +1,171 @@
+package subscriptions
+
+import (
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestCurrentPeriod(t *testing.T) {
+	monthly := func(day int) Plan { return Plan{Price: 31, Period: 1, PaymentDay: day} }
+	tests := []struct {
+		name       string
+		sub        Subscription
+		now        time.Time
+		start, end time.Time
+		paid       float64
+	}{
+		{
+			name:  "payment day 31 in February",
+			sub:   Subscription{Plan: monthly(31), BillingStartsAt: date(2026, 1, 31)},
+			now:   date(2026, 2, 15),
+			start: date(2026, 1, 31), end: date(2026, 2, 28), paid: 31,
+		},
+		{
+			name:  "payment day 31 after a short month",
+			sub:   Subscription{Plan: monthly(31), BillingStartsAt: date(2026, 1, 31)},
+			now:   date(2026, 3, 5),
+			start: date(2026, 2, 28), end: date(2026, 3, 31), paid: 31,
+		},
+		{
+			name:  "payment day 31 on a 30-day month end",
+			sub:   Subscription{Plan: monthly(31), BillingStartsAt: date(2026, 1, 31)},
+			now:   date(2026, 4, 30),
+			start: date(2026, 4, 30), end: date(2026, 5, 31), paid: 31,
+		},
+		{
+			name:  "payment day 31 in a leap February",
+			sub:   Subscription{Plan: monthly(31), BillingStartsAt: date(2028, 1, 31)},
+			now:   date(2028, 2, 10),
+			start: date(2028, 1, 31), end: date(2028, 2, 29), paid: 31,
+		},
+		{
+			name:  "on the leap day",
+			sub:   Subscription{Plan: monthly(29), BillingStartsAt: date(2028, 1, 29)},
+			now:   date(2028, 2, 29),
+			start: date(2028, 2, 29), end: date(2028, 3, 29), paid: 31,
+		},
+		{
+			name:  "yearly from a leap day",
+			sub:   Subscription{Plan: Plan{Price: 365, Period: 12, PaymentDay: 29}, BillingStartsAt: date(2028, 2, 29)},
+			now:   date(2028, 6, 1),
+			start: date(2028, 2, 29), end: date(2029, 2, 28), paid: 365,
+		},
+		{
+			name: "before billing starts",
+			sub: Subscription{
+				Plan:            monthly(1),
+				CreatedAt:       date(2026, 1, 10),
+				BillingStartsAt: date(2026, 2, 1),
+				PrepaidAmount:   22,
+			},
+			now:   date(2026, 1, 20),
+			start: date(2026, 1, 10), end: date(2026, 2, 1), paid: 22,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CurrentPeriod(tt.sub, tt.now)
+			if !got.Start.Equal(tt.start) || !got.End.Equal(tt.end) || got.Paid != tt.paid {
+				t.Errorf("CurrentPeriod = %s to %s paid %v, want %s to %s paid %v",
+					got.Start.Format("2006-01-02"), got.End.Format("2006-01-02"), got.Paid,
+					tt.start.Format("2006-01-02"), tt.end.Format("2006-01-02"), tt.paid)
+			}
+		})
+	}
+}
+
+func TestProrate(t *testing.T) {
+	sub := func(price float64, day int, starts time.Time, balance float64) Subscription {
+		return Subscription{
+			PlanID:          "from",
+			Plan:            Plan{ID: "from", Price: price, Currency: "TRY", Period: 1, PaymentDay: day, Active: true},
+			Status:          StatusActive,
+			BillingStartsAt: starts,
+			CreditBalance:   balance,
+		}
+	}
+	to := func(price float64) Plan {
+		return Plan{ID: "to", Price: price, Currency: "TRY", Period: 1, Active: true}
+	}
+	tests := []struct {
+		name          string
+		sub           Subscription
+		to            Plan
+		now           time.Time
+		remaining     int
+		credit        float64
+		charge        float64
+		balanceUsed   float64
+		amountDue     float64
+		creditBalance float64
+		next          time.Time
+	}{
+		{
+			name: "upgrade in a leap February",
+			sub:  sub(31, 29, date(2028, 1, 29), 0), to: to(62), now: date(2028, 2, 10),
+			remaining: 19, credit: 19, charge: 38, amountDue: 19, next: date(2028, 2, 29),
+		},
+		{
+			name: "upgrade in a common February",
+			sub:  sub(31, 29, date(2027, 1, 29), 0), to: to(62), now: date(2027, 2, 10),
+			remaining: 18, credit: 18.6, charge: 37.2, amountDue: 18.6, next: date(2027, 2, 28),
+		},
+		{
+			name: "upgrade paid partly from the credit balance",
+			sub:  sub(31, 29, date(2028, 1, 29), 10), to: to(62), now: date(2028, 2, 10),
+			remaining: 19, credit: 19, charge: 38, balanceUsed: 10, amountDue: 9, next: date(2028, 2, 29),
+		},
+		{
+			name: "downgrade after a month end clamped to February",
+			sub:  sub(62, 31, date(2026, 1, 31), 5), to: to(31), now: date(2026, 3, 15),
+			remaining: 16, credit: 32, charge: 16, creditBalance: 21, next: date(2026, 3, 31),
+		},
+		{
+			name: "change on the last day of the period",
+			sub:  sub(31, 31, date(2026, 1, 31), 0), to: to(62), now: date(2026, 3, 31),
+			remaining: 30, credit: 31, charge: 62, amountDue: 31, next: date(2026, 4, 30),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Prorate(tt.sub, tt.to, tt.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.RemainingDays != tt.remaining || got.Credit != tt.credit || got.Charge != tt.charge ||
+				got.BalanceUsed != tt.balanceUsed || got.AmountDue != tt.amountDue ||
+				got.CreditBalance != tt.creditBalance || !got.NextPaymentAt.Equal(tt.next) {
+				t.Errorf("Prorate = %+v", got)
+			}
+		})
+	}
+}
+
+func TestProrateRefusesInvalidChanges(t *testing.T) {
+	active := Subscription{
+		PlanID: "gold",
+		Plan:   Plan{ID: "gold", Price: 10, Currency: "TRY", Period: 1, PaymentDay: 1},
+		Status: StatusActive,
+	}
+	pastDue := active
+	pastDue.Status = StatusPastDue
+	tests := []struct {
+		name string
+		sub  Subscription
+		to   Plan
+	}{
+		{"not active", pastDue, Plan{ID: "silver", Currency: "TRY", Period: 1, Active: true}},
+		{"same plan", active, Plan{ID: "gold", Currency: "TRY", Period: 1, Active: true}},
+		{"inactive plan", active, Plan{ID: "silver", Currency: "TRY", Period: 1}},
+		{"other currency", active, Plan{ID: "silver", Currency: "USD", Period: 1, Active: true}},
+	}
+	for _, tt := range tests {
+		if _, err := Prorate(tt.sub, tt.to, date(2026, 1, 15)); err == nil {
+			t.Errorf("%s: Prorate succeeded", tt.name)
+		}
+	}
+}
@@ -0,0 +1,396 @@
+package subscriptions
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"tapsilat-go-example/store"
+)
+
+// Status is the local state of a subscription
+type Status string
+
+const (
+	StatusActive    Status = "active"
+	StatusPastDue   Status = "past_due" // a renewal failed, dunning is running
+	StatusPaused    Status = "paused"   // not billed until resumed
+	StatusResuming  Status = "resuming" // the gateway subscription that continues it is being created
+	StatusChanged   Status = "changed"  // replaced by a subscription on another plan or after a pause
+	StatusCancelled Status = "cancelled"
+)
+
+// Event is an entry in the history of a subscription
+type Event struct {
+	Type   string    `json:"type"` // e.g. renewal_failed, retry, notified, recovered, cancelled
+	Detail string    `json:"detail,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// Subscription is the local record of a subscription created through the example
+type Subscription struct {
+	ReferenceID      string         `json:"reference_id"` // gateway reference
+	LogicalID        string         `json:"logical_id"`   // stays the same across plan changes
+	OrderReferenceID string         `json:"order_reference_id,omitempty"`
+	PlanID           string         `json:"plan_id"`
+	Plan             Plan           `json:"plan"` // the plan as it was when subscribed
+	SubscriberEmail  string         `json:"subscriber_email"`
+	SubscriberPhone  string         `json:"subscriber_phone,omitempty"`
+	Country          string         `json:"country,omitempty"` // subscriber's ISO country code
+	CardID           string         `json:"card_id,omitempty"` // saved card the gateway charges
+	Status           Status         `json:"status"`
+	BaseURL          string         `json:"base_url,omitempty"`       // app address payments return to
+	BillingStartsAt  time.Time      `json:"billing_starts_at"`        // first charge on the gateway
+	PrepaidAmount    float64        `json:"prepaid_amount,omitempty"` // paid for the time before BillingStartsAt
+	CreditBalance    float64        `json:"credit_balance,omitempty"` // left over from downgrades
+	Replaces         string         `json:"replaces,omitempty"`       // reference of the previous plan's subscription
+	ReplacedBy       string         `json:"replaced_by,omitempty"`
+	Pauses           []Pause        `json:"pauses,omitempty"`
+	PendingChange    *PendingChange `json:"pending_change,omitempty"` // waits for its proration order
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+
+	// Dunning bookkeeping
+	PastDueSince     time.Time `json:"past_due_since,omitempty"`
+	RenewalReference string    `json:"renewal_reference_id,omitempty"` // the order of the failed renewal
+	RetryAttempts    int       `json:"retry_attempts,omitempty"`
+	NextRetryAt      time.Time `json:"next_retry_at,omitempty"`
+	History          []Event   `json:"history,omitempty"`
+}
+
+// PendingChange is a plan change that is applied once its prorated amount is paid
+type PendingChange struct {
+	OrderReferenceID string    `json:"order_reference_id"`
+	Plan             Plan      `json:"plan"`
+	Proration        Proration `json:"proration"`
+	BaseURL          string    `json:"base_url"`
+	RequestedAt      time.Time `json:"requested_at"`
+	PaidAt           time.Time `json:"paid_at,omitempty"`
+	Error            string    `json:"error,omitempty"` // why the last attempt to apply it failed
+
+	claimed bool // being applied, not persisted so a crash leaves it claimable
+}
+
+// record appends an event to the history
+func (s *Subscription) record(eventType, detail string, at time.Time) {
+	s.History = append(s.History, Event{Type: eventType, Detail: detail, At: at})
+}
+
+// Registry keeps the local subscription records
+type Registry struct {
+	mu      sync.RWMutex
+	file    *store.JSONFile
+	records map[string]*Subscription
+}
+
+// NewRegistry loads the registry from path
+func NewRegistry(path string) (*Registry, error) {
+	r := &Registry{
+		file:    store.NewJSONFile(path),
+		records: make(map[string]*Subscription),
+	}
+	if err := r.file.Load(&r.records); err != nil {
+		return nil, err
+	}
+	if r.records == nil {
+		r.records = make(map[string]*Subscription)
+	}
+	// Records saved before plan changes existed
+	for _, sub := range r.records {
+		if sub.LogicalID == "" {
+			sub.LogicalID = sub.ReferenceID
+		}
+		if sub.BillingStartsAt.IsZero() {
+			sub.BillingStartsAt = sub.CreatedAt
+		}
+	}
+	return r, nil
+}
+
+// Create stores a new active subscription on plan
+func (r *Registry) Create(sub Subscription, plan Plan) (Subscription, error) {
+	if sub.ReferenceID == "" {
+		return Subscription{}, fmt.Errorf("reference id is required")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.records[sub.ReferenceID]; exists {
+		return Subscription{}, fmt.Errorf("subscription %s already exists", sub.ReferenceID)
+	}
+
+	now := time.Now()
+	sub.LogicalID = sub.ReferenceID
+	sub.PlanID = plan.ID
+	sub.Plan = plan
+	sub.Status = StatusActive
+	sub.BillingStartsAt = now
+	sub.CreatedAt = now
+	sub.UpdatedAt = now
+	sub.record("created", "plan "+plan.ID, now)
+	r.records[sub.ReferenceID] = &sub
+	if err := r.file.Save(r.records); err != nil {
+		return Subscription{}, err
+	}
+	return sub, nil
+}
+
+// Get returns a copy of the subscription for referenceID
+func (r *Registry) Get(referenceID string) (Subscription, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	sub, ok := r.records[referenceID]
+	if !ok {
+		return Subscription{}, false
+	}
+	return *sub, true
+}
+
+// List returns all subscriptions, newest first
+func (r *Registry) List() []Subscription {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]Subscription, 0, len(r.records))
+	for _, sub := range r.records {
+		list = append(list, *sub)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
+
+// Replace records a plan change: next takes over from the subscription at referenceID
+// under the same logical id, starting to bill at p.NextPaymentAt.
+func (r *Registry) Replace(referenceID string, next Subscription, plan Plan, p Proration, now time.Time) (Subscription, error) {
+	detail := fmt.Sprintf("%s -> %s, credit %.2f, due %.2f, balance %.2f %s",
+		p.FromPlanID, p.ToPlanID, p.Credit, p.AmountDue, p.CreditBalance, p.Currency)
+
+	return r.supersede(referenceID, next, now, func(prev, next *Subscription) {
+		prev.record("plan_changed", detail, now)
+
+		next.PlanID = plan.ID
+		next.Plan = plan
+		next.BillingStartsAt = p.NextPaymentAt
+		next.PrepaidAmount = p.Charge
+		next.CreditBalance = p.CreditBalance
+		next.record("created", "plan change from "+prev.ReferenceID+": "+detail, now)
+	})
+}
+
+// supersede stores next as the successor of the subscription at referenceID. fn sets
+// what differs between the two; everything else carries over.
+func (r *Registry) supersede(referenceID string, next Subscription, now time.Time, fn func(prev, next *Subscription)) (Subscription, error) {
+	if next.ReferenceID == "" {
+		return Subscription{}, fmt.Errorf("reference id is required")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	prev, ok := r.records[referenceID]
+	if !ok {
+		return Subscription{}, fmt.Errorf("subscription %s not found", referenceID)
+	}
+	if _, exists := r.records[next.ReferenceID]; exists {
+		return Subscription{}, fmt.Errorf("subscription %s already exists", next.ReferenceID)
+	}
+
+	prev.Status = StatusChanged
+	prev.ReplacedBy = next.ReferenceID
+	prev.NextRetryAt = time.Time{}
+	prev.UpdatedAt = now
+
+	next.LogicalID = prev.LogicalID
+	next.Replaces = prev.ReferenceID
+	next.PlanID = prev.PlanID
+	next.Plan = prev.Plan
+	next.Status = StatusActive
+	next.SubscriberEmail = prev.SubscriberEmail
+	next.SubscriberPhone = prev.SubscriberPhone
+	next.Country = prev.Country
+	next.CardID = prev.CardID
+	next.BaseURL = prev.BaseURL
+	next.CreditBalance = prev.CreditBalance
+	next.Pauses = append([]Pause(nil), prev.Pauses...)
+	next.CreatedAt = now
+	next.UpdatedAt = now
+	next.History = nil
+	fn(prev, &next)
+	r.records[next.ReferenceID] = &next
+
+	if err := r.file.Save(r.records); err != nil {
+		return Subscription{}, err
+	}
+	return next, nil
+}
+
+// Chain returns every subscription of a logical subscription, oldest first
+func (r *Registry) Chain(logicalID string) []Subscription {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var chain []Subscription
+	for _, sub := range r.records {
+		if sub.LogicalID == logicalID {
+			chain = append(chain, *sub)
+		}
+	}
+	sort.Slice(chain, func(i, j int) bool { return chain[i].CreatedAt.Before(chain[j].CreatedAt) })
+	return chain
+}
+
+// FindByOrder returns the subscription whose first payment or failed renewal is orderReferenceID
+func (r *Registry) FindByOrder(orderReferenceID string) (Subscription, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, sub := range r.records {
+		if sub.OrderReferenceID == orderReferenceID || sub.RenewalReference == orderReferenceID {
+			return *sub, true
+		}
+	}
+	return Subscription{}, false
+}
+
+// SetPendingChange parks a plan change until its proration order is paid. A
+// subscription waits for one change at a time.
+func (r *Registry) SetPendingChange(referenceID string, change PendingChange) (Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sub, ok := r.records[referenceID]
+	if !ok {
+		return Subscription{}, fmt.Errorf("subscription %s not found", referenceID)
+	}
+	if sub.PendingChange != nil {
+		return Subscription{}, fmt.Errorf("a plan change is already waiting for payment of order %s", sub.PendingChange.OrderReferenceID)
+	}
+	sub.PendingChange = &change
+	sub.UpdatedAt = change.RequestedAt
+	sub.record("plan_change_pending", fmt.Sprintf("%s -> %s, due %.2f %s with order %s",
+		change.Proration.FromPlanID, change.Proration.ToPlanID, change.Proration.AmountDue, change.Proration.Currency, change.OrderReferenceID), change.RequestedAt)
+	if err := r.file.Save(r.records); err != nil {
+		return Subscription{}, err
+	}
+	return *sub, nil
+}
+
+// TakePendingChange removes the plan change waiting for orderReferenceID and records
+// eventType, so the change is applied or dropped at most once. It reports false when no
+// change waits for the order.
+func (r *Registry) TakePendingChange(orderReferenceID, eventType string, now time.Time) (Subscription, PendingChange, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, sub := range r.records {
+		if sub.PendingChange == nil || sub.PendingChange.OrderReferenceID != orderReferenceID {
+			continue
+		}
+		change := *sub.PendingChange
+		sub.PendingChange = nil
+		sub.UpdatedAt = now
+		sub.record(eventType, "order "+orderReferenceID, now)
+		if err := r.file.Save(r.records); err != nil {
+			return Subscription{}, PendingChange{}, false, err
+		}
+		return *sub, change, true, nil
+	}
+	return Subscription{}, PendingChange{}, false, nil
+}
+
+// ClaimPendingChange marks the plan change waiting for orderReferenceID as paid and hands
+// it to a single caller to apply. The change stays on the subscription until it is taken
+// with TakePendingChange; a failed attempt is released with FailPendingChange so it can be
+// claimed again. It reports false when no change waits for the order or it is being applied.
+func (r *Registry) ClaimPendingChange(orderReferenceID string, now time.Time) (Subscription, PendingChange, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sub, ok := r.pendingLocked(orderReferenceID)
+	if !ok || sub.PendingChange.claimed {
+		return Subscription{}, PendingChange{}, false, nil
+	}
+	if sub.PendingChange.PaidAt.IsZero() {
+		sub.PendingChange.PaidAt = now
+		sub.record("plan_change_paid", "order "+orderReferenceID, now)
+	}
+	sub.PendingChange.claimed = true
+	sub.UpdatedAt = now
+	if err := r.file.Save(r.records); err != nil {
+		sub.PendingChange.claimed = false
+		return Subscription{}, PendingChange{}, false, err
+	}
+	return *sub, *sub.PendingChange, true, nil
+}
+
+// FailPendingChange records why a claimed plan change could not be applied and releases it
+func (r *Registry) FailPendingChange(orderReferenceID, reason string, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sub, ok := r.pendingLocked(orderReferenceID)
+	if !ok {
+		return fmt.Errorf("no plan change waits for order %s", orderReferenceID)
+	}
+	sub.PendingChange.claimed = false
+	sub.PendingChange.Error = reason
+	sub.UpdatedAt = now
+	sub.record("plan_change_failed", reason, now)
+	return r.file.Save(r.records)
+}
+
+// DropPendingChange removes the plan change of a proration order that will not be paid.
+// A change whose order was paid is kept, as the payment still has to be settled.
+func (r *Registry) DropPendingChange(orderReferenceID string, now time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sub, ok := r.pendingLocked(orderReferenceID)
+	if !ok || !sub.PendingChange.PaidAt.IsZero() {
+		return false, nil
+	}
+	sub.PendingChange = nil
+	sub.UpdatedAt = now
+	sub.record("plan_change_dropped", "order "+orderReferenceID, now)
+	return true, r.file.Save(r.records)
+}
+
+func (r *Registry) pendingLocked(orderReferenceID string) (*Subscription, bool) {
+	for _, sub := range r.records {
+		if sub.PendingChange != nil && sub.PendingChange.OrderReferenceID == orderReferenceID {
+			return sub, true
+		}
+	}
+	return nil, false
+}
+
+// SetStatus changes the local status of a subscription
+func (r *Registry) SetStatus(referenceID string, status Status, source string) error {
+	_, err := r.Update(referenceID, func(sub *Subscription) {
+		if sub.Status != status {
+			sub.record(string(status), source, time.Now())
+		}
+		sub.Status = status
+	})
+	return err
+}
+
+// Update applies fn to a subscription and saves the registry
+func (r *Registry) Update(referenceID string, fn func(sub *Subscription)) (Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sub, ok := r.records[referenceID]
+	if !ok {
+		return Subscription{}, fmt.Errorf("subscription %s not found", referenceID)
+	}
+	fn(sub)
+	sub.UpdatedAt = time.Now()
+	if err := r.file.Save(r.records); err != nil {
+		return Subscription{}, err
+	}
+	return *sub, nil
+}
@@ -0,0 +1,228 @@
+package tax
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"tapsilat-go-example/cart"
+	"tapsilat-go-example/store"
+)
+
+// Mode says whether catalog prices already contain tax
+type Mode string
+
+const (
+	ModeInclusive Mode = "inclusive"
+	ModeExclusive Mode = "exclusive"
+)
+
+// Rounding says where tax amounts are rounded to cents
+type Rounding string
+
+const (
+	RoundPerLine    Rounding = "per_line"
+	RoundPerInvoice Rounding = "per_invoice"
+)
+
+// Rate is a tax rate in percent for a country and, optionally, a product category
+type Rate struct {
+	Country  string  `json:"country"`
+	Category string  `json:"category,omitempty"` // empty is the country default
+	Rate     float64 `json:"rate"`
+}
+
+// Config is the tax configuration
+type Config struct {
+	Mode           Mode     `json:"mode"`
+	Rounding       Rounding `json:"rounding"`
+	DefaultCountry string   `json:"default_country"`
+	Rates          []Rate   `json:"rates"`
+}
+
+// DefaultConfig uses Turkish KDV rates with tax-inclusive prices
+func DefaultConfig() Config {
+	return Config{
+		Mode:           ModeInclusive,
+		Rounding:       RoundPerLine,
+		DefaultCountry: "TR",
+		Rates: []Rate{
+			{Country: "TR", Rate: 20},
+			{Country: "TR", Category: "Food", Rate: 1},
+			{Country: "TR", Category: "Books", Rate: 10},
+			{Country: "TR", Category: "Electronics", Rate: 20},
+		},
+	}
+}
+
+// Engine computes tax for carts and implements cart.Pricer
+type Engine struct {
+	mu   sync.RWMutex
+	file *store.JSONFile
+	cfg  Config
+}
+
+// NewEngine loads the tax configuration from path, falling back to DefaultConfig
+func NewEngine(path string) (*Engine, error) {
+	e := &Engine{
+		file: store.NewJSONFile(path),
+		cfg:  DefaultConfig(),
+	}
+	if err := e.file.Load(&e.cfg); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Config returns the current configuration
+func (e *Engine) Config() Config {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.cfg
+}
+
+// SetConfig validates and stores a new configuration
+func (e *Engine) SetConfig(cfg Config) error {
+	switch cfg.Mode {
+	case ModeInclusive, ModeExclusive:
+	default:
+		return fmt.Errorf("mode must be inclusive or exclusive")
+	}
+	switch cfg.Rounding {
+	case RoundPerLine, RoundPerInvoice:
+	default:
+		return fmt.Errorf("rounding must be per_line or per_invoice")
+	}
+	for _, r := range cfg.Rates {
+		if r.Country == "" {
+			return fmt.Errorf("every rate needs a country")
+		}
+		if r.Rate < 0 || r.Rate > 100 {
+			return fmt.Errorf("rate %v for %s is out of range", r.Rate, r.Country)
+		}
+	}
+	if cfg.DefaultCountry == "" {
+		cfg.DefaultCountry = "TR"
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.cfg = cfg
+	return e.file.Save(e.cfg)
+}
+
+// RateFor returns the rate for a category in a country, falling back to the country default
+func (e *Engine) RateFor(country, category string) float64 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.rateLocked(country, category)
+}
+
+func (e *Engine) rateLocked(country, category string) float64 {
+	if country == "" {
+		country = e.cfg.DefaultCountry
+	}
+	fallback := 0.0
+	for _, r := range e.cfg.Rates {
+		if !strings.EqualFold(r.Country, country) {
+			continue
+		}
+		if r.Category == "" {
+			fallback = r.Rate
+		} else if strings.EqualFold(r.Category, category) {
+			return r.Rate
+		}
+	}
+	return fallback
+}
+
+// Price implements cart.Pricer. Tax is computed on each line after its discount.
+func (e *Engine) Price(c cart.Cart, t *cart.Totals) error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	inclusive := e.cfg.Mode == ModeInclusive
+	t.TaxIncluded = inclusive
+
+	// Exact tax per line, rounded below according to the rounding policy
+	exact := make([]float64, len(t.Lines))
+	groups := make(map[float64][]int)
+	for i := range t.Lines {
+		line := &t.Lines[i]
+		category := ""
+		if i < len(c.Lines) {
+			category = c.Lines[i].Category
+		}
+		line.TaxRate = e.rateLocked(c.Country, category)
+
+		base := line.Amount - line.Discount
+		if inclusive {
+			exact[i] = base * line.TaxRate / (100 + line.TaxRate)
+		} else {
+			exact[i] = base * line.TaxRate / 100
+		}
+		groups[line.TaxRate] = append(groups[line.TaxRate], i)
+	}
+
+	if e.cfg.Rounding == RoundPerLine {
+		for i := range t.Lines {
+			t.Lines[i].Tax = cart.Round(exact[i])
+		}
+	} else {
+		// Round once per rate, then hand the rounded amount back to the lines so they still add up
+		for _, idx := range groups {
+			groupTax := 0.0
+			for _, i := range idx {
+				groupTax += exact[i]
+			}
+			left := cart.Round(groupTax)
+			for n, i := range idx {
+				if n == len(idx)-1 {
+					t.Lines[i].Tax = cart.Round(left)
+					break
+				}
+				t.Lines[i].Tax = cart.Round(exact[i])
+				left -= t.Lines[i].Tax
+			}
+		}
+	}
+
+	t.Tax = 0
+	t.Net = 0
+	t.Gross = 0
+	t.TaxLines = t.TaxLines[:0]
+	byRate := make(map[float64]*cart.TaxLine)
+	for _, line := range t.Lines {
+		base := line.Amount - line.Discount
+		net, gross := base, base+line.Tax
+		if inclusive {
+			net, gross = base-line.Tax, base
+		}
+		t.Tax += line.Tax
+		t.Net += net
+		t.Gross += gross
+
+		tl, ok := byRate[line.TaxRate]
+		if !ok {
+			tl = &cart.TaxLine{Rate: line.TaxRate}
+			byRate[line.TaxRate] = tl
+		}
+		tl.Net += net
+		tl.Tax += line.Tax
+		tl.Gross += gross
+	}
+	t.Tax = cart.Round(t.Tax)
+	t.Net = cart.Round(t.Net)
+	t.Gross = cart.Round(t.Gross)
+
+	for _, tl := range byRate {
+		tl.Net = cart.Round(tl.Net)
+		tl.Tax = cart.Round(tl.Tax)
+		tl.Gross = cart.Round(tl.Gross)
+		t.TaxLines = append(t.TaxLines, *tl)
+	}
+	sort.Slice(t.TaxLines, func(i, j int) bool { return t.TaxLines[i].Rate < t.TaxLines[j].Rate })
+	return nil
+}
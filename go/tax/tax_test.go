@@ -0,0 +1,143 @@
+package tax
+
+import (
+	"path/filepath"
+	"testing"
+
+	"tapsilat-go-example/cart"
+)
+
+func newEngine(t *testing.T, mode Mode, rounding Rounding) *Engine {
+	t.Helper()
+	e, err := NewEngine(filepath.Join(t.TempDir(), "tax.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig()
+	cfg.Mode = mode
+	cfg.Rounding = rounding
+	if err := e.SetConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// lines returns n single-unit lines of price in category
+func lines(n int, price float64, category string) []cart.Line {
+	list := make([]cart.Line, n)
+	for i := range list {
+		list[i] = cart.Line{ProductID: i + 1, Price: price, Quantity: 1, Category: category}
+	}
+	return list
+}
+
+func TestPrice(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     Mode
+		rounding Rounding
+		lines    []cart.Line
+		lineTax  []float64
+		tax      float64
+		net      float64
+		gross    float64
+		total    float64
+	}{
+		// 0.026 tax per line: 0.03 each when rounded per line, 0.078 = 0.08 per invoice
+		{
+			name: "exclusive per line", mode: ModeExclusive, rounding: RoundPerLine,
+			lines:   lines(3, 0.13, ""),
+			lineTax: []float64{0.03, 0.03, 0.03}, tax: 0.09, net: 0.39, gross: 0.48, total: 0.48,
+		},
+		{
+			name: "exclusive per invoice", mode: ModeExclusive, rounding: RoundPerInvoice,
+			lines:   lines(3, 0.13, ""),
+			lineTax: []float64{0.03, 0.03, 0.02}, tax: 0.08, net: 0.39, gross: 0.47, total: 0.47,
+		},
+		// 0.02333 tax per line: 0.02 each when rounded per line, 0.07 per invoice
+		{
+			name: "inclusive per line", mode: ModeInclusive, rounding: RoundPerLine,
+			lines:   lines(3, 0.14, ""),
+			lineTax: []float64{0.02, 0.02, 0.02}, tax: 0.06, net: 0.36, gross: 0.42, total: 0.42,
+		},
+		{
+			name: "inclusive per invoice", mode: ModeInclusive, rounding: RoundPerInvoice,
+			lines:   lines(3, 0.14, ""),
+			lineTax: []float64{0.02, 0.02, 0.03}, tax: 0.07, net: 0.35, gross: 0.42, total: 0.42,
+		},
+		{
+			name: "inclusive at the category rate", mode: ModeInclusive, rounding: RoundPerLine,
+			lines:   []cart.Line{{ProductID: 1, Price: 110, Quantity: 1, Category: "Books"}},
+			lineTax: []float64{10}, tax: 10, net: 100, gross: 110, total: 110,
+		},
+		{
+			name: "exclusive at the category rate", mode: ModeExclusive, rounding: RoundPerInvoice,
+			lines:   []cart.Line{{ProductID: 1, Price: 100, Quantity: 2, Category: "Food"}},
+			lineTax: []float64{2}, tax: 2, net: 200, gross: 202, total: 202,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newEngine(t, tt.mode, tt.rounding)
+			totals, err := cart.Calculate(cart.Cart{Currency: "TRY", Country: "TR", Lines: tt.lines}, e)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, want := range tt.lineTax {
+				if got := totals.Lines[i].Tax; got != want {
+					t.Errorf("line %d tax = %v, want %v", i+1, got, want)
+				}
+			}
+			if totals.Tax != tt.tax || totals.Net != tt.net || totals.Gross != tt.gross || totals.Total != tt.total {
+				t.Errorf("tax %v net %v gross %v total %v, want %v %v %v %v",
+					totals.Tax, totals.Net, totals.Gross, totals.Total, tt.tax, tt.net, tt.gross, tt.total)
+			}
+			if totals.TaxIncluded != (tt.mode == ModeInclusive) {
+				t.Errorf("TaxIncluded = %v in %s mode", totals.TaxIncluded, tt.mode)
+			}
+		})
+	}
+}
+
+func TestPriceGroupsRatesPerInvoice(t *testing.T) {
+	e := newEngine(t, ModeExclusive, RoundPerInvoice)
+	c := cart.Cart{Currency: "TRY", Country: "TR", Lines: []cart.Line{
+		{ProductID: 1, Price: 0.13, Quantity: 1},
+		{ProductID: 2, Price: 0.13, Quantity: 1, Category: "Books"},
+		{ProductID: 3, Price: 0.13, Quantity: 1},
+	}}
+	totals, err := cart.Calculate(c, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []cart.TaxLine{
+		{Rate: 10, Net: 0.13, Tax: 0.01, Gross: 0.14},
+		{Rate: 20, Net: 0.26, Tax: 0.05, Gross: 0.31},
+	}
+	if len(totals.TaxLines) != len(want) {
+		t.Fatalf("tax lines = %+v, want %+v", totals.TaxLines, want)
+	}
+	for i := range want {
+		if totals.TaxLines[i] != want[i] {
+			t.Errorf("tax line %d = %+v, want %+v", i, totals.TaxLines[i], want[i])
+		}
+	}
+}
+
+func TestSetConfigRejectsInvalid(t *testing.T) {
+	e := newEngine(t, ModeInclusive, RoundPerLine)
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"mode", Config{Mode: "gross", Rounding: RoundPerLine}},
+		{"rounding", Config{Mode: ModeInclusive, Rounding: "per_cent"}},
+		{"country", Config{Mode: ModeInclusive, Rounding: RoundPerLine, Rates: []Rate{{Rate: 20}}}},
+		{"rate", Config{Mode: ModeInclusive, Rounding: RoundPerLine, Rates: []Rate{{Country: "TR", Rate: 120}}}},
+	}
+	for _, tt := range tests {
+		if err := e.SetConfig(tt.cfg); err == nil {
+			t.Errorf("SetConfig accepted an invalid %s", tt.name)
+		}
+	}
+}
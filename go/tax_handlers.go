@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/http"
+
+	"tapsilat-go-example/tax"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getTaxConfigHandler returns the tax mode, rounding and rates
+func getTaxConfigHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, taxEngine.Config())
+}
+
+// updateTaxConfigHandler replaces the tax configuration
+func updateTaxConfigHandler(c *gin.Context) {
+	var req tax.Config
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := taxEngine.SetConfig(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, taxEngine.Config())
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"tapsilat-go-example/terms"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tapsilat/tapsilat-go"
+)
+
+// TermPlanRequest plans the payment terms of an order. Amount is optional and must match the order total.
+type TermPlanRequest struct {
+	OrderReferenceID string     `json:"order_reference_id" binding:"required"`
+	Amount           float64    `json:"amount"`
+	Rule             terms.Rule `json:"rule"`
+}
+
+// TermPlanResponse is a planned or created schedule
+type TermPlanResponse struct {
+	Success          bool         `json:"success"`
+	OrderReferenceID string       `json:"order_reference_id"`
+	Total            float64      `json:"total"`
+	Terms            []terms.Term `json:"terms"`
+	Error            string       `json:"error,omitempty"`
+	Leftover         []terms.Term `json:"leftover,omitempty"`   // terms the rollback could not delete
+	Unverified       []terms.Term `json:"unverified,omitempty"` // leftovers not found on the gateway; clean up manually, not tracked
+}
+
+// termPlansInFlight holds the orders whose terms are being created, so two plans for the
+// same order cannot both pass the open-terms check in planTerms
+var termPlansInFlight = struct {
+	sync.Mutex
+	orders map[string]bool
+}{orders: make(map[string]bool)}
+
+// claimTermPlan reserves an order for one plan at a time; it reports false while another
+// plan of the order is being created
+func claimTermPlan(orderReferenceID string) bool {
+	termPlansInFlight.Lock()
+	defer termPlansInFlight.Unlock()
+	if termPlansInFlight.orders[orderReferenceID] {
+		return false
+	}
+	termPlansInFlight.orders[orderReferenceID] = true
+	return true
+}
+
+func releaseTermPlan(orderReferenceID string) {
+	termPlansInFlight.Lock()
+	defer termPlansInFlight.Unlock()
+	delete(termPlansInFlight.orders, orderReferenceID)
+}
+
+// sdkTermClient creates and deletes terms through the Tapsilat SDK
+type sdkTermClient struct {
+	api *tapsilat.API
+}
+
+func (s sdkTermClient) CreateTerm(ctx context.Context, orderID string, term terms.Term) error {
+	_, err := s.api.CreateOrderTerm(ctx, tapsilat.OrderPaymentTermCreateDTO{
+		OrderId:         orderID,
+		TermReferenceId: term.TermReferenceID,
+		Amount:          term.Amount,
+		DueDate:         term.DueDate,
+		TermSequence:    term.Sequence,
+		Required:        term.Required,
+	})
+	return err
+}
+
+func (s sdkTermClient) DeleteTerm(ctx context.Context, orderID string, term terms.Term) error {
+	_, err := s.api.DeleteOrderTerm(ctx, orderID, term.TermReferenceID)
+	return err
+}
+
+// termExists reports whether GetOrderTerm finds a term that is not cancelled or deleted
+func termExists(ctx context.Context, apiClient *tapsilat.API, termReferenceID string) bool {
+	response, err := apiClient.GetOrderTerm(context.WithoutCancel(ctx), termReferenceID)
+	if err != nil {
+		return false
+	}
+	return terms.ParseGatewayStatus(responseField(response, "status", "term_status")) != terms.StatusCancelled
+}
+
+// planTerms resolves the order total and builds the schedule
+func planTerms(c *gin.Context, apiClient *tapsilat.API, req TermPlanRequest) (TermPlanResponse, int) {
+	resp := TermPlanResponse{OrderReferenceID: req.OrderReferenceID}
+
+	// A second plan would add its terms next to the open ones
+	for _, term := range termTracker.List("") {
+		if term.OrderReferenceID == req.OrderReferenceID && term.Status.IsOpen() {
+			resp.Error = "Order already has open payment terms, delete them before planning again"
+			return resp, http.StatusConflict
+		}
+	}
+
+	total, err := orderTotal(c.Request.Context(), apiClient, req)
+	if err != nil {
+		resp.Error = err.Error()
+		return resp, http.StatusBadRequest
+	}
+
+	planned, err := terms.Plan(total, req.Rule, time.Now())
+	if err != nil {
+		resp.Error = err.Error()
+		return resp, http.StatusBadRequest
+	}
+	// Terms of an earlier, deleted plan may still exist on the gateway, so each plan gets its own ids
+	planID := strconv.FormatInt(time.Now().UnixNano(), 36)
+	for i := range planned {
+		planned[i].TermReferenceID = fmt.Sprintf("%s-%s-T%02d", req.OrderReferenceID, planID, planned[i].Sequence)
+	}
+
+	resp.Success = true
+	resp.Total = total
+	resp.Terms = planned
+	return resp, http.StatusOK
+}
+
+// orderTotal returns the local order amount or the amount reported by Tapsilat. A requested
+// amount is only accepted when it matches.
+func orderTotal(ctx context.Context, apiClient *tapsilat.API, req TermPlanRequest) (float64, error) {
+	total := 0.0
+	if rec, ok := orderStore.Get(req.OrderReferenceID); ok {
+		total = rec.Amount
+	} else {
+		order, err := apiClient.GetOrder(ctx, req.OrderReferenceID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get order: %w", err)
+		}
+		total, err = strconv.ParseFloat(responseField(order, "amount", "total_amount", "total"), 64)
+		if err != nil || total <= 0 {
+			return 0, fmt.Errorf("order total is unknown")
+		}
+	}
+	if req.Amount > 0 && math.Abs(req.Amount-total) >= 0.005 {
+		return 0, fmt.Errorf("amount %.2f does not match the order total %.2f", req.Amount, total)
+	}
+	return total, nil
+}
+
+// previewTermPlanHandler returns the schedule without creating anything
+func previewTermPlanHandler(c *gin.Context) {
+	var req TermPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	apiClient, err := getAPIClient()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	resp, status := planTerms(c, apiClient, req)
+	c.JSON(status, resp)
+}
+
+// createTermPlanHandler creates every term of the schedule, deleting the created ones if one fails
+func createTermPlanHandler(c *gin.Context) {
+	var req TermPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	apiClient, err := getAPIClient()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	// Hold the order until its terms are tracked, so the open-terms check sees them
+	if !claimTermPlan(req.OrderReferenceID) {
+		c.JSON(http.StatusConflict, TermPlanResponse{
+			OrderReferenceID: req.OrderReferenceID,
+			Error:            "Payment terms of this order are already being created",
+		})
+		return
+	}
+	defer releaseTermPlan(req.OrderReferenceID)
+
+	resp, status := planTerms(c, apiClient, req)
+	if !resp.Success {
+		c.JSON(status, resp)
+		return
+	}
+
+	if err := terms.Create(c.Request.Context(), sdkTermClient{api: apiClient}, req.OrderReferenceID, resp.Terms); err != nil {
+		utilsInstance.LogError("Failed to create payment terms", map[string]interface{}{
+			"order_reference_id": req.OrderReferenceID,
+			"error":              err.Error(),
+		})
+		resp.Success = false
+		resp.Error = err.Error()
+		var rbErr *terms.RollbackError
+		if errors.As(err, &rbErr) {
+			// Only terms the gateway confirms are tracked; the failed one may never have been created
+			resp.Leftover = rbErr.Leftover
+			for _, term := range rbErr.Leftover {
+				if !termExists(c.Request.Context(), apiClient, term.TermReferenceID) {
+					resp.Unverified = append(resp.Unverified, term)
+					continue
+				}
+				trackTerm(req.OrderReferenceID, term.TermReferenceID, term.Sequence, term.Amount, term.DueDate)
+			}
+		}
+		c.JSON(http.StatusBadGateway, resp)
+		return
+	}
+
+	for _, term := range resp.Terms {
+		trackTerm(req.OrderReferenceID, term.TermReferenceID, term.Sequence, term.Amount, term.DueDate)
+	}
+	c.JSON(http.StatusOK, resp)
+}
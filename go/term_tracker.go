@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"tapsilat-go-example/cart"
+	"tapsilat-go-example/store"
+	"tapsilat-go-example/terms"
+
+	"github.com/gin-gonic/gin"
+)
+
+var termTracker *terms.Tracker
+
+// OverdueTerm is a row of the overdue terms report
+type OverdueTerm struct {
+	terms.Tracked
+	DaysOverdue int `json:"days_overdue"`
+}
+
+// fetchTermStatus reads the status of a term through GetOrderTerm
+func fetchTermStatus(ctx context.Context, termReferenceID string) (terms.Status, error) {
+	apiClient, err := getAPIClient()
+	if err != nil {
+		return "", err
+	}
+	response, err := apiClient.GetOrderTerm(ctx, termReferenceID)
+	if err != nil {
+		return "", fmt.Errorf("get order term: %w", err)
+	}
+	return terms.ParseGatewayStatus(responseField(response, "status", "term_status")), nil
+}
+
+// startTermTracker loads tracked terms and starts reminders unless disabled via TERM_TRACKER_ENABLED=false
+func startTermTracker() {
+	cfg := terms.DefaultTrackerConfig()
+	cfg.Interval = getEnvDuration("TERM_TRACKER_INTERVAL", cfg.Interval)
+	cfg.ReminderOffsets = getEnvInts("TERM_REMINDER_DAYS", cfg.ReminderOffsets)
+	var err error
+	if grace := os.Getenv("TERM_GRACE_DAYS"); grace != "" {
+		if cfg.GraceDays, err = strconv.Atoi(grace); err != nil {
+			log.Fatalf("Invalid TERM_GRACE_DAYS value %q", grace)
+		}
+	}
+	cfg.EscalateTo = os.Getenv("TERM_ESCALATION_EMAIL")
+
+	termTracker, err = terms.NewTracker(store.DataPath("terms.json"), cfg, fetchTermStatus, notifier)
+	if err != nil {
+		log.Fatal("Failed to load tracked terms:", err)
+	}
+
+	if os.Getenv("TERM_TRACKER_ENABLED") == "false" {
+		log.Println("Term tracker disabled")
+		return
+	}
+	termTracker.Start(context.Background())
+	log.Printf("Term tracker started (interval %s, reminders %v days ahead, grace %d days)", cfg.Interval, cfg.ReminderOffsets, cfg.GraceDays)
+}
+
+// trackTerm starts watching a created term, taking buyer and currency from the local order
+func trackTerm(orderReferenceID, termReferenceID string, sequence int, amount float64, dueDate string) {
+	term := terms.Tracked{
+		OrderReferenceID: orderReferenceID,
+		TermReferenceID:  termReferenceID,
+		Sequence:         sequence,
+		Amount:           amount,
+		DueDate:          dueDate,
+	}
+	if rec, ok := orderStore.Get(orderReferenceID); ok {
+		term.BuyerEmail = rec.BuyerEmail
+		term.Currency = rec.Currency
+	}
+	if err := termTracker.Track(term); err != nil {
+		utilsInstance.LogError("Failed to track payment term", map[string]interface{}{
+			"term_reference_id": termReferenceID,
+			"error":             err.Error(),
+		})
+	}
+}
+
+// listTrackedTermsHandler lists tracked terms, optionally filtered by ?status=
+func listTrackedTermsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, termTracker.List(terms.Status(c.Query("status"))))
+}
+
+// overdueTermsHandler reports open terms past their due date
+func overdueTermsHandler(c *gin.Context) {
+	now := time.Now()
+	report := make([]OverdueTerm, 0)
+	totals := make(map[string]float64)
+	for _, term := range termTracker.Overdue(now) {
+		report = append(report, OverdueTerm{Tracked: term, DaysOverdue: term.DaysOverdue(now)})
+		totals[term.Currency] = cart.Round(totals[term.Currency] + term.Amount)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"count":  len(report),
+		"totals": totals,
+		"terms":  report,
+	})
+}
+
+// termTrackerStatusHandler returns the tracker state
+func termTrackerStatusHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, termTracker.Stats())
+}
+
+// termTrackerRunHandler checks all terms immediately
+func termTrackerRunHandler(c *gin.Context) {
+	if !termTracker.RunOnce(c.Request.Context(), time.Now()) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A term check is already running"})
+		return
+	}
+	c.JSON(http.StatusOK, termTracker.Stats())
+}
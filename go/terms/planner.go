@@ -0,0 +1,245 @@
+package terms
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// DateLayout is the due date format sent to Tapsilat
+const DateLayout = "2006-01-02"
+
+// RuleType is how an order total is split into terms
+type RuleType string
+
+const (
+	RuleEqual       RuleType = "equal"       // Count equal terms, IntervalDays apart
+	RuleDeposit     RuleType = "deposit"     // a deposit now, the balance in Count terms
+	RulePercentages RuleType = "percentages" // one term per percentage, IntervalDays apart
+	RuleMonthly     RuleType = "monthly"     // Count equal terms on DayOfMonth of each month
+)
+
+// Rule describes a payment term schedule
+type Rule struct {
+	Type           RuleType  `json:"type"`
+	Count          int       `json:"count,omitempty"`
+	StartDate      string    `json:"start_date,omitempty"` // first due date, defaults to today
+	IntervalDays   int       `json:"interval_days,omitempty"`
+	DepositPercent float64   `json:"deposit_percent,omitempty"`
+	DepositAmount  float64   `json:"deposit_amount,omitempty"`
+	Percentages    []float64 `json:"percentages,omitempty"`
+	DayOfMonth     int       `json:"day_of_month,omitempty"`
+	Required       bool      `json:"required"`
+}
+
+// Term is one planned payment term
+type Term struct {
+	Sequence        int     `json:"sequence"`
+	TermReferenceID string  `json:"term_reference_id"`
+	Amount          float64 `json:"amount"`
+	DueDate         string  `json:"due_date"`
+	Required        bool    `json:"required"`
+}
+
+// Plan splits total into terms according to rule. The amounts always add up to total exactly.
+func Plan(total float64, rule Rule, now time.Time) ([]Term, error) {
+	cents := int64(math.Round(total * 100))
+	if cents <= 0 {
+		return nil, fmt.Errorf("order total must be positive")
+	}
+
+	start := dateOnly(now)
+	if rule.StartDate != "" {
+		parsed, err := time.Parse(DateLayout, rule.StartDate)
+		if err != nil {
+			return nil, fmt.Errorf("start_date must be YYYY-MM-DD")
+		}
+		start = parsed
+	}
+	if rule.IntervalDays == 0 {
+		rule.IntervalDays = 30
+	}
+	if rule.IntervalDays < 0 {
+		return nil, fmt.Errorf("interval_days cannot be negative")
+	}
+
+	var amounts []int64
+	var dates []time.Time
+	switch rule.Type {
+	case RuleEqual:
+		if rule.Count < 1 {
+			return nil, fmt.Errorf("count must be at least 1")
+		}
+		amounts = splitEqual(cents, rule.Count)
+		dates = spaced(start, rule.Count, rule.IntervalDays)
+
+	case RuleDeposit:
+		deposit := int64(math.Round(rule.DepositAmount * 100))
+		if rule.DepositPercent > 0 {
+			deposit = int64(math.Round(float64(cents) * rule.DepositPercent / 100))
+		}
+		if deposit <= 0 || deposit >= cents {
+			return nil, fmt.Errorf("deposit must be more than zero and less than the order total")
+		}
+		count := rule.Count
+		if count < 1 {
+			count = 1
+		}
+		amounts = append([]int64{deposit}, splitEqual(cents-deposit, count)...)
+		dates = spaced(start, count+1, rule.IntervalDays)
+
+	case RulePercentages:
+		if len(rule.Percentages) == 0 {
+			return nil, fmt.Errorf("percentages are required")
+		}
+		sum := 0.0
+		for _, p := range rule.Percentages {
+			if p <= 0 {
+				return nil, fmt.Errorf("percentages must be positive")
+			}
+			sum += p
+		}
+		if math.Abs(sum-100) > 0.0001 {
+			return nil, fmt.Errorf("percentages must add up to 100, got %v", sum)
+		}
+		// Every term but the last is rounded down, the last one takes the rest
+		left := cents
+		for i, p := range rule.Percentages {
+			amount := left
+			if i < len(rule.Percentages)-1 {
+				amount = int64(math.Floor(float64(cents) * p / 100))
+			}
+			amounts = append(amounts, amount)
+			left -= amount
+		}
+		dates = spaced(start, len(amounts), rule.IntervalDays)
+
+	case RuleMonthly:
+		if rule.Count < 1 {
+			return nil, fmt.Errorf("count must be at least 1")
+		}
+		if rule.DayOfMonth < 1 || rule.DayOfMonth > 31 {
+			return nil, fmt.Errorf("day_of_month must be between 1 and 31")
+		}
+		amounts = splitEqual(cents, rule.Count)
+		dates = monthly(start, rule.Count, rule.DayOfMonth)
+
+	default:
+		return nil, fmt.Errorf("unknown rule type %q", rule.Type)
+	}
+
+	for _, a := range amounts {
+		if a <= 0 {
+			return nil, fmt.Errorf("the order total is too small for %d terms", len(amounts))
+		}
+	}
+
+	terms := make([]Term, len(amounts))
+	for i := range amounts {
+		terms[i] = Term{
+			Sequence: i + 1,
+			Amount:   float64(amounts[i]) / 100,
+			DueDate:  dates[i].Format(DateLayout),
+			Required: rule.Required,
+		}
+	}
+	return terms, nil
+}
+
+// splitEqual divides cents into n parts, the first parts take the leftover cents
+func splitEqual(cents int64, n int) []int64 {
+	parts := make([]int64, n)
+	base, rest := cents/int64(n), cents%int64(n)
+	for i := range parts {
+		parts[i] = base
+		if int64(i) < rest {
+			parts[i]++
+		}
+	}
+	return parts
+}
+
+func spaced(start time.Time, n, days int) []time.Time {
+	dates := make([]time.Time, n)
+	for i := range dates {
+		dates[i] = start.AddDate(0, 0, i*days)
+	}
+	return dates
+}
+
+// monthly returns n dates on day of each month, from the first one on or after start.
+// Short months use their last day.
+func monthly(start time.Time, n, day int) []time.Time {
+	first := onDay(start.Year(), start.Month(), day)
+	if first.Before(start) {
+		first = onDay(start.Year(), start.Month()+1, day)
+	}
+	dates := make([]time.Time, n)
+	for i := range dates {
+		dates[i] = onDay(first.Year(), first.Month()+time.Month(i), day)
+	}
+	return dates
+}
+
+func onDay(year int, month time.Month, day int) time.Time {
+	last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	if day > last {
+		day = last
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func dateOnly(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Client creates and deletes terms on the gateway
+type Client interface {
+	CreateTerm(ctx context.Context, orderID string, term Term) error
+	DeleteTerm(ctx context.Context, orderID string, term Term) error
+}
+
+// RollbackError reports a failed creation and any terms that could not be removed afterwards
+type RollbackError struct {
+	Term     Term
+	Err      error
+	Leftover []Term // terms whose deletion failed; the failed term is included as it may exist
+}
+
+func (e *RollbackError) Error() string {
+	msg := fmt.Sprintf("creating term %d failed: %v", e.Term.Sequence, e.Err)
+	if len(e.Leftover) > 0 {
+		refs := make([]string, len(e.Leftover))
+		for i, t := range e.Leftover {
+			refs[i] = t.TermReferenceID
+		}
+		msg += "; rollback could not delete " + strings.Join(refs, ", ")
+	}
+	return msg
+}
+
+func (e *RollbackError) Unwrap() error {
+	return e.Err
+}
+
+// Create creates every term in order. When one fails, the terms created so far are deleted
+// again, newest first, and a *RollbackError is returned. The failed term is deleted as
+// well, since a create that timed out may still have gone through.
+func Create(ctx context.Context, client Client, orderID string, terms []Term) error {
+	for i, term := range terms {
+		if err := client.CreateTerm(ctx, orderID, term); err != nil {
+			rbErr := &RollbackError{Term: term, Err: err}
+			// Use a fresh context so a cancelled request still rolls back
+			cleanup := context.WithoutCancel(ctx)
+			for j := i; j >= 0; j-- {
+				if err := client.DeleteTerm(cleanup, orderID, terms[j]); err != nil {
+					rbErr.Leftover = append(rbErr.Leftover, terms[j])
+				}
+			}
+			return rbErr
+		}
+	}
+	return nil
+}
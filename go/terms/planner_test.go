@@ -0,0 +1,143 @@
+package terms
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPlan(t *testing.T) {
+	now := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		total   float64
+		rule    Rule
+		amounts []float64
+		dates   []string
+	}{
+		{
+			"equal", 100, Rule{Type: RuleEqual, Count: 3, IntervalDays: 10},
+			[]float64{33.34, 33.33, 33.33},
+			[]string{"2026-01-15", "2026-01-25", "2026-02-04"},
+		},
+		{
+			"deposit percent", 1000, Rule{Type: RuleDeposit, DepositPercent: 25, Count: 2, StartDate: "2026-02-01"},
+			[]float64{250, 375, 375},
+			[]string{"2026-02-01", "2026-03-03", "2026-04-02"},
+		},
+		{
+			"deposit amount", 99.99, Rule{Type: RuleDeposit, DepositAmount: 50},
+			[]float64{50, 49.99},
+			[]string{"2026-01-15", "2026-02-14"},
+		},
+		{
+			"percentages", 100.01, Rule{Type: RulePercentages, Percentages: []float64{33.3, 33.3, 33.4}, IntervalDays: 7},
+			[]float64{33.3, 33.3, 33.41},
+			[]string{"2026-01-15", "2026-01-22", "2026-01-29"},
+		},
+		{
+			"monthly on the last day", 90, Rule{Type: RuleMonthly, Count: 3, DayOfMonth: 31},
+			[]float64{30, 30, 30},
+			[]string{"2026-01-31", "2026-02-28", "2026-03-31"},
+		},
+		{
+			"monthly from next month", 20, Rule{Type: RuleMonthly, Count: 2, DayOfMonth: 5},
+			[]float64{10, 10},
+			[]string{"2026-02-05", "2026-03-05"},
+		},
+	}
+	for _, tt := range tests {
+		planned, err := Plan(tt.total, tt.rule, now)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(planned) != len(tt.amounts) {
+			t.Errorf("%s: %d terms, want %d", tt.name, len(planned), len(tt.amounts))
+			continue
+		}
+		for i, term := range planned {
+			if term.Sequence != i+1 || term.Amount != tt.amounts[i] || term.DueDate != tt.dates[i] {
+				t.Errorf("%s: term %d = %+v, want %.2f on %s", tt.name, i+1, term, tt.amounts[i], tt.dates[i])
+			}
+		}
+	}
+}
+
+func TestPlanRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		total float64
+		rule  Rule
+	}{
+		{"zero total", 0, Rule{Type: RuleEqual, Count: 1}},
+		{"no count", 100, Rule{Type: RuleEqual}},
+		{"bad start date", 100, Rule{Type: RuleEqual, Count: 1, StartDate: "15.01.2026"}},
+		{"negative interval", 100, Rule{Type: RuleEqual, Count: 2, IntervalDays: -1}},
+		{"deposit of everything", 100, Rule{Type: RuleDeposit, DepositPercent: 100}},
+		{"percentages below 100", 100, Rule{Type: RulePercentages, Percentages: []float64{50, 40}}},
+		{"day of month", 100, Rule{Type: RuleMonthly, Count: 2, DayOfMonth: 32}},
+		{"too many terms", 0.02, Rule{Type: RuleEqual, Count: 3}},
+		{"unknown type", 100, Rule{Type: "weekly"}},
+	}
+	for _, tt := range tests {
+		if _, err := Plan(tt.total, tt.rule, time.Now()); err == nil {
+			t.Errorf("%s: Plan succeeded", tt.name)
+		}
+	}
+}
+
+// fakeClient fails to create the term with failCreate and to delete those in failDelete
+type fakeClient struct {
+	failCreate int
+	failDelete map[int]bool
+	created    []int
+	deleted    []int
+}
+
+func (f *fakeClient) CreateTerm(ctx context.Context, orderID string, term Term) error {
+	if term.Sequence == f.failCreate {
+		return errors.New("timeout")
+	}
+	f.created = append(f.created, term.Sequence)
+	return nil
+}
+
+func (f *fakeClient) DeleteTerm(ctx context.Context, orderID string, term Term) error {
+	if f.failDelete[term.Sequence] {
+		return errors.New("unavailable")
+	}
+	f.deleted = append(f.deleted, term.Sequence)
+	return nil
+}
+
+func TestCreateRollsBack(t *testing.T) {
+	planned, err := Plan(100, Rule{Type: RuleEqual, Count: 4}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &fakeClient{failCreate: 3, failDelete: map[int]bool{1: true}}
+	err = Create(context.Background(), client, "ORDER", planned)
+
+	var rbErr *RollbackError
+	if !errors.As(err, &rbErr) {
+		t.Fatalf("Create = %v, want a RollbackError", err)
+	}
+	if rbErr.Term.Sequence != 3 {
+		t.Errorf("failed term = %d, want 3", rbErr.Term.Sequence)
+	}
+	// The failed term is deleted too, newest first
+	if len(client.deleted) != 2 || client.deleted[0] != 3 || client.deleted[1] != 2 {
+		t.Errorf("deleted = %v, want [3 2]", client.deleted)
+	}
+	if len(rbErr.Leftover) != 1 || rbErr.Leftover[0].Sequence != 1 {
+		t.Errorf("leftover = %+v, want term 1", rbErr.Leftover)
+	}
+
+	if err := Create(context.Background(), &fakeClient{}, "ORDER", planned); err != nil {
+		t.Errorf("Create = %v", err)
+	}
+}
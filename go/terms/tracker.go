@@ -0,0 +1,476 @@
+package terms
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"tapsilat-go-example/notify"
+	"tapsilat-go-example/store"
+)
+
+// Status is the local state of a payment term
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusPaid      Status = "paid"
+	StatusOverdue   Status = "overdue"
+	StatusEscalated Status = "escalated"
+	StatusCancelled Status = "cancelled"
+)
+
+// IsOpen reports whether the term still has to be paid
+func (s Status) IsOpen() bool {
+	return s == StatusPending || s == StatusOverdue || s == StatusEscalated
+}
+
+// ParseGatewayStatus maps a term status reported by Tapsilat to a local status. Only exact
+// values match, so "unpaid" or "incomplete" never count as paid. Unknown values return "" so
+// the local status is kept.
+func ParseGatewayStatus(raw string) Status {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "paid", "success", "succeeded", "completed":
+		return StatusPaid
+	case "cancelled", "canceled", "deleted", "refunded":
+		return StatusCancelled
+	}
+	return ""
+}
+
+// Tracked is a payment term watched by the tracker
+type Tracked struct {
+	OrderReferenceID string    `json:"order_reference_id"`
+	TermReferenceID  string    `json:"term_reference_id"`
+	Sequence         int       `json:"sequence,omitempty"`
+	Amount           float64   `json:"amount"`
+	Currency         string    `json:"currency,omitempty"`
+	DueDate          string    `json:"due_date"`
+	BuyerEmail       string    `json:"buyer_email,omitempty"`
+	Status           Status    `json:"status"`
+	RemindersSent    []int     `json:"reminders_sent,omitempty"` // offsets in days already sent
+	OverdueAt        time.Time `json:"overdue_at,omitempty"`
+	OverdueNotice    bool      `json:"overdue_notice,omitempty"` // the buyer has yet to be told the term is overdue
+	EscalatedAt      time.Time `json:"escalated_at,omitempty"`
+	LastRefreshedAt  time.Time `json:"last_refreshed_at,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// Due returns the due date at midnight UTC
+func (t Tracked) Due() (time.Time, error) {
+	// Accept date-only and date-time values
+	for _, layout := range []string{DateLayout, time.RFC3339, "2006-01-02 15:04:05"} {
+		if due, err := time.Parse(layout, t.DueDate); err == nil {
+			return dateOnly(due), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid due date %q", t.DueDate)
+}
+
+// DaysOverdue returns how many days the term is past its due date on now
+func (t Tracked) DaysOverdue(now time.Time) int {
+	due, err := t.Due()
+	if err != nil {
+		return 0
+	}
+	return int(dateOnly(now).Sub(due).Hours() / 24)
+}
+
+// StatusFetcher asks the gateway for the current status of a term
+type StatusFetcher func(ctx context.Context, termReferenceID string) (Status, error)
+
+// TrackerConfig controls reminders and escalation
+type TrackerConfig struct {
+	Interval        time.Duration // how often terms are checked
+	ReminderOffsets []int         // days before the due date a reminder is sent
+	GraceDays       int           // days after the due date before an overdue term is escalated
+	EscalateTo      string        // merchant address for escalations
+}
+
+// DefaultTrackerConfig reminds 7, 3 and 1 days ahead and escalates after 7 days
+func DefaultTrackerConfig() TrackerConfig {
+	return TrackerConfig{
+		Interval:        time.Hour,
+		ReminderOffsets: []int{7, 3, 1},
+		GraceDays:       7,
+	}
+}
+
+// TrackerStats describes the tracker state
+type TrackerStats struct {
+	Running   bool      `json:"running"`
+	Tracked   int       `json:"tracked"`
+	Open      int       `json:"open"`
+	Overdue   int       `json:"overdue"`
+	Reminders int       `json:"reminders_sent"`
+	Escalated int       `json:"escalated"`
+	Errors    int       `json:"errors"`
+	LastRunAt time.Time `json:"last_run_at,omitempty"`
+}
+
+// Tracker keeps payment terms, refreshes their status and sends reminders
+type Tracker struct {
+	cfg       TrackerConfig
+	file      *store.JSONFile
+	fetch     StatusFetcher
+	transport notify.Transport
+
+	run   sync.Mutex // held for the duration of a pass
+	mu    sync.Mutex
+	terms map[string]*Tracked
+	stats TrackerStats
+}
+
+// NewTracker loads tracked terms from path
+func NewTracker(path string, cfg TrackerConfig, fetch StatusFetcher, transport notify.Transport) (*Tracker, error) {
+	t := &Tracker{
+		cfg:       cfg,
+		file:      store.NewJSONFile(path),
+		fetch:     fetch,
+		transport: transport,
+		terms:     make(map[string]*Tracked),
+	}
+	if err := t.file.Load(&t.terms); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Track starts watching a term, or updates amount and due date of a tracked one
+func (t *Tracker) Track(term Tracked) error {
+	if term.TermReferenceID == "" {
+		return fmt.Errorf("term reference id is required")
+	}
+	if _, err := term.Due(); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if existing, ok := t.terms[term.TermReferenceID]; ok {
+		if existing.DueDate != term.DueDate {
+			// A new due date starts the reminders over
+			existing.RemindersSent = nil
+			existing.OverdueAt = time.Time{}
+			existing.OverdueNotice = false
+			existing.EscalatedAt = time.Time{}
+			if existing.Status.IsOpen() {
+				existing.Status = StatusPending
+			}
+		}
+		existing.DueDate = term.DueDate
+		if term.Amount > 0 {
+			existing.Amount = term.Amount
+		}
+		existing.UpdatedAt = now
+		return t.saveLocked()
+	}
+
+	if term.Status == "" {
+		term.Status = StatusPending
+	}
+	term.CreatedAt = now
+	term.UpdatedAt = now
+	t.terms[term.TermReferenceID] = &term
+	return t.saveLocked()
+}
+
+// Get returns a tracked term
+func (t *Tracker) Get(termReferenceID string) (Tracked, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	term, ok := t.terms[termReferenceID]
+	if !ok {
+		return Tracked{}, false
+	}
+	return *term, true
+}
+
+// Untrack stops watching a term, e.g. after it was deleted
+func (t *Tracker) Untrack(termReferenceID string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.terms, termReferenceID)
+	return t.saveLocked()
+}
+
+// SetStatus changes the local status of a term
+func (t *Tracker) SetStatus(termReferenceID string, status Status) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	term, ok := t.terms[termReferenceID]
+	if !ok {
+		return fmt.Errorf("term %s is not tracked", termReferenceID)
+	}
+	term.Status = status
+	term.UpdatedAt = time.Now()
+	return t.saveLocked()
+}
+
+// List returns tracked terms ordered by due date, optionally only those with status
+func (t *Tracker) List(status Status) []Tracked {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	list := make([]Tracked, 0, len(t.terms))
+	for _, term := range t.terms {
+		if status == "" || term.Status == status {
+			list = append(list, *term)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].DueDate != list[j].DueDate {
+			return list[i].DueDate < list[j].DueDate
+		}
+		return list[i].TermReferenceID < list[j].TermReferenceID
+	})
+	return list
+}
+
+// Overdue returns open terms past their due date on now, most overdue first
+func (t *Tracker) Overdue(now time.Time) []Tracked {
+	var list []Tracked
+	for _, term := range t.List("") {
+		if term.Status.IsOpen() && term.DaysOverdue(now) > 0 {
+			list = append(list, term)
+		}
+	}
+	return list
+}
+
+// Start runs the tracker until ctx is cancelled
+func (t *Tracker) Start(ctx context.Context) {
+	t.mu.Lock()
+	t.stats.Running = true
+	t.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(t.cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			t.RunOnce(ctx, time.Now())
+			select {
+			case <-ctx.Done():
+				t.mu.Lock()
+				t.stats.Running = false
+				t.mu.Unlock()
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RunOnce refreshes every open term and sends the reminders, overdue notices and escalations
+// that are due. Passes never overlap: it returns false when another pass is running.
+func (t *Tracker) RunOnce(ctx context.Context, now time.Time) bool {
+	if !t.run.TryLock() {
+		return false
+	}
+	defer t.run.Unlock()
+
+	open := make([]Tracked, 0)
+	for _, term := range t.List("") {
+		if term.Status.IsOpen() {
+			open = append(open, term)
+		}
+	}
+
+	for _, term := range open {
+		if ctx.Err() != nil {
+			return true
+		}
+		if t.fetch != nil {
+			status, err := t.fetch(ctx, term.TermReferenceID)
+			if err != nil {
+				// Without the gateway state the term may be paid or gone, so nothing is sent
+				t.countError()
+				log.Printf("Term tracker: failed to refresh %s: %v", term.TermReferenceID, err)
+				continue
+			}
+			t.update(term.TermReferenceID, func(tr *Tracked) {
+				tr.LastRefreshedAt = now
+				if status != "" {
+					tr.Status = status
+				}
+			})
+			if status != "" && !status.IsOpen() {
+				continue
+			}
+		}
+		t.check(ctx, term.TermReferenceID, now)
+	}
+
+	t.mu.Lock()
+	t.stats.LastRunAt = now
+	t.mu.Unlock()
+	return true
+}
+
+// check marks a term overdue once it is past due, then sends at most one notification: the
+// most urgent one that is due. A notification only counts as sent once it is queued, so a
+// failed one is retried next pass.
+func (t *Tracker) check(ctx context.Context, termReferenceID string, now time.Time) {
+	term, ok := t.Get(termReferenceID)
+	if !ok {
+		return
+	}
+	days := term.DaysOverdue(now)
+
+	// A term is overdue from the day after its due date, whether or not the buyer can be
+	// told yet; the notice is sent below and retried until it is queued
+	if days > 0 && term.OverdueAt.IsZero() {
+		t.update(termReferenceID, func(tr *Tracked) {
+			if tr.Status == StatusPending {
+				tr.Status = StatusOverdue
+			}
+			tr.OverdueAt = now
+			tr.OverdueNotice = true
+		})
+		if term, ok = t.Get(termReferenceID); !ok {
+			return
+		}
+	}
+
+	switch {
+	case days > t.cfg.GraceDays && term.EscalatedAt.IsZero() && t.cfg.EscalateTo != "":
+		if !t.send(ctx, term, "term_escalated", t.cfg.EscalateTo,
+			fmt.Sprintf("Payment term %s is %d days overdue", term.TermReferenceID, days)) {
+			return
+		}
+		t.update(termReferenceID, func(tr *Tracked) {
+			tr.Status = StatusEscalated
+			tr.EscalatedAt = now
+		})
+		t.mu.Lock()
+		t.stats.Escalated++
+		t.mu.Unlock()
+
+	case days > 0 && term.OverdueNotice:
+		if !t.send(ctx, term, "term_overdue", term.BuyerEmail,
+			fmt.Sprintf("Your payment of %.2f %s was due on %s", term.Amount, term.Currency, term.DueDate)) {
+			return
+		}
+		t.update(termReferenceID, func(tr *Tracked) {
+			tr.OverdueNotice = false
+		})
+
+	case days <= 0:
+		// Send the closest reminder that has not been sent yet
+		until := -days
+		offset := -1
+		for _, o := range t.cfg.ReminderOffsets {
+			if until <= o && !containsInt(term.RemindersSent, o) && (offset == -1 || o < offset) {
+				offset = o
+			}
+		}
+		if offset == -1 {
+			return
+		}
+		if !t.send(ctx, term, "term_reminder", term.BuyerEmail,
+			fmt.Sprintf("Your payment of %.2f %s is due on %s", term.Amount, term.Currency, term.DueDate)) {
+			return
+		}
+		t.update(termReferenceID, func(tr *Tracked) {
+			// Earlier offsets that were skipped are not sent any more
+			for _, o := range t.cfg.ReminderOffsets {
+				if o >= offset && !containsInt(tr.RemindersSent, o) {
+					tr.RemindersSent = append(tr.RemindersSent, o)
+				}
+			}
+		})
+		t.mu.Lock()
+		t.stats.Reminders++
+		t.mu.Unlock()
+	}
+}
+
+// send queues a notification and reports whether it was accepted
+func (t *Tracker) send(ctx context.Context, term Tracked, kind, to, subject string) bool {
+	if t.transport == nil || to == "" {
+		return false
+	}
+	err := t.transport.Send(ctx, notify.Message{
+		Kind:    kind,
+		To:      to,
+		Subject: subject,
+		Body: fmt.Sprintf("Order: %s\nTerm: %s\nAmount: %.2f %s\nDue date: %s\n",
+			term.OrderReferenceID, term.TermReferenceID, term.Amount, term.Currency, term.DueDate),
+		Meta: map[string]string{
+			"order_reference_id": term.OrderReferenceID,
+			"term_reference_id":  term.TermReferenceID,
+		},
+		SentAt: time.Now(),
+	})
+	if err != nil {
+		t.countError()
+		log.Printf("Term tracker: failed to send %s for %s: %v", kind, term.TermReferenceID, err)
+		return false
+	}
+	return true
+}
+
+func (t *Tracker) update(termReferenceID string, fn func(tr *Tracked)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	term, ok := t.terms[termReferenceID]
+	if !ok {
+		return
+	}
+	fn(term)
+	term.UpdatedAt = time.Now()
+	if err := t.saveLocked(); err != nil {
+		log.Printf("Term tracker: failed to save %s: %v", termReferenceID, err)
+	}
+}
+
+func (t *Tracker) countError() {
+	t.mu.Lock()
+	t.stats.Errors++
+	t.mu.Unlock()
+}
+
+// Stats returns a snapshot of the tracker state
+func (t *Tracker) Stats() TrackerStats {
+	now := time.Now()
+	overdue := len(t.Overdue(now))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := t.stats
+	stats.Tracked = len(t.terms)
+	stats.Open = 0
+	for _, term := range t.terms {
+		if term.Status.IsOpen() {
+			stats.Open++
+		}
+	}
+	stats.Overdue = overdue
+	return stats
+}
+
+func (t *Tracker) saveLocked() error {
+	return t.file.Save(t.terms)
+}
+
+func containsInt(list []int, v int) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+package terms
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tapsilat-go-example/notify"
+)
+
+// fakeTransport records sent messages and fails while fail is set
+type fakeTransport struct {
+	fail bool
+	sent []notify.Message
+}
+
+func (f *fakeTransport) Send(ctx context.Context, msg notify.Message) error {
+	if f.fail {
+		return errors.New("smtp down")
+	}
+	f.sent = append(f.sent, msg)
+	return nil
+}
+
+func (f *fakeTransport) kinds() []string {
+	kinds := make([]string, len(f.sent))
+	for i, msg := range f.sent {
+		kinds[i] = msg.Kind
+	}
+	return kinds
+}
+
+func newTracker(t *testing.T, cfg TrackerConfig, fetch StatusFetcher, transport notify.Transport) *Tracker {
+	t.Helper()
+	tr, err := NewTracker(filepath.Join(t.TempDir(), "terms.json"), cfg, fetch, transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tr
+}
+
+func track(t *testing.T, tr *Tracker, ref, due string) {
+	t.Helper()
+	if err := tr.Track(Tracked{TermReferenceID: ref, DueDate: due, Amount: 100, Currency: "TRY", BuyerEmail: "buyer@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func day(date string) time.Time {
+	d, _ := time.Parse(DateLayout, date)
+	return d.Add(9 * time.Hour)
+}
+
+func TestReminders(t *testing.T) {
+	transport := &fakeTransport{}
+	tr := newTracker(t, DefaultTrackerConfig(), nil, transport)
+	track(t, tr, "T1", "2026-03-10")
+
+	tests := []struct {
+		now   string
+		kinds int
+	}{
+		{"2026-03-01", 0},
+		{"2026-03-03", 1}, // 7 days ahead
+		{"2026-03-04", 1},
+		{"2026-03-09", 2}, // 3 days ahead was missed, only the 1 day reminder is sent
+		{"2026-03-10", 2},
+	}
+	for _, tt := range tests {
+		tr.RunOnce(context.Background(), day(tt.now))
+		if len(transport.sent) != tt.kinds {
+			t.Errorf("%s: sent %v", tt.now, transport.kinds())
+		}
+	}
+	term, _ := tr.Get("T1")
+	if len(term.RemindersSent) != 3 {
+		t.Errorf("reminders sent = %v, want all three offsets", term.RemindersSent)
+	}
+}
+
+func TestOverdueWithoutNotice(t *testing.T) {
+	transport := &fakeTransport{fail: true}
+	cfg := DefaultTrackerConfig()
+	cfg.ReminderOffsets = nil
+	cfg.EscalateTo = "merchant@example.com"
+	cfg.GraceDays = 2
+	tr := newTracker(t, cfg, nil, transport)
+	track(t, tr, "T1", "2026-03-10")
+
+	// The term is overdue even though the notice could not be sent
+	tr.RunOnce(context.Background(), day("2026-03-11"))
+	term, _ := tr.Get("T1")
+	if term.Status != StatusOverdue || term.OverdueAt.IsZero() || !term.OverdueNotice {
+		t.Errorf("after a failed notice: %+v", term)
+	}
+	if got := len(tr.Overdue(day("2026-03-11"))); got != 1 {
+		t.Errorf("Overdue = %d terms, want 1", got)
+	}
+	if stats := tr.Stats(); stats.Errors != 1 {
+		t.Errorf("errors = %d, want 1", stats.Errors)
+	}
+
+	// The notice is retried on the next pass
+	transport.fail = false
+	tr.RunOnce(context.Background(), day("2026-03-12"))
+	term, _ = tr.Get("T1")
+	if term.OverdueNotice || len(transport.sent) != 1 || transport.sent[0].Kind != "term_overdue" {
+		t.Errorf("after retry: notice pending %v, sent %v", term.OverdueNotice, transport.kinds())
+	}
+
+	// Past the grace period the merchant is told once
+	tr.RunOnce(context.Background(), day("2026-03-13"))
+	tr.RunOnce(context.Background(), day("2026-03-14"))
+	term, _ = tr.Get("T1")
+	if term.Status != StatusEscalated || term.EscalatedAt.IsZero() {
+		t.Errorf("after grace: %+v", term)
+	}
+	if kinds := transport.kinds(); len(kinds) != 2 || kinds[1] != "term_escalated" {
+		t.Errorf("sent %v, want the overdue notice and one escalation", kinds)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	statuses := map[string]Status{"paid": StatusPaid, "open": ""}
+	fetch := func(ctx context.Context, ref string) (Status, error) {
+		status, ok := statuses[ref]
+		if !ok {
+			return "", errors.New("gateway unavailable")
+		}
+		return status, nil
+	}
+	transport := &fakeTransport{}
+	tr := newTracker(t, DefaultTrackerConfig(), fetch, transport)
+	for _, ref := range []string{"paid", "open", "unknown"} {
+		track(t, tr, ref, "2026-03-10")
+	}
+
+	tr.RunOnce(context.Background(), day("2026-03-12"))
+
+	if term, _ := tr.Get("paid"); term.Status != StatusPaid || !term.OverdueAt.IsZero() {
+		t.Errorf("paid term = %+v", term)
+	}
+	if term, _ := tr.Get("open"); term.Status != StatusOverdue {
+		t.Errorf("open term = %+v", term)
+	}
+	// Nothing is decided for a term whose gateway state is unknown
+	if term, _ := tr.Get("unknown"); term.Status != StatusPending {
+		t.Errorf("unknown term = %+v", term)
+	}
+	if len(transport.sent) != 1 {
+		t.Errorf("sent %v, want one overdue notice", transport.kinds())
+	}
+}
+
+func TestTrackNewDueDate(t *testing.T) {
+	tr := newTracker(t, DefaultTrackerConfig(), nil, &fakeTransport{})
+	track(t, tr, "T1", "2026-03-10")
+	tr.RunOnce(context.Background(), day("2026-03-12"))
+
+	track(t, tr, "T1", "2026-04-10")
+	term, _ := tr.Get("T1")
+	if term.Status != StatusPending || !term.OverdueAt.IsZero() || term.OverdueNotice || len(term.RemindersSent) != 0 {
+		t.Errorf("after a new due date: %+v", term)
+	}
+}
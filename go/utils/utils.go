@@ -8,6 +8,8 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+
+	"tapsilat-go-example/validation"
 )
 
 // Utils provides utility functions for the application
@@ -36,20 +38,15 @@ func (u *Utils) FormatPrice(price float64, currency string) string {
 	return fmt.Sprintf("%s%.2f", symbol, price)
 }
 
-// ValidatePhone validates phone number (generic validation)
+// ValidatePhone normalizes a phone number to E.164, reading national numbers as Turkish
 func (u *Utils) ValidatePhone(phone string) (string, error) {
-	// Simple validation - just ensure it's not empty and return as-is
-	if strings.TrimSpace(phone) == "" {
-		return "", fmt.Errorf("phone number cannot be empty")
-	}
-
-	return strings.TrimSpace(phone), nil
+	return validation.Phone(phone, validation.DefaultCountry)
 }
 
-// ValidateID validates ID number (generic validation)
+// ValidateID checks a Turkish national ID (TCKN) or tax number (VKN) against its check digits
 func (u *Utils) ValidateID(idNumber string) bool {
-	// Simple validation - just ensure it's not empty
-	return strings.TrimSpace(idNumber) != ""
+	_, err := validation.TaxID(idNumber, validation.DefaultCountry)
+	return err == nil
 }
 
 // SanitizeInput sanitizes input data
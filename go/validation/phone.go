@@ -0,0 +1,125 @@
+package validation
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// numberingPlan describes the national phone numbers of a country
+type numberingPlan struct {
+	callingCode string         // country calling code, e.g. "90"
+	trunk       string         // national prefix dialled before the number, e.g. "0"
+	min, max    int            // digits in the national number, without the trunk prefix
+	pattern     *regexp.Regexp // national numbers in use, nil accepts any
+}
+
+var numberingPlans = map[string]numberingPlan{
+	// 5xx mobile, 2xx-4xx landline, 850/800/888 non-geographic
+	"TR": {"90", "0", 10, 10, regexp.MustCompile(`^[2-58]\d{9}$`)},
+	"US": {"1", "1", 10, 10, regexp.MustCompile(`^[2-9]\d{2}[2-9]\d{6}$`)},
+	"CA": {"1", "1", 10, 10, regexp.MustCompile(`^[2-9]\d{2}[2-9]\d{6}$`)},
+	"GB": {"44", "0", 9, 10, regexp.MustCompile(`^[1-9]`)},
+	"DE": {"49", "0", 6, 13, regexp.MustCompile(`^[1-9]`)},
+	"FR": {"33", "0", 9, 9, regexp.MustCompile(`^[1-9]`)},
+	"NL": {"31", "0", 9, 9, regexp.MustCompile(`^[1-9]`)},
+}
+
+// plansByCallingCode lists one plan per calling code, longest codes first, for reading
+// international numbers
+var plansByCallingCode = func() []numberingPlan {
+	var list []numberingPlan
+	seen := make(map[string]bool)
+	for _, p := range numberingPlans {
+		if !seen[p.callingCode] {
+			seen[p.callingCode] = true
+			list = append(list, p)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if len(list[i].callingCode) != len(list[j].callingCode) {
+			return len(list[i].callingCode) > len(list[j].callingCode)
+		}
+		return list[i].callingCode < list[j].callingCode
+	})
+	return list
+}()
+
+// Phone normalizes a phone number to E.164, e.g. "0555 123 45 67" in TR becomes
+// "+905551234567". Numbers with a "+" or "00" prefix are read as international; other
+// numbers are read in the national format of country, with or without the trunk prefix.
+// International numbers of countries without a numbering plan here are only checked for
+// length.
+func Phone(raw, country string) (string, error) {
+	s := strings.TrimSpace(raw)
+	international := strings.HasPrefix(s, "+")
+	s = strings.TrimPrefix(s, "+")
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return "", invalid("invalid_phone", "may only contain digits, spaces, dashes and parentheses after an optional +")
+		}
+	}
+	digits := b.String()
+	if digits == "" {
+		return "", invalid("invalid_phone", "must contain digits")
+	}
+	if !international && strings.HasPrefix(digits, "00") {
+		international, digits = true, digits[2:]
+	}
+
+	plan, known := numberingPlans[country]
+	if international {
+		if !known || !strings.HasPrefix(digits, plan.callingCode) {
+			known = false
+			for _, p := range plansByCallingCode {
+				if strings.HasPrefix(digits, p.callingCode) {
+					plan, known = p, true
+					break
+				}
+			}
+		}
+		if !known {
+			if len(digits) < 8 || len(digits) > 15 || digits[0] == '0' {
+				return "", invalid("invalid_phone", "must be 8 to 15 digits including the country code")
+			}
+			return "+" + digits, nil
+		}
+		return plan.format(digits[len(plan.callingCode):])
+	}
+
+	if !known {
+		return "", invalid("invalid_phone", "must start with + and the country code")
+	}
+	national := digits
+	switch {
+	case plan.trunk != "" && strings.HasPrefix(national, plan.trunk) && plan.fits(len(national)-len(plan.trunk)):
+		national = national[len(plan.trunk):]
+	case strings.HasPrefix(national, plan.callingCode) && plan.fits(len(national)-len(plan.callingCode)) && !plan.fits(len(national)):
+		// The country code without the +, as in "905551234567"
+		national = national[len(plan.callingCode):]
+	}
+	return plan.format(national)
+}
+
+func (p numberingPlan) fits(n int) bool {
+	return n >= p.min && n <= p.max
+}
+
+// format checks a national number against the plan and returns it in E.164
+func (p numberingPlan) format(national string) (string, error) {
+	if !p.fits(len(national)) {
+		if p.min == p.max {
+			return "", invalid("invalid_phone", "must have %d digits after the country code +%s", p.min, p.callingCode)
+		}
+		return "", invalid("invalid_phone", "must have %d to %d digits after the country code +%s", p.min, p.max, p.callingCode)
+	}
+	if p.pattern != nil && !p.pattern.MatchString(national) {
+		return "", invalid("invalid_phone", "is not a phone number in use for +%s", p.callingCode)
+	}
+	return "+" + p.callingCode + national, nil
+}
@@ -0,0 +1,48 @@
+package validation
+
+import (
+	"regexp"
+	"strings"
+)
+
+// postalFormat is the postal code format of a country, matched without spaces
+type postalFormat struct {
+	pattern *regexp.Regexp
+	example string
+	space   int // a space goes before the last space characters, e.g. 3 for "SW1A 1AA"
+}
+
+var postalFormats = map[string]postalFormat{
+	// The first two digits are the province plate code, 01-81
+	"TR": {regexp.MustCompile(`^(0[1-9]|[1-7]\d|8[01])\d{3}$`), "34000", 0},
+	"US": {regexp.MustCompile(`^\d{5}(-\d{4})?$`), "94103 or 94103-1234", 0},
+	"CA": {regexp.MustCompile(`^[ABCEGHJ-NPRSTVXY]\d[A-Z]\d[A-Z]\d$`), "K1A 0B1", 3},
+	"GB": {regexp.MustCompile(`^[A-Z]{1,2}\d[A-Z\d]?\d[A-Z]{2}$`), "SW1A 1AA", 3},
+	"DE": {regexp.MustCompile(`^\d{5}$`), "10115", 0},
+	"FR": {regexp.MustCompile(`^\d{5}$`), "75001", 0},
+	"NL": {regexp.MustCompile(`^[1-9]\d{3}[A-Z]{2}$`), "1012 AB", 2},
+}
+
+var otherPostalCode = regexp.MustCompile(`^[A-Z0-9][A-Z0-9 -]{1,9}$`)
+
+// PostalCode checks a postal code against the format of country and returns it in upper
+// case with the usual spacing, e.g. "sw1a1aa" in GB becomes "SW1A 1AA"
+func PostalCode(raw, country string) (string, error) {
+	code := strings.ToUpper(strings.Join(strings.Fields(raw), " "))
+	format, ok := postalFormats[country]
+	if !ok {
+		if !otherPostalCode.MatchString(code) {
+			return "", invalid("invalid_postal_code", "must be 2 to 10 letters and digits")
+		}
+		return code, nil
+	}
+	compact := strings.ReplaceAll(code, " ", "")
+	if !format.pattern.MatchString(compact) {
+		return "", invalid("invalid_postal_code", "must be a %s postal code like %s", country, format.example)
+	}
+	if format.space > 0 {
+		cut := len(compact) - format.space
+		return compact[:cut] + " " + compact[cut:], nil
+	}
+	return compact, nil
+}
@@ -0,0 +1,236 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+// DefaultCountry is assumed for phone numbers, tax numbers and postal codes given without
+// a country
+const DefaultCountry = "TR"
+
+// Error explains why a single value is invalid
+type Error struct {
+	Code    string `json:"code"` // e.g. "invalid_phone", stable for clients
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func invalid(code, format string, args ...interface{}) error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// FieldError is an invalid field of a request, named by its JSON path, e.g. "billing.email"
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Errors lists every invalid field of a request
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	parts := make([]string, len(e))
+	for i, f := range e {
+		parts[i] = f.Field + ": " + f.Message
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Add records err against field. Errors other than *Error get the code "invalid".
+func (e *Errors) Add(field string, err error) {
+	if err == nil {
+		return
+	}
+	var v *Error
+	if !errors.As(err, &v) {
+		v = &Error{Code: "invalid", Message: err.Error()}
+	}
+	*e = append(*e, FieldError{Field: field, Code: v.Code, Message: v.Message})
+}
+
+// Addf records a problem with field
+func (e *Errors) Addf(field, code, format string, args ...interface{}) {
+	e.Add(field, invalid(code, format, args...))
+}
+
+// Required records a missing field when value is blank and reports whether it was present
+func (e *Errors) Required(field, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		e.Addf(field, "required", "is required")
+		return false
+	}
+	return true
+}
+
+// Country normalizes an ISO 3166 alpha-2 code or the English name of a country with
+// specific rules, e.g. "tr", "Turkey" and "Türkiye" all become "TR". Blank means
+// DefaultCountry.
+func Country(raw string) (string, error) {
+	s := strings.TrimSpace(raw)
+	if s == "" {
+		return DefaultCountry, nil
+	}
+	if code, ok := countryNames[strings.ToLower(s)]; ok {
+		return code, nil
+	}
+	if len(s) == 2 && isLetters(s) {
+		return strings.ToUpper(s), nil
+	}
+	return "", invalid("invalid_country", "must be a two-letter ISO country code")
+}
+
+var countryNames = map[string]string{
+	"turkey":         "TR",
+	"türkiye":        "TR",
+	"turkiye":        "TR",
+	"united states":  "US",
+	"usa":            "US",
+	"canada":         "CA",
+	"united kingdom": "GB",
+	"uk":             "GB",
+	"germany":        "DE",
+	"france":         "FR",
+	"netherlands":    "NL",
+}
+
+// CountryName returns the English name of a country code normalized by Country, or the
+// code itself for countries without a known name
+func CountryName(code string) string {
+	if name, ok := countryDisplayNames[code]; ok {
+		return name
+	}
+	return code
+}
+
+var countryDisplayNames = map[string]string{
+	"TR": "Turkey",
+	"US": "United States",
+	"CA": "Canada",
+	"GB": "United Kingdom",
+	"DE": "Germany",
+	"FR": "France",
+	"NL": "Netherlands",
+}
+
+// Email checks the syntax of a bare address (no display name) and returns it trimmed
+func Email(raw string) (string, error) {
+	addr := strings.TrimSpace(raw)
+	parsed, err := mail.ParseAddress(addr)
+	if err != nil || parsed.Address != addr {
+		return "", invalid("invalid_email", "must be an email address like name@example.com")
+	}
+	at := strings.LastIndexByte(addr, '@')
+	local, domain := addr[:at], addr[at+1:]
+	if len(addr) > 254 || len(local) > 64 {
+		return "", invalid("invalid_email", "is too long")
+	}
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return "", invalid("invalid_email", "must have a domain like example.com")
+	}
+	for _, label := range labels {
+		if !domainLabel.MatchString(label) {
+			return "", invalid("invalid_email", "has an invalid domain %q", domain)
+		}
+	}
+	if tld := labels[len(labels)-1]; len(tld) < 2 || !isLetters(tld) {
+		return "", invalid("invalid_email", "has an invalid domain %q", domain)
+	}
+	return addr, nil
+}
+
+var domainLabel = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+
+// TaxID checks the national ID or tax number of a buyer and returns it without spaces.
+// Turkish buyers give an 11-digit TCKN or, for companies, a 10-digit VKN; both are checked
+// against their check digits. Elsewhere only the shape is checked.
+func TaxID(raw, country string) (string, error) {
+	id := strings.ToUpper(strings.Join(strings.Fields(raw), ""))
+	if country != "TR" {
+		if !otherTaxID.MatchString(id) {
+			return "", invalid("invalid_tax_id", "must be 4 to 20 letters and digits")
+		}
+		return id, nil
+	}
+	switch {
+	case !isDigits(id) || (len(id) != 10 && len(id) != 11):
+		return "", invalid("invalid_tax_id", "must be an 11-digit T.C. identity number or a 10-digit tax number")
+	case len(id) == 11 && !ValidTCKN(id):
+		return "", invalid("invalid_tckn", "is not a valid T.C. identity number")
+	case len(id) == 10 && !ValidVKN(id):
+		return "", invalid("invalid_vkn", "is not a valid tax number")
+	}
+	return id, nil
+}
+
+var otherTaxID = regexp.MustCompile(`^[A-Z0-9-]{4,20}$`)
+
+// ValidTCKN checks the two check digits of a Turkish national ID (T.C. Kimlik No)
+func ValidTCKN(id string) bool {
+	if len(id) != 11 || !isDigits(id) || id[0] == '0' {
+		return false
+	}
+	d := make([]int, 11)
+	for i := range id {
+		d[i] = int(id[i] - '0')
+	}
+	odd := d[0] + d[2] + d[4] + d[6] + d[8]
+	even := d[1] + d[3] + d[5] + d[7]
+	if ((odd*7-even)%10+10)%10 != d[9] {
+		return false
+	}
+	sum := 0
+	for _, n := range d[:10] {
+		sum += n
+	}
+	return sum%10 == d[10]
+}
+
+// ValidVKN checks the check digit of a Turkish tax number (Vergi Kimlik No)
+func ValidVKN(id string) bool {
+	if len(id) != 10 || !isDigits(id) {
+		return false
+	}
+	sum := 0
+	for i := 0; i < 9; i++ {
+		tmp := (int(id[i]-'0') + 9 - i) % 10
+		if tmp == 0 {
+			continue
+		}
+		v := tmp * (1 << (9 - i)) % 9
+		if v == 0 {
+			v = 9
+		}
+		sum += v
+	}
+	return (10-sum%10)%10 == int(id[9]-'0')
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isLetters(s string) bool {
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,165 @@
+package validation
+
+import (
+	"errors"
+	"testing"
+)
+
+// code returns the code of a validation error, or "" for nil
+func code(err error) string {
+	if err == nil {
+		return ""
+	}
+	var v *Error
+	if !errors.As(err, &v) {
+		return "not a validation error: " + err.Error()
+	}
+	return v.Code
+}
+
+func TestValidTCKN(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"12345678950", true},
+		{"11111111110", true},
+		{"11111111111", false}, // the anonymous TCKN has a wrong last check digit
+		{"12345678951", false}, // second check digit
+		{"12345678940", false}, // first check digit
+		{"02345678950", false}, // leading zero
+		{"1234567895", false},  // 10 digits
+		{"1234567895a", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := ValidTCKN(tt.id); got != tt.want {
+			t.Errorf("ValidTCKN(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestValidVKN(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"1234567890", true},
+		{"0123456789", true},
+		{"4840847211", true},
+		{"3230512384", true},
+		{"1234567891", false},
+		{"9990000000", false},
+		{"123456789", false},   // 9 digits
+		{"12345678950", false}, // 11 digits
+		{"12345678a0", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := ValidVKN(tt.id); got != tt.want {
+			t.Errorf("ValidVKN(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestTaxID(t *testing.T) {
+	tests := []struct {
+		raw, country string
+		want, code   string
+	}{
+		{"123 456 789 50", "TR", "12345678950", ""},
+		{"1234567890", "TR", "1234567890", ""},
+		{"11111111111", "TR", "", "invalid_tckn"},
+		{"1234567891", "TR", "", "invalid_vkn"},
+		{"123456789", "TR", "", "invalid_tax_id"},
+		{"TR1234567890", "TR", "", "invalid_tax_id"},
+		{"de 123 456 789", "DE", "DE123456789", ""},
+		{"12", "DE", "", "invalid_tax_id"},
+	}
+	for _, tt := range tests {
+		got, err := TaxID(tt.raw, tt.country)
+		if got != tt.want || code(err) != tt.code {
+			t.Errorf("TaxID(%q, %q) = %q, %q; want %q, %q", tt.raw, tt.country, got, code(err), tt.want, tt.code)
+		}
+	}
+}
+
+func TestPhone(t *testing.T) {
+	tests := []struct {
+		raw, country string
+		want         string // "" when invalid
+	}{
+		// National formats, with and without the trunk prefix
+		{"0555 123 45 67", "TR", "+905551234567"},
+		{"555 123 45 67", "TR", "+905551234567"},
+		{"(0212) 555-12-34", "TR", "+902125551234"},
+		{"905551234567", "TR", "+905551234567"},
+		{"(415) 555-2671", "US", "+14155552671"},
+		{"020 7946 0958", "GB", "+442079460958"},
+		{"06 12 34 56 78", "FR", "+33612345678"},
+
+		// International formats win over the country
+		{"+90 555 123 45 67", "", "+905551234567"},
+		{"0090 555 123 45 67", "DE", "+905551234567"},
+		{"+1 415 555 2671", "TR", "+14155552671"},
+		{"+86 138 0013 8000", "", "+8613800138000"},
+
+		{"0555 123 45", "TR", ""},    // too short
+		{"0155 123 45 67", "TR", ""}, // not a number in use
+		{"555-abc-4567", "TR", ""},   // letters
+		{"5551234567", "", ""},       // national without a known country
+		{"+999 1234", "", ""},        // too short for an unknown country
+		{"(415) 155-2671", "US", ""}, // exchange cannot start with 1
+		{"", "TR", ""},
+	}
+	for _, tt := range tests {
+		got, err := Phone(tt.raw, tt.country)
+		if tt.want == "" {
+			if code(err) != "invalid_phone" {
+				t.Errorf("Phone(%q, %q) = %q, %v; want invalid_phone", tt.raw, tt.country, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Phone(%q, %q) = %q, %v; want %q", tt.raw, tt.country, got, err, tt.want)
+		}
+	}
+}
+
+func TestPostalCode(t *testing.T) {
+	tests := []struct {
+		raw, country string
+		want         string // "" when invalid
+	}{
+		{"34000", "TR", "34000"},
+		{"81000", "TR", "81000"},
+		{"00100", "TR", ""}, // no province 00
+		{"82000", "TR", ""}, // no province 82
+		{"3400", "TR", ""},
+		{"94103", "US", "94103"},
+		{"94103-1234", "US", "94103-1234"},
+		{"9410", "US", ""},
+		{"k1a0b1", "CA", "K1A 0B1"},
+		{"D1A 0B1", "CA", ""}, // D is not used
+		{"sw1a1aa", "GB", "SW1A 1AA"},
+		{" ec1a  1bb ", "GB", "EC1A 1BB"},
+		{"SW1A", "GB", ""},
+		{"10115", "DE", "10115"},
+		{"1012ab", "NL", "1012 AB"},
+		{"0123 AB", "NL", ""},
+		{"100-0001", "JP", "100-0001"},
+		{"1", "JP", ""},
+	}
+	for _, tt := range tests {
+		got, err := PostalCode(tt.raw, tt.country)
+		if tt.want == "" {
+			if code(err) != "invalid_postal_code" {
+				t.Errorf("PostalCode(%q, %q) = %q, %v; want invalid_postal_code", tt.raw, tt.country, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("PostalCode(%q, %q) = %q, %v; want %q", tt.raw, tt.country, got, err, tt.want)
+		}
+	}
+}